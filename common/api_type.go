@@ -73,6 +73,12 @@ func ChannelType2APIType(channelType int) (int, bool) {
 		apiType = constant.APITypeMiniMax
 	case constant.ChannelTypeReplicate:
 		apiType = constant.APITypeReplicate
+	case constant.ChannelTypeTemplate:
+		apiType = constant.APITypeTemplate
+	case constant.ChannelTypeSimulator:
+		apiType = constant.APITypeSimulator
+	case constant.ChannelTypeReplay:
+		apiType = constant.APITypeReplay
 	}
 	if apiType == -1 {
 		return constant.APITypeOpenAI, false
@@ -71,6 +71,9 @@ var EmailLoginAuthServerList = []string{
 var DebugEnabled bool
 var MemoryCacheEnabled bool
 
+// CacheEventEnabled 启用 Redis 时通过发布订阅在节点间即时广播缓存失效事件
+var CacheEventEnabled bool
+
 var LogConsumeEnabled = true
 var ContentLoggingEnabled = true      // 是否启用内容记录（请求和响应）- 默认开启
 var ContentRetentionDays = 7          // 内容保留天数
@@ -114,6 +117,12 @@ var RetryTimes = 0
 
 var IsMasterNode bool
 
+// ErrorMessageLanguage 面向客户端的错误信息默认语言，用户未设置且请求未携带受支持的 Accept-Language 时使用
+var ErrorMessageLanguage = "zh"
+
+// LeaderElectionEnabled 启用后后台任务不再依赖 NODE_TYPE，而是由各节点竞选租约，每个任务只在持有租约的节点上执行
+var LeaderElectionEnabled bool
+
 var requestInterval int
 var RequestInterval time.Duration
 
@@ -121,6 +130,8 @@ var SyncFrequency int // unit is second
 
 var BatchUpdateEnabled = false
 var BatchUpdateInterval int
+var BatchUpdateWalPath string // 批量更新预写日志路径，进程异常退出后重启时据此恢复未落库的增量
+var CassetteDir string        // 上游流量录制文件目录，供回放渠道读取
 
 var RelayTimeout int // unit is second
 
@@ -207,7 +218,8 @@ const (
 )
 
 const (
-	TopUpStatusPending = "pending"
-	TopUpStatusSuccess = "success"
-	TopUpStatusExpired = "expired"
+	TopUpStatusPending  = "pending"
+	TopUpStatusSuccess  = "success"
+	TopUpStatusExpired  = "expired"
+	TopUpStatusRefunded = "refunded" // 已全额退款，部分退款的订单仍为 success
 )
@@ -1,6 +1,10 @@
 package common
 
-import "github.com/QuantumNous/new-api/constant"
+import (
+	"strings"
+
+	"github.com/QuantumNous/new-api/constant"
+)
 
 // GetEndpointTypesByChannelType 获取渠道最优先端点类型（所有的渠道都支持 OpenAI 端点）
 func GetEndpointTypesByChannelType(channelType int, modelName string) []constant.EndpointType {
@@ -17,11 +21,26 @@ func GetEndpointTypesByChannelType(channelType int, modelName string) []constant
 	//case constant.ChannelTypeJimeng:
 	//	endpointTypes = []constant.EndpointType{constant.EndpointTypeJimeng}
 	case constant.ChannelTypeAws:
-		fallthrough
+		// Bedrock 上只有 Claude 模型支持 Anthropic 端点，其余模型按类型使用 OpenAI 兼容端点
+		switch {
+		case strings.Contains(modelName, "claude"):
+			endpointTypes = []constant.EndpointType{constant.EndpointTypeAnthropic, constant.EndpointTypeOpenAI}
+		case strings.Contains(modelName, "rerank"):
+			endpointTypes = []constant.EndpointType{constant.EndpointTypeJinaRerank}
+		case strings.Contains(modelName, "embed"):
+			endpointTypes = []constant.EndpointType{constant.EndpointTypeEmbeddings}
+		default:
+			endpointTypes = []constant.EndpointType{constant.EndpointTypeOpenAI}
+		}
 	case constant.ChannelTypeAnthropic:
 		endpointTypes = []constant.EndpointType{constant.EndpointTypeAnthropic, constant.EndpointTypeOpenAI}
 	case constant.ChannelTypeVertexAi:
-		fallthrough
+		// Vertex 的排序模型走 Discovery Engine 排序接口
+		if strings.Contains(modelName, "ranker") {
+			endpointTypes = []constant.EndpointType{constant.EndpointTypeJinaRerank}
+		} else {
+			endpointTypes = []constant.EndpointType{constant.EndpointTypeGemini, constant.EndpointTypeOpenAI}
+		}
 	case constant.ChannelTypeGemini:
 		endpointTypes = []constant.EndpointType{constant.EndpointTypeGemini, constant.EndpointTypeOpenAI}
 	case constant.ChannelTypeOpenRouter: // OpenRouter 只支持 OpenAI 端点
@@ -75,7 +75,9 @@ func InitEnv() {
 	// Initialize variables from constants.go that were using environment variables
 	DebugEnabled = os.Getenv("DEBUG") == "true"
 	MemoryCacheEnabled = os.Getenv("MEMORY_CACHE_ENABLED") == "true"
+	CacheEventEnabled = GetEnvOrDefaultBool("CACHE_EVENT_ENABLED", false)
 	IsMasterNode = os.Getenv("NODE_TYPE") != "slave"
+	LeaderElectionEnabled = GetEnvOrDefaultBool("LEADER_ELECTION_ENABLED", false)
 
 	// Parse requestInterval and set RequestInterval
 	requestInterval, _ = strconv.Atoi(os.Getenv("POLLING_INTERVAL"))
@@ -84,11 +86,14 @@ func InitEnv() {
 	// Initialize variables with GetEnvOrDefault
 	SyncFrequency = GetEnvOrDefault("SYNC_FREQUENCY", 60)
 	BatchUpdateInterval = GetEnvOrDefault("BATCH_UPDATE_INTERVAL", 5)
+	BatchUpdateWalPath = GetEnvOrDefaultString("BATCH_UPDATE_WAL_PATH", "batch-update.wal")
+	CassetteDir = GetEnvOrDefaultString("CASSETTE_DIR", "cassettes")
 	RelayTimeout = GetEnvOrDefault("RELAY_TIMEOUT", 0)
 
 	// Initialize string variables with GetEnvOrDefaultString
 	GeminiSafetySetting = GetEnvOrDefaultString("GEMINI_SAFETY_SETTING", "BLOCK_NONE")
 	CohereSafetySetting = GetEnvOrDefaultString("COHERE_SAFETY_SETTING", "NONE")
+	ErrorMessageLanguage = GetEnvOrDefaultString("ERROR_MESSAGE_LANGUAGE", "zh")
 	
 	// Initialize GitHub sync variables
 	GitHubSyncEnabled = GetEnvOrDefaultBool("GITHUB_SYNC_ENABLED", false)
@@ -35,5 +35,8 @@ const (
 	APITypeSubmodel
 	APITypeMiniMax
 	APITypeReplicate
+	APITypeTemplate
+	APITypeSimulator
+	APITypeReplay
 	APITypeDummy // this one is only for count, do not add any channel after this
 )
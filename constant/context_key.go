@@ -5,6 +5,8 @@ type ContextKey string
 const (
 	ContextKeyTokenCountMeta ContextKey = "token_count_meta"
 	ContextKeyPromptTokens   ContextKey = "prompt_tokens"
+	// 请求文本的 token 计数缓存
+	ContextKeyRequestTextTokens ContextKey = "request_text_tokens"
 
 	ContextKeyOriginalModel    ContextKey = "original_model"
 	ContextKeyRequestStartTime ContextKey = "request_start_time"
@@ -17,6 +19,7 @@ const (
 	ContextKeyTokenSpecificChannelId ContextKey = "specific_channel_id"
 	ContextKeyTokenModelLimitEnabled ContextKey = "token_model_limit_enabled"
 	ContextKeyTokenModelLimit        ContextKey = "token_model_limit"
+	ContextKeyTokenHedgeEnabled      ContextKey = "token_hedge_enabled"
 
 	/* channel related keys */
 	ContextKeyChannelId                ContextKey = "channel_id"
@@ -28,6 +31,7 @@ const (
 	ContextKeyChannelOtherSetting      ContextKey = "channel_other_setting"
 	ContextKeyChannelParamOverride     ContextKey = "param_override"
 	ContextKeyChannelHeaderOverride    ContextKey = "header_override"
+	ContextKeyChannelResponseOverride  ContextKey = "response_override"
 	ContextKeyChannelOrganization      ContextKey = "channel_organization"
 	ContextKeyChannelAutoBan           ContextKey = "auto_ban"
 	ContextKeyChannelModelMapping      ContextKey = "model_mapping"
@@ -47,4 +51,8 @@ const (
 	ContextKeyUserName    ContextKey = "username"
 
 	ContextKeySystemPromptOverride ContextKey = "system_prompt_override"
+
+	ContextKeyHedgeAttempt ContextKey = "hedge_attempt"
+
+	ContextKeyRoutingDecision ContextKey = "routing_decision"
 )
@@ -3,6 +3,9 @@ package constant
 type MultiKeyMode string
 
 const (
-	MultiKeyModeRandom  MultiKeyMode = "random"  // 随机
-	MultiKeyModePolling MultiKeyMode = "polling" // 轮询
+	MultiKeyModeRandom            MultiKeyMode = "random"              // 随机
+	MultiKeyModePolling           MultiKeyMode = "polling"             // 轮询
+	MultiKeyModeLeastRecentlyUsed MultiKeyMode = "least_recently_used" // 最久未使用优先
+	MultiKeyModeLeastTokensUsed   MultiKeyMode = "least_tokens_used"   // 已用 token 最少优先
+	MultiKeyModeCooldown          MultiKeyMode = "cooldown"            // 轮询，遇到 429 时暂停该 key 一段时间
 )
@@ -0,0 +1,256 @@
+package controller
+
+import (
+	"fmt"
+	"math/rand"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/constant"
+	"github.com/QuantumNous/new-api/model"
+	"github.com/QuantumNous/new-api/service"
+	"github.com/QuantumNous/new-api/setting/operation_setting"
+	"github.com/QuantumNous/new-api/types"
+
+	"github.com/gin-gonic/gin"
+)
+
+// channelProbeOutcome 单个模型的探测结果
+type channelProbeOutcome struct {
+	modelName    string
+	result       testResult
+	responseTime int64
+	newAPIError  *types.NewAPIError
+	shouldBan    bool
+}
+
+// pickProbeModels 根据监控设置选出本轮需要探测的模型，测试模型始终排在第一位
+func pickProbeModels(channel *model.Channel) []string {
+	setting := operation_setting.GetMonitorSetting()
+	defaultModel := getChannelDefaultTestModel(channel)
+	if setting.ProbeModelMode != operation_setting.ProbeModelModeAll && setting.ProbeModelMode != operation_setting.ProbeModelModeSample {
+		return []string{defaultModel}
+	}
+
+	others := make([]string, 0)
+	seen := map[string]bool{defaultModel: true}
+	for _, m := range channel.GetModels() {
+		m = strings.TrimSpace(m)
+		if m == "" || seen[m] {
+			continue
+		}
+		seen[m] = true
+		others = append(others, m)
+	}
+	if setting.ProbeModelMode == operation_setting.ProbeModelModeSample {
+		sampleSize := setting.ProbeSampleSize - 1
+		if sampleSize < 0 {
+			sampleSize = 0
+		}
+		rand.Shuffle(len(others), func(i, j int) {
+			others[i], others[j] = others[j], others[i]
+		})
+		if len(others) > sampleSize {
+			others = others[:sampleSize]
+		}
+	}
+	return append([]string{defaultModel}, others...)
+}
+
+func recordChannelProbe(channel *model.Channel, modelName string, stream bool, result testResult, responseTime int64) {
+	probe := &model.ChannelProbe{
+		ChannelId:      channel.Id,
+		ModelName:      modelName,
+		Success:        result.localErr == nil && result.newAPIError == nil,
+		IsStream:       stream,
+		FirstTokenTime: int(result.firstTokenTime),
+		ResponseTime:   int(responseTime),
+	}
+	if result.newAPIError != nil {
+		probe.StatusCode = result.newAPIError.StatusCode
+		probe.ErrorMessage = result.newAPIError.Error()
+	} else if result.localErr != nil {
+		probe.ErrorMessage = result.localErr.Error()
+	}
+	if err := model.RecordChannelProbe(probe); err != nil {
+		common.SysLog(fmt.Sprintf("failed to record channel probe: channel_id=%d, model=%s, error=%v", channel.Id, modelName, err))
+	}
+	// 未真正发出请求的探测（如渠道类型不支持测试）不计入模型可用性
+	if result.context != nil && operation_setting.GetStatusSetting().IncludeProbeResults {
+		for _, group := range channel.GetGroups() {
+			model.LogModelStatus(modelName, group, probe.Success)
+		}
+	}
+}
+
+func probeChannelModel(channel *model.Channel, modelName string, stream bool, disableThreshold int64) channelProbeOutcome {
+	tik := time.Now()
+	result := testChannel(channel, modelName, "", stream)
+	milliseconds := time.Since(tik).Milliseconds()
+
+	outcome := channelProbeOutcome{
+		modelName:    modelName,
+		result:       result,
+		responseTime: milliseconds,
+		newAPIError:  result.newAPIError,
+	}
+	// request error disables the channel
+	if outcome.newAPIError != nil {
+		outcome.shouldBan = service.ShouldDisableChannel(channel.Type, outcome.newAPIError)
+	}
+	// 当错误检查通过，才检查响应时间
+	if common.AutomaticDisableChannelEnabled && !outcome.shouldBan && milliseconds > disableThreshold {
+		err := fmt.Errorf("响应时间 %.2fs 超过阈值 %.2fs", float64(milliseconds)/1000.0, float64(disableThreshold)/1000.0)
+		outcome.newAPIError = types.NewOpenAIError(err, types.ErrorCodeChannelResponseTimeExceeded, http.StatusRequestTimeout)
+		outcome.shouldBan = true
+	}
+	outcome.result.newAPIError = outcome.newAPIError
+	recordChannelProbe(channel, modelName, stream, outcome.result, milliseconds)
+	return outcome
+}
+
+// probeChannel 探测渠道的若干模型，并根据探测结果自动禁用或启用渠道
+func probeChannel(channel *model.Channel, disableThreshold int64) {
+	setting := operation_setting.GetMonitorSetting()
+	isChannelEnabled := channel.Status == common.ChannelStatusEnabled
+
+	outcomes := make([]channelProbeOutcome, 0)
+	for _, modelName := range pickProbeModels(channel) {
+		outcomes = append(outcomes, probeChannelModel(channel, modelName, setting.ProbeStream, disableThreshold))
+	}
+	if len(outcomes) == 0 {
+		return
+	}
+
+	var banOutcome *channelProbeOutcome
+	allSucceeded := true
+	var totalTime, successCount int64
+	for i := range outcomes {
+		outcome := &outcomes[i]
+		if outcome.newAPIError != nil || outcome.result.localErr != nil {
+			allSucceeded = false
+		} else {
+			totalTime += outcome.responseTime
+			successCount++
+		}
+		if outcome.shouldBan && banOutcome == nil {
+			banOutcome = outcome
+		}
+	}
+
+	// 错误类型未触发禁用时，按连续失败次数判断
+	if banOutcome == nil && !allSucceeded && common.AutomaticDisableChannelEnabled && setting.ProbeFailureThreshold > 0 {
+		failing, err := model.IsChannelProbeFailing(channel.Id, setting.ProbeFailureThreshold)
+		if err != nil {
+			common.SysLog(fmt.Sprintf("failed to check channel probe history: channel_id=%d, error=%v", channel.Id, err))
+		} else if failing {
+			last := outcomes[len(outcomes)-1]
+			if last.newAPIError == nil {
+				err := fmt.Errorf("连续 %d 次探测失败", setting.ProbeFailureThreshold)
+				last.newAPIError = types.NewOpenAIError(err, types.ErrorCodeBadResponse, http.StatusInternalServerError)
+			}
+			banOutcome = &last
+		}
+	}
+
+	// disable channel
+	if isChannelEnabled && banOutcome != nil && channel.GetAutoBan() && banOutcome.result.context != nil {
+		ctx := banOutcome.result.context
+		processChannelError(ctx, *types.NewChannelError(channel.Id, channel.Type, channel.Name, channel.ChannelInfo.IsMultiKey, common.GetContextKeyString(ctx, constant.ContextKeyChannelKey), channel.GetAutoBan()), banOutcome.newAPIError)
+	}
+
+	// enable channel
+	if !isChannelEnabled && allSucceeded && service.ShouldEnableChannel(nil, channel.Status) {
+		service.EnableChannel(channel.Id, common.GetContextKeyString(outcomes[0].result.context, constant.ContextKeyChannelKey), channel.Name)
+	}
+
+	responseTime := outcomes[0].responseTime
+	if successCount > 0 {
+		responseTime = totalTime / successCount
+	}
+	channel.UpdateResponseTime(responseTime)
+}
+
+// probeAllChannels 使用 worker 池并发探测所有渠道
+func probeAllChannels(channels []*model.Channel, disableThreshold int64) {
+	concurrency := operation_setting.GetMonitorSetting().ProbeConcurrency
+	if concurrency <= 0 {
+		concurrency = 1
+	}
+	channelChan := make(chan *model.Channel)
+	var wg sync.WaitGroup
+	for i := 0; i < concurrency; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for channel := range channelChan {
+				probeChannel(channel, disableThreshold)
+				time.Sleep(common.RequestInterval)
+			}
+		}()
+	}
+	for _, channel := range channels {
+		channelChan <- channel
+	}
+	close(channelChan)
+	wg.Wait()
+}
+
+func cleanupChannelProbes() {
+	days := operation_setting.GetMonitorSetting().ProbeHistoryDays
+	if days <= 0 {
+		return
+	}
+	count, err := model.DeleteChannelProbesBefore(common.GetTimestamp() - int64(days)*86400)
+	if err != nil {
+		common.SysLog(fmt.Sprintf("failed to cleanup channel probes: %v", err))
+		return
+	}
+	if count > 0 {
+		common.SysLog(fmt.Sprintf("cleaned up %d channel probe records", count))
+	}
+}
+
+func GetChannelProbeStats(c *gin.Context) {
+	channelId, _ := strconv.Atoi(c.Query("channel_id"))
+	startTimestamp, _ := strconv.ParseInt(c.Query("start_timestamp"), 10, 64)
+	endTimestamp, _ := strconv.ParseInt(c.Query("end_timestamp"), 10, 64)
+	stats, err := model.GetChannelProbeStats(channelId, startTimestamp, endTimestamp)
+	if err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "",
+		"data":    stats,
+	})
+}
+
+func GetChannelProbeHistory(c *gin.Context) {
+	channelId, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	startTimestamp, _ := strconv.ParseInt(c.Query("start_timestamp"), 10, 64)
+	endTimestamp, _ := strconv.ParseInt(c.Query("end_timestamp"), 10, 64)
+	limit, _ := strconv.Atoi(c.Query("limit"))
+	if limit <= 0 || limit > 1000 {
+		limit = 1000
+	}
+	probes, err := model.GetChannelProbeHistory(channelId, c.Query("model"), startTimestamp, endTimestamp, limit)
+	if err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "",
+		"data":    probes,
+	})
+}
@@ -13,6 +13,7 @@ import (
 
 	"github.com/QuantumNous/new-api/common"
 	"github.com/QuantumNous/new-api/model"
+	"github.com/QuantumNous/new-api/service"
 	"github.com/gin-gonic/gin"
 )
 
@@ -509,6 +510,9 @@ func StartGitHubAutoSync() {
 					common.SysLog("GitHub 同步配置不完整，跳过本次同步")
 					continue
 				}
+				if !service.IsJobLeader(service.JobGitHubSync) {
+					continue
+				}
 				
 				// 执行同步
 				common.SysLog("开始执行 GitHub 自动同步...")
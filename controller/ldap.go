@@ -0,0 +1,197 @@
+package controller
+
+import (
+	"crypto/tls"
+	"encoding/json"
+	"errors"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/model"
+	"github.com/QuantumNous/new-api/setting/system_setting"
+
+	"github.com/gin-gonic/gin"
+	"github.com/go-ldap/ldap/v3"
+)
+
+var errLdapInvalidCredentials = errors.New("用户名或密码错误")
+
+type LdapUser struct {
+	DN          string
+	Username    string
+	Email       string
+	DisplayName string
+	Groups      []string
+}
+
+func dialLdap(settings *system_setting.LDAPSettings) (*ldap.Conn, error) {
+	tlsConfig := &tls.Config{InsecureSkipVerify: settings.InsecureSkipVerify}
+	if u, err := url.Parse(settings.Url); err == nil {
+		tlsConfig.ServerName = u.Hostname()
+	}
+	conn, err := ldap.DialURL(settings.Url, ldap.DialWithTLSConfig(tlsConfig), ldap.DialWithDialer(&net.Dialer{Timeout: 5 * time.Second}))
+	if err != nil {
+		return nil, err
+	}
+	conn.SetTimeout(10 * time.Second)
+	if settings.StartTLS {
+		if err := conn.StartTLS(tlsConfig); err != nil {
+			conn.Close()
+			return nil, err
+		}
+	}
+	return conn, nil
+}
+
+// authenticateLdapUser 先以服务账号查找用户 DN，再以用户 DN 和密码绑定验证
+func authenticateLdapUser(username string, password string) (*LdapUser, error) {
+	// 空密码会被多数服务器视为匿名绑定而直接成功
+	if username == "" || password == "" {
+		return nil, errLdapInvalidCredentials
+	}
+	settings := system_setting.GetLDAPSettings()
+	conn, err := dialLdap(settings)
+	if err != nil {
+		common.SysLog("failed to connect to LDAP server: " + err.Error())
+		return nil, errors.New("无法连接至 LDAP 服务器，请稍后重试！")
+	}
+	defer conn.Close()
+
+	if settings.BindDN != "" {
+		if err := conn.Bind(settings.BindDN, settings.BindPassword); err != nil {
+			common.SysLog("LDAP service account bind failed: " + err.Error())
+			return nil, errors.New("LDAP 服务账号认证失败，请检查设置！")
+		}
+	}
+
+	filter := strings.ReplaceAll(settings.UserFilter, "%s", ldap.EscapeFilter(username))
+	attributes := []string{"dn"}
+	for _, attribute := range []string{settings.UsernameAttribute, settings.EmailAttribute, settings.DisplayNameAttribute, settings.GroupAttribute} {
+		if attribute != "" {
+			attributes = append(attributes, attribute)
+		}
+	}
+	result, err := conn.Search(ldap.NewSearchRequest(
+		settings.BaseDN, ldap.ScopeWholeSubtree, ldap.NeverDerefAliases, 2, 10, false,
+		filter, attributes, nil,
+	))
+	if err != nil {
+		common.SysLog("LDAP search failed: " + err.Error())
+		return nil, errors.New("LDAP 查询用户失败，请检查设置！")
+	}
+	if len(result.Entries) != 1 {
+		return nil, errLdapInvalidCredentials
+	}
+	entry := result.Entries[0]
+	if err := conn.Bind(entry.DN, password); err != nil {
+		return nil, errLdapInvalidCredentials
+	}
+
+	ldapUser := &LdapUser{
+		DN:          entry.DN,
+		Username:    entry.GetAttributeValue(settings.UsernameAttribute),
+		Email:       entry.GetAttributeValue(settings.EmailAttribute),
+		DisplayName: entry.GetAttributeValue(settings.DisplayNameAttribute),
+	}
+	if ldapUser.Username == "" {
+		ldapUser.Username = username
+	}
+	if settings.GroupAttribute != "" {
+		for _, value := range entry.GetAttributeValues(settings.GroupAttribute) {
+			ldapUser.Groups = append(ldapUser.Groups, value)
+			// memberOf 等属性的值为组 DN，同时以组的 CN 参与映射
+			if dn, err := ldap.ParseDN(value); err == nil && len(dn.RDNs) > 0 && len(dn.RDNs[0].Attributes) > 0 {
+				ldapUser.Groups = append(ldapUser.Groups, dn.RDNs[0].Attributes[0].Value)
+			}
+		}
+	}
+	return ldapUser, nil
+}
+
+func LdapLogin(c *gin.Context) {
+	settings := system_setting.GetLDAPSettings()
+	if !settings.Enabled {
+		c.JSON(http.StatusOK, gin.H{
+			"message": "管理员未开启通过 LDAP 登录",
+			"success": false,
+		})
+		return
+	}
+	var loginRequest LoginRequest
+	if err := json.NewDecoder(c.Request.Body).Decode(&loginRequest); err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"message": "无效的参数",
+			"success": false,
+		})
+		return
+	}
+	ldapUser, err := authenticateLdapUser(strings.TrimSpace(loginRequest.Username), loginRequest.Password)
+	if err != nil {
+		common.ApiError(c, err)
+		return
+	}
+
+	group := ""
+	if settings.GroupAttribute != "" {
+		group = system_setting.ResolveDirectoryGroup(settings.GroupMappings, ldapUser.Groups, settings.DefaultGroup)
+	}
+	user := model.User{
+		LdapId: ldapUser.Username,
+	}
+	if model.IsLdapIdAlreadyTaken(user.LdapId) {
+		if err := user.FillUserByLdapId(); err != nil {
+			common.ApiError(c, err)
+			return
+		}
+	} else if scimUser, err := model.GetScimUserForLink("username", ldapUser.Username); err == nil && scimUser.LdapId == "" {
+		// 由 SCIM 预先创建的账号在首次 LDAP 登录时关联
+		user = *scimUser
+		user.LdapId = ldapUser.Username
+		if err := user.Update(false); err != nil {
+			common.ApiError(c, err)
+			return
+		}
+	} else {
+		if !settings.AutoRegister || !common.RegisterEnabled {
+			c.JSON(http.StatusOK, gin.H{
+				"message": "管理员关闭了新用户注册",
+				"success": false,
+			})
+			return
+		}
+		user.Username = ldapUser.Username
+		user.Email = ldapUser.Email
+		user.DisplayName = ldapUser.DisplayName
+		if user.DisplayName == "" {
+			user.DisplayName = ldapUser.Username
+		}
+		// 账号仅能通过 LDAP 登录，本地密码随机生成
+		user.Password = common.GetRandomString(32)
+		user.Group = group
+		if err := user.Insert(0); err != nil {
+			common.SysLog("failed to create LDAP user: " + err.Error())
+			c.JSON(http.StatusOK, gin.H{
+				"message": "创建用户失败，用户名可能已被占用",
+				"success": false,
+			})
+			return
+		}
+	}
+
+	if user.Status != common.UserStatusEnabled {
+		c.JSON(http.StatusOK, gin.H{
+			"message": "用户已被封禁",
+			"success": false,
+		})
+		return
+	}
+	if err := user.SyncGroupAndRole(group, 0); err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	loginWithTwoFA(&user, c)
+}
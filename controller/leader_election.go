@@ -0,0 +1,29 @@
+package controller
+
+import (
+	"net/http"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/service"
+
+	"github.com/gin-gonic/gin"
+)
+
+// GetJobLeaders 返回各后台任务的租约持有节点，用于确认每个任务只在一个节点上运行
+func GetJobLeaders(c *gin.Context) {
+	backend := "database"
+	if common.RedisEnabled {
+		backend = "redis"
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "",
+		"data": gin.H{
+			"enabled":        common.LeaderElectionEnabled,
+			"is_master_node": common.IsMasterNode,
+			"node_id":        service.JobElectionNodeId(),
+			"backend":        backend,
+			"jobs":           service.GetJobLeaderStatuses(),
+		},
+	})
+}
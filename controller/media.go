@@ -0,0 +1,142 @@
+package controller
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/model"
+	"github.com/QuantumNous/new-api/service"
+	"github.com/QuantumNous/new-api/setting/system_setting"
+
+	"github.com/gin-gonic/gin"
+)
+
+type mediaAssetItem struct {
+	*model.MediaAsset
+	Url string `json:"url"`
+}
+
+// GetMediaAsset 通过签名链接返回保存的生成结果，无需登录
+func GetMediaAsset(c *gin.Context) {
+	key := c.Param("key")
+	expires, _ := strconv.ParseInt(c.Query("expires"), 10, 64)
+	if !service.VerifyMediaSignature(key, expires, c.Query("signature")) {
+		c.JSON(http.StatusForbidden, gin.H{
+			"error": "invalid_or_expired_signature",
+		})
+		return
+	}
+	asset, err := model.GetMediaAssetByKey(key)
+	if err != nil || asset.IsExpired() {
+		c.JSON(http.StatusNotFound, gin.H{
+			"error": "media_not_found",
+		})
+		return
+	}
+	if err := service.ServeMediaAsset(c, asset); err != nil {
+		common.SysError("failed to serve media asset " + key + ": " + err.Error())
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": "media_read_failed",
+		})
+	}
+}
+
+func getMediaAssets(c *gin.Context, userId int) {
+	pageInfo := common.GetPageQuery(c)
+	assets, total, err := model.GetMediaAssets(userId, c.Query("source"), pageInfo.GetStartIdx(), pageInfo.GetPageSize())
+	if err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	items := make([]mediaAssetItem, 0, len(assets))
+	for _, asset := range assets {
+		items = append(items, mediaAssetItem{MediaAsset: asset, Url: service.GetMediaAssetURL(asset)})
+	}
+	pageInfo.SetTotal(int(total))
+	pageInfo.SetItems(items)
+	common.ApiSuccess(c, pageInfo)
+}
+
+func GetAllMediaAssets(c *gin.Context) {
+	userId, _ := strconv.Atoi(c.Query("user_id"))
+	getMediaAssets(c, userId)
+}
+
+func GetSelfMediaAssets(c *gin.Context) {
+	getMediaAssets(c, c.GetInt("id"))
+}
+
+// GetSelfMediaUsage 返回当前用户的存储占用和上限，上限为 0 表示不限制
+func GetSelfMediaUsage(c *gin.Context) {
+	userId := c.GetInt("id")
+	size, count, err := model.GetUserMediaUsage(userId)
+	if err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	group := ""
+	if userCache, err := model.GetUserCache(userId); err == nil {
+		group = userCache.Group
+	}
+	setting := system_setting.GetMediaStorageSetting()
+	common.ApiSuccess(c, gin.H{
+		"used_bytes":     size,
+		"count":          count,
+		"limit_bytes":    setting.GetUserQuotaBytes(group),
+		"retention_days": setting.RetentionDays,
+	})
+}
+
+func deleteMediaAsset(c *gin.Context, userId int) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	asset, err := model.GetMediaAssetById(id)
+	if err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	if userId != 0 && asset.UserId != userId {
+		common.ApiError(c, errors.New("文件不存在"))
+		return
+	}
+	if err := service.DeleteMediaAsset(c.Request.Context(), asset); err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	common.ApiSuccess(c, nil)
+}
+
+func DeleteMediaAsset(c *gin.Context) {
+	deleteMediaAsset(c, 0)
+}
+
+func DeleteSelfMediaAsset(c *gin.Context) {
+	deleteMediaAsset(c, c.GetInt("id"))
+}
+
+var autoCleanupMediaAssetsOnce sync.Once
+
+// AutomaticallyCleanupMediaAssets 定期删除超过保留期的生成结果
+func AutomaticallyCleanupMediaAssets() {
+	if !service.CanRunJobs() {
+		return
+	}
+	autoCleanupMediaAssetsOnce.Do(func() {
+		for {
+			time.Sleep(time.Hour)
+			if !system_setting.GetMediaStorageSetting().Enabled || !service.IsJobLeader(service.JobMediaCleanup) {
+				continue
+			}
+			if deleted := service.CleanupExpiredMediaAssets(); deleted > 0 {
+				common.SysLog("cleaned up " + strconv.Itoa(deleted) + " expired media assets")
+			}
+		}
+	})
+}
@@ -17,6 +17,7 @@ import (
 	"github.com/QuantumNous/new-api/setting"
 	"github.com/QuantumNous/new-api/setting/system_setting"
 
+	"github.com/bytedance/gopkg/util/gopool"
 	"github.com/gin-gonic/gin"
 )
 
@@ -25,6 +26,9 @@ func UpdateMidjourneyTaskBulk() {
 	ctx := context.TODO()
 	for {
 		time.Sleep(time.Duration(15) * time.Second)
+		if !service.IsJobLeader(service.JobMidjourneyPolling) {
+			continue
+		}
 
 		tasks := model.GetAllUnFinishTasks()
 		if len(tasks) == 0 {
@@ -176,8 +180,18 @@ func UpdateMidjourneyTaskBulk() {
 				if err != nil {
 					logger.LogError(ctx, "UpdateMidjourneyTask task error: "+err.Error())
 				} else {
+					if task.Status == "SUCCESS" {
+						gopool.Go(func() {
+							service.PersistMidjourneyImage(task)
+						})
+					}
+					if task.Status == "SUCCESS" || task.Status == "FAILURE" {
+						gopool.Go(func() {
+							service.NotifyMidjourneyWebhook(task)
+						})
+					}
 					if shouldReturnQuota {
-						err = model.IncreaseUserQuota(task.UserId, task.Quota, false)
+						err = model.IncreaseUserQuotaWithLedger(task.UserId, task.Quota, false, model.QuotaLedgerTypeRefund, 0, task.MjId)
 						if err != nil {
 							logger.LogError(ctx, "fail to increase user quota: "+err.Error())
 						}
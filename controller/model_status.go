@@ -0,0 +1,318 @@
+package controller
+
+import (
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/model"
+	"github.com/QuantumNous/new-api/service"
+	"github.com/QuantumNous/new-api/setting"
+	"github.com/QuantumNous/new-api/setting/operation_setting"
+	"github.com/QuantumNous/new-api/types"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	modelStatusOperational = "operational"
+	modelStatusDegraded    = "degraded"
+	modelStatusOutage      = "outage"
+)
+
+type modelGroupStatus struct {
+	Group     string  `json:"group"`
+	Uptime24h float64 `json:"uptime_24h"`
+	Status    string  `json:"status"`
+}
+
+type modelStatusItem struct {
+	ModelName string             `json:"model_name"`
+	Status    string             `json:"status"`
+	Uptime24h float64            `json:"uptime_24h"`
+	Uptime7d  float64            `json:"uptime_7d"`
+	Uptime30d float64            `json:"uptime_30d"`
+	Groups    []modelGroupStatus `json:"groups"`
+}
+
+type modelSLAItem struct {
+	ModelName       string  `json:"model_name"`
+	Group           string  `json:"group"`
+	SuccessCount    int     `json:"success_count"`
+	ErrorCount      int     `json:"error_count"`
+	Uptime          float64 `json:"uptime"`
+	Incidents       int     `json:"incidents"`
+	DowntimeMinutes int64   `json:"downtime_minutes"`
+}
+
+var (
+	modelStatusCache     gin.H
+	modelStatusCacheTime time.Time
+	modelStatusCacheLock sync.Mutex
+)
+
+// recordModelStatus 记录一次请求的最终结果，客户端错误（如参数错误、额度不足）不计入可用性
+func recordModelStatus(modelName string, group string, newAPIError *types.NewAPIError) {
+	if newAPIError == nil {
+		model.LogModelStatus(modelName, group, true)
+		return
+	}
+	if types.IsChannelError(newAPIError) ||
+		newAPIError.GetErrorCode() == types.ErrorCodeGetChannelFailed ||
+		newAPIError.StatusCode >= http.StatusInternalServerError ||
+		newAPIError.StatusCode == http.StatusTooManyRequests {
+		model.LogModelStatus(modelName, group, false)
+	}
+}
+
+// AutomaticallyCheckModelIncidents 各节点定期将请求结果写入共享窗口，持有租约的节点汇总所有节点的窗口开启或关闭故障事件
+func AutomaticallyCheckModelIncidents() {
+	for {
+		time.Sleep(time.Minute)
+		model.FlushModelStatusWindow()
+		if !service.IsJobLeader(service.JobModelIncidents) {
+			continue
+		}
+		statusSetting := operation_setting.GetStatusSetting()
+		stats, err := model.GetModelStatusWindow(statusSetting.IncidentWindowMinutes)
+		if err != nil {
+			common.SysLog("failed to get model status window: " + err.Error())
+			continue
+		}
+		model.CheckModelIncidents(stats, statusSetting.IncidentWindowMinutes, statusSetting.IncidentErrorRate, statusSetting.IncidentMinRequests)
+	}
+}
+
+func modelIncidentStatus(incident *model.ModelIncident) string {
+	if incident.ErrorRate >= 0.9 {
+		return modelStatusOutage
+	}
+	return modelStatusDegraded
+}
+
+// worseModelStatus 返回两个状态中更严重的一个
+func worseModelStatus(a string, b string) string {
+	rank := map[string]int{modelStatusOperational: 0, modelStatusDegraded: 1, modelStatusOutage: 2}
+	if rank[b] > rank[a] {
+		return b
+	}
+	return a
+}
+
+func buildModelStatus() (gin.H, error) {
+	now := common.GetTimestamp()
+	uptime24h, err := model.GetModelUptimes(now-86400, now, false)
+	if err != nil {
+		return nil, err
+	}
+	uptime7d, err := model.GetModelUptimes(now-7*86400, now, false)
+	if err != nil {
+		return nil, err
+	}
+	uptime30d, err := model.GetModelUptimes(now-30*86400, now, false)
+	if err != nil {
+		return nil, err
+	}
+	groupUptime24h, err := model.GetModelUptimes(now-86400, now, true)
+	if err != nil {
+		return nil, err
+	}
+	openIncidents, err := model.GetOpenModelIncidents()
+	if err != nil {
+		return nil, err
+	}
+
+	// 仅公开用户可选的分组，以及在这些分组中启用的模型（与定价页一致），避免泄露私有分组的模型
+	usableGroups := setting.GetUserUsableGroupsCopy()
+	publicModels := make(map[string]bool)
+	for _, pricing := range model.GetPricing() {
+		for _, group := range pricing.EnableGroup {
+			if _, ok := usableGroups[group]; ok {
+				publicModels[pricing.ModelName] = true
+				break
+			}
+		}
+	}
+	items := make(map[string]*modelStatusItem)
+	getItem := func(modelName string) *modelStatusItem {
+		item, ok := items[modelName]
+		if !ok {
+			item = &modelStatusItem{
+				ModelName: modelName,
+				Status:    modelStatusOperational,
+				Uptime24h: 100,
+				Uptime7d:  100,
+				Uptime30d: 100,
+				Groups:    []modelGroupStatus{},
+			}
+			items[modelName] = item
+		}
+		return item
+	}
+	for _, uptime := range uptime30d {
+		if !publicModels[uptime.ModelName] {
+			continue
+		}
+		getItem(uptime.ModelName).Uptime30d = uptime.Uptime
+	}
+	for _, uptime := range uptime7d {
+		if !publicModels[uptime.ModelName] {
+			continue
+		}
+		getItem(uptime.ModelName).Uptime7d = uptime.Uptime
+	}
+	for _, uptime := range uptime24h {
+		if !publicModels[uptime.ModelName] {
+			continue
+		}
+		getItem(uptime.ModelName).Uptime24h = uptime.Uptime
+	}
+	incidentStatus := make(map[string]string)
+	publicIncidents := make([]*model.ModelIncident, 0)
+	for _, incident := range openIncidents {
+		if _, ok := usableGroups[incident.GroupName]; !ok || !publicModels[incident.ModelName] {
+			continue
+		}
+		publicIncidents = append(publicIncidents, incident)
+		key := incident.ModelName + "/" + incident.GroupName
+		incidentStatus[key] = worseModelStatus(incidentStatus[key], modelIncidentStatus(incident))
+		item := getItem(incident.ModelName)
+		item.Status = worseModelStatus(item.Status, modelIncidentStatus(incident))
+	}
+	for _, uptime := range groupUptime24h {
+		if _, ok := usableGroups[uptime.GroupName]; !ok || !publicModels[uptime.ModelName] {
+			continue
+		}
+		status := modelStatusOperational
+		if s, ok := incidentStatus[uptime.ModelName+"/"+uptime.GroupName]; ok {
+			status = s
+		}
+		item := getItem(uptime.ModelName)
+		item.Groups = append(item.Groups, modelGroupStatus{
+			Group:     uptime.GroupName,
+			Uptime24h: uptime.Uptime,
+			Status:    status,
+		})
+	}
+
+	list := make([]*modelStatusItem, 0, len(items))
+	for _, item := range items {
+		list = append(list, item)
+	}
+	sort.Slice(list, func(i, j int) bool {
+		return list[i].ModelName < list[j].ModelName
+	})
+	return gin.H{
+		"models":     list,
+		"incidents":  publicIncidents,
+		"updated_at": now,
+	}, nil
+}
+
+func GetModelStatus(c *gin.Context) {
+	if !operation_setting.GetStatusSetting().PublicStatusEnabled {
+		common.ApiErrorMsg(c, "状态页未启用")
+		return
+	}
+	modelStatusCacheLock.Lock()
+	defer modelStatusCacheLock.Unlock()
+	if modelStatusCache == nil || time.Since(modelStatusCacheTime) > time.Minute {
+		data, err := buildModelStatus()
+		if err != nil {
+			common.ApiError(c, err)
+			return
+		}
+		modelStatusCache = data
+		modelStatusCacheTime = time.Now()
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "",
+		"data":    modelStatusCache,
+	})
+}
+
+// GetModelSLAReport 返回指定月份（格式 2006-01，默认当月）各模型各分组的 SLA 报表
+func GetModelSLAReport(c *gin.Context) {
+	month := c.Query("month")
+	start := time.Now()
+	if month != "" {
+		parsed, err := time.ParseInLocation("2006-01", month, time.Local)
+		if err != nil {
+			common.ApiErrorMsg(c, "月份格式错误，应为 YYYY-MM")
+			return
+		}
+		start = parsed
+	}
+	start = time.Date(start.Year(), start.Month(), 1, 0, 0, 0, 0, time.Local)
+	end := start.AddDate(0, 1, 0)
+	startTime, endTime := start.Unix(), end.Unix()-1
+
+	uptimes, err := model.GetModelUptimes(startTime, endTime, true)
+	if err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	incidents, err := model.GetModelIncidents(startTime, endTime)
+	if err != nil {
+		common.ApiError(c, err)
+		return
+	}
+
+	now := common.GetTimestamp()
+	items := make(map[string]*modelSLAItem)
+	getItem := func(modelName string, group string) *modelSLAItem {
+		key := modelName + "/" + group
+		item, ok := items[key]
+		if !ok {
+			item = &modelSLAItem{ModelName: modelName, Group: group, Uptime: 100}
+			items[key] = item
+		}
+		return item
+	}
+	for _, uptime := range uptimes {
+		item := getItem(uptime.ModelName, uptime.GroupName)
+		item.SuccessCount = uptime.SuccessCount
+		item.ErrorCount = uptime.ErrorCount
+		item.Uptime = uptime.Uptime
+	}
+	for _, incident := range incidents {
+		item := getItem(incident.ModelName, incident.GroupName)
+		item.Incidents++
+		incidentStart, incidentEnd := incident.StartedAt, incident.EndedAt
+		if incidentEnd == 0 {
+			incidentEnd = now
+		}
+		if incidentStart < startTime {
+			incidentStart = startTime
+		}
+		if incidentEnd > endTime {
+			incidentEnd = endTime
+		}
+		if incidentEnd > incidentStart {
+			item.DowntimeMinutes += (incidentEnd - incidentStart) / 60
+		}
+	}
+
+	list := make([]*modelSLAItem, 0, len(items))
+	for _, item := range items {
+		list = append(list, item)
+	}
+	sort.Slice(list, func(i, j int) bool {
+		if list[i].ModelName != list[j].ModelName {
+			return list[i].ModelName < list[j].ModelName
+		}
+		return list[i].Group < list[j].Group
+	})
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "",
+		"data": gin.H{
+			"month":     start.Format("2006-01"),
+			"items":     list,
+			"incidents": incidents,
+		},
+	})
+}
@@ -0,0 +1,72 @@
+package controller
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/model"
+	"github.com/QuantumNous/new-api/service"
+	"github.com/QuantumNous/new-api/setting/operation_setting"
+)
+
+// recoverChannelKeys 重新测试多 Key 渠道中被自动禁用的 key，测试通过则重新启用
+func recoverChannelKeys() {
+	setting := operation_setting.GetMultiKeySetting()
+	interval := time.Duration(setting.AutoRecoveryMinutes) * time.Minute
+	channels, err := model.GetAllChannels(0, 0, true, false)
+	if err != nil {
+		common.SysLog(fmt.Sprintf("failed to load channels for key recovery: %v", err))
+		return
+	}
+	for _, channel := range channels {
+		if !channel.ChannelInfo.IsMultiKey || channel.Status == common.ChannelStatusManuallyDisabled {
+			continue
+		}
+		keys := channel.GetKeys()
+		for keyIndex, status := range channel.ChannelInfo.MultiKeyStatusList {
+			if status != common.ChannelStatusAutoDisabled || keyIndex < 0 || keyIndex >= len(keys) {
+				continue
+			}
+			// 刚被禁用的 key 至少等待一个间隔再测试
+			if disabledTime, ok := channel.ChannelInfo.MultiKeyDisabledTime[keyIndex]; ok && common.GetTimestamp()-disabledTime < int64(interval.Seconds()) {
+				continue
+			}
+			if !model.TryMarkChannelKeyRecovery(channel.Id, keyIndex, interval) {
+				continue
+			}
+			// 以单 key 渠道的形式测试该 key
+			single := *channel
+			single.Key = keys[keyIndex]
+			single.Keys = nil
+			single.ChannelInfo = model.ChannelInfo{}
+			result := testChannel(&single, "", "", false)
+			if result.localErr != nil || result.newAPIError != nil {
+				continue
+			}
+			if err := model.EnableChannelKey(channel.Id, keyIndex); err != nil {
+				common.SysLog(fmt.Sprintf("failed to recover key #%d of channel #%d: %v", keyIndex, channel.Id, err))
+				continue
+			}
+			common.SysLog(fmt.Sprintf("通道「%s」（#%d）的 key #%d 测试通过，已自动恢复", channel.Name, channel.Id, keyIndex))
+		}
+	}
+}
+
+var autoRecoverChannelKeysOnce sync.Once
+
+func AutomaticallyRecoverChannelKeys() {
+	if !service.CanRunJobs() {
+		return
+	}
+	autoRecoverChannelKeysOnce.Do(func() {
+		for {
+			time.Sleep(1 * time.Minute)
+			if !operation_setting.GetMultiKeySetting().AutoRecoveryEnabled || !service.IsJobLeader(service.JobChannelKeyRecovery) {
+				continue
+			}
+			recoverChannelKeys()
+		}
+	})
+}
@@ -1,6 +1,8 @@
 package controller
 
 import (
+	"crypto/sha256"
+	"encoding/base64"
 	"encoding/json"
 	"errors"
 	"fmt"
@@ -16,6 +18,7 @@ import (
 
 	"github.com/gin-contrib/sessions"
 	"github.com/gin-gonic/gin"
+	"github.com/samber/lo"
 )
 
 type OidcResponse struct {
@@ -33,21 +36,112 @@ type OidcUser struct {
 	Name              string `json:"name"`
 	PreferredUsername string `json:"preferred_username"`
 	Picture           string `json:"picture"`
+	// ID Token 与 userinfo 合并后的全部声明，userinfo 优先
+	Claims map[string]any `json:"-"`
 }
 
-func getOidcUserInfoByCode(code string) (*OidcUser, error) {
+// EmailVerified 判断身份提供方是否声明邮箱已验证，部分提供方以字符串形式返回该声明
+func (u *OidcUser) EmailVerified() bool {
+	switch verified := u.Claims["email_verified"].(type) {
+	case bool:
+		return verified
+	case string:
+		return strings.EqualFold(verified, "true")
+	}
+	return false
+}
+
+// isOidcEmailAllowed 配置了邮箱域名白名单时，仅接受已验证且域名在白名单内的邮箱
+func isOidcEmailAllowed(settings *system_setting.OIDCSettings, oidcUser *OidcUser) bool {
+	if len(settings.AllowedEmailDomains) == 0 {
+		return true
+	}
+	return oidcUser.EmailVerified() && settings.IsEmailDomainAllowed(oidcUser.Email)
+}
+
+const oidcCodeVerifierSessionKey = "oidc_code_verifier"
+
+// GenerateOidcAuthState 生成 OIDC 授权请求所需的 state、scope，启用 PKCE 时一并生成 code_challenge
+func GenerateOidcAuthState(c *gin.Context) {
+	settings := system_setting.GetOIDCSettings()
+	session := sessions.Default(c)
+	state := common.GetRandomString(12)
+	if affCode := c.Query("aff"); affCode != "" {
+		session.Set("aff", affCode)
+	}
+	session.Set("oauth_state", state)
+	data := gin.H{
+		"state": state,
+		"scope": settings.Scopes,
+	}
+	if settings.UsePKCE {
+		verifier, err := common.GenerateRandomCharsKey(64)
+		if err != nil {
+			common.ApiError(c, err)
+			return
+		}
+		session.Set(oidcCodeVerifierSessionKey, verifier)
+		sum := sha256.Sum256([]byte(verifier))
+		data["code_challenge"] = base64.RawURLEncoding.EncodeToString(sum[:])
+		data["code_challenge_method"] = "S256"
+	} else {
+		session.Delete(oidcCodeVerifierSessionKey)
+	}
+	if err := session.Save(); err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	common.ApiSuccess(c, data)
+}
+
+// takeOidcCodeVerifier 取出并清除会话中的 PKCE code_verifier，每个授权码只能使用一次
+func takeOidcCodeVerifier(c *gin.Context) string {
+	session := sessions.Default(c)
+	verifier, _ := session.Get(oidcCodeVerifierSessionKey).(string)
+	if verifier != "" {
+		session.Delete(oidcCodeVerifierSessionKey)
+		_ = session.Save()
+	}
+	return verifier
+}
+
+// decodeOidcIdTokenClaims 解析 ID Token 的声明。ID Token 由令牌端点经 TLS 直接返回，按 OIDC 规范可不校验签名
+func decodeOidcIdTokenClaims(idToken string) (map[string]any, error) {
+	parts := strings.Split(idToken, ".")
+	if len(parts) != 3 {
+		return nil, errors.New("invalid id token")
+	}
+	payload, err := base64.RawURLEncoding.DecodeString(strings.TrimRight(parts[1], "="))
+	if err != nil {
+		return nil, err
+	}
+	claims := map[string]any{}
+	if err := common.Unmarshal(payload, &claims); err != nil {
+		return nil, err
+	}
+	return claims, nil
+}
+
+func getOidcUserInfoByCode(code string, codeVerifier string) (*OidcUser, error) {
 	if code == "" {
 		return nil, errors.New("无效的参数")
 	}
+	settings := system_setting.GetOIDCSettings()
+	if settings.UsePKCE && codeVerifier == "" {
+		return nil, errors.New("PKCE 校验信息已失效，请重新登录")
+	}
 
 	values := url.Values{}
-	values.Set("client_id", system_setting.GetOIDCSettings().ClientId)
-	values.Set("client_secret", system_setting.GetOIDCSettings().ClientSecret)
+	values.Set("client_id", settings.ClientId)
+	values.Set("client_secret", settings.ClientSecret)
 	values.Set("code", code)
 	values.Set("grant_type", "authorization_code")
 	values.Set("redirect_uri", fmt.Sprintf("%s/oauth/oidc", system_setting.ServerAddress))
+	if codeVerifier != "" {
+		values.Set("code_verifier", codeVerifier)
+	}
 	formData := values.Encode()
-	req, err := http.NewRequest("POST", system_setting.GetOIDCSettings().TokenEndpoint, strings.NewReader(formData))
+	req, err := http.NewRequest("POST", settings.TokenEndpoint, strings.NewReader(formData))
 	if err != nil {
 		return nil, err
 	}
@@ -73,7 +167,17 @@ func getOidcUserInfoByCode(code string) (*OidcUser, error) {
 		return nil, errors.New("OIDC 获取 Token 失败，请检查设置！")
 	}
 
-	req, err = http.NewRequest("GET", system_setting.GetOIDCSettings().UserInfoEndpoint, nil)
+	claims := map[string]any{}
+	if oidcResponse.IDToken != "" {
+		idTokenClaims, err := decodeOidcIdTokenClaims(oidcResponse.IDToken)
+		if err != nil {
+			common.SysLog("OIDC 解析 ID Token 失败: " + err.Error())
+		} else {
+			claims = idTokenClaims
+		}
+	}
+
+	req, err = http.NewRequest("GET", settings.UserInfoEndpoint, nil)
 	if err != nil {
 		return nil, err
 	}
@@ -89,11 +193,23 @@ func getOidcUserInfoByCode(code string) (*OidcUser, error) {
 		return nil, errors.New("OIDC 获取用户信息失败！请检查设置！")
 	}
 
-	var oidcUser OidcUser
-	err = json.NewDecoder(res2.Body).Decode(&oidcUser)
+	var userInfoClaims map[string]any
+	err = json.NewDecoder(res2.Body).Decode(&userInfoClaims)
 	if err != nil {
 		return nil, err
 	}
+	for key, value := range userInfoClaims {
+		claims[key] = value
+	}
+	claimsBytes, err := common.Marshal(claims)
+	if err != nil {
+		return nil, err
+	}
+	var oidcUser OidcUser
+	if err := common.Unmarshal(claimsBytes, &oidcUser); err != nil {
+		return nil, err
+	}
+	oidcUser.Claims = claims
 	if oidcUser.OpenID == "" || oidcUser.Email == "" {
 		common.SysLog("OIDC 获取用户信息为空！请检查设置！")
 		return nil, errors.New("OIDC 获取用户信息为空！请检查设置！")
@@ -101,6 +217,60 @@ func getOidcUserInfoByCode(code string) (*OidcUser, error) {
 	return &oidcUser, nil
 }
 
+// oidcClaimValues 按路径读取声明的值，路径以 . 分隔访问嵌套对象，数组展开为多个值
+func oidcClaimValues(claims map[string]any, path string) []string {
+	var current any = claims
+	for _, key := range strings.Split(path, ".") {
+		object, ok := current.(map[string]any)
+		if !ok {
+			return nil
+		}
+		current = object[key]
+	}
+	switch value := current.(type) {
+	case nil:
+		return nil
+	case []any:
+		values := make([]string, 0, len(value))
+		for _, item := range value {
+			values = append(values, fmt.Sprint(item))
+		}
+		return values
+	default:
+		return []string{fmt.Sprint(value)}
+	}
+}
+
+// resolveOidcGroup 返回第一个命中的分组映射；未配置分组声明时返回 nil
+func resolveOidcGroup(settings *system_setting.OIDCSettings, claims map[string]any) *system_setting.OIDCGroupMapping {
+	if settings.GroupClaim == "" {
+		return nil
+	}
+	values := oidcClaimValues(claims, settings.GroupClaim)
+	for i := range settings.GroupMappings {
+		mapping := &settings.GroupMappings[i]
+		if mapping.Group != "" && lo.Contains(values, mapping.Value) {
+			return mapping
+		}
+	}
+	return &system_setting.OIDCGroupMapping{Group: settings.DefaultGroup}
+}
+
+// resolveOidcRole 返回命中的最高角色，未命中时为普通用户，最高为管理员；未配置角色声明时返回 0
+func resolveOidcRole(settings *system_setting.OIDCSettings, claims map[string]any) int {
+	if settings.RoleClaim == "" {
+		return 0
+	}
+	values := oidcClaimValues(claims, settings.RoleClaim)
+	role := common.RoleCommonUser
+	for _, mapping := range settings.RoleMappings {
+		if lo.Contains(values, mapping.Value) && mapping.Role > role {
+			role = mapping.Role
+		}
+	}
+	return min(role, common.RoleAdminUser)
+}
+
 func OidcAuth(c *gin.Context) {
 	session := sessions.Default(c)
 	state := c.Query("state")
@@ -123,12 +293,26 @@ func OidcAuth(c *gin.Context) {
 		})
 		return
 	}
+	settings := system_setting.GetOIDCSettings()
 	code := c.Query("code")
-	oidcUser, err := getOidcUserInfoByCode(code)
+	oidcUser, err := getOidcUserInfoByCode(code, takeOidcCodeVerifier(c))
 	if err != nil {
 		common.ApiError(c, err)
 		return
 	}
+	if !isOidcEmailAllowed(settings, oidcUser) {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": "该邮箱未验证或域名不允许登录",
+		})
+		return
+	}
+	groupMapping := resolveOidcGroup(settings, oidcUser.Claims)
+	mappedGroup := ""
+	if groupMapping != nil {
+		mappedGroup = groupMapping.Group
+	}
+	mappedRole := resolveOidcRole(settings, oidcUser.Claims)
 	user := model.User{
 		OidcId: oidcUser.OpenID,
 	}
@@ -141,6 +325,14 @@ func OidcAuth(c *gin.Context) {
 			})
 			return
 		}
+	} else if scimUser, err := model.GetScimUserForLink("email", oidcUser.Email); err == nil && scimUser.OidcId == "" && oidcUser.EmailVerified() {
+		// 由 SCIM 预先创建的账号在首次 OIDC 登录时按已验证邮箱关联
+		user = *scimUser
+		user.OidcId = oidcUser.OpenID
+		if err := user.Update(false); err != nil {
+			common.ApiError(c, err)
+			return
+		}
 	} else {
 		if common.RegisterEnabled {
 			user.Email = oidcUser.Email
@@ -154,6 +346,8 @@ func OidcAuth(c *gin.Context) {
 			} else {
 				user.DisplayName = "OIDC User"
 			}
+			user.Group = mappedGroup
+			user.Role = mappedRole
 			err := user.Insert(0)
 			if err != nil {
 				c.JSON(http.StatusOK, gin.H{
@@ -178,6 +372,16 @@ func OidcAuth(c *gin.Context) {
 		})
 		return
 	}
+	// 每次登录按身份源的声明刷新分组与角色
+	if err := user.SyncGroupAndRole(mappedGroup, mappedRole); err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	if groupMapping != nil && groupMapping.ProvisionToken && groupMapping.Group != "" {
+		if _, err := model.EnsureUserGroupToken(user.Id, groupMapping.Group, "OIDC "+groupMapping.Group); err != nil {
+			common.SysLog(fmt.Sprintf("failed to provision token for user %d: %s", user.Id, err.Error()))
+		}
+	}
 	setupLogin(&user, c)
 }
 
@@ -190,11 +394,18 @@ func OidcBind(c *gin.Context) {
 		return
 	}
 	code := c.Query("code")
-	oidcUser, err := getOidcUserInfoByCode(code)
+	oidcUser, err := getOidcUserInfoByCode(code, takeOidcCodeVerifier(c))
 	if err != nil {
 		common.ApiError(c, err)
 		return
 	}
+	if !isOidcEmailAllowed(system_setting.GetOIDCSettings(), oidcUser) {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": "该邮箱未验证或域名不允许绑定",
+		})
+		return
+	}
 	user := model.User{
 		OidcId: oidcUser.OpenID,
 	}
@@ -0,0 +1,372 @@
+package controller
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/model"
+	"github.com/QuantumNous/new-api/service"
+	"github.com/QuantumNous/new-api/setting/operation_setting"
+
+	"github.com/gin-gonic/gin"
+)
+
+// PaymentProvider 充值支付渠道，易支付、Stripe 与 Creem 各自实现
+type PaymentProvider interface {
+	// Name 渠道名称，与回调事件登记中的 provider 一致
+	Name() string
+	// CreateOrder 创建充值订单并返回拉起支付所需的数据
+	CreateOrder(user *model.User, req *PaymentOrderRequest) (*PaymentCheckout, error)
+	// VerifyWebhook 校验回调签名并解析为统一的支付事件
+	VerifyWebhook(c *gin.Context) (*PaymentEvent, error)
+	// RespondWebhook 按渠道要求返回回调处理结果，err 非空时渠道会重试
+	RespondWebhook(c *gin.Context, err error)
+	// QueryOrder 向支付平台查询订单状态
+	QueryOrder(topUp *model.TopUp) (*PaymentOrderStatus, error)
+	// Refund 在支付平台退款，money 与 TopUp.Money 同单位
+	Refund(topUp *model.TopUp, money float64) error
+}
+
+type PaymentOrderRequest struct {
+	Amount        int64  `json:"amount"`
+	PaymentMethod string `json:"payment_method"`
+	ProductId     string `json:"product_id"`
+}
+
+// PaymentCheckout 拉起支付所需的数据，Url 非空时与 Data 一并返回（易支付表单提交地址）
+type PaymentCheckout struct {
+	Data any
+	Url  string
+}
+
+const (
+	PaymentEventPaid     = "paid"
+	PaymentEventExpired  = "expired"
+	PaymentEventRefunded = "refunded"
+	PaymentEventOther    = "other"
+)
+
+// PaymentEvent 统一的支付回调事件
+type PaymentEvent struct {
+	// 平台事件 ID，非空时同一事件只处理一次
+	Id   string
+	Type string
+	// 本地订单号；为空时按 ProviderPaymentId 查找订单
+	TradeNo           string
+	ProviderPaymentId string
+	Completion        model.TopUpCompletion
+	// 退款金额占订单金额的比例；RefundCumulative 为 true 时为累计退款比例
+	RefundRatio      float64
+	RefundCumulative bool
+	// 非充值事件（如订阅）的处理函数
+	Handle func() error
+}
+
+const (
+	PaymentOrderPending = "pending"
+	PaymentOrderPaid    = "paid"
+	PaymentOrderExpired = "expired"
+	PaymentOrderUnknown = "unknown"
+)
+
+type PaymentOrderStatus struct {
+	State      string
+	Completion model.TopUpCompletion
+}
+
+var (
+	errPaymentWebhookSignature = errors.New("invalid webhook signature")
+	errPaymentWebhookMalformed = errors.New("malformed webhook payload")
+	errPaymentNotSupported     = errors.New("该支付渠道不支持此操作")
+)
+
+var (
+	epayProvider   = &epayPaymentProvider{}
+	stripeProvider = &stripePaymentProvider{}
+	creemProvider  = &creemPaymentProvider{}
+)
+
+// paymentProviderForTopUp 按订单的支付方式找到对应渠道；订阅付款等非充值订单返回 nil
+func paymentProviderForTopUp(topUp *model.TopUp) PaymentProvider {
+	switch topUp.PaymentMethod {
+	case PaymentMethodStripe:
+		return stripeProvider
+	case PaymentMethodCreem, "":
+		return creemProvider
+	}
+	if operation_setting.ContainsPayMethod(topUp.PaymentMethod) {
+		return epayProvider
+	}
+	return nil
+}
+
+// paymentOrderResponse 按前端约定返回下单结果，失败时 data 为错误信息
+func paymentOrderResponse(c *gin.Context, checkout *PaymentCheckout, err error) {
+	if err != nil {
+		c.JSON(200, gin.H{"message": "error", "data": err.Error()})
+		return
+	}
+	resp := gin.H{"message": "success", "data": checkout.Data}
+	if checkout.Url != "" {
+		resp["url"] = checkout.Url
+	}
+	c.JSON(200, resp)
+}
+
+func requestPaymentOrder(c *gin.Context, provider PaymentProvider) {
+	var req PaymentOrderRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(200, gin.H{"message": "error", "data": "参数错误"})
+		return
+	}
+	user, err := model.GetUserById(c.GetInt("id"), false)
+	if err != nil {
+		c.JSON(200, gin.H{"message": "error", "data": "获取用户信息失败"})
+		return
+	}
+	checkout, err := provider.CreateOrder(user, &req)
+	paymentOrderResponse(c, checkout, err)
+}
+
+// handlePaymentWebhook 校验并处理支付回调，同一事件 ID 只处理一次，处理失败时撤销登记以便平台重试
+func handlePaymentWebhook(c *gin.Context, provider PaymentProvider) {
+	event, err := provider.VerifyWebhook(c)
+	if err != nil {
+		log.Printf("%s 回调校验失败: %v", provider.Name(), err)
+		provider.RespondWebhook(c, err)
+		return
+	}
+	provider.RespondWebhook(c, processPaymentEvent(provider, event))
+}
+
+func processPaymentEvent(provider PaymentProvider, event *PaymentEvent) error {
+	// 支付与退款事件在订单事务中登记，其余事件在处理前登记，处理失败时撤销
+	claimInTx := event.Type == PaymentEventPaid || event.Type == PaymentEventRefunded
+	if event.Id != "" && !claimInTx {
+		claimed, err := model.ClaimPaymentWebhookEvent(provider.Name(), event.Id, event.Type, event.TradeNo)
+		if err != nil {
+			return err
+		}
+		if !claimed {
+			return nil
+		}
+	}
+	err := applyPaymentEvent(provider, event)
+	if err != nil {
+		log.Printf("%s 回调处理失败: %s, 订单号: %s, err: %v", provider.Name(), event.Type, event.TradeNo, err)
+		if event.Id != "" && !claimInTx {
+			_ = model.ReleasePaymentWebhookEvent(provider.Name(), event.Id)
+		}
+	}
+	return err
+}
+
+// webhookEvent 返回需在订单事务中登记的回调事件，事件 ID 为空时返回 nil
+func (event *PaymentEvent) webhookEvent(provider PaymentProvider) *model.PaymentWebhookEvent {
+	if event.Id == "" {
+		return nil
+	}
+	return &model.PaymentWebhookEvent{
+		Provider:  provider.Name(),
+		EventId:   event.Id,
+		EventType: event.Type,
+		TradeNo:   event.TradeNo,
+	}
+}
+
+func applyPaymentEvent(provider PaymentProvider, event *PaymentEvent) error {
+	if event.Type == PaymentEventOther {
+		if event.Handle != nil {
+			return event.Handle()
+		}
+		return nil
+	}
+	if event.TradeNo == "" {
+		if topUp := model.GetTopUpByProviderPaymentId(event.ProviderPaymentId); topUp != nil {
+			event.TradeNo = topUp.TradeNo
+		}
+	}
+	if event.TradeNo == "" {
+		log.Printf("%s 回调未找到对应的充值订单: %s", provider.Name(), event.ProviderPaymentId)
+		return nil
+	}
+
+	LockOrder(event.TradeNo)
+	defer UnlockOrder(event.TradeNo)
+	var err error
+	switch event.Type {
+	case PaymentEventPaid:
+		if event.Completion.ProviderPaymentId == "" {
+			event.Completion.ProviderPaymentId = event.ProviderPaymentId
+		}
+		event.Completion.WebhookEvent = event.webhookEvent(provider)
+		err = model.CompleteTopUp(event.TradeNo, &event.Completion, fmt.Sprintf("使用 %s 在线充值", provider.Name()))
+	case PaymentEventExpired:
+		err = model.ExpireTopUp(event.TradeNo)
+	case PaymentEventRefunded:
+		topUp := model.GetTopUpByTradeNo(event.TradeNo)
+		if topUp == nil {
+			err = model.ErrTopUpNotFound
+			break
+		}
+		_, err = model.RefundTopUp(event.TradeNo, topUp.Money*event.RefundRatio, event.RefundCumulative, provider.Name()+" 退款通知", event.webhookEvent(provider))
+	}
+	// 订单不存在时重试也无法处理，记录后直接确认回调
+	if errors.Is(err, model.ErrTopUpNotFound) {
+		log.Printf("%s 回调的充值订单不存在: %s", provider.Name(), event.TradeNo)
+		return nil
+	}
+	return err
+}
+
+// respondWebhookStatus 以 HTTP 状态码应答回调：签名或格式错误返回 4xx，处理失败返回 500 以触发重试
+func respondWebhookStatus(c *gin.Context, err error) {
+	switch {
+	case err == nil:
+		c.Status(http.StatusOK)
+	case errors.Is(err, errPaymentWebhookSignature):
+		c.AbortWithStatus(http.StatusUnauthorized)
+	case errors.Is(err, errPaymentWebhookMalformed):
+		c.AbortWithStatus(http.StatusBadRequest)
+	default:
+		c.AbortWithStatus(http.StatusInternalServerError)
+	}
+}
+
+type AdminRefundTopUpRequest struct {
+	TradeNo string `json:"trade_no"`
+	// 退款金额，与订单支付金额同单位；为 0 时退还剩余全部金额
+	Money float64 `json:"money"`
+	// 为 true 时仅在本地记录退款并扣回额度（款项已在支付平台后台退还）
+	Offline bool   `json:"offline"`
+	Reason  string `json:"reason"`
+}
+
+// AdminRefundTopUp 管理员为充值订单退款并扣回对应额度
+func AdminRefundTopUp(c *gin.Context) {
+	var req AdminRefundTopUpRequest
+	if err := c.ShouldBindJSON(&req); err != nil || req.TradeNo == "" || req.Money < 0 {
+		common.ApiErrorMsg(c, "参数错误")
+		return
+	}
+
+	LockOrder(req.TradeNo)
+	defer UnlockOrder(req.TradeNo)
+
+	topUp := model.GetTopUpByTradeNo(req.TradeNo)
+	if topUp == nil {
+		common.ApiError(c, model.ErrTopUpNotFound)
+		return
+	}
+	if topUp.Status != common.TopUpStatusSuccess {
+		common.ApiErrorMsg(c, "只能对已完成的充值订单退款")
+		return
+	}
+	remaining := topUp.Money - topUp.RefundedMoney
+	money := req.Money
+	if money == 0 || money > remaining {
+		money = remaining
+	}
+	if money <= 0 {
+		common.ApiErrorMsg(c, "订单已全额退款")
+		return
+	}
+	// Creem 的退款通知按单笔金额扣回，线下记录后再收到通知会重复扣回，只能等待通知处理
+	if req.Offline && topUp.PaymentMethod == "creem" {
+		common.ApiErrorMsg(c, "Creem 订单请在 Creem 后台退款，收到退款通知后会自动扣回额度")
+		return
+	}
+	if !req.Offline {
+		provider := paymentProviderForTopUp(topUp)
+		if provider == nil {
+			common.ApiError(c, errPaymentNotSupported)
+			return
+		}
+		if err := provider.Refund(topUp, money); err != nil {
+			common.ApiError(c, err)
+			return
+		}
+	}
+	reason := req.Reason
+	if reason == "" {
+		reason = "管理员退款"
+	}
+	// 按累计退款金额记录，与随后到达的支付平台退款通知（同样按累计金额）重复时不会再次扣回
+	quota, err := model.RefundTopUp(req.TradeNo, topUp.RefundedMoney+money, true, reason, nil)
+	if err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	common.ApiSuccess(c, gin.H{"refunded_money": money, "deducted_quota": quota})
+}
+
+var autoReconcileTopUpsOnce sync.Once
+
+func AutomaticallyReconcilePendingTopUps() {
+	if !service.CanRunJobs() {
+		return
+	}
+	autoReconcileTopUpsOnce.Do(func() {
+		for {
+			setting := operation_setting.GetPaymentSetting()
+			interval := setting.ReconcileIntervalMinutes
+			if interval <= 0 {
+				interval = 5
+			}
+			time.Sleep(time.Duration(interval) * time.Minute)
+			if setting.ReconcileEnabled && service.IsJobLeader(service.JobTopUpReconcile) {
+				reconcilePendingTopUps()
+			}
+		}
+	})
+}
+
+// reconcilePendingTopUps 主动查询待支付订单，补全丢失的支付与过期回调，并将超时未支付的订单标记为过期
+func reconcilePendingTopUps() {
+	expireHours := operation_setting.GetPaymentSetting().PendingExpireHours
+	if expireHours <= 0 {
+		expireHours = 24
+	}
+	now := common.GetTimestamp()
+	expireBefore := now - int64(expireHours)*3600
+	// 刚创建的订单用户可能仍在支付，稍后再查
+	topUps, err := model.GetPendingTopUps(expireBefore, now-5*60, 200)
+	if err != nil {
+		common.SysLog("failed to query pending top-ups: " + err.Error())
+		return
+	}
+	for _, topUp := range topUps {
+		provider := paymentProviderForTopUp(topUp)
+		if provider == nil {
+			continue
+		}
+		status, err := provider.QueryOrder(topUp)
+		if err != nil {
+			if !errors.Is(err, errPaymentNotSupported) {
+				common.SysLog(fmt.Sprintf("failed to query %s order %s: %s", provider.Name(), topUp.TradeNo, err.Error()))
+			}
+			continue
+		}
+		switch status.State {
+		case PaymentOrderPaid:
+			err = applyPaymentEvent(provider, &PaymentEvent{Type: PaymentEventPaid, TradeNo: topUp.TradeNo, Completion: status.Completion})
+		case PaymentOrderExpired:
+			err = applyPaymentEvent(provider, &PaymentEvent{Type: PaymentEventExpired, TradeNo: topUp.TradeNo})
+		}
+		if err != nil {
+			common.SysLog(fmt.Sprintf("failed to reconcile %s order %s: %s", provider.Name(), topUp.TradeNo, err.Error()))
+		}
+	}
+	if _, err := model.ExpireTopUps(expireBefore); err != nil {
+		common.SysLog("failed to expire pending top-ups: " + err.Error())
+	}
+	// 回调事件登记只需覆盖平台的重试窗口
+	if err := model.CleanupPaymentWebhookEvents(now - 30*24*3600); err != nil {
+		common.SysLog("failed to clean up payment webhook events: " + err.Error())
+	}
+}
@@ -0,0 +1,89 @@
+package controller
+
+import (
+	"fmt"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/model"
+	"github.com/QuantumNous/new-api/service"
+	"github.com/QuantumNous/new-api/setting/operation_setting"
+
+	"github.com/gin-gonic/gin"
+)
+
+func GetQuotaLedgers(c *gin.Context) {
+	pageInfo := common.GetPageQuery(c)
+	userId, _ := strconv.Atoi(c.Query("user_id"))
+	ledgerType := c.Query("type")
+	startTimestamp, _ := strconv.ParseInt(c.Query("start_timestamp"), 10, 64)
+	endTimestamp, _ := strconv.ParseInt(c.Query("end_timestamp"), 10, 64)
+	ledgers, total, err := model.GetQuotaLedgers(userId, ledgerType, startTimestamp, endTimestamp, pageInfo.GetStartIdx(), pageInfo.GetPageSize())
+	if err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	pageInfo.SetTotal(int(total))
+	pageInfo.SetItems(ledgers)
+	common.ApiSuccess(c, pageInfo)
+}
+
+func GetSelfQuotaLedgers(c *gin.Context) {
+	pageInfo := common.GetPageQuery(c)
+	userId := c.GetInt("id")
+	ledgerType := c.Query("type")
+	startTimestamp, _ := strconv.ParseInt(c.Query("start_timestamp"), 10, 64)
+	endTimestamp, _ := strconv.ParseInt(c.Query("end_timestamp"), 10, 64)
+	ledgers, total, err := model.GetQuotaLedgers(userId, ledgerType, startTimestamp, endTimestamp, pageInfo.GetStartIdx(), pageInfo.GetPageSize())
+	if err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	pageInfo.SetTotal(int(total))
+	pageInfo.SetItems(ledgers)
+	common.ApiSuccess(c, pageInfo)
+}
+
+func GetQuotaLedgerDrifts(c *gin.Context) {
+	pageInfo := common.GetPageQuery(c)
+	userId, _ := strconv.Atoi(c.Query("user_id"))
+	drifts, total, err := model.GetQuotaLedgerDrifts(userId, pageInfo.GetStartIdx(), pageInfo.GetPageSize())
+	if err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	pageInfo.SetTotal(int(total))
+	pageInfo.SetItems(drifts)
+	common.ApiSuccess(c, pageInfo)
+}
+
+var autoReconcileQuotaLedgerOnce sync.Once
+
+func AutomaticallyReconcileQuotaLedger() {
+	if !service.CanRunJobs() {
+		return
+	}
+	autoReconcileQuotaLedgerOnce.Do(func() {
+		for {
+			setting := operation_setting.GetQuotaLedgerSetting()
+			interval := setting.ReconcileIntervalMinutes
+			if interval <= 0 {
+				interval = 60
+			}
+			time.Sleep(time.Duration(interval) * time.Minute)
+			if !setting.Enabled || !setting.ReconcileEnabled || !service.IsJobLeader(service.JobQuotaLedgerReconcile) {
+				continue
+			}
+			drifts, err := model.ReconcileQuotaLedger()
+			if err != nil {
+				common.SysLog("failed to reconcile quota ledger: " + err.Error())
+				continue
+			}
+			for _, drift := range drifts {
+				common.SysLog(fmt.Sprintf("quota ledger drift detected: user_id=%d, balance=%d, ledger_balance=%d, drift=%d", drift.UserId, drift.Balance, drift.LedgerBalance, drift.Drift))
+			}
+		}
+	})
+}
@@ -85,6 +85,7 @@ func Relay(c *gin.Context, relayFormat types.RelayFormat) {
 	defer func() {
 		if newAPIError != nil {
 			logger.LogError(c, fmt.Sprintf("relay error: %s", newAPIError.Error()))
+			newAPIError.Localize(service.GetErrorLanguage(c))
 			newAPIError.SetMessage(common.MessageWithRequestId(newAPIError.Error(), requestId))
 			switch relayFormat {
 			case types.RelayFormatOpenAIRealtime:
@@ -157,6 +158,10 @@ func Relay(c *gin.Context, relayFormat types.RelayFormat) {
 		}
 	}()
 
+	defer func() {
+		recordModelStatus(originalModel, relayInfo.UsingGroup, newAPIError)
+	}()
+
 	for i := 0; i <= common.RetryTimes; i++ {
 		channel, err := getChannel(c, group, originalModel, i)
 		if err != nil {
@@ -165,22 +170,30 @@ func Relay(c *gin.Context, relayFormat types.RelayFormat) {
 			break
 		}
 
+		if modelName := common.GetContextKeyString(c, constant.ContextKeyOriginalModel); modelName != originalModel {
+			// 重试时路由目标模型已无可用渠道，回退到请求的模型，按回退后的模型重新计价
+			originalModel = modelName
+			relayInfo.OriginModelName = modelName
+			if _, err := helper.ModelPriceHelper(c, relayInfo, tokens, meta); err != nil {
+				newAPIError = types.NewError(err, types.ErrorCodeModelPriceError)
+				break
+			}
+		}
+
 		addUsedChannel(c, channel.Id)
 		requestBody, _ := common.GetRequestBody(c)
 		c.Request.Body = io.NopCloser(bytes.NewBuffer(requestBody))
 
-		switch relayFormat {
-		case types.RelayFormatOpenAIRealtime:
-			newAPIError = relay.WssHelper(c, relayInfo)
-		case types.RelayFormatClaude:
-			newAPIError = relay.ClaudeHelper(c, relayInfo)
-		case types.RelayFormatGemini:
-			newAPIError = geminiRelayHandler(c, relayInfo)
-		default:
-			newAPIError = relayHandler(c, relayInfo)
+		if i == 0 && shouldHedge(c, relayFormat, channel, group) {
+			channel, newAPIError = relayWithHedge(c, relayFormat, relayInfo, channel, group, originalModel)
+		} else {
+			newAPIError = relayByFormat(c, relayFormat, relayInfo)
 		}
 
 		if newAPIError == nil {
+			if common.GetContextKeyBool(c, constant.ContextKeyChannelIsMultiKey) {
+				model.ResetChannelKeyCooldown(channel.Id, common.GetContextKeyInt(c, constant.ContextKeyChannelMultiKeyIndex))
+			}
 			return
 		}
 
@@ -205,6 +218,19 @@ var upgrader = websocket.Upgrader{
 	},
 }
 
+func relayByFormat(c *gin.Context, relayFormat types.RelayFormat, relayInfo *relaycommon.RelayInfo) *types.NewAPIError {
+	switch relayFormat {
+	case types.RelayFormatOpenAIRealtime:
+		return relay.WssHelper(c, relayInfo)
+	case types.RelayFormatClaude:
+		return relay.ClaudeHelper(c, relayInfo)
+	case types.RelayFormatGemini:
+		return geminiRelayHandler(c, relayInfo)
+	default:
+		return relayHandler(c, relayInfo)
+	}
+}
+
 func addUsedChannel(c *gin.Context, channelId int) {
 	useChannel := c.GetStringSlice("use_channel")
 	useChannel = append(useChannel, fmt.Sprintf("%d", channelId))
@@ -225,14 +251,15 @@ func getChannel(c *gin.Context, group, originalModel string, retryCount int) (*m
 			AutoBan: &autoBanInt,
 		}, nil
 	}
-	channel, selectGroup, err := service.CacheGetRandomSatisfiedChannel(c, group, originalModel, retryCount)
+	channel, selectGroup, modelName, err := service.CacheGetRoutedChannel(c, group, originalModel, retryCount)
 	if err != nil {
-		return nil, types.NewError(fmt.Errorf("获取分组 %s 下模型 %s 的可用渠道失败（retry）: %s", selectGroup, originalModel, err.Error()), types.ErrorCodeGetChannelFailed, types.ErrOptionWithSkipRetry())
+		logger.LogError(c, fmt.Sprintf("获取分组 %s 下模型 %s 的可用渠道失败（retry）: %s", selectGroup, originalModel, err.Error()))
+		return nil, types.NewLocalizedError(types.ErrorCodeGetChannelFailed, http.StatusInternalServerError, []any{originalModel, selectGroup}, types.ErrOptionWithSkipRetry())
 	}
 	if channel == nil {
-		return nil, types.NewError(fmt.Errorf("分组 %s 下模型 %s 的可用渠道不存在（retry）", selectGroup, originalModel), types.ErrorCodeGetChannelFailed, types.ErrOptionWithSkipRetry())
+		return nil, types.NewLocalizedError(types.ErrorCodeGetChannelFailed, http.StatusInternalServerError, []any{originalModel, selectGroup}, types.ErrOptionWithSkipRetry())
 	}
-	newAPIError := middleware.SetupContextForSelectedChannel(c, channel, originalModel)
+	newAPIError := middleware.SetupContextForSelectedChannel(c, channel, modelName)
 	if newAPIError != nil {
 		return nil, newAPIError
 	}
@@ -285,6 +312,9 @@ func processChannelError(c *gin.Context, channelError types.ChannelError, err *t
 	logger.LogError(c, fmt.Sprintf("channel error (channel #%d, status code: %d): %s", channelError.ChannelId, err.StatusCode, err.Error()))
 	// 不要使用context获取渠道信息，异步处理时可能会出现渠道信息不一致的情况
 	// do not use context to get channel info, there may be inconsistent channel info when processing asynchronously
+	if err.StatusCode == http.StatusTooManyRequests && common.GetContextKeyBool(c, constant.ContextKeyChannelIsMultiKey) {
+		service.CooldownChannelKey(channelError.ChannelId, common.GetContextKeyInt(c, constant.ContextKeyChannelMultiKeyIndex), err.RetryAfter)
+	}
 	if service.ShouldDisableChannel(channelError.ChannelId, err) && channelError.AutoBan {
 		gopool.Go(func() {
 			service.DisableChannel(channelError, err.Error())
@@ -407,6 +437,7 @@ func RelayTask(c *gin.Context) {
 		channel, newAPIError := getChannel(c, group, originalModel, i)
 		if newAPIError != nil {
 			logger.LogError(c, fmt.Sprintf("CacheGetRandomSatisfiedChannel failed: %s", newAPIError.Error()))
+			newAPIError.Localize(service.GetErrorLanguage(c))
 			taskErr = service.TaskErrorWrapperLocal(newAPIError.Err, "get_channel_failed", http.StatusInternalServerError)
 			break
 		}
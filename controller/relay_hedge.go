@@ -0,0 +1,136 @@
+package controller
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/constant"
+	"github.com/QuantumNous/new-api/logger"
+	"github.com/QuantumNous/new-api/middleware"
+	"github.com/QuantumNous/new-api/model"
+	relaycommon "github.com/QuantumNous/new-api/relay/common"
+	"github.com/QuantumNous/new-api/service"
+	"github.com/QuantumNous/new-api/setting/operation_setting"
+	"github.com/QuantumNous/new-api/types"
+
+	"github.com/gin-gonic/gin"
+)
+
+// 这些渠道的适配器不经过 channel.DoApiRequest 发送请求，无法在写回下游前确定胜出方，不参与对冲
+var hedgeUnsupportedChannelTypes = map[int]bool{
+	constant.ChannelTypeAws:       true,
+	constant.ChannelTypeXunfei:    true,
+	constant.ChannelTypeSimulator: true,
+}
+
+// shouldHedge 实时接口、指定渠道的请求以及不支持对冲的渠道不做对冲
+func shouldHedge(c *gin.Context, relayFormat types.RelayFormat, channel *model.Channel, group string) bool {
+	if relayFormat == types.RelayFormatOpenAIRealtime || hedgeUnsupportedChannelTypes[channel.Type] {
+		return false
+	}
+	if _, ok := c.Get("specific_channel_id"); ok {
+		return false
+	}
+	return operation_setting.ShouldHedge(group, common.GetContextKeyBool(c, constant.ContextKeyTokenHedgeEnabled))
+}
+
+// relayWithHedge 在首个渠道上发起请求，若超过阈值仍未收到上游响应，则在另一个渠道上并行发起对冲请求，
+// 先收到响应的一方胜出并写回下游，落败方被取消且不计费。返回最终结果所属的渠道及其错误
+func relayWithHedge(c *gin.Context, relayFormat types.RelayFormat, relayInfo *relaycommon.RelayInfo, channel *model.Channel, group, originalModel string) (*model.Channel, *types.NewAPIError) {
+	threshold := time.Duration(operation_setting.GetHedgeSetting().ThresholdMs) * time.Millisecond
+	race := relaycommon.NewHedgeRace(threshold)
+	defer c.Set(string(constant.ContextKeyHedgeAttempt), nil)
+
+	// 两个请求可能同时在等待上游，不能各自向下游发送 ping；流式响应头由胜出方在 Claim 成功后设置
+	relayInfo.DisablePing = true
+
+	primary := race.NewAttempt(c.Request.Context(), channel.Id)
+	defer primary.Release()
+	common.SetContextKey(c, constant.ContextKeyHedgeAttempt, primary)
+
+	// 在主请求开始前复制上下文，避免与主请求并发读写 c.Keys
+	hedgeCtx := c.Copy()
+	hedgeCtx.Writer = middleware.WithResponseOverrideContext(c.Writer, hedgeCtx)
+	hedgeCtx.Request = c.Request.Clone(c.Request.Context())
+	requestBody, _ := common.GetRequestBody(c)
+	hedgeCtx.Request.Body = io.NopCloser(bytes.NewBuffer(requestBody))
+	hedgeInfo := relayInfo.Clone()
+
+	primaryDone := runHedgeAttempt(c, relayFormat, relayInfo)
+	select {
+	case err := <-primaryDone:
+		return channel, err
+	case <-race.Claimed():
+		return channel, <-primaryDone
+	case <-time.After(threshold):
+	}
+
+	hedgeChannel := selectHedgeChannel(hedgeCtx, group, originalModel, channel.Id)
+	if hedgeChannel == nil || race.Winner() != nil {
+		return channel, <-primaryDone
+	}
+	hedge := race.NewAttempt(c.Request.Context(), hedgeChannel.Id)
+	defer hedge.Release()
+	common.SetContextKey(hedgeCtx, constant.ContextKeyHedgeAttempt, hedge)
+	addUsedChannel(hedgeCtx, hedgeChannel.Id)
+	logger.LogInfo(c, fmt.Sprintf("渠道 #%d 超过 %dms 未响应，对冲请求渠道 #%d", channel.Id, threshold.Milliseconds(), hedgeChannel.Id))
+
+	hedgeDone := runHedgeAttempt(hedgeCtx, relayFormat, hedgeInfo)
+	primaryErr := <-primaryDone
+	hedgeErr := <-hedgeDone
+
+	switch race.Winner() {
+	case hedge:
+		// 主渠道在对冲胜出前已自行失败时，其错误仍需计入渠道状态；因落败被取消的不算
+		if primaryErr != nil && primaryErr.GetErrorCode() != types.ErrorCodeHedgeLost && primary.Ctx.Err() == nil {
+			processChannelError(c, *types.NewChannelError(channel.Id, channel.Type, channel.Name, channel.ChannelInfo.IsMultiKey, common.GetContextKeyString(c, constant.ContextKeyChannelKey), channel.GetAutoBan()), primaryErr)
+		}
+		// 以胜出方的上下文和 relayInfo 作为后续处理依据
+		for k, v := range hedgeCtx.Keys {
+			c.Set(k, v)
+		}
+		*relayInfo = *hedgeInfo
+		return hedgeChannel, hedgeErr
+	case nil:
+		// 双方均失败，对冲渠道的错误在此处理，主渠道的错误交给外层重试
+		addUsedChannel(c, hedgeChannel.Id)
+		if hedgeErr != nil {
+			processChannelError(hedgeCtx, *types.NewChannelError(hedgeChannel.Id, hedgeChannel.Type, hedgeChannel.Name, hedgeChannel.ChannelInfo.IsMultiKey, common.GetContextKeyString(hedgeCtx, constant.ContextKeyChannelKey), hedgeChannel.GetAutoBan()), hedgeErr)
+		}
+	}
+	return channel, primaryErr
+}
+
+// runHedgeAttempt 在独立的 goroutine 中执行请求，panic 会被转换为错误
+func runHedgeAttempt(c *gin.Context, relayFormat types.RelayFormat, relayInfo *relaycommon.RelayInfo) <-chan *types.NewAPIError {
+	done := make(chan *types.NewAPIError, 1)
+	go func() {
+		defer func() {
+			if r := recover(); r != nil {
+				common.SysError(fmt.Sprintf("hedged relay panic: %v", r))
+				done <- types.NewErrorWithStatusCode(fmt.Errorf("hedged relay panic: %v", r), types.ErrorCodeDoRequestFailed, http.StatusInternalServerError, types.ErrOptionWithSkipRetry())
+			}
+		}()
+		done <- relayByFormat(c, relayFormat, relayInfo)
+	}()
+	return done
+}
+
+// selectHedgeChannel 选择与主请求不同的渠道，并写入对冲请求的上下文
+func selectHedgeChannel(c *gin.Context, group, originalModel string, excludeChannelId int) *model.Channel {
+	for retry := 0; retry <= common.RetryTimes; retry++ {
+		channel, _, err := service.CacheGetRandomSatisfiedChannel(c, group, originalModel, retry)
+		if err != nil || channel == nil || channel.Id == excludeChannelId || hedgeUnsupportedChannelTypes[channel.Type] {
+			continue
+		}
+		if newAPIError := middleware.SetupContextForSelectedChannel(c, channel, originalModel); newAPIError != nil {
+			continue
+		}
+		return channel
+	}
+	return nil
+}
@@ -0,0 +1,1002 @@
+package controller
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/model"
+	"github.com/QuantumNous/new-api/setting/ratio_setting"
+	"github.com/QuantumNous/new-api/setting/system_setting"
+
+	"github.com/gin-gonic/gin"
+)
+
+// SCIM 2.0 (RFC 7643 / RFC 7644) 用户与组同步接口，供 Okta、Entra ID 等身份提供方调用
+
+const (
+	scimContentType        = "application/scim+json; charset=utf-8"
+	scimSchemaUser         = "urn:ietf:params:scim:schemas:core:2.0:User"
+	scimSchemaGroup        = "urn:ietf:params:scim:schemas:core:2.0:Group"
+	scimSchemaListResponse = "urn:ietf:params:scim:api:messages:2.0:ListResponse"
+	scimSchemaError        = "urn:ietf:params:scim:api:messages:2.0:Error"
+	scimSchemaSPConfig     = "urn:ietf:params:scim:schemas:core:2.0:ServiceProviderConfig"
+	scimSchemaResourceType = "urn:ietf:params:scim:schemas:core:2.0:ResourceType"
+
+	scimDefaultPageSize = 100
+	scimMaxPageSize     = 200
+	scimMaxNameLength   = 191
+)
+
+type ScimMeta struct {
+	ResourceType string `json:"resourceType"`
+	Created      string `json:"created,omitempty"`
+	LastModified string `json:"lastModified,omitempty"`
+	Location     string `json:"location,omitempty"`
+}
+
+type ScimName struct {
+	Formatted  string `json:"formatted,omitempty"`
+	GivenName  string `json:"givenName,omitempty"`
+	FamilyName string `json:"familyName,omitempty"`
+}
+
+type ScimEmail struct {
+	Value   string `json:"value"`
+	Type    string `json:"type,omitempty"`
+	Primary bool   `json:"primary,omitempty"`
+}
+
+type ScimReference struct {
+	Value   string `json:"value"`
+	Display string `json:"display,omitempty"`
+	Ref     string `json:"$ref,omitempty"`
+}
+
+type ScimUser struct {
+	Schemas     []string        `json:"schemas"`
+	Id          string          `json:"id,omitempty"`
+	ExternalId  string          `json:"externalId,omitempty"`
+	UserName    string          `json:"userName"`
+	Name        *ScimName       `json:"name,omitempty"`
+	DisplayName string          `json:"displayName,omitempty"`
+	Emails      []ScimEmail     `json:"emails,omitempty"`
+	Active      *bool           `json:"active,omitempty"`
+	Groups      []ScimReference `json:"groups,omitempty"`
+	Meta        *ScimMeta       `json:"meta,omitempty"`
+}
+
+type ScimGroup struct {
+	Schemas     []string        `json:"schemas"`
+	Id          string          `json:"id,omitempty"`
+	ExternalId  string          `json:"externalId,omitempty"`
+	DisplayName string          `json:"displayName"`
+	Members     []ScimReference `json:"members,omitempty"`
+	Meta        *ScimMeta       `json:"meta,omitempty"`
+}
+
+type ScimListResponse struct {
+	Schemas      []string `json:"schemas"`
+	TotalResults int64    `json:"totalResults"`
+	StartIndex   int      `json:"startIndex"`
+	ItemsPerPage int      `json:"itemsPerPage"`
+	Resources    []any    `json:"Resources"`
+}
+
+type ScimPatchRequest struct {
+	Schemas    []string             `json:"schemas"`
+	Operations []ScimPatchOperation `json:"Operations"`
+}
+
+type ScimPatchOperation struct {
+	Op    string          `json:"op"`
+	Path  string          `json:"path"`
+	Value json.RawMessage `json:"value"`
+}
+
+type ScimError struct {
+	Schemas  []string `json:"schemas"`
+	Status   string   `json:"status"`
+	ScimType string   `json:"scimType,omitempty"`
+	Detail   string   `json:"detail,omitempty"`
+}
+
+var (
+	scimFilterRegex        = regexp.MustCompile(`(?i)^\s*([a-z][\w.:]*)\s+eq\s+("(?:[^"\\]|\\.)*")\s*$`)
+	scimMemberPathRegex    = regexp.MustCompile(`(?i)^members\[\s*value\s+eq\s+"([^"]*)"\s*]$`)
+	scimUserFilterColumns  = map[string]string{"username": "username", "externalid": "scim_external_id", "emails": "email", "emails.value": "email"}
+	scimGroupFilterColumns = map[string]string{"displayname": "display_name", "externalid": "external_id"}
+)
+
+func scimRespond(c *gin.Context, status int, v any) {
+	c.Header("Content-Type", scimContentType)
+	c.JSON(status, v)
+}
+
+func scimError(c *gin.Context, status int, scimType string, detail string) {
+	scimRespond(c, status, ScimError{
+		Schemas:  []string{scimSchemaError},
+		Status:   strconv.Itoa(status),
+		ScimType: scimType,
+		Detail:   detail,
+	})
+}
+
+func scimInternalError(c *gin.Context, err error) {
+	common.SysLog("SCIM request failed: " + err.Error())
+	scimError(c, http.StatusInternalServerError, "", "internal server error")
+}
+
+func scimLocation(resource string, id int) string {
+	return strings.TrimRight(system_setting.ServerAddress, "/") + "/scim/v2/" + resource + "/" + strconv.Itoa(id)
+}
+
+func scimTime(timestamp int64) string {
+	if timestamp == 0 {
+		return ""
+	}
+	return time.Unix(timestamp, 0).UTC().Format(time.RFC3339)
+}
+
+// scimPagination 将 1 起始的 startIndex 和 count 转换为 offset 和 limit
+func scimPagination(c *gin.Context) (startIndex int, count int) {
+	startIndex, _ = strconv.Atoi(c.Query("startIndex"))
+	if startIndex < 1 {
+		startIndex = 1
+	}
+	count = scimDefaultPageSize
+	if value := c.Query("count"); value != "" {
+		if n, err := strconv.Atoi(value); err == nil {
+			count = n
+		}
+	}
+	if count < 0 {
+		count = 0
+	}
+	if count > scimMaxPageSize {
+		count = scimMaxPageSize
+	}
+	return startIndex, count
+}
+
+// parseScimFilter 解析 attribute eq "value" 形式的过滤条件，返回对应的数据库列
+func parseScimFilter(filter string, columns map[string]string) (string, string, error) {
+	if strings.TrimSpace(filter) == "" {
+		return "", "", nil
+	}
+	matches := scimFilterRegex.FindStringSubmatch(filter)
+	if matches == nil {
+		return "", "", errors.New(`only filters of the form 'attribute eq "value"' are supported`)
+	}
+	column, ok := columns[strings.ToLower(matches[1])]
+	if !ok {
+		return "", "", fmt.Errorf("unsupported filter attribute: %s", matches[1])
+	}
+	value, err := strconv.Unquote(matches[2])
+	if err != nil {
+		return "", "", errors.New("invalid filter value")
+	}
+	return column, value, nil
+}
+
+func scimResourceId(c *gin.Context) (int, bool) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil || id <= 0 {
+		return 0, false
+	}
+	return id, true
+}
+
+// scimBool 解析布尔值，部分身份提供方会以字符串 "True"/"False" 发送
+func scimBool(raw json.RawMessage) (bool, error) {
+	var value bool
+	if err := common.Unmarshal(raw, &value); err == nil {
+		return value, nil
+	}
+	var text string
+	if err := common.Unmarshal(raw, &text); err != nil {
+		return false, errors.New("invalid boolean value")
+	}
+	return strconv.ParseBool(strings.TrimSpace(text))
+}
+
+func scimString(raw json.RawMessage) (string, error) {
+	var value string
+	if err := common.Unmarshal(raw, &value); err != nil {
+		return "", errors.New("invalid string value")
+	}
+	return value, nil
+}
+
+func ScimServiceProviderConfig(c *gin.Context) {
+	scimRespond(c, http.StatusOK, gin.H{
+		"schemas":        []string{scimSchemaSPConfig},
+		"patch":          gin.H{"supported": true},
+		"bulk":           gin.H{"supported": false, "maxOperations": 0, "maxPayloadSize": 0},
+		"filter":         gin.H{"supported": true, "maxResults": scimMaxPageSize},
+		"changePassword": gin.H{"supported": false},
+		"sort":           gin.H{"supported": false},
+		"etag":           gin.H{"supported": false},
+		"authenticationSchemes": []gin.H{{
+			"type":        "oauthbearertoken",
+			"name":        "OAuth Bearer Token",
+			"description": "Authentication using the SCIM token configured in system settings",
+		}},
+		"meta": gin.H{"resourceType": "ServiceProviderConfig"},
+	})
+}
+
+func ScimResourceTypes(c *gin.Context) {
+	resources := []any{
+		gin.H{"schemas": []string{scimSchemaResourceType}, "id": "User", "name": "User", "endpoint": "/Users", "schema": scimSchemaUser},
+		gin.H{"schemas": []string{scimSchemaResourceType}, "id": "Group", "name": "Group", "endpoint": "/Groups", "schema": scimSchemaGroup},
+	}
+	scimRespond(c, http.StatusOK, ScimListResponse{
+		Schemas:      []string{scimSchemaListResponse},
+		TotalResults: int64(len(resources)),
+		StartIndex:   1,
+		ItemsPerPage: len(resources),
+		Resources:    resources,
+	})
+}
+
+// ---------- Users ----------
+
+func scimUserResource(user *model.User) ScimUser {
+	active := user.Status == common.UserStatusEnabled
+	resource := ScimUser{
+		Schemas:     []string{scimSchemaUser},
+		Id:          strconv.Itoa(user.Id),
+		ExternalId:  user.ScimExternalId,
+		UserName:    user.Username,
+		DisplayName: user.DisplayName,
+		Active:      &active,
+		Meta:        &ScimMeta{ResourceType: "User", Location: scimLocation("Users", user.Id)},
+	}
+	if user.DisplayName != "" {
+		resource.Name = &ScimName{Formatted: user.DisplayName}
+	}
+	if user.Email != "" {
+		resource.Emails = []ScimEmail{{Value: user.Email, Type: "work", Primary: true}}
+	}
+	groups, err := model.GetUserScimGroups(user.Id)
+	if err != nil {
+		common.SysLog(fmt.Sprintf("failed to get SCIM groups of user %d: %s", user.Id, err.Error()))
+	}
+	for _, group := range groups {
+		resource.Groups = append(resource.Groups, ScimReference{
+			Value:   strconv.Itoa(group.Id),
+			Display: group.DisplayName,
+			Ref:     scimLocation("Groups", group.Id),
+		})
+	}
+	return resource
+}
+
+func scimPrimaryEmail(emails []ScimEmail) string {
+	for _, email := range emails {
+		if email.Primary {
+			return strings.TrimSpace(email.Value)
+		}
+	}
+	if len(emails) > 0 {
+		return strings.TrimSpace(emails[0].Value)
+	}
+	return ""
+}
+
+func scimDisplayName(resource *ScimUser) string {
+	if name := strings.TrimSpace(resource.DisplayName); name != "" {
+		return name
+	}
+	if resource.Name != nil {
+		if name := strings.TrimSpace(resource.Name.Formatted); name != "" {
+			return name
+		}
+		if name := strings.TrimSpace(resource.Name.GivenName + " " + resource.Name.FamilyName); name != "" {
+			return name
+		}
+	}
+	return resource.UserName
+}
+
+// validateScimUser 校验资源并检查用户名是否已被其他用户（包括已删除用户）占用
+func validateScimUser(c *gin.Context, resource *ScimUser, currentUsername string) bool {
+	resource.UserName = strings.TrimSpace(resource.UserName)
+	if resource.UserName == "" {
+		scimError(c, http.StatusBadRequest, "invalidValue", "userName is required")
+		return false
+	}
+	if len(resource.UserName) > scimMaxNameLength || len(resource.ExternalId) > scimMaxNameLength {
+		scimError(c, http.StatusBadRequest, "invalidValue", "userName or externalId is too long")
+		return false
+	}
+	if resource.UserName != currentUsername {
+		exist, err := model.CheckUserExistOrDeleted(resource.UserName, "")
+		if err != nil {
+			scimInternalError(c, err)
+			return false
+		}
+		if exist {
+			scimError(c, http.StatusConflict, "uniqueness", "userName is already taken")
+			return false
+		}
+	}
+	return true
+}
+
+// saveScimUser 将资源属性写入用户，active 由真变假时停用账号并撤销全部令牌
+func saveScimUser(c *gin.Context, user *model.User, resource *ScimUser) bool {
+	wasActive := user.Status == common.UserStatusEnabled
+	user.Username = resource.UserName
+	user.DisplayName = scimDisplayName(resource)
+	user.Email = scimPrimaryEmail(resource.Emails)
+	if resource.ExternalId != "" {
+		user.ScimExternalId = resource.ExternalId
+	}
+	active := wasActive
+	if resource.Active != nil {
+		active = *resource.Active
+	}
+	if active {
+		user.Status = common.UserStatusEnabled
+	} else {
+		user.Status = common.UserStatusDisabled
+	}
+	if err := user.UpdateScimAttributes(); err != nil {
+		scimInternalError(c, err)
+		return false
+	}
+	if wasActive && !active {
+		if _, err := model.DeprovisionUser(user.Id); err != nil {
+			scimInternalError(c, err)
+			return false
+		}
+	} else if !wasActive && active {
+		model.RecordLog(user.Id, model.LogTypeManage, "用户已被身份提供方重新启用")
+	}
+	return true
+}
+
+func ScimListUsers(c *gin.Context) {
+	column, value, err := parseScimFilter(c.Query("filter"), scimUserFilterColumns)
+	if err != nil {
+		scimError(c, http.StatusBadRequest, "invalidFilter", err.Error())
+		return
+	}
+	startIndex, count := scimPagination(c)
+	users, total, err := model.GetScimUsers(column, value, startIndex-1, count)
+	if err != nil {
+		scimInternalError(c, err)
+		return
+	}
+	resources := make([]any, 0, len(users))
+	for _, user := range users {
+		resources = append(resources, scimUserResource(user))
+	}
+	scimRespond(c, http.StatusOK, ScimListResponse{
+		Schemas:      []string{scimSchemaListResponse},
+		TotalResults: total,
+		StartIndex:   startIndex,
+		ItemsPerPage: len(resources),
+		Resources:    resources,
+	})
+}
+
+func ScimGetUser(c *gin.Context) {
+	user, ok := scimLoadUser(c)
+	if !ok {
+		return
+	}
+	scimRespond(c, http.StatusOK, scimUserResource(user))
+}
+
+func scimLoadUser(c *gin.Context) (*model.User, bool) {
+	id, ok := scimResourceId(c)
+	if !ok {
+		scimError(c, http.StatusNotFound, "", "user not found")
+		return nil, false
+	}
+	user, err := model.GetScimUserById(id)
+	if err != nil {
+		if errors.Is(err, model.ErrScimUserNotFound) {
+			scimError(c, http.StatusNotFound, "", "user not found")
+		} else {
+			scimInternalError(c, err)
+		}
+		return nil, false
+	}
+	return user, true
+}
+
+func ScimCreateUser(c *gin.Context) {
+	var resource ScimUser
+	if err := common.DecodeJson(c.Request.Body, &resource); err != nil {
+		scimError(c, http.StatusBadRequest, "invalidSyntax", "invalid request body")
+		return
+	}
+	if !validateScimUser(c, &resource, "") {
+		return
+	}
+	settings := system_setting.GetSCIMSettings()
+	user := model.User{
+		Username:       resource.UserName,
+		DisplayName:    scimDisplayName(&resource),
+		Email:          scimPrimaryEmail(resource.Emails),
+		ScimExternalId: resource.ExternalId,
+		// 账号通过 LDAP、OIDC 等外部方式登录，本地密码随机生成
+		Password: common.GetRandomString(32),
+		Group:    settings.DefaultGroup,
+		Status:   common.UserStatusEnabled,
+	}
+	if user.ScimExternalId == "" {
+		user.ScimExternalId = resource.UserName
+	}
+	if resource.Active != nil && !*resource.Active {
+		user.Status = common.UserStatusDisabled
+	}
+	if err := user.Insert(0); err != nil {
+		scimInternalError(c, err)
+		return
+	}
+	model.RecordLog(user.Id, model.LogTypeManage, "用户由身份提供方通过 SCIM 创建")
+	c.Header("Location", scimLocation("Users", user.Id))
+	scimRespond(c, http.StatusCreated, scimUserResource(&user))
+}
+
+func ScimReplaceUser(c *gin.Context) {
+	user, ok := scimLoadUser(c)
+	if !ok {
+		return
+	}
+	var resource ScimUser
+	if err := common.DecodeJson(c.Request.Body, &resource); err != nil {
+		scimError(c, http.StatusBadRequest, "invalidSyntax", "invalid request body")
+		return
+	}
+	if !validateScimUser(c, &resource, user.Username) || !saveScimUser(c, user, &resource) {
+		return
+	}
+	scimRespond(c, http.StatusOK, scimUserResource(user))
+}
+
+// applyScimUserPatch 将单个 PATCH 操作应用到用户资源上
+func applyScimUserPatch(resource *ScimUser, op string, path string, value json.RawMessage) error {
+	if path == "" {
+		// 无 path 时 value 为属性到值的映射
+		var attributes map[string]json.RawMessage
+		if err := common.Unmarshal(value, &attributes); err != nil {
+			return errors.New("value must be an object when path is omitted")
+		}
+		for key, attributeValue := range attributes {
+			if err := applyScimUserPatch(resource, op, key, attributeValue); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	if op == "remove" {
+		switch strings.ToLower(path) {
+		case "displayname", "name.formatted":
+			resource.DisplayName = ""
+			resource.Name = nil
+		case "emails":
+			resource.Emails = nil
+		}
+		return nil
+	}
+	var err error
+	switch lowerPath := strings.ToLower(path); {
+	case lowerPath == "active":
+		var active bool
+		if active, err = scimBool(value); err == nil {
+			resource.Active = &active
+		}
+	case lowerPath == "username":
+		resource.UserName, err = scimString(value)
+	case lowerPath == "externalid":
+		resource.ExternalId, err = scimString(value)
+	case lowerPath == "displayname", lowerPath == "name.formatted":
+		resource.DisplayName, err = scimString(value)
+	case lowerPath == "name":
+		var name ScimName
+		if err = common.Unmarshal(value, &name); err == nil {
+			resource.Name = &name
+			resource.DisplayName = ""
+		}
+	case lowerPath == "emails":
+		var emails []ScimEmail
+		if err = common.Unmarshal(value, &emails); err == nil {
+			resource.Emails = emails
+		}
+	case strings.HasPrefix(lowerPath, "emails"):
+		// 形如 emails[type eq "work"].value 的路径
+		var email string
+		if email, err = scimString(value); err == nil {
+			resource.Emails = []ScimEmail{{Value: email, Type: "work", Primary: true}}
+		}
+	}
+	// 其余属性（如 name.givenName、title）不在本系统中保存，直接忽略
+	return err
+}
+
+func ScimPatchUser(c *gin.Context) {
+	user, ok := scimLoadUser(c)
+	if !ok {
+		return
+	}
+	var request ScimPatchRequest
+	if err := common.DecodeJson(c.Request.Body, &request); err != nil {
+		scimError(c, http.StatusBadRequest, "invalidSyntax", "invalid request body")
+		return
+	}
+	resource := scimUserResource(user)
+	for _, operation := range request.Operations {
+		op := strings.ToLower(operation.Op)
+		if op != "add" && op != "replace" && op != "remove" {
+			scimError(c, http.StatusBadRequest, "invalidSyntax", "unsupported patch operation: "+operation.Op)
+			return
+		}
+		if err := applyScimUserPatch(&resource, op, operation.Path, operation.Value); err != nil {
+			scimError(c, http.StatusBadRequest, "invalidValue", err.Error())
+			return
+		}
+	}
+	if !validateScimUser(c, &resource, user.Username) || !saveScimUser(c, user, &resource) {
+		return
+	}
+	scimRespond(c, http.StatusOK, scimUserResource(user))
+}
+
+func ScimDeleteUser(c *gin.Context) {
+	user, ok := scimLoadUser(c)
+	if !ok {
+		return
+	}
+	if _, err := model.DeprovisionUser(user.Id); err != nil {
+		scimInternalError(c, err)
+		return
+	}
+	if err := model.RemoveUserScimGroupMemberships(user.Id); err != nil {
+		scimInternalError(c, err)
+		return
+	}
+	if err := user.Delete(); err != nil {
+		scimInternalError(c, err)
+		return
+	}
+	c.Status(http.StatusNoContent)
+}
+
+// ---------- Groups ----------
+
+func scimGroupResource(group *model.ScimGroup, includeMembers bool) ScimGroup {
+	resource := ScimGroup{
+		Schemas:     []string{scimSchemaGroup},
+		Id:          strconv.Itoa(group.Id),
+		ExternalId:  group.ExternalId,
+		DisplayName: group.DisplayName,
+		Meta: &ScimMeta{
+			ResourceType: "Group",
+			Created:      scimTime(group.CreatedTime),
+			LastModified: scimTime(group.UpdatedTime),
+			Location:     scimLocation("Groups", group.Id),
+		},
+	}
+	if !includeMembers {
+		return resource
+	}
+	members, err := model.GetScimGroupMembers(group.Id)
+	if err != nil {
+		common.SysLog(fmt.Sprintf("failed to get members of SCIM group %d: %s", group.Id, err.Error()))
+	}
+	for _, member := range members {
+		resource.Members = append(resource.Members, ScimReference{
+			Value:   strconv.Itoa(member.Id),
+			Display: member.Username,
+			Ref:     scimLocation("Users", member.Id),
+		})
+	}
+	return resource
+}
+
+func scimMemberIds(members []ScimReference) ([]int, error) {
+	ids := make([]int, 0, len(members))
+	for _, member := range members {
+		id, err := strconv.Atoi(member.Value)
+		if err != nil {
+			return nil, fmt.Errorf("invalid member value: %s", member.Value)
+		}
+		ids = append(ids, id)
+	}
+	return ids, nil
+}
+
+// resolveScimUserGroup 根据用户所属 SCIM 组计算其分组：优先使用分组映射，其次使用与系统分组同名的组，最后使用默认分组
+func resolveScimUserGroup(groupNames []string) string {
+	settings := system_setting.GetSCIMSettings()
+	if group := system_setting.ResolveDirectoryGroup(settings.GroupMappings, groupNames, ""); group != "" {
+		return group
+	}
+	for _, name := range groupNames {
+		if ratio_setting.ContainsGroupRatio(name) {
+			return name
+		}
+	}
+	return settings.DefaultGroup
+}
+
+// syncScimUserGroups 在组成员关系变化后重新计算相关用户的分组
+func syncScimUserGroups(userIds []int) {
+	for _, userId := range userIds {
+		user, err := model.GetScimUserById(userId)
+		if err != nil {
+			continue
+		}
+		groups, err := model.GetUserScimGroups(userId)
+		if err != nil {
+			common.SysLog(fmt.Sprintf("failed to get SCIM groups of user %d: %s", userId, err.Error()))
+			continue
+		}
+		names := make([]string, 0, len(groups))
+		for _, group := range groups {
+			names = append(names, group.DisplayName)
+		}
+		if err := user.SyncGroupAndRole(resolveScimUserGroup(names), 0); err != nil {
+			common.SysLog(fmt.Sprintf("failed to sync group of user %d: %s", userId, err.Error()))
+		}
+	}
+}
+
+func scimLoadGroup(c *gin.Context) (*model.ScimGroup, bool) {
+	id, ok := scimResourceId(c)
+	if !ok {
+		scimError(c, http.StatusNotFound, "", "group not found")
+		return nil, false
+	}
+	group, err := model.GetScimGroupById(id)
+	if err != nil {
+		if errors.Is(err, model.ErrScimGroupNotFound) {
+			scimError(c, http.StatusNotFound, "", "group not found")
+		} else {
+			scimInternalError(c, err)
+		}
+		return nil, false
+	}
+	return group, true
+}
+
+func scimIncludeMembers(c *gin.Context) bool {
+	for _, attribute := range strings.Split(c.Query("excludedAttributes"), ",") {
+		if strings.EqualFold(strings.TrimSpace(attribute), "members") {
+			return false
+		}
+	}
+	return true
+}
+
+var (
+	errScimGroupNameInvalid = errors.New("displayName is required and must not exceed 191 characters")
+	errScimGroupNameTaken   = errors.New("displayName is already taken")
+)
+
+// validateScimGroupName 检查组名是否为空或已被其他组使用
+func validateScimGroupName(name string, currentId int) error {
+	if name == "" || len(name) > scimMaxNameLength {
+		return errScimGroupNameInvalid
+	}
+	groups, _, err := model.GetScimGroups("display_name", name, 0, 1)
+	if err != nil {
+		return err
+	}
+	if len(groups) > 0 && groups[0].Id != currentId {
+		return errScimGroupNameTaken
+	}
+	return nil
+}
+
+func scimGroupError(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, errScimGroupNameTaken):
+		scimError(c, http.StatusConflict, "uniqueness", err.Error())
+	case errors.Is(err, errScimGroupNameInvalid):
+		scimError(c, http.StatusBadRequest, "invalidValue", err.Error())
+	default:
+		scimInternalError(c, err)
+	}
+}
+
+func ScimListGroups(c *gin.Context) {
+	column, value, err := parseScimFilter(c.Query("filter"), scimGroupFilterColumns)
+	if err != nil {
+		scimError(c, http.StatusBadRequest, "invalidFilter", err.Error())
+		return
+	}
+	startIndex, count := scimPagination(c)
+	groups, total, err := model.GetScimGroups(column, value, startIndex-1, count)
+	if err != nil {
+		scimInternalError(c, err)
+		return
+	}
+	includeMembers := scimIncludeMembers(c)
+	resources := make([]any, 0, len(groups))
+	for _, group := range groups {
+		resources = append(resources, scimGroupResource(group, includeMembers))
+	}
+	scimRespond(c, http.StatusOK, ScimListResponse{
+		Schemas:      []string{scimSchemaListResponse},
+		TotalResults: total,
+		StartIndex:   startIndex,
+		ItemsPerPage: len(resources),
+		Resources:    resources,
+	})
+}
+
+func ScimGetGroup(c *gin.Context) {
+	group, ok := scimLoadGroup(c)
+	if !ok {
+		return
+	}
+	scimRespond(c, http.StatusOK, scimGroupResource(group, scimIncludeMembers(c)))
+}
+
+func ScimCreateGroup(c *gin.Context) {
+	var resource ScimGroup
+	if err := common.DecodeJson(c.Request.Body, &resource); err != nil {
+		scimError(c, http.StatusBadRequest, "invalidSyntax", "invalid request body")
+		return
+	}
+	resource.DisplayName = strings.TrimSpace(resource.DisplayName)
+	if err := validateScimGroupName(resource.DisplayName, 0); err != nil {
+		scimGroupError(c, err)
+		return
+	}
+	memberIds, err := scimMemberIds(resource.Members)
+	if err != nil {
+		scimError(c, http.StatusBadRequest, "invalidValue", err.Error())
+		return
+	}
+	group := model.ScimGroup{
+		DisplayName: resource.DisplayName,
+		ExternalId:  resource.ExternalId,
+	}
+	if err := group.Insert(); err != nil {
+		scimInternalError(c, err)
+		return
+	}
+	added, err := model.AddScimGroupMembers(group.Id, memberIds)
+	syncScimUserGroups(added)
+	if err != nil {
+		scimError(c, http.StatusBadRequest, "invalidValue", err.Error())
+		return
+	}
+	c.Header("Location", scimLocation("Groups", group.Id))
+	scimRespond(c, http.StatusCreated, scimGroupResource(&group, true))
+}
+
+func ScimReplaceGroup(c *gin.Context) {
+	group, ok := scimLoadGroup(c)
+	if !ok {
+		return
+	}
+	var resource ScimGroup
+	if err := common.DecodeJson(c.Request.Body, &resource); err != nil {
+		scimError(c, http.StatusBadRequest, "invalidSyntax", "invalid request body")
+		return
+	}
+	resource.DisplayName = strings.TrimSpace(resource.DisplayName)
+	if err := validateScimGroupName(resource.DisplayName, group.Id); err != nil {
+		scimGroupError(c, err)
+		return
+	}
+	memberIds, err := scimMemberIds(resource.Members)
+	if err != nil {
+		scimError(c, http.StatusBadRequest, "invalidValue", err.Error())
+		return
+	}
+	renamed := group.DisplayName != resource.DisplayName
+	group.DisplayName = resource.DisplayName
+	group.ExternalId = resource.ExternalId
+	if err := group.Update(); err != nil {
+		scimInternalError(c, err)
+		return
+	}
+	affected, err := replaceScimGroupMembers(group.Id, memberIds, renamed)
+	syncScimUserGroups(affected)
+	if err != nil {
+		scimError(c, http.StatusBadRequest, "invalidValue", err.Error())
+		return
+	}
+	scimRespond(c, http.StatusOK, scimGroupResource(group, true))
+}
+
+// replaceScimGroupMembers 将组成员替换为 memberIds，返回需要重新计算分组的用户
+func replaceScimGroupMembers(groupId int, memberIds []int, includeUnchanged bool) ([]int, error) {
+	existing, err := model.GetScimGroupMemberIds(groupId)
+	if err != nil {
+		return nil, err
+	}
+	keep := make(map[int]bool, len(memberIds))
+	for _, id := range memberIds {
+		keep[id] = true
+	}
+	var toRemove []int
+	for _, id := range existing {
+		if !keep[id] {
+			toRemove = append(toRemove, id)
+		}
+	}
+	affected, err := model.RemoveScimGroupMembers(groupId, toRemove)
+	if err != nil {
+		return affected, err
+	}
+	if includeUnchanged {
+		// 组被重命名时，所有成员的分组映射结果都可能变化
+		affected = nil
+		for _, id := range existing {
+			if keep[id] {
+				affected = append(affected, id)
+			}
+		}
+		affected = append(affected, toRemove...)
+	}
+	added, err := model.AddScimGroupMembers(groupId, memberIds)
+	return append(affected, added...), err
+}
+
+func ScimPatchGroup(c *gin.Context) {
+	group, ok := scimLoadGroup(c)
+	if !ok {
+		return
+	}
+	var request ScimPatchRequest
+	if err := common.DecodeJson(c.Request.Body, &request); err != nil {
+		scimError(c, http.StatusBadRequest, "invalidSyntax", "invalid request body")
+		return
+	}
+	var affected []int
+	renamed := false
+	patchErr := func() error {
+		for _, operation := range request.Operations {
+			op := strings.ToLower(operation.Op)
+			path := strings.TrimSpace(operation.Path)
+			switch {
+			case op != "add" && op != "replace" && op != "remove":
+				return fmt.Errorf("unsupported patch operation: %s", operation.Op)
+			case path == "" && op != "remove":
+				// 无 path 时 value 为属性到值的映射
+				var attributes ScimGroup
+				if err := common.Unmarshal(operation.Value, &attributes); err != nil {
+					return errors.New("value must be an object when path is omitted")
+				}
+				if name := strings.TrimSpace(attributes.DisplayName); name != "" && name != group.DisplayName {
+					if err := validateScimGroupName(name, group.Id); err != nil {
+						return err
+					}
+					group.DisplayName = name
+					renamed = true
+				}
+				if attributes.ExternalId != "" {
+					group.ExternalId = attributes.ExternalId
+				}
+				if attributes.Members != nil {
+					ids, err := scimMemberIds(attributes.Members)
+					if err != nil {
+						return err
+					}
+					changed, err := patchScimGroupMembers(group.Id, op, ids)
+					affected = append(affected, changed...)
+					if err != nil {
+						return err
+					}
+				}
+			case strings.EqualFold(path, "displayName"):
+				name, err := scimString(operation.Value)
+				if err != nil {
+					return err
+				}
+				if name = strings.TrimSpace(name); name != group.DisplayName {
+					if err := validateScimGroupName(name, group.Id); err != nil {
+						return err
+					}
+					group.DisplayName = name
+					renamed = true
+				}
+			case strings.EqualFold(path, "externalId"):
+				externalId, err := scimString(operation.Value)
+				if err != nil {
+					return err
+				}
+				group.ExternalId = externalId
+			case strings.EqualFold(path, "members"):
+				var ids []int
+				if op != "remove" || len(operation.Value) > 0 {
+					var members []ScimReference
+					if err := common.Unmarshal(operation.Value, &members); err != nil {
+						return errors.New("members value must be an array")
+					}
+					var err error
+					if ids, err = scimMemberIds(members); err != nil {
+						return err
+					}
+				}
+				changed, err := patchScimGroupMembers(group.Id, op, ids)
+				affected = append(affected, changed...)
+				if err != nil {
+					return err
+				}
+			case scimMemberPathRegex.MatchString(path):
+				if op != "remove" {
+					return fmt.Errorf("unsupported path for %s: %s", operation.Op, path)
+				}
+				id, err := strconv.Atoi(scimMemberPathRegex.FindStringSubmatch(path)[1])
+				if err != nil {
+					return fmt.Errorf("invalid member path: %s", path)
+				}
+				changed, err := model.RemoveScimGroupMembers(group.Id, []int{id})
+				affected = append(affected, changed...)
+				if err != nil {
+					return err
+				}
+			default:
+				return fmt.Errorf("unsupported patch path: %s", path)
+			}
+		}
+		return nil
+	}()
+	if patchErr == nil {
+		if err := group.Update(); err != nil {
+			syncScimUserGroups(affected)
+			scimInternalError(c, err)
+			return
+		}
+		if renamed {
+			memberIds, err := model.GetScimGroupMemberIds(group.Id)
+			if err == nil {
+				affected = append(affected, memberIds...)
+			}
+		}
+	}
+	syncScimUserGroups(affected)
+	if patchErr != nil {
+		if errors.Is(patchErr, errScimGroupNameTaken) {
+			scimGroupError(c, patchErr)
+		} else {
+			scimError(c, http.StatusBadRequest, "invalidValue", patchErr.Error())
+		}
+		return
+	}
+	scimRespond(c, http.StatusOK, scimGroupResource(group, true))
+}
+
+// patchScimGroupMembers 按 PATCH 操作增加、移除或替换组成员，返回成员关系发生变化的用户
+func patchScimGroupMembers(groupId int, op string, ids []int) ([]int, error) {
+	switch op {
+	case "add":
+		return model.AddScimGroupMembers(groupId, ids)
+	case "remove":
+		return model.RemoveScimGroupMembers(groupId, ids)
+	default:
+		return replaceScimGroupMembers(groupId, ids, false)
+	}
+}
+
+func ScimDeleteGroup(c *gin.Context) {
+	group, ok := scimLoadGroup(c)
+	if !ok {
+		return
+	}
+	userIds, err := model.DeleteScimGroup(group.Id)
+	if err != nil {
+		scimInternalError(c, err)
+		return
+	}
+	syncScimUserGroups(userIds)
+	c.Status(http.StatusNoContent)
+}
@@ -0,0 +1,201 @@
+package controller
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/model"
+	"github.com/QuantumNous/new-api/service"
+	"github.com/QuantumNous/new-api/setting/operation_setting"
+
+	"github.com/gin-gonic/gin"
+)
+
+func GetStatements(c *gin.Context) {
+	pageInfo := common.GetPageQuery(c)
+	userId, _ := strconv.Atoi(c.Query("user_id"))
+	statements, total, err := model.GetStatements(userId, c.Query("group"), c.Query("period"), pageInfo.GetStartIdx(), pageInfo.GetPageSize())
+	if err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	pageInfo.SetTotal(int(total))
+	pageInfo.SetItems(statements)
+	common.ApiSuccess(c, pageInfo)
+}
+
+func GetSelfStatements(c *gin.Context) {
+	pageInfo := common.GetPageQuery(c)
+	statements, total, err := model.GetStatements(c.GetInt("id"), "", c.Query("period"), pageInfo.GetStartIdx(), pageInfo.GetPageSize())
+	if err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	pageInfo.SetTotal(int(total))
+	pageInfo.SetItems(statements)
+	common.ApiSuccess(c, pageInfo)
+}
+
+type generateStatementRequest struct {
+	UserId int    `json:"user_id"`
+	Group  string `json:"group"`
+	Period string `json:"period"`
+}
+
+func GenerateStatement(c *gin.Context) {
+	var req generateStatementRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	statement, err := service.GenerateStatement(req.UserId, req.Group, req.Period)
+	if err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	common.ApiSuccess(c, statement)
+}
+
+func GetStatement(c *gin.Context) {
+	statement, ok := getStatementForRequest(c, false)
+	if !ok {
+		return
+	}
+	common.ApiSuccess(c, statement)
+}
+
+func GetSelfStatement(c *gin.Context) {
+	statement, ok := getStatementForRequest(c, true)
+	if !ok {
+		return
+	}
+	common.ApiSuccess(c, statement)
+}
+
+func DownloadStatement(c *gin.Context) {
+	statement, ok := getStatementForRequest(c, false)
+	if !ok {
+		return
+	}
+	writeStatementFile(c, statement)
+}
+
+func DownloadSelfStatement(c *gin.Context) {
+	statement, ok := getStatementForRequest(c, true)
+	if !ok {
+		return
+	}
+	writeStatementFile(c, statement)
+}
+
+// getStatementForRequest 读取路径中的账单，self 为 true 时只允许访问自己的账单
+func getStatementForRequest(c *gin.Context, self bool) (*model.Statement, bool) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		common.ApiError(c, err)
+		return nil, false
+	}
+	statement, err := model.GetStatementById(id)
+	if err == nil && self && statement.UserId != c.GetInt("id") {
+		err = errors.New("账单不存在")
+	}
+	if err != nil {
+		common.ApiError(c, err)
+		return nil, false
+	}
+	return statement, true
+}
+
+func writeStatementFile(c *gin.Context, statement *model.Statement) {
+	var (
+		data        []byte
+		err         error
+		contentType string
+	)
+	format := c.DefaultQuery("format", "html")
+	switch format {
+	case "csv":
+		data, err = service.RenderStatementCSV(statement)
+		contentType = "text/csv; charset=utf-8"
+	case "pdf":
+		data = service.RenderStatementPDF(statement)
+		contentType = "application/pdf"
+	case "html":
+		data, err = service.RenderStatementHTML(statement)
+		contentType = "text/html; charset=utf-8"
+	default:
+		err = fmt.Errorf("不支持的账单格式: %s", format)
+	}
+	if err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	if format != "html" {
+		c.Header("Content-Disposition", fmt.Sprintf("attachment; filename=%s.%s", statement.InvoiceNo, format))
+	}
+	c.Data(http.StatusOK, contentType, data)
+}
+
+var autoGenerateStatementsOnce sync.Once
+
+func AutomaticallyGenerateMonthlyStatements() {
+	if !service.CanRunJobs() {
+		return
+	}
+	autoGenerateStatementsOnce.Do(func() {
+		lastPeriod := ""
+		for {
+			time.Sleep(time.Hour)
+			if !operation_setting.GetStatementSetting().MonthlyEnabled || !service.IsJobLeader(service.JobMonthlyStatements) {
+				continue
+			}
+			// 每个账期只需在进入新月份后执行一次
+			now := time.Now()
+			period := time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, time.Local).AddDate(0, -1, 0).Format("2006-01")
+			if period == lastPeriod {
+				continue
+			}
+			generateMonthlyStatements(period)
+			lastPeriod = period
+		}
+	})
+}
+
+// generateMonthlyStatements 为账期内有消费的用户生成账单，已生成的账单会被跳过，因此可以重复执行
+func generateMonthlyStatements(period string) {
+	start, end, err := service.ParseStatementPeriod(period)
+	if err != nil {
+		return
+	}
+	userIds, err := model.GetConsumedUserIds(start.Unix(), end.Unix())
+	if err != nil {
+		common.SysLog("failed to list users for monthly statements: " + err.Error())
+		return
+	}
+	sendEmail := operation_setting.GetStatementSetting().MonthlyEmailEnabled
+	for _, userId := range userIds {
+		statement, err := service.GenerateStatement(userId, "", period)
+		if errors.Is(err, service.ErrStatementEmpty) {
+			continue
+		}
+		if err != nil {
+			common.SysLog(fmt.Sprintf("failed to generate statement for user %d, period %s: %s", userId, period, err.Error()))
+			continue
+		}
+		if !sendEmail || statement.EmailSentAt != 0 {
+			continue
+		}
+		email, err := model.GetUserEmail(userId)
+		if err != nil || email == "" {
+			continue
+		}
+		if err := service.SendStatementEmail(statement, email); err != nil {
+			common.SysLog(fmt.Sprintf("failed to send statement %s: %s", statement.InvoiceNo, err.Error()))
+		}
+	}
+}
@@ -0,0 +1,429 @@
+package controller
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/model"
+	"github.com/QuantumNous/new-api/service"
+	"github.com/QuantumNous/new-api/setting/operation_setting"
+
+	"github.com/gin-gonic/gin"
+)
+
+// SubscriptionProvider 订阅支付渠道。Stripe 与 Creem 由平台自动续费并通过 Webhook 通知续期；
+// 易支付不支持自动扣款，每个周期由用户手动续费
+type SubscriptionProvider interface {
+	// Available 渠道已配置且套餐配置了该渠道所需的价格信息
+	Available(plan *model.SubscriptionPlan) bool
+	// Checkout 为订阅发起一个周期的支付，返回前端跳转所需的数据
+	Checkout(req *SubscribeRequest, user *model.User, plan *model.SubscriptionPlan, subscription *model.Subscription) (gin.H, error)
+	// Cancel 停止续费；immediately 为 true 时立即终止平台侧订阅，否则在当前周期结束后终止
+	Cancel(subscription *model.Subscription, immediately bool) error
+	// SupportsImmediateChange 是否支持在周期内立即变更套餐并按比例收取差价
+	SupportsImmediateChange() bool
+	// ChangePlan 在平台侧切换套餐；immediate 为 false 时从下个周期开始按新套餐收费
+	ChangePlan(subscription *model.Subscription, plan *model.SubscriptionPlan, immediate bool) error
+}
+
+var subscriptionProviders = map[string]SubscriptionProvider{
+	PaymentMethodStripe: &stripeSubscriptionProvider{},
+	PaymentMethodCreem:  &creemSubscriptionProvider{},
+	PaymentMethodEpay:   &epaySubscriptionProvider{},
+}
+
+func getSubscriptionProvider(name string) (SubscriptionProvider, error) {
+	provider, ok := subscriptionProviders[name]
+	if !ok {
+		return nil, fmt.Errorf("不支持的支付渠道: %s", name)
+	}
+	return provider, nil
+}
+
+type SubscribeRequest struct {
+	PlanId   int    `json:"plan_id"`
+	Provider string `json:"provider"`
+	// 易支付的支付方式，如 alipay、wxpay
+	PaymentMethod string `json:"payment_method"`
+}
+
+type subscriptionPlanRequest struct {
+	PlanId int `json:"plan_id"`
+}
+
+func GetSubscriptionPlans(c *gin.Context) {
+	plans, err := model.GetSubscriptionPlans(true)
+	if err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	providers := make(map[int][]string, len(plans))
+	for _, plan := range plans {
+		available := make([]string, 0)
+		for name, provider := range subscriptionProviders {
+			if provider.Available(plan) {
+				available = append(available, name)
+			}
+		}
+		providers[plan.Id] = available
+	}
+	common.ApiSuccess(c, gin.H{
+		"enabled":   operation_setting.GetSubscriptionSetting().Enabled,
+		"plans":     plans,
+		"providers": providers,
+	})
+}
+
+func GetAllSubscriptionPlans(c *gin.Context) {
+	plans, err := model.GetSubscriptionPlans(false)
+	if err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	common.ApiSuccess(c, plans)
+}
+
+func validateSubscriptionPlan(plan *model.SubscriptionPlan) error {
+	if plan.Name == "" {
+		return errors.New("套餐名称不能为空")
+	}
+	switch plan.PeriodUnit {
+	case model.SubscriptionPeriodDay, model.SubscriptionPeriodWeek, model.SubscriptionPeriodMonth, model.SubscriptionPeriodYear:
+	default:
+		return errors.New("周期单位必须为 day、week、month 或 year")
+	}
+	if plan.PeriodCount <= 0 {
+		plan.PeriodCount = 1
+	}
+	if plan.Price < 0 || plan.QuotaPerPeriod < 0 {
+		return errors.New("价格和额度不能为负数")
+	}
+	return nil
+}
+
+func AddSubscriptionPlan(c *gin.Context) {
+	var plan model.SubscriptionPlan
+	if err := c.ShouldBindJSON(&plan); err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	if err := validateSubscriptionPlan(&plan); err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	plan.Id = 0
+	if err := plan.Insert(); err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	common.ApiSuccess(c, plan)
+}
+
+func UpdateSubscriptionPlan(c *gin.Context) {
+	var plan model.SubscriptionPlan
+	if err := c.ShouldBindJSON(&plan); err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	if _, err := model.GetSubscriptionPlanById(plan.Id); err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	if err := validateSubscriptionPlan(&plan); err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	if err := plan.Update(); err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	common.ApiSuccess(c, plan)
+}
+
+func DeleteSubscriptionPlan(c *gin.Context) {
+	id, _ := strconv.Atoi(c.Param("id"))
+	if err := model.DeleteSubscriptionPlan(id); err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	common.ApiSuccess(c, nil)
+}
+
+func GetAllSubscriptions(c *gin.Context) {
+	pageInfo := common.GetPageQuery(c)
+	userId, _ := strconv.Atoi(c.Query("user_id"))
+	subscriptions, total, err := model.GetSubscriptions(userId, c.Query("status"), pageInfo.GetStartIdx(), pageInfo.GetPageSize())
+	if err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	pageInfo.SetTotal(int(total))
+	pageInfo.SetItems(subscriptions)
+	common.ApiSuccess(c, pageInfo)
+}
+
+func GetSelfSubscription(c *gin.Context) {
+	subscription, err := model.GetUserSubscription(c.GetInt("id"))
+	if err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	data := gin.H{"subscription": subscription}
+	if subscription != nil {
+		data["plan"], _ = model.GetSubscriptionPlanById(subscription.PlanId)
+		if subscription.PendingPlanId != 0 {
+			data["pending_plan"], _ = model.GetSubscriptionPlanById(subscription.PendingPlanId)
+		}
+	}
+	common.ApiSuccess(c, data)
+}
+
+// Subscribe 订阅套餐。已有易支付订阅时视为续费下一个周期
+func Subscribe(c *gin.Context) {
+	if !operation_setting.GetSubscriptionSetting().Enabled {
+		common.ApiErrorMsg(c, "订阅功能未开启")
+		return
+	}
+	var req SubscribeRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	provider, err := getSubscriptionProvider(req.Provider)
+	if err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	plan, err := model.GetSubscriptionPlanById(req.PlanId)
+	if err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	if !plan.Enabled || !provider.Available(plan) {
+		common.ApiErrorMsg(c, "该套餐暂不支持此支付渠道")
+		return
+	}
+	user, err := model.GetUserById(c.GetInt("id"), false)
+	if err != nil {
+		common.ApiError(c, err)
+		return
+	}
+
+	subscription, err := model.GetUserSubscription(user.Id)
+	if err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	if subscription != nil {
+		renewPlanId := subscription.PlanId
+		if subscription.PendingPlanId != 0 {
+			renewPlanId = subscription.PendingPlanId
+		}
+		if subscription.Provider != PaymentMethodEpay || req.Provider != PaymentMethodEpay || renewPlanId != plan.Id {
+			common.ApiErrorMsg(c, "已有生效中的订阅，如需更换套餐请使用套餐变更")
+			return
+		}
+	} else {
+		subscription = &model.Subscription{
+			UserId:    user.Id,
+			PlanId:    plan.Id,
+			Reference: "sub_" + common.Sha1([]byte(fmt.Sprintf("%d-%d-%s", user.Id, time.Now().UnixNano(), common.GetRandomString(8)))),
+			Provider:  req.Provider,
+			Status:    model.SubscriptionStatusPending,
+		}
+		if err := subscription.Insert(); err != nil {
+			common.ApiError(c, err)
+			return
+		}
+	}
+
+	data, err := provider.Checkout(&req, user, plan, subscription)
+	if err != nil {
+		common.SysLog(fmt.Sprintf("failed to create subscription checkout for user %d: %s", user.Id, err.Error()))
+		common.ApiErrorMsg(c, "拉起支付失败")
+		return
+	}
+	data["reference"] = subscription.Reference
+	common.ApiSuccess(c, data)
+}
+
+func CancelSelfSubscription(c *gin.Context) {
+	subscription, err := model.GetUserSubscription(c.GetInt("id"))
+	if err == nil && subscription == nil {
+		err = errors.New("当前没有生效中的订阅")
+	}
+	if err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	provider, err := getSubscriptionProvider(subscription.Provider)
+	if err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	if err := provider.Cancel(subscription, false); err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	if err := model.UpdateSubscriptionFields(subscription.Id, map[string]interface{}{"cancel_at_period_end": true}); err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	common.ApiSuccess(c, nil)
+}
+
+func PreviewSelfSubscriptionChange(c *gin.Context) {
+	changeSelfSubscription(c, true)
+}
+
+func ChangeSelfSubscription(c *gin.Context) {
+	changeSelfSubscription(c, false)
+}
+
+// changeSelfSubscription 变更套餐：升级且渠道支持时立即生效并按比例结算差价与额度，否则从下个周期生效
+func changeSelfSubscription(c *gin.Context, preview bool) {
+	var req subscriptionPlanRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	subscription, err := model.GetUserSubscription(c.GetInt("id"))
+	if err == nil && (subscription == nil || subscription.Status != model.SubscriptionStatusActive) {
+		err = errors.New("当前没有生效中的订阅")
+	}
+	if err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	if subscription.PlanId == req.PlanId {
+		common.ApiErrorMsg(c, "已是当前套餐")
+		return
+	}
+	from, err := model.GetSubscriptionPlanById(subscription.PlanId)
+	if err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	to, err := model.GetSubscriptionPlanById(req.PlanId)
+	if err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	provider, err := getSubscriptionProvider(subscription.Provider)
+	if err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	if !to.Enabled || !provider.Available(to) {
+		common.ApiErrorMsg(c, "该套餐暂不支持当前订阅的支付渠道")
+		return
+	}
+
+	proration := service.CalcSubscriptionProration(subscription, from, to, common.GetTimestamp())
+	immediate := proration.Upgrade && provider.SupportsImmediateChange()
+	effectiveAt := subscription.CurrentPeriodEnd
+	if immediate {
+		effectiveAt = common.GetTimestamp()
+	} else {
+		proration.AmountDue = 0
+		proration.QuotaDelta = 0
+	}
+	if preview {
+		common.ApiSuccess(c, gin.H{"proration": proration, "immediate": immediate, "effective_at": effectiveAt})
+		return
+	}
+
+	if err := provider.ChangePlan(subscription, to, immediate); err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	if immediate {
+		err = model.ChangeSubscriptionPlan(subscription.Id, to.Id, proration.QuotaDelta)
+	} else {
+		err = model.UpdateSubscriptionFields(subscription.Id, map[string]interface{}{"pending_plan_id": to.Id})
+	}
+	if err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	common.ApiSuccess(c, gin.H{"proration": proration, "immediate": immediate, "effective_at": effectiveAt})
+}
+
+// AdminExpireSubscription 管理员立即终止订阅
+func AdminExpireSubscription(c *gin.Context) {
+	id, _ := strconv.Atoi(c.Param("id"))
+	subscription, err := model.GetSubscriptionById(id)
+	if err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	if provider, err := getSubscriptionProvider(subscription.Provider); err == nil {
+		if err := provider.Cancel(subscription, true); err != nil {
+			common.ApiError(c, err)
+			return
+		}
+	}
+	if err := model.ExpireSubscription(subscription.Id, "管理员终止"); err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	common.ApiSuccess(c, nil)
+}
+
+var autoCheckSubscriptionsOnce sync.Once
+
+func AutomaticallyCheckSubscriptions() {
+	if !service.CanRunJobs() {
+		return
+	}
+	autoCheckSubscriptionsOnce.Do(func() {
+		for {
+			interval := operation_setting.GetSubscriptionSetting().CheckIntervalMinutes
+			if interval <= 0 {
+				interval = 10
+			}
+			time.Sleep(time.Duration(interval) * time.Minute)
+			if service.IsJobLeader(service.JobSubscriptionCheck) {
+				checkSubscriptions()
+			}
+		}
+	})
+}
+
+// checkSubscriptions 清理未付款的订阅；周期结束未续费的订阅进入宽限期，超过宽限期或已取消的订阅到期
+func checkSubscriptions() {
+	setting := operation_setting.GetSubscriptionSetting()
+	now := common.GetTimestamp()
+	if _, err := model.ExpirePendingSubscriptions(now - int64(setting.PendingExpireHours)*3600); err != nil {
+		common.SysLog("failed to expire pending subscriptions: " + err.Error())
+	}
+	subscriptions, err := model.GetLapsedSubscriptions(now)
+	if err != nil {
+		common.SysLog("failed to query lapsed subscriptions: " + err.Error())
+		return
+	}
+	for _, subscription := range subscriptions {
+		switch {
+		case subscription.CancelAtPeriodEnd:
+			err = model.ExpireSubscription(subscription.Id, "用户已取消")
+		case subscription.Status == model.SubscriptionStatusActive:
+			err = model.UpdateSubscriptionFields(subscription.Id, map[string]interface{}{"status": model.SubscriptionStatusPastDue})
+		case now > subscription.CurrentPeriodEnd+int64(setting.GracePeriodHours)*3600:
+			if provider, perr := getSubscriptionProvider(subscription.Provider); perr == nil {
+				if perr = provider.Cancel(subscription, true); perr != nil {
+					common.SysLog(fmt.Sprintf("failed to cancel subscription %s at provider: %s", subscription.Reference, perr.Error()))
+				}
+			}
+			err = model.ExpireSubscription(subscription.Id, "超过宽限期未续费")
+		default:
+			continue
+		}
+		if err != nil {
+			common.SysLog(fmt.Sprintf("failed to update lapsed subscription %s: %s", subscription.Reference, err.Error()))
+		}
+	}
+}
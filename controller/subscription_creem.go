@@ -0,0 +1,178 @@
+package controller
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/QuantumNous/new-api/model"
+	"github.com/QuantumNous/new-api/setting"
+
+	"github.com/gin-gonic/gin"
+)
+
+type creemSubscriptionProvider struct{}
+
+func (*creemSubscriptionProvider) Available(plan *model.SubscriptionPlan) bool {
+	return setting.CreemApiKey != "" && plan.CreemProductId != ""
+}
+
+func (*creemSubscriptionProvider) Checkout(req *SubscribeRequest, user *model.User, plan *model.SubscriptionPlan, subscription *model.Subscription) (gin.H, error) {
+	product := &CreemProduct{
+		ProductId: plan.CreemProductId,
+		Name:      plan.Name,
+		Price:     plan.Price,
+		Currency:  plan.Currency,
+		Quota:     int64(plan.QuotaPerPeriod),
+	}
+	checkoutUrl, _, err := genCreemLink(subscription.Reference, product, user.Email, user.Username)
+	if err != nil {
+		return nil, err
+	}
+	return gin.H{"checkout_url": checkoutUrl, "order_id": subscription.Reference}, nil
+}
+
+func (*creemSubscriptionProvider) Cancel(subscription *model.Subscription, immediately bool) error {
+	if subscription.ProviderSubscriptionId == "" {
+		return nil
+	}
+	// Creem 取消后订阅在当前周期结束时失效，立即终止由本地到期处理完成
+	return creemApiPost(fmt.Sprintf("/v1/subscriptions/%s/cancel", subscription.ProviderSubscriptionId), map[string]string{})
+}
+
+func (*creemSubscriptionProvider) SupportsImmediateChange() bool {
+	return true
+}
+
+func (*creemSubscriptionProvider) ChangePlan(subscription *model.Subscription, plan *model.SubscriptionPlan, immediate bool) error {
+	if subscription.ProviderSubscriptionId == "" {
+		return errors.New("订阅尚未与 Creem 关联")
+	}
+	behavior := "proration-none"
+	if immediate {
+		behavior = "proration-charge-immediately"
+	}
+	return creemApiPost(fmt.Sprintf("/v1/subscriptions/%s/upgrade", subscription.ProviderSubscriptionId), map[string]string{
+		"product_id":      plan.CreemProductId,
+		"update_behavior": behavior,
+	})
+}
+
+func creemApiPost(path string, payload any) error {
+	return creemApiRequest(http.MethodPost, path, payload, nil)
+}
+
+// creemApiRequest 调用 Creem API，result 非空时解析响应内容
+func creemApiRequest(method string, path string, payload any, result any) error {
+	if setting.CreemApiKey == "" {
+		return errors.New("未配置Creem API密钥")
+	}
+	apiUrl := "https://api.creem.io" + path
+	if setting.CreemTestMode {
+		apiUrl = "https://test-api.creem.io" + path
+	}
+	var reqBody io.Reader
+	if payload != nil {
+		body, err := json.Marshal(payload)
+		if err != nil {
+			return err
+		}
+		reqBody = bytes.NewReader(body)
+	}
+	req, err := http.NewRequest(method, apiUrl, reqBody)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("x-api-key", setting.CreemApiKey)
+	client := &http.Client{Timeout: 30 * time.Second}
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	respBody, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode/100 != 2 {
+		return fmt.Errorf("Creem API http status %d: %s", resp.StatusCode, string(respBody))
+	}
+	if result == nil {
+		return nil
+	}
+	return json.Unmarshal(respBody, result)
+}
+
+// CreemSubscriptionEvent subscription.* 事件，object 为订阅对象
+type CreemSubscriptionEvent struct {
+	Id        string `json:"id"`
+	EventType string `json:"eventType"`
+	Object    struct {
+		Id                     string            `json:"id"`
+		Status                 string            `json:"status"`
+		CurrentPeriodStartDate string            `json:"current_period_start_date"`
+		CurrentPeriodEndDate   string            `json:"current_period_end_date"`
+		Metadata               map[string]string `json:"metadata"`
+		Customer               struct {
+			Id string `json:"id"`
+		} `json:"customer"`
+	} `json:"object"`
+}
+
+// handleCreemSubscriptionCheckout 订阅商品的首次支付，仅关联 Creem 订阅，额度由 subscription.paid 事件发放
+func handleCreemSubscriptionCheckout(event *CreemWebhookEvent) error {
+	subscription, err := model.GetSubscriptionByReference(event.Object.RequestId)
+	if err != nil {
+		log.Printf("Creem订阅不存在: %s", event.Object.RequestId)
+		return nil
+	}
+	if event.Object.Subscription.Id == "" || subscription.ProviderSubscriptionId == event.Object.Subscription.Id {
+		return nil
+	}
+	return model.UpdateSubscriptionFields(subscription.Id, map[string]interface{}{
+		"provider_subscription_id": event.Object.Subscription.Id,
+		"provider_customer_id":     event.Object.Customer.Id,
+	})
+}
+
+func handleCreemSubscriptionEvent(body []byte) error {
+	var event CreemSubscriptionEvent
+	if err := json.Unmarshal(body, &event); err != nil {
+		return fmt.Errorf("%w: %v", errPaymentWebhookMalformed, err)
+	}
+	subscription, err := model.GetSubscriptionByProviderId(PaymentMethodCreem, event.Object.Id)
+	if err != nil {
+		// 订阅事件可能早于 checkout.completed 到达，此时按元数据中的本地编号关联
+		subscription, err = model.GetSubscriptionByReference(event.Object.Metadata["reference_id"])
+		if err != nil {
+			log.Printf("Creem订阅事件对应的订阅不存在: %s", event.Object.Id)
+			return nil
+		}
+		_ = model.UpdateSubscriptionFields(subscription.Id, map[string]interface{}{
+			"provider_subscription_id": event.Object.Id,
+			"provider_customer_id":     event.Object.Customer.Id,
+		})
+	}
+
+	switch event.EventType {
+	case "subscription.paid":
+		start, err1 := time.Parse(time.RFC3339, event.Object.CurrentPeriodStartDate)
+		end, err2 := time.Parse(time.RFC3339, event.Object.CurrentPeriodEndDate)
+		if err1 != nil || err2 != nil {
+			return fmt.Errorf("%w: Creem订阅周期格式错误: %s - %s", errPaymentWebhookMalformed, event.Object.CurrentPeriodStartDate, event.Object.CurrentPeriodEndDate)
+		}
+		return model.RenewSubscription(subscription.Id, start.Unix(), end.Unix(), "")
+	case "subscription.canceled":
+		return model.UpdateSubscriptionFields(subscription.Id, map[string]interface{}{"cancel_at_period_end": true})
+	case "subscription.expired":
+		return model.ExpireSubscription(subscription.Id, "Creem 订阅已到期")
+	}
+	log.Printf("忽略Creem订阅事件类型: %s", event.EventType)
+	return nil
+}
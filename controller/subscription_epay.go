@@ -0,0 +1,152 @@
+package controller
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"net/url"
+	"strconv"
+	"time"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/model"
+	"github.com/QuantumNous/new-api/service"
+	"github.com/QuantumNous/new-api/setting/operation_setting"
+	"github.com/QuantumNous/new-api/setting/system_setting"
+
+	"github.com/Calcium-Ion/go-epay/epay"
+	"github.com/gin-gonic/gin"
+	"github.com/samber/lo"
+)
+
+const (
+	PaymentMethodEpay               = "epay"
+	subscriptionPaymentMethodPrefix = "subscription_"
+)
+
+// epaySubscriptionProvider 易支付不支持自动扣款，每次支付购买一个周期，续费时从当前周期结束时间顺延
+type epaySubscriptionProvider struct{}
+
+func (*epaySubscriptionProvider) Available(plan *model.SubscriptionPlan) bool {
+	return GetEpayClient() != nil && plan.Price > 0
+}
+
+func (*epaySubscriptionProvider) Checkout(req *SubscribeRequest, user *model.User, plan *model.SubscriptionPlan, subscription *model.Subscription) (gin.H, error) {
+	if !operation_setting.ContainsPayMethod(req.PaymentMethod) {
+		return nil, errors.New("支付方式不存在")
+	}
+	client := GetEpayClient()
+	if client == nil {
+		return nil, errors.New("当前管理员未配置支付信息")
+	}
+	returnUrl, _ := url.Parse(system_setting.ServerAddress + "/console/topup")
+	notifyUrl, _ := url.Parse(service.GetCallbackAddress() + "/api/subscription/epay/notify")
+	tradeNo := fmt.Sprintf("SUB%dNO%s%d", subscription.Id, common.GetRandomString(6), time.Now().Unix())
+	uri, params, err := client.Purchase(&epay.PurchaseArgs{
+		Type:           req.PaymentMethod,
+		ServiceTradeNo: tradeNo,
+		Name:           fmt.Sprintf("SUB%d", plan.Id),
+		Money:          strconv.FormatFloat(plan.Price, 'f', 2, 64),
+		Device:         epay.PC,
+		NotifyUrl:      notifyUrl,
+		ReturnUrl:      returnUrl,
+	})
+	if err != nil {
+		return nil, err
+	}
+	// 订阅付款记录在充值订单中，额度由订阅续期发放，因此 Amount 为 0；
+	// 支付方式加上前缀，避免被当作充值订单对账或退款
+	topUp := &model.TopUp{
+		UserId:        user.Id,
+		Amount:        0,
+		Money:         plan.Price,
+		TradeNo:       tradeNo,
+		PaymentMethod: subscriptionPaymentMethodPrefix + req.PaymentMethod,
+		CreateTime:    time.Now().Unix(),
+		Status:        common.TopUpStatusPending,
+	}
+	if err := topUp.Insert(); err != nil {
+		return nil, err
+	}
+	return gin.H{"params": params, "url": uri}, nil
+}
+
+func (*epaySubscriptionProvider) Cancel(subscription *model.Subscription, immediately bool) error {
+	return nil
+}
+
+func (*epaySubscriptionProvider) SupportsImmediateChange() bool {
+	return false
+}
+
+func (*epaySubscriptionProvider) ChangePlan(subscription *model.Subscription, plan *model.SubscriptionPlan, immediate bool) error {
+	if immediate {
+		return errors.New("易支付订阅仅支持在下个周期变更套餐")
+	}
+	return nil
+}
+
+func SubscriptionEpayNotify(c *gin.Context) {
+	params := lo.Reduce(lo.Keys(c.Request.URL.Query()), func(r map[string]string, t string, i int) map[string]string {
+		r[t] = c.Request.URL.Query().Get(t)
+		return r
+	}, map[string]string{})
+	client := GetEpayClient()
+	if client == nil {
+		log.Println("易支付订阅回调失败 未找到配置信息")
+		_, _ = c.Writer.Write([]byte("fail"))
+		return
+	}
+	verifyInfo, err := client.Verify(params)
+	if err != nil || !verifyInfo.VerifyStatus {
+		log.Println("易支付订阅回调签名验证失败")
+		_, _ = c.Writer.Write([]byte("fail"))
+		return
+	}
+	_, _ = c.Writer.Write([]byte("success"))
+	if verifyInfo.TradeStatus != epay.StatusTradeSuccess {
+		log.Printf("易支付订阅异常回调: %v", verifyInfo)
+		return
+	}
+
+	LockOrder(verifyInfo.ServiceTradeNo)
+	defer UnlockOrder(verifyInfo.ServiceTradeNo)
+	topUp := model.GetTopUpByTradeNo(verifyInfo.ServiceTradeNo)
+	if topUp == nil || topUp.Status != common.TopUpStatusPending {
+		return
+	}
+	var subscriptionId int
+	if _, err := fmt.Sscanf(topUp.TradeNo, "SUB%dNO", &subscriptionId); err != nil {
+		log.Printf("易支付订阅回调订单号错误: %s", topUp.TradeNo)
+		return
+	}
+	subscription, err := model.GetSubscriptionById(subscriptionId)
+	if err != nil {
+		log.Printf("易支付订阅回调未找到订阅: %s", topUp.TradeNo)
+		return
+	}
+	planId := subscription.PlanId
+	if subscription.PendingPlanId != 0 {
+		planId = subscription.PendingPlanId
+	}
+	plan, err := model.GetSubscriptionPlanById(planId)
+	if err != nil {
+		log.Printf("易支付订阅回调未找到套餐: %s", topUp.TradeNo)
+		return
+	}
+
+	topUp.Status = common.TopUpStatusSuccess
+	topUp.CompleteTime = common.GetTimestamp()
+	if err := topUp.Update(); err != nil {
+		log.Printf("易支付订阅回调更新订单失败: %v", topUp)
+		return
+	}
+	// 提前续费时从当前周期结束时间顺延，否则从付款时间开始
+	start := common.GetTimestamp()
+	if subscription.Status == model.SubscriptionStatusActive && subscription.CurrentPeriodEnd > start {
+		start = subscription.CurrentPeriodEnd
+	}
+	if err := model.RenewSubscription(subscription.Id, start, plan.NextPeriodEnd(start), fmt.Sprintf("，支付金额: %.2f", topUp.Money)); err != nil {
+		log.Printf("易支付订阅续期失败: %s, %v", subscription.Reference, err)
+	}
+}
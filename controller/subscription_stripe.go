@@ -0,0 +1,232 @@
+package controller
+
+import (
+	"errors"
+	"log"
+	"os"
+	"strings"
+	"sync"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/model"
+	"github.com/QuantumNous/new-api/setting"
+	"github.com/QuantumNous/new-api/setting/system_setting"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stripe/stripe-go/v81"
+	"github.com/stripe/stripe-go/v81/checkout/session"
+	stripesubscription "github.com/stripe/stripe-go/v81/subscription"
+)
+
+const stripeSubscriptionRefKey = "subscription_ref"
+
+var stripeBackendOnce sync.Once
+
+// initStripeClient 设置 Stripe 密钥；配置 STRIPE_API_BASE 时请求发往该地址，便于使用 stripe-mock 测试
+func initStripeClient() error {
+	if !strings.HasPrefix(setting.StripeApiSecret, "sk_") && !strings.HasPrefix(setting.StripeApiSecret, "rk_") {
+		return errors.New("无效的Stripe API密钥")
+	}
+	stripe.Key = setting.StripeApiSecret
+	stripeBackendOnce.Do(func() {
+		if base := os.Getenv("STRIPE_API_BASE"); base != "" {
+			stripe.SetBackend(stripe.APIBackend, stripe.GetBackendWithConfig(stripe.APIBackend, &stripe.BackendConfig{
+				URL: stripe.String(base),
+			}))
+		}
+	})
+	return nil
+}
+
+type stripeSubscriptionProvider struct{}
+
+func (*stripeSubscriptionProvider) Available(plan *model.SubscriptionPlan) bool {
+	return setting.StripeApiSecret != "" && setting.StripeWebhookSecret != "" && plan.StripePriceId != ""
+}
+
+func (*stripeSubscriptionProvider) Checkout(req *SubscribeRequest, user *model.User, plan *model.SubscriptionPlan, subscription *model.Subscription) (gin.H, error) {
+	if err := initStripeClient(); err != nil {
+		return nil, err
+	}
+	params := &stripe.CheckoutSessionParams{
+		ClientReferenceID: stripe.String(subscription.Reference),
+		SuccessURL:        stripe.String(system_setting.ServerAddress + "/console/topup"),
+		CancelURL:         stripe.String(system_setting.ServerAddress + "/console/topup"),
+		LineItems: []*stripe.CheckoutSessionLineItemParams{
+			{
+				Price:    stripe.String(plan.StripePriceId),
+				Quantity: stripe.Int64(1),
+			},
+		},
+		Mode: stripe.String(string(stripe.CheckoutSessionModeSubscription)),
+		SubscriptionData: &stripe.CheckoutSessionSubscriptionDataParams{
+			Metadata: map[string]string{stripeSubscriptionRefKey: subscription.Reference},
+		},
+		AllowPromotionCodes: stripe.Bool(setting.StripePromotionCodesEnabled),
+	}
+	if user.StripeCustomer != "" {
+		params.Customer = stripe.String(user.StripeCustomer)
+	} else if user.Email != "" {
+		params.CustomerEmail = stripe.String(user.Email)
+	}
+	result, err := session.New(params)
+	if err != nil {
+		return nil, err
+	}
+	return gin.H{"pay_link": result.URL}, nil
+}
+
+func (*stripeSubscriptionProvider) Cancel(subscription *model.Subscription, immediately bool) error {
+	if subscription.ProviderSubscriptionId == "" {
+		return nil
+	}
+	if err := initStripeClient(); err != nil {
+		return err
+	}
+	var err error
+	if immediately {
+		_, err = stripesubscription.Cancel(subscription.ProviderSubscriptionId, &stripe.SubscriptionCancelParams{})
+	} else {
+		_, err = stripesubscription.Update(subscription.ProviderSubscriptionId, &stripe.SubscriptionParams{
+			CancelAtPeriodEnd: stripe.Bool(true),
+		})
+	}
+	return err
+}
+
+func (*stripeSubscriptionProvider) SupportsImmediateChange() bool {
+	return true
+}
+
+// ChangePlan 替换订阅的价格；立即变更时由 Stripe 开具按比例折算的账单并当场扣款，扣款失败则变更失败
+func (*stripeSubscriptionProvider) ChangePlan(subscription *model.Subscription, plan *model.SubscriptionPlan, immediate bool) error {
+	if subscription.ProviderSubscriptionId == "" {
+		return errors.New("订阅尚未与 Stripe 关联")
+	}
+	if err := initStripeClient(); err != nil {
+		return err
+	}
+	current, err := stripesubscription.Get(subscription.ProviderSubscriptionId, nil)
+	if err != nil {
+		return err
+	}
+	if current.Items == nil || len(current.Items.Data) == 0 {
+		return errors.New("Stripe 订阅中没有可变更的项目")
+	}
+	params := &stripe.SubscriptionParams{
+		Items: []*stripe.SubscriptionItemsParams{
+			{
+				ID:    stripe.String(current.Items.Data[0].ID),
+				Price: stripe.String(plan.StripePriceId),
+			},
+		},
+		ProrationBehavior: stripe.String("none"),
+	}
+	if immediate {
+		params.ProrationBehavior = stripe.String("always_invoice")
+		params.PaymentBehavior = stripe.String("error_if_incomplete")
+	}
+	_, err = stripesubscription.Update(subscription.ProviderSubscriptionId, params)
+	return err
+}
+
+// findStripeSubscription 优先按 Stripe 订阅 ID 查找本地订阅，找不到时按元数据中的本地编号查找并补全关联
+func findStripeSubscription(providerSubscriptionId string, reference string, customerId string) (*model.Subscription, error) {
+	if providerSubscriptionId != "" {
+		if subscription, err := model.GetSubscriptionByProviderId(PaymentMethodStripe, providerSubscriptionId); err == nil {
+			return subscription, nil
+		}
+	}
+	if reference == "" {
+		return nil, errors.New("订阅不存在")
+	}
+	subscription, err := model.GetSubscriptionByReference(reference)
+	if err != nil {
+		return nil, err
+	}
+	if providerSubscriptionId != "" && subscription.ProviderSubscriptionId != providerSubscriptionId {
+		subscription.ProviderSubscriptionId = providerSubscriptionId
+		subscription.ProviderCustomerId = customerId
+		err = model.UpdateSubscriptionFields(subscription.Id, map[string]interface{}{
+			"provider_subscription_id": providerSubscriptionId,
+			"provider_customer_id":     customerId,
+		})
+	}
+	return subscription, err
+}
+
+func stripeSubscriptionCheckoutCompleted(event stripe.Event) error {
+	reference := event.GetObjectValue("client_reference_id")
+	_, err := findStripeSubscription(event.GetObjectValue("subscription"), reference, event.GetObjectValue("customer"))
+	if err != nil {
+		log.Println("Stripe订阅关联失败", reference, err.Error())
+	}
+	return nil
+}
+
+// stripeInvoicePaid 订阅账单支付成功后续期；找不到订阅的账单直接忽略，续期失败时返回错误由 Stripe 重试
+func stripeInvoicePaid(event stripe.Event) error {
+	var invoice stripe.Invoice
+	if err := common.Unmarshal(event.Data.Raw, &invoice); err != nil {
+		log.Println("解析Stripe账单失败", err.Error())
+		return nil
+	}
+	if invoice.Subscription == nil {
+		return nil
+	}
+	reference := ""
+	if invoice.SubscriptionDetails != nil {
+		reference = invoice.SubscriptionDetails.Metadata[stripeSubscriptionRefKey]
+	}
+	customerId := ""
+	if invoice.Customer != nil {
+		customerId = invoice.Customer.ID
+	}
+	subscription, err := findStripeSubscription(invoice.Subscription.ID, reference, customerId)
+	if err != nil {
+		log.Println("Stripe账单对应的订阅不存在", invoice.Subscription.ID)
+		return nil
+	}
+	// 以账单中服务周期最晚的一项作为本次续期的周期
+	var period *stripe.Period
+	if invoice.Lines != nil {
+		for _, line := range invoice.Lines.Data {
+			if line.Period != nil && (period == nil || line.Period.End > period.End) {
+				period = line.Period
+			}
+		}
+	}
+	if period == nil {
+		log.Println("Stripe账单缺少服务周期", invoice.ID)
+		return nil
+	}
+	return model.RenewSubscription(subscription.Id, period.Start, period.End, "")
+}
+
+func stripeInvoicePaymentFailed(event stripe.Event) error {
+	subscription, err := model.GetSubscriptionByProviderId(PaymentMethodStripe, event.GetObjectValue("subscription"))
+	if err != nil || subscription.Status != model.SubscriptionStatusActive {
+		return nil
+	}
+	return model.UpdateSubscriptionFields(subscription.Id, map[string]interface{}{"status": model.SubscriptionStatusPastDue})
+}
+
+func stripeSubscriptionUpdated(event stripe.Event) error {
+	subscription, err := model.GetSubscriptionByProviderId(PaymentMethodStripe, event.GetObjectValue("id"))
+	if err != nil {
+		return nil
+	}
+	cancelAtPeriodEnd := event.GetObjectValue("cancel_at_period_end") == "true"
+	if cancelAtPeriodEnd == subscription.CancelAtPeriodEnd {
+		return nil
+	}
+	return model.UpdateSubscriptionFields(subscription.Id, map[string]interface{}{"cancel_at_period_end": cancelAtPeriodEnd})
+}
+
+func stripeSubscriptionDeleted(event stripe.Event) error {
+	subscription, err := model.GetSubscriptionByProviderId(PaymentMethodStripe, event.GetObjectValue("id"))
+	if err != nil {
+		return nil
+	}
+	return model.ExpireSubscription(subscription.Id, "Stripe 订阅已终止")
+}
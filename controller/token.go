@@ -175,6 +175,7 @@ func AddToken(c *gin.Context) {
 		QuotaResetAmount:    token.QuotaResetAmount,
 		QuotaResetStartTime: token.QuotaResetStartTime,
 		QuotaResetEndTime:   token.QuotaResetEndTime,
+		HedgeEnabled:        token.HedgeEnabled,
 	}
 	err = cleanToken.Insert()
 	if err != nil {
@@ -256,6 +257,7 @@ func UpdateToken(c *gin.Context) {
 		cleanToken.QuotaResetAmount = token.QuotaResetAmount
 		cleanToken.QuotaResetStartTime = token.QuotaResetStartTime
 		cleanToken.QuotaResetEndTime = token.QuotaResetEndTime
+		cleanToken.HedgeEnabled = token.HedgeEnabled
 	}
 	err = cleanToken.Update()
 	if err != nil {
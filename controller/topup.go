@@ -1,15 +1,18 @@
 package controller
 
 import (
+	"errors"
 	"fmt"
+	"io"
 	"log"
+	"net/http"
 	"net/url"
 	"strconv"
+	"strings"
 	"sync"
 	"time"
 
 	"github.com/QuantumNous/new-api/common"
-	"github.com/QuantumNous/new-api/logger"
 	"github.com/QuantumNous/new-api/model"
 	"github.com/QuantumNous/new-api/service"
 	"github.com/QuantumNous/new-api/setting"
@@ -62,12 +65,6 @@ func GetTopUpInfo(c *gin.Context) {
 	common.ApiSuccess(c, data)
 }
 
-type EpayRequest struct {
-	Amount        int64  `json:"amount"`
-	PaymentMethod string `json:"payment_method"`
-	TopUpCode     string `json:"top_up_code"`
-}
-
 type AmountRequest struct {
 	Amount    int64  `json:"amount"`
 	TopUpCode string `json:"top_up_code"`
@@ -127,44 +124,59 @@ func getMinTopup() int64 {
 	return int64(minTopup)
 }
 
-func RequestEpay(c *gin.Context) {
-	var req EpayRequest
-	err := c.ShouldBindJSON(&req)
-	if err != nil {
-		c.JSON(200, gin.H{"message": "error", "data": "参数错误"})
-		return
+// tradeNo lock
+var orderLocks sync.Map
+var createLock sync.Mutex
+
+// LockOrder 尝试对给定订单号加锁
+func LockOrder(tradeNo string) {
+	lock, ok := orderLocks.Load(tradeNo)
+	if !ok {
+		createLock.Lock()
+		defer createLock.Unlock()
+		lock, ok = orderLocks.Load(tradeNo)
+		if !ok {
+			lock = new(sync.Mutex)
+			orderLocks.Store(tradeNo, lock)
+		}
 	}
-	if req.Amount < getMinTopup() {
-		c.JSON(200, gin.H{"message": "error", "data": fmt.Sprintf("充值数量不能小于 %d", getMinTopup())})
-		return
+	lock.(*sync.Mutex).Lock()
+}
+
+// UnlockOrder 释放给定订单号的锁
+func UnlockOrder(tradeNo string) {
+	lock, ok := orderLocks.Load(tradeNo)
+	if ok {
+		lock.(*sync.Mutex).Unlock()
 	}
+}
 
-	id := c.GetInt("id")
-	group, err := model.GetUserGroup(id, true)
-	if err != nil {
-		c.JSON(200, gin.H{"message": "error", "data": "获取用户分组失败"})
-		return
+type epayPaymentProvider struct{}
+
+func (*epayPaymentProvider) Name() string {
+	return PaymentMethodEpay
+}
+
+func (*epayPaymentProvider) CreateOrder(user *model.User, req *PaymentOrderRequest) (*PaymentCheckout, error) {
+	if req.Amount < getMinTopup() {
+		return nil, fmt.Errorf("充值数量不能小于 %d", getMinTopup())
 	}
-	payMoney := getPayMoney(req.Amount, group)
+	payMoney := getPayMoney(req.Amount, user.Group)
 	if payMoney < 0.01 {
-		c.JSON(200, gin.H{"message": "error", "data": "充值金额过低"})
-		return
+		return nil, errors.New("充值金额过低")
 	}
-
 	if !operation_setting.ContainsPayMethod(req.PaymentMethod) {
-		c.JSON(200, gin.H{"message": "error", "data": "支付方式不存在"})
-		return
+		return nil, errors.New("支付方式不存在")
 	}
 
 	callBackAddress := service.GetCallbackAddress()
 	returnUrl, _ := url.Parse(system_setting.ServerAddress + "/console/log")
 	notifyUrl, _ := url.Parse(callBackAddress + "/api/user/epay/notify")
 	tradeNo := fmt.Sprintf("%s%d", common.GetRandomString(6), time.Now().Unix())
-	tradeNo = fmt.Sprintf("USR%dNO%s", id, tradeNo)
+	tradeNo = fmt.Sprintf("USR%dNO%s", user.Id, tradeNo)
 	client := GetEpayClient()
 	if client == nil {
-		c.JSON(200, gin.H{"message": "error", "data": "当前管理员未配置支付信息"})
-		return
+		return nil, errors.New("当前管理员未配置支付信息")
 	}
 	uri, params, err := client.Purchase(&epay.PurchaseArgs{
 		Type:           req.PaymentMethod,
@@ -176,8 +188,7 @@ func RequestEpay(c *gin.Context) {
 		ReturnUrl:      returnUrl,
 	})
 	if err != nil {
-		c.JSON(200, gin.H{"message": "error", "data": "拉起支付失败"})
-		return
+		return nil, errors.New("拉起支付失败")
 	}
 	amount := req.Amount
 	if operation_setting.GetQuotaDisplayType() == operation_setting.QuotaDisplayTypeTokens {
@@ -186,110 +197,126 @@ func RequestEpay(c *gin.Context) {
 		amount = dAmount.Div(dQuotaPerUnit).IntPart()
 	}
 	topUp := &model.TopUp{
-		UserId:        id,
+		UserId:        user.Id,
 		Amount:        amount,
 		Money:         payMoney,
 		TradeNo:       tradeNo,
 		PaymentMethod: req.PaymentMethod,
 		CreateTime:    time.Now().Unix(),
-		Status:        "pending",
-	}
-	err = topUp.Insert()
-	if err != nil {
-		c.JSON(200, gin.H{"message": "error", "data": "创建订单失败"})
-		return
-	}
-	c.JSON(200, gin.H{"message": "success", "data": params, "url": uri})
-}
-
-// tradeNo lock
-var orderLocks sync.Map
-var createLock sync.Mutex
-
-// LockOrder 尝试对给定订单号加锁
-func LockOrder(tradeNo string) {
-	lock, ok := orderLocks.Load(tradeNo)
-	if !ok {
-		createLock.Lock()
-		defer createLock.Unlock()
-		lock, ok = orderLocks.Load(tradeNo)
-		if !ok {
-			lock = new(sync.Mutex)
-			orderLocks.Store(tradeNo, lock)
-		}
+		Status:        common.TopUpStatusPending,
 	}
-	lock.(*sync.Mutex).Lock()
-}
-
-// UnlockOrder 释放给定订单号的锁
-func UnlockOrder(tradeNo string) {
-	lock, ok := orderLocks.Load(tradeNo)
-	if ok {
-		lock.(*sync.Mutex).Unlock()
+	if err := topUp.Insert(); err != nil {
+		return nil, errors.New("创建订单失败")
 	}
+	return &PaymentCheckout{Data: params, Url: uri}, nil
 }
 
-func EpayNotify(c *gin.Context) {
+func (*epayPaymentProvider) VerifyWebhook(c *gin.Context) (*PaymentEvent, error) {
 	params := lo.Reduce(lo.Keys(c.Request.URL.Query()), func(r map[string]string, t string, i int) map[string]string {
 		r[t] = c.Request.URL.Query().Get(t)
 		return r
 	}, map[string]string{})
 	client := GetEpayClient()
 	if client == nil {
-		log.Println("易支付回调失败 未找到配置信息")
-		_, err := c.Writer.Write([]byte("fail"))
-		if err != nil {
-			log.Println("易支付回调写入失败")
-		}
-		return
+		return nil, errors.New("未找到易支付配置信息")
 	}
 	verifyInfo, err := client.Verify(params)
-	if err == nil && verifyInfo.VerifyStatus {
-		_, err := c.Writer.Write([]byte("success"))
-		if err != nil {
-			log.Println("易支付回调写入失败")
-		}
-	} else {
-		_, err := c.Writer.Write([]byte("fail"))
-		if err != nil {
-			log.Println("易支付回调写入失败")
-		}
-		log.Println("易支付回调签名验证失败")
-		return
+	if err != nil || !verifyInfo.VerifyStatus {
+		return nil, errPaymentWebhookSignature
 	}
+	if verifyInfo.TradeStatus != epay.StatusTradeSuccess {
+		log.Printf("易支付异常回调: %v", verifyInfo)
+		return &PaymentEvent{Type: PaymentEventOther}, nil
+	}
+	// 易支付回调没有事件 ID，同一订单的同一状态视为同一事件
+	return &PaymentEvent{
+		Id:                verifyInfo.ServiceTradeNo + ":" + verifyInfo.TradeStatus,
+		Type:              PaymentEventPaid,
+		TradeNo:           verifyInfo.ServiceTradeNo,
+		ProviderPaymentId: verifyInfo.TradeNo,
+	}, nil
+}
 
-	if verifyInfo.TradeStatus == epay.StatusTradeSuccess {
-		log.Println(verifyInfo)
-		LockOrder(verifyInfo.ServiceTradeNo)
-		defer UnlockOrder(verifyInfo.ServiceTradeNo)
-		topUp := model.GetTopUpByTradeNo(verifyInfo.ServiceTradeNo)
-		if topUp == nil {
-			log.Printf("易支付回调未找到订单: %v", verifyInfo)
-			return
-		}
-		if topUp.Status == "pending" {
-			topUp.Status = "success"
-			err := topUp.Update()
-			if err != nil {
-				log.Printf("易支付回调更新订单失败: %v", topUp)
-				return
-			}
-			//user, _ := model.GetUserById(topUp.UserId, false)
-			//user.Quota += topUp.Amount * 500000
-			dAmount := decimal.NewFromInt(int64(topUp.Amount))
-			dQuotaPerUnit := decimal.NewFromFloat(common.QuotaPerUnit)
-			quotaToAdd := int(dAmount.Mul(dQuotaPerUnit).IntPart())
-			err = model.IncreaseUserQuota(topUp.UserId, quotaToAdd, true)
-			if err != nil {
-				log.Printf("易支付回调更新用户失败: %v", topUp)
-				return
-			}
-			log.Printf("易支付回调更新用户成功 %v", topUp)
-			model.RecordLog(topUp.UserId, model.LogTypeTopup, fmt.Sprintf("使用在线充值成功，充值金额: %v，支付金额：%f", logger.LogQuota(quotaToAdd), topUp.Money))
-		}
+// RespondWebhook 易支付以响应内容判断是否成功，返回 fail 时会重试通知
+func (*epayPaymentProvider) RespondWebhook(c *gin.Context, err error) {
+	result := "success"
+	if err != nil {
+		result = "fail"
+	}
+	if _, err := c.Writer.Write([]byte(result)); err != nil {
+		log.Println("易支付回调写入失败")
+	}
+}
+
+type epayApiResponse struct {
+	Code   any    `json:"code"`
+	Msg    string `json:"msg"`
+	Status any    `json:"status"`
+}
+
+// epayApi 调用易支付商户接口（api.php），code 为 1 表示成功
+func epayApi(method string, act string, params url.Values) (*epayApiResponse, error) {
+	if operation_setting.PayAddress == "" || operation_setting.EpayId == "" || operation_setting.EpayKey == "" {
+		return nil, errors.New("当前管理员未配置支付信息")
+	}
+	params.Set("act", act)
+	params.Set("pid", operation_setting.EpayId)
+	params.Set("key", operation_setting.EpayKey)
+	apiUrl := strings.TrimSuffix(operation_setting.PayAddress, "/") + "/api.php"
+	client := &http.Client{Timeout: 30 * time.Second}
+	var (
+		resp *http.Response
+		err  error
+	)
+	if method == http.MethodPost {
+		resp, err = client.PostForm(apiUrl, params)
 	} else {
-		log.Printf("易支付异常回调: %v", verifyInfo)
+		resp, err = client.Get(apiUrl + "?" + params.Encode())
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	var result epayApiResponse
+	if err := common.Unmarshal(body, &result); err != nil {
+		return nil, fmt.Errorf("解析易支付响应失败: %s", string(body))
 	}
+	if fmt.Sprint(result.Code) != "1" {
+		return nil, fmt.Errorf("易支付接口返回错误: %s", result.Msg)
+	}
+	return &result, nil
+}
+
+func (*epayPaymentProvider) QueryOrder(topUp *model.TopUp) (*PaymentOrderStatus, error) {
+	result, err := epayApi(http.MethodGet, "order", url.Values{"out_trade_no": {topUp.TradeNo}})
+	if err != nil {
+		return nil, err
+	}
+	// 易支付订单没有过期状态，未支付的订单由对账任务按超时时间过期
+	if fmt.Sprint(result.Status) == "1" {
+		return &PaymentOrderStatus{State: PaymentOrderPaid}, nil
+	}
+	return &PaymentOrderStatus{State: PaymentOrderPending}, nil
+}
+
+func (*epayPaymentProvider) Refund(topUp *model.TopUp, money float64) error {
+	_, err := epayApi(http.MethodPost, "refund", url.Values{
+		"out_trade_no": {topUp.TradeNo},
+		"money":        {strconv.FormatFloat(money, 'f', 2, 64)},
+	})
+	return err
+}
+
+func RequestEpay(c *gin.Context) {
+	requestPaymentOrder(c, epayProvider)
+}
+
+func EpayNotify(c *gin.Context) {
+	handlePaymentWebhook(c, epayProvider)
 }
 
 func RequestAmount(c *gin.Context) {
@@ -6,10 +6,12 @@ import (
 	"crypto/sha256"
 	"encoding/hex"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"log"
 	"net/http"
+	"net/url"
 	"github.com/QuantumNous/new-api/common"
 	"github.com/QuantumNous/new-api/model"
 	"github.com/QuantumNous/new-api/setting"
@@ -24,8 +26,6 @@ const (
 	CreemSignatureHeader = "creem-signature"
 )
 
-var creemAdaptor = &CreemAdaptor{}
-
 // 生成HMAC-SHA256签名
 func generateCreemSignature(payload string, secret string) string {
 	h := hmac.New(sha256.New, []byte(secret))
@@ -61,18 +61,18 @@ type CreemProduct struct {
 	Quota     int64   `json:"quota"`
 }
 
-type CreemAdaptor struct {
+type creemPaymentProvider struct{}
+
+func (*creemPaymentProvider) Name() string {
+	return PaymentMethodCreem
 }
 
-func (*CreemAdaptor) RequestPay(c *gin.Context, req *CreemPayRequest) {
+func (*creemPaymentProvider) CreateOrder(user *model.User, req *PaymentOrderRequest) (*PaymentCheckout, error) {
 	if req.PaymentMethod != PaymentMethodCreem {
-		c.JSON(200, gin.H{"message": "error", "data": "不支持的支付渠道"})
-		return
+		return nil, errors.New("不支持的支付渠道")
 	}
-
 	if req.ProductId == "" {
-		c.JSON(200, gin.H{"message": "error", "data": "请选择产品"})
-		return
+		return nil, errors.New("请选择产品")
 	}
 
 	// 解析产品列表
@@ -80,8 +80,7 @@ func (*CreemAdaptor) RequestPay(c *gin.Context, req *CreemPayRequest) {
 	err := json.Unmarshal([]byte(setting.CreemProducts), &products)
 	if err != nil {
 		log.Println("解析Creem产品列表失败", err)
-		c.JSON(200, gin.H{"message": "error", "data": "产品配置错误"})
-		return
+		return nil, errors.New("产品配置错误")
 	}
 
 	// 查找对应的产品
@@ -92,78 +91,187 @@ func (*CreemAdaptor) RequestPay(c *gin.Context, req *CreemPayRequest) {
 			break
 		}
 	}
-
 	if selectedProduct == nil {
-		c.JSON(200, gin.H{"message": "error", "data": "产品不存在"})
-		return
+		return nil, errors.New("产品不存在")
 	}
 
-	id := c.GetInt("id")
-	user, _ := model.GetUserById(id, false)
-
 	// 生成唯一的订单引用ID
 	reference := fmt.Sprintf("creem-api-ref-%d-%d-%s", user.Id, time.Now().UnixMilli(), randstr.String(4))
 	referenceId := "ref_" + common.Sha1([]byte(reference))
 
-	// 先创建订单记录，使用产品配置的金额和充值额度
-	topUp := &model.TopUp{
-		UserId:     id,
-		Amount:     selectedProduct.Quota, // 充值额度
-		Money:      selectedProduct.Price, // 支付金额
-		TradeNo:    referenceId,
-		CreateTime: time.Now().Unix(),
-		Status:     common.TopUpStatusPending,
-	}
-	err = topUp.Insert()
-	if err != nil {
-		log.Printf("创建Creem订单失败: %v", err)
-		c.JSON(200, gin.H{"message": "error", "data": "创建订单失败"})
-		return
-	}
-
 	// 创建支付链接，传入用户邮箱
-	checkoutUrl, err := genCreemLink(referenceId, selectedProduct, user.Email, user.Username)
+	checkoutUrl, checkoutId, err := genCreemLink(referenceId, selectedProduct, user.Email, user.Username)
 	if err != nil {
 		log.Printf("获取Creem支付链接失败: %v", err)
-		c.JSON(200, gin.H{"message": "error", "data": "拉起支付失败"})
-		return
+		return nil, errors.New("拉起支付失败")
+	}
+
+	// 使用产品配置的金额和充值额度创建订单记录
+	topUp := &model.TopUp{
+		UserId:          user.Id,
+		Amount:          selectedProduct.Quota, // 充值额度
+		Money:           selectedProduct.Price, // 支付金额
+		TradeNo:         referenceId,
+		PaymentMethod:   PaymentMethodCreem,
+		CreateTime:      time.Now().Unix(),
+		Status:          common.TopUpStatusPending,
+		ProviderOrderId: checkoutId,
+	}
+	if err := topUp.Insert(); err != nil {
+		log.Printf("创建Creem订单失败: %v", err)
+		return nil, errors.New("创建订单失败")
 	}
 
 	log.Printf("Creem订单创建成功 - 用户ID: %d, 订单号: %s, 产品: %s, 充值额度: %d, 支付金额: %.2f",
-		id, referenceId, selectedProduct.Name, selectedProduct.Quota, selectedProduct.Price)
+		user.Id, referenceId, selectedProduct.Name, selectedProduct.Quota, selectedProduct.Price)
 
-	c.JSON(200, gin.H{
-		"message": "success",
-		"data": gin.H{
-			"checkout_url": checkoutUrl,
-			"order_id":     referenceId,
-		},
-	})
+	return &PaymentCheckout{Data: gin.H{
+		"checkout_url": checkoutUrl,
+		"order_id":     referenceId,
+	}}, nil
 }
 
-func RequestCreemPay(c *gin.Context) {
-	var req CreemPayRequest
-
-	// 读取body内容用于打印，同时保留原始数据供后续使用
+func (*creemPaymentProvider) VerifyWebhook(c *gin.Context) (*PaymentEvent, error) {
 	bodyBytes, err := io.ReadAll(c.Request.Body)
 	if err != nil {
-		log.Printf("read creem pay req body err: %v", err)
-		c.JSON(200, gin.H{"message": "error", "data": "read query error"})
-		return
+		return nil, fmt.Errorf("%w: %v", errPaymentWebhookMalformed, err)
 	}
 
-	// 打印body内容
-	log.Printf("creem pay request body: %s", string(bodyBytes))
+	// 获取签名头
+	signature := c.GetHeader(CreemSignatureHeader)
 
-	// 重新设置body供后续的ShouldBindJSON使用
-	c.Request.Body = io.NopCloser(bytes.NewReader(bodyBytes))
+	// 打印关键信息（避免输出完整敏感payload）
+	log.Printf("Creem Webhook - URI: %s", c.Request.RequestURI)
+	if setting.CreemTestMode {
+		log.Printf("Creem Webhook - Signature: %s , Body: %s", signature, bodyBytes)
+	} else if signature == "" {
+		return nil, fmt.Errorf("%w: 缺少签名头", errPaymentWebhookSignature)
+	}
+	if !verifyCreemSignature(string(bodyBytes), signature, setting.CreemWebhookSecret) {
+		return nil, errPaymentWebhookSignature
+	}
 
-	err = c.ShouldBindJSON(&req)
-	if err != nil {
-		c.JSON(200, gin.H{"message": "error", "data": "参数错误"})
-		return
+	var webhookEvent CreemWebhookEvent
+	if err := json.Unmarshal(bodyBytes, &webhookEvent); err != nil {
+		return nil, fmt.Errorf("%w: %v", errPaymentWebhookMalformed, err)
+	}
+	log.Printf("Creem Webhook解析成功 - EventType: %s, EventId: %s", webhookEvent.EventType, webhookEvent.Id)
+
+	event := &PaymentEvent{Id: webhookEvent.Id, Type: PaymentEventOther}
+	switch webhookEvent.EventType {
+	case "checkout.completed":
+		return creemCheckoutCompletedEvent(event, &webhookEvent)
+	case "subscription.paid", "subscription.canceled", "subscription.expired":
+		event.Handle = func() error { return handleCreemSubscriptionEvent(bodyBytes) }
+	case "refund.created":
+		var refundEvent CreemRefundEvent
+		if err := json.Unmarshal(bodyBytes, &refundEvent); err != nil {
+			return nil, fmt.Errorf("%w: %v", errPaymentWebhookMalformed, err)
+		}
+		if refundEvent.Object.Order.Amount <= 0 {
+			break
+		}
+		// Creem 每次退款单独通知，refund_amount 为本次退款金额；以退款 ID 去重，同一笔退款重复通知时只扣回一次
+		if refundEvent.Object.Id != "" {
+			event.Id = "refund:" + refundEvent.Object.Id
+		}
+		event.Type = PaymentEventRefunded
+		event.TradeNo = refundEvent.Object.Checkout.RequestId
+		event.ProviderPaymentId = refundEvent.Object.Order.Id
+		event.RefundRatio = float64(refundEvent.Object.RefundAmount) / float64(refundEvent.Object.Order.Amount)
+	default:
+		log.Printf("忽略Creem Webhook事件类型: %s", webhookEvent.EventType)
+	}
+	return event, nil
+}
+
+// creemCheckoutCompletedEvent 处理支付完成事件，订阅商品的首次支付由订阅流程处理
+func creemCheckoutCompletedEvent(event *PaymentEvent, webhookEvent *CreemWebhookEvent) (*PaymentEvent, error) {
+	// 验证订单状态
+	if webhookEvent.Object.Order.Status != "paid" {
+		log.Printf("订单状态不是已支付: %s, 跳过处理", webhookEvent.Object.Order.Status)
+		return event, nil
+	}
+	// 获取引用ID（这是我们创建订单时传递的request_id）
+	referenceId := webhookEvent.Object.RequestId
+	if referenceId == "" {
+		return nil, fmt.Errorf("%w: 缺少request_id字段", errPaymentWebhookMalformed)
+	}
+	switch webhookEvent.Object.Order.Type {
+	case "recurring":
+		event.Handle = func() error { return handleCreemSubscriptionCheckout(webhookEvent) }
+		return event, nil
+	case "onetime":
+	default:
+		log.Printf("暂不支持的订单类型: %s, 跳过处理", webhookEvent.Object.Order.Type)
+		return event, nil
+	}
+
+	log.Printf("处理Creem支付完成 - 订单号: %s, Creem订单ID: %s, 支付金额: %d %s, 客户邮箱: <redacted>, 产品: %s",
+		referenceId,
+		webhookEvent.Object.Order.Id,
+		webhookEvent.Object.Order.AmountPaid,
+		webhookEvent.Object.Order.Currency,
+		webhookEvent.Object.Product.Name)
+
+	if webhookEvent.Object.Customer.Email == "" {
+		log.Printf("警告：Creem回调中客户邮箱为空 - 订单号: %s", referenceId)
+	}
+	event.Type = PaymentEventPaid
+	event.TradeNo = referenceId
+	event.ProviderPaymentId = webhookEvent.Object.Order.Id
+	event.Completion.CustomerEmail = webhookEvent.Object.Customer.Email
+	return event, nil
+}
+
+func (*creemPaymentProvider) RespondWebhook(c *gin.Context, err error) {
+	respondWebhookStatus(c, err)
+}
+
+type CreemCheckout struct {
+	Id        string `json:"id"`
+	Status    string `json:"status"`
+	RequestId string `json:"request_id"`
+	Order     struct {
+		Id     string `json:"id"`
+		Status string `json:"status"`
+	} `json:"order"`
+	Customer struct {
+		Email string `json:"email"`
+	} `json:"customer"`
+}
+
+func (*creemPaymentProvider) QueryOrder(topUp *model.TopUp) (*PaymentOrderStatus, error) {
+	// 早期订单未记录 Creem Checkout，无法查询
+	if topUp.ProviderOrderId == "" {
+		return nil, errPaymentNotSupported
+	}
+	var checkout CreemCheckout
+	if err := creemApiRequest(http.MethodGet, "/v1/checkouts?checkout_id="+url.QueryEscape(topUp.ProviderOrderId), nil, &checkout); err != nil {
+		return nil, err
 	}
-	creemAdaptor.RequestPay(c, &req)
+	switch checkout.Status {
+	case "completed":
+		if checkout.Order.Status != "" && checkout.Order.Status != "paid" {
+			return &PaymentOrderStatus{State: PaymentOrderPending}, nil
+		}
+		return &PaymentOrderStatus{State: PaymentOrderPaid, Completion: model.TopUpCompletion{
+			ProviderPaymentId: checkout.Order.Id,
+			CustomerEmail:     checkout.Customer.Email,
+		}}, nil
+	case "expired":
+		return &PaymentOrderStatus{State: PaymentOrderExpired}, nil
+	}
+	return &PaymentOrderStatus{State: PaymentOrderPending}, nil
+}
+
+// Refund Creem 未开放退款接口，需在 Creem 后台操作，额度在收到 refund.created 通知后扣回
+func (*creemPaymentProvider) Refund(topUp *model.TopUp, money float64) error {
+	return errors.New("Creem 不支持通过接口退款，请在 Creem 后台退款，收到退款通知后会自动扣回额度")
+}
+
+func RequestCreemPay(c *gin.Context) {
+	requestPaymentOrder(c, creemProvider)
 }
 
 // 新的Creem Webhook结构体，匹配实际的webhook数据格式
@@ -210,7 +318,11 @@ type CreemWebhookEvent struct {
 			UpdatedAt         string  `json:"updated_at"`
 			Mode              string  `json:"mode"`
 		} `json:"product"`
-		Units    int `json:"units"`
+		Units        int `json:"units"`
+		Subscription struct {
+			Id     string `json:"id"`
+			Status string `json:"status"`
+		} `json:"subscription"`
 		Customer struct {
 			Id        string `json:"id"`
 			Object    string `json:"object"`
@@ -237,128 +349,27 @@ type CreemWebhookData struct {
 	} `json:"data"`
 }
 
-func CreemWebhook(c *gin.Context) {
-	// 读取body内容用于打印，同时保留原始数据供后续使用
-	bodyBytes, err := io.ReadAll(c.Request.Body)
-	if err != nil {
-		log.Printf("读取Creem Webhook请求body失败: %v", err)
-		c.AbortWithStatus(http.StatusBadRequest)
-		return
-	}
-
-	// 获取签名头
-	signature := c.GetHeader(CreemSignatureHeader)
-
-	// 打印关键信息（避免输出完整敏感payload）
-	log.Printf("Creem Webhook - URI: %s", c.Request.RequestURI)
-	if setting.CreemTestMode {
-		log.Printf("Creem Webhook - Signature: %s , Body: %s", signature, bodyBytes)
-	} else if signature == "" {
-		log.Printf("Creem Webhook缺少签名头")
-		c.AbortWithStatus(http.StatusUnauthorized)
-		return
-	}
-
-	// 验证签名
-	if !verifyCreemSignature(string(bodyBytes), signature, setting.CreemWebhookSecret) {
-		log.Printf("Creem Webhook签名验证失败")
-		c.AbortWithStatus(http.StatusUnauthorized)
-		return
-	}
-
-	log.Printf("Creem Webhook签名验证成功")
-
-	// 重新设置body供后续的ShouldBindJSON使用
-	c.Request.Body = io.NopCloser(bytes.NewReader(bodyBytes))
-
-	// 解析新格式的webhook数据
-	var webhookEvent CreemWebhookEvent
-	if err := c.ShouldBindJSON(&webhookEvent); err != nil {
-		log.Printf("解析Creem Webhook参数失败: %v", err)
-		c.AbortWithStatus(http.StatusBadRequest)
-		return
-	}
-
-	log.Printf("Creem Webhook解析成功 - EventType: %s, EventId: %s", webhookEvent.EventType, webhookEvent.Id)
-
-	// 根据事件类型处理不同的webhook
-	switch webhookEvent.EventType {
-	case "checkout.completed":
-		handleCheckoutCompleted(c, &webhookEvent)
-	default:
-		log.Printf("忽略Creem Webhook事件类型: %s", webhookEvent.EventType)
-		c.Status(http.StatusOK)
-	}
+// CreemRefundEvent refund.created 事件，object 为退款对象
+type CreemRefundEvent struct {
+	Id        string `json:"id"`
+	EventType string `json:"eventType"`
+	Object    struct {
+		Id           string `json:"id"`
+		Status       string `json:"status"`
+		RefundAmount int    `json:"refund_amount"`
+		Checkout     struct {
+			Id        string `json:"id"`
+			RequestId string `json:"request_id"`
+		} `json:"checkout"`
+		Order struct {
+			Id     string `json:"id"`
+			Amount int    `json:"amount"`
+		} `json:"order"`
+	} `json:"object"`
 }
 
-// 处理支付完成事件
-func handleCheckoutCompleted(c *gin.Context, event *CreemWebhookEvent) {
-	// 验证订单状态
-	if event.Object.Order.Status != "paid" {
-		log.Printf("订单状态不是已支付: %s, 跳过处理", event.Object.Order.Status)
-		c.Status(http.StatusOK)
-		return
-	}
-
-	// 获取引用ID（这是我们创建订单时传递的request_id）
-	referenceId := event.Object.RequestId
-	if referenceId == "" {
-		log.Println("Creem Webhook缺少request_id字段")
-		c.AbortWithStatus(http.StatusBadRequest)
-		return
-	}
-
-	// 验证订单类型，目前只处理一次性付款
-	if event.Object.Order.Type != "onetime" {
-		log.Printf("暂不支持的订单类型: %s, 跳过处理", event.Object.Order.Type)
-		c.Status(http.StatusOK)
-		return
-	}
-
-	// 记录详细的支付信息
-	log.Printf("处理Creem支付完成 - 订单号: %s, Creem订单ID: %s, 支付金额: %d %s, 客户邮箱: <redacted>, 产品: %s",
-		referenceId,
-		event.Object.Order.Id,
-		event.Object.Order.AmountPaid,
-		event.Object.Order.Currency,
-		event.Object.Product.Name)
-
-	// 查询本地订单确认存在
-	topUp := model.GetTopUpByTradeNo(referenceId)
-	if topUp == nil {
-		log.Printf("Creem充值订单不存在: %s", referenceId)
-		c.AbortWithStatus(http.StatusBadRequest)
-		return
-	}
-
-	if topUp.Status != common.TopUpStatusPending {
-		log.Printf("Creem充值订单状态错误: %s, 当前状态: %s", referenceId, topUp.Status)
-		c.Status(http.StatusOK) // 已处理过的订单，返回成功避免重复处理
-		return
-	}
-
-	// 处理充值，传入客户邮箱和姓名信息
-	customerEmail := event.Object.Customer.Email
-	customerName := event.Object.Customer.Name
-
-	// 防护性检查，确保邮箱和姓名不为空字符串
-	if customerEmail == "" {
-		log.Printf("警告：Creem回调中客户邮箱为空 - 订单号: %s", referenceId)
-	}
-	if customerName == "" {
-		log.Printf("警告：Creem回调中客户姓名为空 - 订单号: %s", referenceId)
-	}
-
-	err := model.RechargeCreem(referenceId, customerEmail, customerName)
-	if err != nil {
-		log.Printf("Creem充值处理失败: %s, 订单号: %s", err.Error(), referenceId)
-		c.AbortWithStatus(http.StatusInternalServerError)
-		return
-	}
-
-	log.Printf("Creem充值成功 - 订单号: %s, 充值额度: %d, 支付金额: %.2f",
-		referenceId, topUp.Amount, topUp.Money)
-	c.Status(http.StatusOK)
+func CreemWebhook(c *gin.Context) {
+	handlePaymentWebhook(c, creemProvider)
 }
 
 type CreemCheckoutRequest struct {
@@ -375,9 +386,10 @@ type CreemCheckoutResponse struct {
 	Id          string `json:"id"`
 }
 
-func genCreemLink(referenceId string, product *CreemProduct, email string, username string) (string, error) {
+// genCreemLink 创建 Creem Checkout，返回支付链接与 Checkout ID
+func genCreemLink(referenceId string, product *CreemProduct, email string, username string) (string, string, error) {
 	if setting.CreemApiKey == "" {
-		return "", fmt.Errorf("未配置Creem API密钥")
+		return "", "", fmt.Errorf("未配置Creem API密钥")
 	}
 
 	// 根据测试模式选择 API 端点
@@ -407,13 +419,13 @@ func genCreemLink(referenceId string, product *CreemProduct, email string, usern
 	// 序列化请求数据
 	jsonData, err := json.Marshal(requestData)
 	if err != nil {
-		return "", fmt.Errorf("序列化请求数据失败: %v", err)
+		return "", "", fmt.Errorf("序列化请求数据失败: %v", err)
 	}
 
 	// 创建 HTTP 请求
 	req, err := http.NewRequest("POST", apiUrl, bytes.NewBuffer(jsonData))
 	if err != nil {
-		return "", fmt.Errorf("创建HTTP请求失败: %v", err)
+		return "", "", fmt.Errorf("创建HTTP请求失败: %v", err)
 	}
 
 	// 设置请求头
@@ -429,33 +441,33 @@ func genCreemLink(referenceId string, product *CreemProduct, email string, usern
 	}
 	resp, err := client.Do(req)
 	if err != nil {
-		return "", fmt.Errorf("发送HTTP请求失败: %v", err)
+		return "", "", fmt.Errorf("发送HTTP请求失败: %v", err)
 	}
 	defer resp.Body.Close()
 
 	// 读取响应
 	body, err := io.ReadAll(resp.Body)
 	if err != nil {
-		return "", fmt.Errorf("读取响应失败: %v", err)
+		return "", "", fmt.Errorf("读取响应失败: %v", err)
 	}
 
 	log.Printf("Creem API resp - status code: %d, resp: %s", resp.StatusCode, string(body))
 
 	// 检查响应状态
 	if resp.StatusCode/100 != 2 {
-		return "", fmt.Errorf("Creem API http status %d ", resp.StatusCode)
+		return "", "", fmt.Errorf("Creem API http status %d ", resp.StatusCode)
 	}
 	// 解析响应
 	var checkoutResp CreemCheckoutResponse
 	err = json.Unmarshal(body, &checkoutResp)
 	if err != nil {
-		return "", fmt.Errorf("解析响应失败: %v", err)
+		return "", "", fmt.Errorf("解析响应失败: %v", err)
 	}
 
 	if checkoutResp.CheckoutUrl == "" {
-		return "", fmt.Errorf("Creem API resp no checkout url ")
+		return "", "", fmt.Errorf("Creem API resp no checkout url ")
 	}
 
 	log.Printf("Creem 支付链接创建成功 - 订单号: %s, 支付链接: %s", referenceId, checkoutResp.CheckoutUrl)
-	return checkoutResp.CheckoutUrl, nil
+	return checkoutResp.CheckoutUrl, checkoutResp.Id, nil
 }
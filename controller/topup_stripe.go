@@ -1,10 +1,11 @@
 package controller
 
 import (
+	"errors"
 	"fmt"
 	"io"
 	"log"
-	"net/http"
+	"math"
 	"strconv"
 	"strings"
 	"time"
@@ -18,6 +19,8 @@ import (
 	"github.com/gin-gonic/gin"
 	"github.com/stripe/stripe-go/v81"
 	"github.com/stripe/stripe-go/v81/checkout/session"
+	"github.com/stripe/stripe-go/v81/paymentintent"
+	"github.com/stripe/stripe-go/v81/refund"
 	"github.com/stripe/stripe-go/v81/webhook"
 	"github.com/thanhpk/randstr"
 )
@@ -26,196 +29,215 @@ const (
 	PaymentMethodStripe = "stripe"
 )
 
-var stripeAdaptor = &StripeAdaptor{}
+type stripePaymentProvider struct{}
 
-type StripePayRequest struct {
-	Amount        int64  `json:"amount"`
-	PaymentMethod string `json:"payment_method"`
+func (*stripePaymentProvider) Name() string {
+	return PaymentMethodStripe
 }
 
-type StripeAdaptor struct {
-}
-
-func (*StripeAdaptor) RequestAmount(c *gin.Context, req *StripePayRequest) {
-	if req.Amount < getStripeMinTopup() {
-		c.JSON(200, gin.H{"message": "error", "data": fmt.Sprintf("充值数量不能小于 %d", getStripeMinTopup())})
-		return
-	}
-	id := c.GetInt("id")
-	group, err := model.GetUserGroup(id, true)
-	if err != nil {
-		c.JSON(200, gin.H{"message": "error", "data": "获取用户分组失败"})
-		return
-	}
-	payMoney := getStripePayMoney(float64(req.Amount), group)
-	if payMoney <= 0.01 {
-		c.JSON(200, gin.H{"message": "error", "data": "充值金额过低"})
-		return
-	}
-	c.JSON(200, gin.H{"message": "success", "data": strconv.FormatFloat(payMoney, 'f', 2, 64)})
-}
-
-func (*StripeAdaptor) RequestPay(c *gin.Context, req *StripePayRequest) {
+func (*stripePaymentProvider) CreateOrder(user *model.User, req *PaymentOrderRequest) (*PaymentCheckout, error) {
 	if req.PaymentMethod != PaymentMethodStripe {
-		c.JSON(200, gin.H{"message": "error", "data": "不支持的支付渠道"})
-		return
+		return nil, errors.New("不支持的支付渠道")
 	}
 	if req.Amount < getStripeMinTopup() {
-		c.JSON(200, gin.H{"message": fmt.Sprintf("充值数量不能小于 %d", getStripeMinTopup()), "data": 10})
-		return
+		return nil, fmt.Errorf("充值数量不能小于 %d", getStripeMinTopup())
 	}
 	if req.Amount > 10000 {
-		c.JSON(200, gin.H{"message": "充值数量不能大于 10000", "data": 10})
-		return
+		return nil, errors.New("充值数量不能大于 10000")
 	}
-
-	id := c.GetInt("id")
-	user, _ := model.GetUserById(id, false)
 	chargedMoney := GetChargedAmount(float64(req.Amount), *user)
 
 	reference := fmt.Sprintf("new-api-ref-%d-%d-%s", user.Id, time.Now().UnixMilli(), randstr.String(4))
 	referenceId := "ref_" + common.Sha1([]byte(reference))
 
-	payLink, err := genStripeLink(referenceId, user.StripeCustomer, user.Email, req.Amount)
+	checkout, err := genStripeLink(referenceId, user.StripeCustomer, user.Email, req.Amount)
 	if err != nil {
 		log.Println("获取Stripe Checkout支付链接失败", err)
-		c.JSON(200, gin.H{"message": "error", "data": "拉起支付失败"})
-		return
+		return nil, errors.New("拉起支付失败")
 	}
 
 	topUp := &model.TopUp{
-		UserId:        id,
-		Amount:        req.Amount,
-		Money:         chargedMoney,
-		TradeNo:       referenceId,
-		PaymentMethod: PaymentMethodStripe,
-		CreateTime:    time.Now().Unix(),
-		Status:        common.TopUpStatusPending,
+		UserId:          user.Id,
+		Amount:          req.Amount,
+		Money:           chargedMoney,
+		TradeNo:         referenceId,
+		PaymentMethod:   PaymentMethodStripe,
+		CreateTime:      time.Now().Unix(),
+		Status:          common.TopUpStatusPending,
+		ProviderOrderId: checkout.ID,
 	}
-	err = topUp.Insert()
-	if err != nil {
-		c.JSON(200, gin.H{"message": "error", "data": "创建订单失败"})
-		return
+	if err := topUp.Insert(); err != nil {
+		return nil, errors.New("创建订单失败")
 	}
-	c.JSON(200, gin.H{
-		"message": "success",
-		"data": gin.H{
-			"pay_link": payLink,
-		},
-	})
+	return &PaymentCheckout{Data: gin.H{"pay_link": checkout.URL}}, nil
 }
 
-func RequestStripeAmount(c *gin.Context) {
-	var req StripePayRequest
-	err := c.ShouldBindJSON(&req)
-	if err != nil {
-		c.JSON(200, gin.H{"message": "error", "data": "参数错误"})
-		return
-	}
-	stripeAdaptor.RequestAmount(c, &req)
-}
-
-func RequestStripePay(c *gin.Context) {
-	var req StripePayRequest
-	err := c.ShouldBindJSON(&req)
-	if err != nil {
-		c.JSON(200, gin.H{"message": "error", "data": "参数错误"})
-		return
-	}
-	stripeAdaptor.RequestPay(c, &req)
-}
-
-func StripeWebhook(c *gin.Context) {
+func (*stripePaymentProvider) VerifyWebhook(c *gin.Context) (*PaymentEvent, error) {
 	payload, err := io.ReadAll(c.Request.Body)
 	if err != nil {
-		log.Printf("解析Stripe Webhook参数失败: %v\n", err)
-		c.AbortWithStatus(http.StatusServiceUnavailable)
-		return
+		return nil, fmt.Errorf("%w: %v", errPaymentWebhookMalformed, err)
 	}
-
 	signature := c.GetHeader("Stripe-Signature")
-	endpointSecret := setting.StripeWebhookSecret
-	event, err := webhook.ConstructEventWithOptions(payload, signature, endpointSecret, webhook.ConstructEventOptions{
+	event, err := webhook.ConstructEventWithOptions(payload, signature, setting.StripeWebhookSecret, webhook.ConstructEventOptions{
 		IgnoreAPIVersionMismatch: true,
 	})
-
 	if err != nil {
-		log.Printf("Stripe Webhook验签失败: %v\n", err)
-		c.AbortWithStatus(http.StatusBadRequest)
-		return
+		return nil, fmt.Errorf("%w: %v", errPaymentWebhookSignature, err)
 	}
 
+	paymentEvent := &PaymentEvent{Id: event.ID, Type: PaymentEventOther}
 	switch event.Type {
-	case stripe.EventTypeCheckoutSessionCompleted:
-		sessionCompleted(event)
+	case stripe.EventTypeCheckoutSessionCompleted, stripe.EventTypeCheckoutSessionAsyncPaymentSucceeded:
+		if event.GetObjectValue("mode") == string(stripe.CheckoutSessionModeSubscription) {
+			paymentEvent.Handle = func() error { return stripeSubscriptionCheckoutCompleted(event) }
+			break
+		}
+		referenceId := event.GetObjectValue("client_reference_id")
+		status := event.GetObjectValue("status")
+		if status != string(stripe.CheckoutSessionStatusComplete) {
+			log.Println("错误的Stripe Checkout完成状态:", status, ",", referenceId)
+			break
+		}
+		// 异步支付方式在 checkout.session.async_payment_succeeded 时才到账
+		if event.GetObjectValue("payment_status") == string(stripe.CheckoutSessionPaymentStatusUnpaid) {
+			log.Println("Stripe Checkout等待异步支付:", referenceId)
+			break
+		}
+		total, _ := strconv.ParseFloat(event.GetObjectValue("amount_total"), 64)
+		currency := strings.ToUpper(event.GetObjectValue("currency"))
+		log.Printf("收到款项：%s, %.2f(%s)", referenceId, total/100, currency)
+		paymentEvent.Type = PaymentEventPaid
+		paymentEvent.TradeNo = referenceId
+		paymentEvent.ProviderPaymentId = event.GetObjectValue("payment_intent")
+		paymentEvent.Completion.StripeCustomer = event.GetObjectValue("customer")
 	case stripe.EventTypeCheckoutSessionExpired:
-		sessionExpired(event)
+		if event.GetObjectValue("mode") == string(stripe.CheckoutSessionModeSubscription) {
+			break
+		}
+		paymentEvent.Type = PaymentEventExpired
+		paymentEvent.TradeNo = event.GetObjectValue("client_reference_id")
+	case stripe.EventTypeChargeRefunded:
+		var charge stripe.Charge
+		if err := common.Unmarshal(event.Data.Raw, &charge); err != nil {
+			return nil, fmt.Errorf("%w: %v", errPaymentWebhookMalformed, err)
+		}
+		if charge.PaymentIntent == nil || charge.Amount <= 0 {
+			break
+		}
+		// charge.refunded 携带累计退款金额，多次部分退款时按累计比例计算
+		paymentEvent.Type = PaymentEventRefunded
+		paymentEvent.ProviderPaymentId = charge.PaymentIntent.ID
+		paymentEvent.RefundRatio = float64(charge.AmountRefunded) / float64(charge.Amount)
+		paymentEvent.RefundCumulative = true
+	case stripe.EventTypeInvoicePaid:
+		paymentEvent.Handle = func() error { return stripeInvoicePaid(event) }
+	case stripe.EventTypeInvoicePaymentFailed:
+		paymentEvent.Handle = func() error { return stripeInvoicePaymentFailed(event) }
+	case stripe.EventTypeCustomerSubscriptionUpdated:
+		paymentEvent.Handle = func() error { return stripeSubscriptionUpdated(event) }
+	case stripe.EventTypeCustomerSubscriptionDeleted:
+		paymentEvent.Handle = func() error { return stripeSubscriptionDeleted(event) }
 	default:
 		log.Printf("不支持的Stripe Webhook事件类型: %s\n", event.Type)
 	}
+	return paymentEvent, nil
+}
 
-	c.Status(http.StatusOK)
+func (*stripePaymentProvider) RespondWebhook(c *gin.Context, err error) {
+	respondWebhookStatus(c, err)
 }
 
-func sessionCompleted(event stripe.Event) {
-	customerId := event.GetObjectValue("customer")
-	referenceId := event.GetObjectValue("client_reference_id")
-	status := event.GetObjectValue("status")
-	if "complete" != status {
-		log.Println("错误的Stripe Checkout完成状态:", status, ",", referenceId)
-		return
+func (*stripePaymentProvider) QueryOrder(topUp *model.TopUp) (*PaymentOrderStatus, error) {
+	// 早期订单未记录 Checkout Session，无法查询
+	if topUp.ProviderOrderId == "" {
+		return nil, errPaymentNotSupported
 	}
-
-	err := model.Recharge(referenceId, customerId)
+	if err := initStripeClient(); err != nil {
+		return nil, err
+	}
+	result, err := session.Get(topUp.ProviderOrderId, nil)
 	if err != nil {
-		log.Println(err.Error(), referenceId)
-		return
+		return nil, err
 	}
-
-	total, _ := strconv.ParseFloat(event.GetObjectValue("amount_total"), 64)
-	currency := strings.ToUpper(event.GetObjectValue("currency"))
-	log.Printf("收到款项：%s, %.2f(%s)", referenceId, total/100, currency)
+	switch {
+	case result.Status == stripe.CheckoutSessionStatusComplete && result.PaymentStatus != stripe.CheckoutSessionPaymentStatusUnpaid:
+		status := &PaymentOrderStatus{State: PaymentOrderPaid}
+		if result.PaymentIntent != nil {
+			status.Completion.ProviderPaymentId = result.PaymentIntent.ID
+		}
+		if result.Customer != nil {
+			status.Completion.StripeCustomer = result.Customer.ID
+		}
+		return status, nil
+	case result.Status == stripe.CheckoutSessionStatusExpired:
+		return &PaymentOrderStatus{State: PaymentOrderExpired}, nil
+	}
+	return &PaymentOrderStatus{State: PaymentOrderPending}, nil
 }
 
-func sessionExpired(event stripe.Event) {
-	referenceId := event.GetObjectValue("client_reference_id")
-	status := event.GetObjectValue("status")
-	if "expired" != status {
-		log.Println("错误的Stripe Checkout过期状态:", status, ",", referenceId)
-		return
+// Refund 按退款金额占订单金额的比例退还 PaymentIntent 的实付金额（已扣除优惠码等折扣）
+func (*stripePaymentProvider) Refund(topUp *model.TopUp, money float64) error {
+	if topUp.ProviderPaymentId == "" {
+		return errors.New("订单缺少 Stripe 付款信息，请在 Stripe 后台退款后使用线下退款")
 	}
-
-	if len(referenceId) == 0 {
-		log.Println("未提供支付单号")
-		return
+	if topUp.Money <= 0 {
+		return errors.New("订单金额错误")
+	}
+	if err := initStripeClient(); err != nil {
+		return err
 	}
+	intent, err := paymentintent.Get(topUp.ProviderPaymentId, nil)
+	if err != nil {
+		return err
+	}
+	amount := int64(math.Round(float64(intent.Amount) * money / topUp.Money))
+	if amount <= 0 {
+		return errors.New("退款金额过低")
+	}
+	_, err = refund.New(&stripe.RefundParams{
+		PaymentIntent: stripe.String(topUp.ProviderPaymentId),
+		Amount:        stripe.Int64(amount),
+	})
+	return err
+}
 
-	topUp := model.GetTopUpByTradeNo(referenceId)
-	if topUp == nil {
-		log.Println("充值订单不存在", referenceId)
+func RequestStripeAmount(c *gin.Context) {
+	var req AmountRequest
+	err := c.ShouldBindJSON(&req)
+	if err != nil {
+		c.JSON(200, gin.H{"message": "error", "data": "参数错误"})
 		return
 	}
-
-	if topUp.Status != common.TopUpStatusPending {
-		log.Println("充值订单状态错误", referenceId)
+	if req.Amount < getStripeMinTopup() {
+		c.JSON(200, gin.H{"message": "error", "data": fmt.Sprintf("充值数量不能小于 %d", getStripeMinTopup())})
+		return
 	}
-
-	topUp.Status = common.TopUpStatusExpired
-	err := topUp.Update()
+	id := c.GetInt("id")
+	group, err := model.GetUserGroup(id, true)
 	if err != nil {
-		log.Println("过期充值订单失败", referenceId, ", err:", err.Error())
+		c.JSON(200, gin.H{"message": "error", "data": "获取用户分组失败"})
 		return
 	}
+	payMoney := getStripePayMoney(float64(req.Amount), group)
+	if payMoney <= 0.01 {
+		c.JSON(200, gin.H{"message": "error", "data": "充值金额过低"})
+		return
+	}
+	c.JSON(200, gin.H{"message": "success", "data": strconv.FormatFloat(payMoney, 'f', 2, 64)})
+}
 
-	log.Println("充值订单已过期", referenceId)
+func RequestStripePay(c *gin.Context) {
+	requestPaymentOrder(c, stripeProvider)
 }
 
-func genStripeLink(referenceId string, customerId string, email string, amount int64) (string, error) {
-	if !strings.HasPrefix(setting.StripeApiSecret, "sk_") && !strings.HasPrefix(setting.StripeApiSecret, "rk_") {
-		return "", fmt.Errorf("无效的Stripe API密钥")
-	}
+func StripeWebhook(c *gin.Context) {
+	handlePaymentWebhook(c, stripeProvider)
+}
 
-	stripe.Key = setting.StripeApiSecret
+func genStripeLink(referenceId string, customerId string, email string, amount int64) (*stripe.CheckoutSession, error) {
+	if err := initStripeClient(); err != nil {
+		return nil, err
+	}
 
 	params := &stripe.CheckoutSessionParams{
 		ClientReferenceID: stripe.String(referenceId),
@@ -241,12 +263,7 @@ func genStripeLink(referenceId string, customerId string, email string, amount i
 		params.Customer = stripe.String(customerId)
 	}
 
-	result, err := session.New(params)
-	if err != nil {
-		return "", err
-	}
-
-	return result.URL, nil
+	return session.New(params)
 }
 
 func GetChargedAmount(count float64, user model.User) float64 {
@@ -15,6 +15,8 @@ import (
 	"github.com/QuantumNous/new-api/model"
 	"github.com/QuantumNous/new-api/service"
 	"github.com/QuantumNous/new-api/setting"
+	"github.com/QuantumNous/new-api/setting/system_setting"
+	"github.com/QuantumNous/new-api/types"
 
 	"github.com/QuantumNous/new-api/constant"
 
@@ -66,6 +68,11 @@ func Login(c *gin.Context) {
 		return
 	}
 
+	loginWithTwoFA(&user, c)
+}
+
+// loginWithTwoFA 用户启用了两步验证时先要求输入验证码，否则直接完成登录
+func loginWithTwoFA(user *model.User, c *gin.Context) {
 	// 检查是否启用2FA
 	if model.IsTwoFAEnabled(user.Id) {
 		// 设置pending session，等待2FA验证
@@ -91,7 +98,7 @@ func Login(c *gin.Context) {
 		return
 	}
 
-	setupLogin(&user, c)
+	setupLogin(user, c)
 }
 
 // setup session & cookies and then return user info
@@ -641,7 +648,7 @@ func UpdateUser(c *gin.Context) {
 		updatedUser.Password = "" // rollback to what it should be
 	}
 	updatePassword := updatedUser.Password != ""
-	if err := updatedUser.Edit(updatePassword); err != nil {
+	if err := updatedUser.Edit(updatePassword, fmt.Sprintf("admin #%d", c.GetInt("id"))); err != nil {
 		common.ApiError(c, err)
 		return
 	}
@@ -1109,6 +1116,8 @@ type UpdateUserSettingRequest struct {
 	GotifyPriority             int     `json:"gotify_priority,omitempty"`
 	AcceptUnsetModelRatioModel bool    `json:"accept_unset_model_ratio_model"`
 	RecordIpLog                bool    `json:"record_ip_log"`
+	ErrorLanguage              *string `json:"error_language,omitempty"`
+	MediaRetentionDays         *int    `json:"media_retention_days,omitempty"`
 }
 
 func UpdateUserSetting(c *gin.Context) {
@@ -1231,6 +1240,27 @@ func UpdateUserSetting(c *gin.Context) {
 		}
 	}
 
+	// 验证错误信息语言，空字符串表示跟随请求的 Accept-Language
+	if req.ErrorLanguage != nil && *req.ErrorLanguage != "" && !types.IsSupportedErrorLanguage(*req.ErrorLanguage) {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": "无效的错误信息语言",
+		})
+		return
+	}
+
+	// 验证生成结果保留天数，0 表示使用系统默认值
+	if req.MediaRetentionDays != nil {
+		maxRetentionDays := system_setting.GetMediaStorageSetting().MaxRetentionDays
+		if *req.MediaRetentionDays < 0 || (maxRetentionDays > 0 && *req.MediaRetentionDays > maxRetentionDays) {
+			c.JSON(http.StatusOK, gin.H{
+				"success": false,
+				"message": fmt.Sprintf("生成结果保留天数必须在 0 到 %d 之间", maxRetentionDays),
+			})
+			return
+		}
+	}
+
 	userId := c.GetInt("id")
 	user, err := model.GetUserById(userId, true)
 	if err != nil {
@@ -1244,6 +1274,14 @@ func UpdateUserSetting(c *gin.Context) {
 		QuotaWarningThreshold: req.QuotaWarningThreshold,
 		AcceptUnsetRatioModel: req.AcceptUnsetModelRatioModel,
 		RecordIpLog:           req.RecordIpLog,
+		ErrorLanguage:         user.GetSetting().ErrorLanguage,
+	}
+	if req.ErrorLanguage != nil {
+		settings.ErrorLanguage = *req.ErrorLanguage
+	}
+	settings.MediaRetentionDays = user.GetSetting().MediaRetentionDays
+	if req.MediaRetentionDays != nil {
+		settings.MediaRetentionDays = *req.MediaRetentionDays
 	}
 
 	// 如果是webhook类型,添加webhook相关设置
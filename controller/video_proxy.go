@@ -1,16 +1,20 @@
 package controller
 
 import (
+	"context"
 	"fmt"
 	"io"
 	"net/http"
 	"net/url"
 	"time"
 
+	"github.com/QuantumNous/new-api/common"
 	"github.com/QuantumNous/new-api/constant"
 	"github.com/QuantumNous/new-api/logger"
 	"github.com/QuantumNous/new-api/model"
+	"github.com/QuantumNous/new-api/service"
 
+	"github.com/bytedance/gopkg/util/gopool"
 	"github.com/gin-gonic/gin"
 )
 
@@ -58,6 +62,14 @@ func VideoProxy(c *gin.Context) {
 		return
 	}
 
+	// 已持久化保存的视频直接从存储返回，上游链接过期后仍可访问
+	asset, err := model.GetMediaAssetBySource(model.MediaSourceVideo, task.TaskID)
+	if err == nil && asset != nil {
+		if err := service.ServeMediaAsset(c, asset); err == nil {
+			return
+		}
+	}
+
 	channel, err := model.CacheGetChannel(task.ChannelId)
 	if err != nil {
 		logger.LogError(c.Request.Context(), fmt.Sprintf("Failed to get task %s: not found", taskID))
@@ -170,8 +182,29 @@ func VideoProxy(c *gin.Context) {
 
 	c.Writer.Header().Set("Cache-Control", "public, max-age=86400") // Cache for 24 hours
 	c.Writer.WriteHeader(resp.StatusCode)
-	_, err = io.Copy(c.Writer, resp.Body)
+	// 需要鉴权才能下载的视频（如 Sora）无法在任务完成时保存，首次代理时边转发边保存
+	var body io.Reader = resp.Body
+	var capture *service.MediaCapture
+	if asset == nil && service.MediaStorageEnabled(model.MediaSourceVideo) {
+		capture = service.NewMediaCapture()
+		body = io.TeeReader(resp.Body, capture)
+	}
+	_, err = io.Copy(c.Writer, body)
 	if err != nil {
 		logger.LogError(c.Request.Context(), fmt.Sprintf("Failed to stream video content: %s", err.Error()))
+		return
+	}
+	if capture != nil {
+		contentType := resp.Header.Get("Content-Type")
+		gopool.Go(func() {
+			data, err := capture.Bytes()
+			if err == nil {
+				asset := service.NewMediaAsset(task.UserId, model.MediaSourceVideo, task.TaskID)
+				err = service.StoreMediaAsset(context.Background(), asset, contentType, data)
+			}
+			if err != nil {
+				common.SysError(fmt.Sprintf("failed to persist video task %s: %s", task.TaskID, err.Error()))
+			}
+		})
 	}
 }
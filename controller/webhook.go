@@ -0,0 +1,233 @@
+package controller
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/model"
+	"github.com/QuantumNous/new-api/service"
+	"github.com/QuantumNous/new-api/setting/operation_setting"
+
+	"github.com/gin-gonic/gin"
+	"github.com/samber/lo"
+)
+
+type webhookSubscriptionRequest struct {
+	Name    string   `json:"name"`
+	Url     string   `json:"url"`
+	Secret  string   `json:"secret"`
+	Events  []string `json:"events"`
+	Enabled *bool    `json:"enabled"`
+}
+
+func (req *webhookSubscriptionRequest) validate() error {
+	if _, err := url.ParseRequestURI(req.Url); err != nil || !(strings.HasPrefix(req.Url, "https://") || strings.HasPrefix(req.Url, "http://")) {
+		return errors.New("无效的 Webhook 地址")
+	}
+	if len(req.Name) > 64 {
+		return errors.New("名称不能超过 64 个字符")
+	}
+	if len(req.Secret) > 128 {
+		return errors.New("签名密钥不能超过 128 个字符")
+	}
+	for _, event := range req.Events {
+		if !lo.Contains(model.WebhookEventTypes, event) {
+			return fmt.Errorf("不支持的事件类型：%s", event)
+		}
+	}
+	return nil
+}
+
+// GetWebhookEventTypes 返回可订阅的事件类型
+func GetWebhookEventTypes(c *gin.Context) {
+	common.ApiSuccess(c, model.WebhookEventTypes)
+}
+
+func GetSelfWebhookSubscriptions(c *gin.Context) {
+	subscriptions, err := model.GetUserWebhookSubscriptions(c.GetInt("id"))
+	if err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	common.ApiSuccess(c, subscriptions)
+}
+
+// CreateSelfWebhookSubscription 创建订阅，未提供签名密钥时自动生成
+func CreateSelfWebhookSubscription(c *gin.Context) {
+	var req webhookSubscriptionRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	if err := req.validate(); err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	userId := c.GetInt("id")
+	count, err := model.CountUserWebhookSubscriptions(userId)
+	if err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	if maxCount := operation_setting.GetWebhookSetting().MaxSubscriptionsPerUser; maxCount > 0 && count >= int64(maxCount) {
+		common.ApiErrorMsg(c, fmt.Sprintf("最多只能创建 %d 个 Webhook 订阅", maxCount))
+		return
+	}
+	subscription := &model.WebhookSubscription{
+		UserId:  userId,
+		Name:    req.Name,
+		Url:     req.Url,
+		Secret:  req.Secret,
+		Events:  strings.Join(req.Events, ","),
+		Enabled: req.Enabled == nil || *req.Enabled,
+	}
+	if subscription.Secret == "" {
+		subscription.Secret = "whsec_" + common.GetRandomString(32)
+	}
+	if err := subscription.Insert(); err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	common.ApiSuccess(c, subscription)
+}
+
+func UpdateSelfWebhookSubscription(c *gin.Context) {
+	subscription, ok := getSelfWebhookSubscription(c)
+	if !ok {
+		return
+	}
+	var req webhookSubscriptionRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	if err := req.validate(); err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	subscription.Name = req.Name
+	subscription.Url = req.Url
+	subscription.Events = strings.Join(req.Events, ",")
+	if req.Secret != "" {
+		subscription.Secret = req.Secret
+	}
+	if req.Enabled != nil {
+		subscription.Enabled = *req.Enabled
+	}
+	if err := subscription.Update(); err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	common.ApiSuccess(c, subscription)
+}
+
+func DeleteSelfWebhookSubscription(c *gin.Context) {
+	subscription, ok := getSelfWebhookSubscription(c)
+	if !ok {
+		return
+	}
+	if err := subscription.Delete(); err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	common.ApiSuccess(c, nil)
+}
+
+// PingSelfWebhookSubscription 向订阅发送一条 ping 事件并返回投递结果
+func PingSelfWebhookSubscription(c *gin.Context) {
+	subscription, ok := getSelfWebhookSubscription(c)
+	if !ok {
+		return
+	}
+	delivery, err := service.PingWebhookSubscription(subscription)
+	if err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	common.ApiSuccess(c, delivery)
+}
+
+func getSelfWebhookSubscription(c *gin.Context) (*model.WebhookSubscription, bool) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		common.ApiError(c, err)
+		return nil, false
+	}
+	subscription, err := model.GetWebhookSubscriptionById(id, c.GetInt("id"))
+	if err != nil {
+		common.ApiErrorMsg(c, "Webhook 订阅不存在")
+		return nil, false
+	}
+	return subscription, true
+}
+
+func GetSelfWebhookDeliveries(c *gin.Context) {
+	pageInfo := common.GetPageQuery(c)
+	subscriptionId, _ := strconv.Atoi(c.Query("subscription_id"))
+	deliveries, total, err := model.GetUserWebhookDeliveries(c.GetInt("id"), subscriptionId, c.Query("status"), pageInfo.GetStartIdx(), pageInfo.GetPageSize())
+	if err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	pageInfo.SetTotal(int(total))
+	pageInfo.SetItems(deliveries)
+	common.ApiSuccess(c, pageInfo)
+}
+
+// RedeliverSelfWebhookDelivery 手动重新投递已成功或已失败的投递
+func RedeliverSelfWebhookDelivery(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	delivery, err := model.GetWebhookDeliveryById(id, c.GetInt("id"))
+	if err != nil {
+		common.ApiErrorMsg(c, "投递记录不存在")
+		return
+	}
+	if err := service.RedeliverWebhook(delivery); err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	common.ApiSuccess(c, delivery)
+}
+
+var autoProcessWebhookDeliveriesOnce sync.Once
+
+// AutomaticallyProcessWebhookDeliveries 定期重试到期的投递、扫描即将过期的令牌并清理过期的投递记录
+func AutomaticallyProcessWebhookDeliveries() {
+	if !service.CanRunJobs() {
+		return
+	}
+	autoProcessWebhookDeliveriesOnce.Do(func() {
+		var lastTokenScan, lastCleanup time.Time
+		for {
+			time.Sleep(10 * time.Second)
+			setting := operation_setting.GetWebhookSetting()
+			if !setting.Enabled || !service.IsJobLeader(service.JobWebhookDelivery) {
+				continue
+			}
+			service.ProcessWebhookDeliveries()
+			if time.Since(lastTokenScan) >= 10*time.Minute {
+				lastTokenScan = time.Now()
+				service.NotifyTokenExpiringWebhooks()
+			}
+			if setting.DeliveryRetentionDays > 0 && time.Since(lastCleanup) >= time.Hour {
+				lastCleanup = time.Now()
+				before := time.Now().AddDate(0, 0, -setting.DeliveryRetentionDays).Unix()
+				if deleted, err := model.DeleteWebhookDeliveriesBefore(before); err != nil {
+					common.SysError("failed to clean up webhook deliveries: " + err.Error())
+				} else if deleted > 0 {
+					common.SysLog(fmt.Sprintf("cleaned up %d webhook deliveries", deleted))
+				}
+			}
+		}
+	})
+}
@@ -23,14 +23,77 @@ const (
 	AwsKeyTypeApiKey AwsKeyType = "api_key"
 )
 
+// RerankFormat 重排序上游的接口格式
+type RerankFormat string
+
+const (
+	RerankFormatJina      RerankFormat = "jina"       // 默认，Jina/Cohere 兼容的 /v1/rerank
+	RerankFormatTEI       RerankFormat = "tei"        // HuggingFace Text Embeddings Inference 的 /rerank
+	RerankFormatVllmScore RerankFormat = "vllm_score" // vLLM 的 /v1/score
+)
+
 type ChannelOtherSettings struct {
-	AzureResponsesVersion string        `json:"azure_responses_version,omitempty"`
-	VertexKeyType         VertexKeyType `json:"vertex_key_type,omitempty"` // "json" or "api_key"
-	OpenRouterEnterprise  *bool         `json:"openrouter_enterprise,omitempty"`
-	AllowServiceTier      bool          `json:"allow_service_tier,omitempty"`      // 是否允许 service_tier 透传（默认过滤以避免额外计费）
-	DisableStore          bool          `json:"disable_store,omitempty"`           // 是否禁用 store 透传（默认允许透传，禁用后可能导致 Codex 无法使用）
-	AllowSafetyIdentifier bool          `json:"allow_safety_identifier,omitempty"` // 是否允许 safety_identifier 透传（默认过滤以保护用户隐私）
-	AwsKeyType            AwsKeyType    `json:"aws_key_type,omitempty"`
+	AzureResponsesVersion string            `json:"azure_responses_version,omitempty"`
+	VertexKeyType         VertexKeyType     `json:"vertex_key_type,omitempty"` // "json" or "api_key"
+	OpenRouterEnterprise  *bool             `json:"openrouter_enterprise,omitempty"`
+	AllowServiceTier      bool              `json:"allow_service_tier,omitempty"`      // 是否允许 service_tier 透传（默认过滤以避免额外计费）
+	DisableStore          bool              `json:"disable_store,omitempty"`           // 是否禁用 store 透传（默认允许透传，禁用后可能导致 Codex 无法使用）
+	AllowSafetyIdentifier bool              `json:"allow_safety_identifier,omitempty"` // 是否允许 safety_identifier 透传（默认过滤以保护用户隐私）
+	AwsKeyType            AwsKeyType        `json:"aws_key_type,omitempty"`
+	RealtimeEmulation     bool              `json:"realtime_emulation,omitempty"`      // 上游不支持 Realtime WebSocket 时，由网关基于流式对话补全模拟实时接口
+	Template              *ChannelTemplate  `json:"template,omitempty"`                // 仅模板渠道使用
+	Simulator             *ChannelSimulator `json:"simulator,omitempty"`               // 仅模拟渠道使用
+	RecordTraffic         bool              `json:"record_traffic,omitempty"`          // 将脱敏后的上游请求和响应录制到磁盘，供回放渠道复现
+	Replay                *ChannelReplay    `json:"replay,omitempty"`                  // 仅回放渠道使用
+	RerankFormat          RerankFormat      `json:"rerank_format,omitempty"`           // 重排序上游的接口格式，为空时按 jina 格式
+	EmbeddingBatchSize    int               `json:"embedding_batch_size,omitempty"`    // 嵌入请求单次的最大输入条数，超出时拆分为子批次并发请求，0 使用渠道类型的默认值，-1 表示不拆分
+	EmbeddingNoDimensions bool              `json:"embedding_no_dimensions,omitempty"` // 上游不支持 dimensions 参数，由网关截断向量并重新归一化
+	EmbeddingNoBase64     bool              `json:"embedding_no_base64,omitempty"`     // 上游不支持 base64 编码，由网关在本地编码
+}
+
+// ChannelTemplate 模板渠道的声明式配置，用于在不新增适配器的情况下接入 OpenAI 类上游。
+// 路径均为 gjson 语法，响应路径为空时按 OpenAI 格式处理对应响应
+type ChannelTemplate struct {
+	RequestURL       string `json:"request_url"`                  // 请求地址，支持 {base_url}、{model} 变量
+	StreamRequestURL string `json:"stream_request_url,omitempty"` // 流式请求地址，为空时使用 RequestURL
+	AuthHeader       string `json:"auth_header,omitempty"`        // 鉴权请求头，默认 Authorization
+	AuthValue        string `json:"auth_value,omitempty"`         // 鉴权请求头的值，支持 {api_key} 变量，默认 Bearer {api_key}
+	// 上游请求体模板，字符串值中的 {{路径}} 从 OpenAI 请求取值，整个值为 {{路径}} 时保留原类型，
+	// 另支持 {{$prompt}}、{{$system}}、{{$last_user_message}}；为空时原样转发 OpenAI 请求
+	RequestMapping       map[string]any `json:"request_mapping,omitempty"`
+	ContentPath          string         `json:"content_path,omitempty"`
+	ReasoningPath        string         `json:"reasoning_path,omitempty"`
+	FinishReasonPath     string         `json:"finish_reason_path,omitempty"`
+	PromptTokensPath     string         `json:"prompt_tokens_path,omitempty"`
+	CompletionTokensPath string         `json:"completion_tokens_path,omitempty"`
+	// 流式数据块中的字段路径，为空时使用对应的非流式路径
+	StreamContentPath      string `json:"stream_content_path,omitempty"`
+	StreamReasoningPath    string `json:"stream_reasoning_path,omitempty"`
+	StreamFinishReasonPath string `json:"stream_finish_reason_path,omitempty"`
+	StreamDelimiter        string `json:"stream_delimiter,omitempty"` // 数据块分隔符，默认换行，数据块的 data: 前缀会被去除
+	DoneSentinel           string `json:"done_sentinel,omitempty"`    // 数据块等于该值时结束，默认 [DONE]
+	DonePath               string `json:"done_path,omitempty"`        // 数据块中该路径为 true 时结束
+}
+
+// ChannelSimulator 模拟渠道配置，在本地生成响应用于压测和故障演练，各比例取值 0 到 1
+type ChannelSimulator struct {
+	TTFTMs           int     `json:"ttft_ms,omitempty"`           // 首字延迟（毫秒）
+	TokensPerSecond  float64 `json:"tokens_per_second,omitempty"` // 输出速度，0 表示不限速
+	OutputTokens     int     `json:"output_tokens,omitempty"`     // 输出长度，默认 64，不超过请求的 max_tokens
+	PromptTokens     int     `json:"prompt_tokens,omitempty"`     // 上报的输入用量，0 时使用网关估算值
+	CompletionTokens int     `json:"completion_tokens,omitempty"` // 上报的输出用量，0 时等于输出长度
+	RateLimitRate    float64 `json:"rate_limit_rate,omitempty"`   // 返回 429 的比例
+	ServerErrorRate  float64 `json:"server_error_rate,omitempty"` // 返回 500 的比例
+	TimeoutRate      float64 `json:"timeout_rate,omitempty"`      // 请求超时的比例
+	TimeoutMs        int     `json:"timeout_ms,omitempty"`        // 模拟超时前的等待时长（毫秒），默认 30000
+	MalformedRate    float64 `json:"malformed_rate,omitempty"`    // 流式响应中插入无法解析的数据块的比例
+	DisconnectRate   float64 `json:"disconnect_rate,omitempty"`   // 流式响应中途断开的比例
+}
+
+// ChannelReplay 回放渠道配置，按请求指纹读取录制文件代替上游响应
+type ChannelReplay struct {
+	ChannelType  int  `json:"channel_type"`            // 录制时的渠道类型，决定使用哪个适配器转换请求和响应
+	IgnoreTiming bool `json:"ignore_timing,omitempty"` // 忽略录制的时间间隔，立即返回全部数据
 }
 
 func (s *ChannelOtherSettings) IsOpenRouterEnterprise() bool {
@@ -34,7 +34,8 @@ func (r *RerankRequest) GetTokenCountMeta() *types.TokenCountMeta {
 	}
 
 	return &types.TokenCountMeta{
-		CombineText: strings.Join(texts, "\n"),
+		CombineText:   strings.Join(texts, "\n"),
+		DocumentCount: len(r.Documents),
 	}
 }
 
@@ -13,6 +13,8 @@ type UserSetting struct {
 	AcceptUnsetRatioModel bool    `json:"accept_unset_model_ratio_model,omitempty"` // AcceptUnsetRatioModel 是否接受未设置价格的模型
 	RecordIpLog           bool    `json:"record_ip_log,omitempty"`                  // 是否记录请求和错误日志IP
 	SidebarModules        string  `json:"sidebar_modules,omitempty"`                // SidebarModules 左侧边栏模块配置
+	ErrorLanguage         string  `json:"error_language,omitempty"`                 // ErrorLanguage 接口错误信息语言，为空时按请求的 Accept-Language
+	MediaRetentionDays    int     `json:"media_retention_days,omitempty"`           // MediaRetentionDays 生成结果保留天数，为 0 时使用系统默认值
 }
 
 var (
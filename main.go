@@ -90,9 +90,19 @@ func main() {
 	// 热更新配置
 	go model.SyncOptions(common.SyncFrequency)
 
+	// 跨节点即时缓存失效，定时同步作为兜底
+	go model.SubscribeCacheEvents()
+
 	// 数据看板
 	go model.UpdateQuotaData()
 
+	// 模型可用性统计与故障检测
+	go model.UpdateModelStatusData()
+	go controller.AutomaticallyCheckModelIncidents()
+
+	// 后台任务租约竞选，未启用时沿用 NODE_TYPE 判断主节点
+	service.StartLeaderElection()
+
 	if os.Getenv("CHANNEL_UPDATE_FREQUENCY") != "" {
 		frequency, err := strconv.Atoi(os.Getenv("CHANNEL_UPDATE_FREQUENCY"))
 		if err != nil {
@@ -103,7 +113,21 @@ func main() {
 
 	go controller.AutomaticallyTestChannels()
 
-	if common.IsMasterNode && constant.UpdateTask {
+	go controller.AutomaticallyRecoverChannelKeys()
+
+	go controller.AutomaticallyReconcileQuotaLedger()
+
+	go controller.AutomaticallyGenerateMonthlyStatements()
+
+	go controller.AutomaticallyCheckSubscriptions()
+
+	go controller.AutomaticallyReconcilePendingTopUps()
+
+	go controller.AutomaticallyCleanupMediaAssets()
+
+	go controller.AutomaticallyProcessWebhookDeliveries()
+
+	if service.CanRunJobs() && constant.UpdateTask {
 		gopool.Go(func() {
 			controller.UpdateMidjourneyTaskBulk()
 		})
@@ -320,6 +344,9 @@ func executeLogContentCleanup() {
 	if !common.ContentLoggingEnabled || common.ContentRetentionDays <= 0 {
 		return
 	}
+	if !service.IsJobLeader(service.JobLogContentCleanup) {
+		return
+	}
 
 	common.SysLog(fmt.Sprintf("Starting log content cleanup task, retention days: %d", common.ContentRetentionDays))
 
@@ -359,6 +386,9 @@ func startTokenQuotaResetTask() {
 
 // executeTokenQuotaReset 执行令牌额度重置
 func executeTokenQuotaReset() {
+	if !service.IsJobLeader(service.JobTokenQuotaReset) {
+		return
+	}
 	common.SysLog("Starting token quota reset task")
 
 	rowsAffected, err := model.ResetTokenQuotas()
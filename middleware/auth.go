@@ -1,6 +1,7 @@
 package middleware
 
 import (
+	"errors"
 	"fmt"
 	"net/http"
 	"strconv"
@@ -11,6 +12,7 @@ import (
 	"github.com/QuantumNous/new-api/model"
 	"github.com/QuantumNous/new-api/service"
 	"github.com/QuantumNous/new-api/setting/ratio_setting"
+	"github.com/QuantumNous/new-api/types"
 
 	"github.com/gin-contrib/sessions"
 	"github.com/gin-gonic/gin"
@@ -236,7 +238,7 @@ func TokenAuth() func(c *gin.Context) {
 			}
 		}
 		if err != nil {
-			abortWithOpenAiMessage(c, http.StatusUnauthorized, err.Error())
+			abortWithTokenError(c, key, err)
 			return
 		}
 
@@ -244,7 +246,7 @@ func TokenAuth() func(c *gin.Context) {
 		if len(allowIpsMap) != 0 {
 			clientIp := c.ClientIP()
 			if _, ok := allowIpsMap[clientIp]; !ok {
-				abortWithOpenAiMessage(c, http.StatusForbidden, "您的 IP 不在令牌允许访问的列表中")
+				abortWithLocalizedMessage(c, http.StatusForbidden, types.ErrorCodeIpNotAllowed)
 				return
 			}
 		}
@@ -256,7 +258,7 @@ func TokenAuth() func(c *gin.Context) {
 		}
 		userEnabled := userCache.Status == common.UserStatusEnabled
 		if !userEnabled {
-			abortWithOpenAiMessage(c, http.StatusForbidden, "用户已被封禁")
+			abortWithLocalizedMessage(c, http.StatusForbidden, types.ErrorCodeUserBanned)
 			return
 		}
 
@@ -267,13 +269,13 @@ func TokenAuth() func(c *gin.Context) {
 		if tokenGroup != "" {
 			// check common.UserUsableGroups[userGroup]
 			if _, ok := service.GetUserUsableGroups(userGroup)[tokenGroup]; !ok {
-				abortWithOpenAiMessage(c, http.StatusForbidden, fmt.Sprintf("无权访问 %s 分组", tokenGroup))
+				abortWithLocalizedMessage(c, http.StatusForbidden, types.ErrorCodeGroupAccessDenied, tokenGroup)
 				return
 			}
 			// check group in common.GroupRatio
 			if !ratio_setting.ContainsGroupRatio(tokenGroup) {
 				if tokenGroup != "auto" {
-					abortWithOpenAiMessage(c, http.StatusForbidden, fmt.Sprintf("分组 %s 已被弃用", tokenGroup))
+					abortWithLocalizedMessage(c, http.StatusForbidden, types.ErrorCodeGroupDeprecated, tokenGroup)
 					return
 				}
 			}
@@ -289,6 +291,24 @@ func TokenAuth() func(c *gin.Context) {
 	}
 }
 
+// abortWithTokenError 将令牌校验失败的原因转换为错误码返回
+func abortWithTokenError(c *gin.Context, key string, err error) {
+	switch {
+	case errors.Is(err, model.ErrTokenNotProvided):
+		abortWithLocalizedMessage(c, http.StatusUnauthorized, types.ErrorCodeTokenNotProvided)
+	case errors.Is(err, model.ErrTokenInvalid):
+		abortWithLocalizedMessage(c, http.StatusUnauthorized, types.ErrorCodeTokenInvalid)
+	case errors.Is(err, model.ErrTokenExpired):
+		abortWithLocalizedMessage(c, http.StatusUnauthorized, types.ErrorCodeTokenExpired)
+	case errors.Is(err, model.ErrTokenUnavailable):
+		abortWithLocalizedMessage(c, http.StatusUnauthorized, types.ErrorCodeTokenUnavailable)
+	case errors.Is(err, model.ErrTokenQuotaExhausted):
+		abortWithLocalizedMessage(c, http.StatusUnauthorized, types.ErrorCodeTokenQuotaExhausted, "sk-"+key[:3]+"***"+key[len(key)-3:])
+	default:
+		abortWithOpenAiMessage(c, http.StatusUnauthorized, err.Error())
+	}
+}
+
 func SetupContextForToken(c *gin.Context, token *model.Token, parts ...string) error {
 	if token == nil {
 		return fmt.Errorf("token is nil")
@@ -308,11 +328,12 @@ func SetupContextForToken(c *gin.Context, token *model.Token, parts ...string) e
 		c.Set("token_model_limit_enabled", false)
 	}
 	c.Set("token_group", token.Group)
+	c.Set("token_hedge_enabled", token.HedgeEnabled)
 	if len(parts) > 1 {
 		if model.IsAdmin(token.UserId) {
 			c.Set("specific_channel_id", parts[1])
 		} else {
-			abortWithOpenAiMessage(c, http.StatusForbidden, "普通用户不支持指定渠道")
+			abortWithLocalizedMessage(c, http.StatusForbidden, types.ErrorCodeSpecificChannelForbidden)
 			return fmt.Errorf("普通用户不支持指定渠道")
 		}
 	}
@@ -38,16 +38,16 @@ func Distribute() func(c *gin.Context) {
 		if ok {
 			id, err := strconv.Atoi(channelId.(string))
 			if err != nil {
-				abortWithOpenAiMessage(c, http.StatusBadRequest, "无效的渠道 Id")
+				abortWithLocalizedMessage(c, http.StatusBadRequest, types.ErrorCodeInvalidChannelId)
 				return
 			}
 			channel, err = model.GetChannelById(id, true)
 			if err != nil {
-				abortWithOpenAiMessage(c, http.StatusBadRequest, "无效的渠道 Id")
+				abortWithLocalizedMessage(c, http.StatusBadRequest, types.ErrorCodeInvalidChannelId)
 				return
 			}
 			if channel.Status != common.ChannelStatusEnabled {
-				abortWithOpenAiMessage(c, http.StatusForbidden, "该渠道已被禁用")
+				abortWithLocalizedMessage(c, http.StatusForbidden, types.ErrorCodeChannelDisabled)
 				return
 			}
 		} else {
@@ -58,7 +58,7 @@ func Distribute() func(c *gin.Context) {
 				s, ok := common.GetContextKey(c, constant.ContextKeyTokenModelLimit)
 				if !ok {
 					// token model limit is empty, all models are not allowed
-					abortWithOpenAiMessage(c, http.StatusForbidden, "该令牌无权访问任何模型")
+					abortWithLocalizedMessage(c, http.StatusForbidden, types.ErrorCodeTokenNoModels)
 					return
 				}
 				var tokenModelLimit map[string]bool
@@ -68,14 +68,14 @@ func Distribute() func(c *gin.Context) {
 				}
 				matchName := ratio_setting.FormatMatchingModelName(modelRequest.Model) // match gpts & thinking-*
 				if _, ok := tokenModelLimit[matchName]; !ok {
-					abortWithOpenAiMessage(c, http.StatusForbidden, "该令牌无权访问模型 "+modelRequest.Model)
+					abortWithLocalizedMessage(c, http.StatusForbidden, types.ErrorCodeTokenModelNotAllowed, modelRequest.Model)
 					return
 				}
 			}
 
 			if shouldSelectChannel {
 				if modelRequest.Model == "" {
-					abortWithOpenAiMessage(c, http.StatusBadRequest, "未指定模型名称，模型名称不能为空")
+					abortWithLocalizedMessage(c, http.StatusBadRequest, types.ErrorCodeModelNameRequired)
 					return
 				}
 				var selectGroup string
@@ -90,20 +90,25 @@ func Distribute() func(c *gin.Context) {
 					}
 					if playgroundRequest.Group != "" {
 						if !service.GroupInUserUsableGroups(usingGroup, playgroundRequest.Group) && playgroundRequest.Group != usingGroup {
-							abortWithOpenAiMessage(c, http.StatusForbidden, "无权访问该分组")
+							abortWithLocalizedMessage(c, http.StatusForbidden, types.ErrorCodeGroupAccessDenied, playgroundRequest.Group)
 							return
 						}
 						usingGroup = playgroundRequest.Group
 						common.SetContextKey(c, constant.ContextKeyUsingGroup, usingGroup)
 					}
 				}
-				channel, selectGroup, err = service.CacheGetRandomSatisfiedChannel(c, usingGroup, modelRequest.Model, 0)
+				routing := applyRoutingRules(c, modelRequest.Model, usingGroup)
+				if routing != nil && routing.Model != "" {
+					modelRequest.Model = routing.Model
+				}
+				channel, selectGroup, modelRequest.Model, err = service.CacheGetRoutedChannel(c, usingGroup, modelRequest.Model, 0)
 				if err != nil {
 					showGroup := usingGroup
 					if usingGroup == "auto" {
 						showGroup = fmt.Sprintf("auto(%s)", selectGroup)
 					}
-					message := fmt.Sprintf("获取分组 %s 下模型 %s 的可用渠道失败（distributor）: %s", showGroup, modelRequest.Model, err.Error())
+					message, _ := types.LocalizeErrorMessage(types.ErrorCodeModelNotFound, service.GetErrorLanguage(c), modelRequest.Model, showGroup)
+					message += ": " + err.Error()
 					// 如果错误，但是渠道不为空，说明是数据库一致性问题
 					//if channel != nil {
 					//	common.SysError(fmt.Sprintf("渠道不存在：%d", channel.Id))
@@ -113,14 +118,18 @@ func Distribute() func(c *gin.Context) {
 					return
 				}
 				if channel == nil {
-					abortWithOpenAiMessage(c, http.StatusServiceUnavailable, fmt.Sprintf("分组 %s 下模型 %s 无可用渠道（distributor）", usingGroup, modelRequest.Model), string(types.ErrorCodeModelNotFound))
+					abortWithLocalizedMessage(c, http.StatusServiceUnavailable, types.ErrorCodeModelNotFound, modelRequest.Model, usingGroup)
 					return
 				}
 			}
 		}
 		common.SetContextKey(c, constant.ContextKeyRequestStartTime, time.Now())
 		SetupContextForSelectedChannel(c, channel, modelRequest.Model)
+		// 渠道响应覆盖在写回下游时统一应用
+		writer := newResponseOverrideWriter(c)
+		c.Writer = writer
 		c.Next()
+		writer.finish()
 	}
 }
 
@@ -307,6 +316,7 @@ func SetupContextForSelectedChannel(c *gin.Context, channel *model.Channel, mode
 	common.SetContextKey(c, constant.ContextKeyChannelOtherSetting, channel.GetOtherSettings())
 	common.SetContextKey(c, constant.ContextKeyChannelParamOverride, channel.GetParamOverride())
 	common.SetContextKey(c, constant.ContextKeyChannelHeaderOverride, channel.GetHeaderOverride())
+	common.SetContextKey(c, constant.ContextKeyChannelResponseOverride, channel.GetResponseOverride())
 	if nil != channel.OpenAIOrganization && *channel.OpenAIOrganization != "" {
 		common.SetContextKey(c, constant.ContextKeyChannelOrganization, *channel.OpenAIOrganization)
 	}
@@ -0,0 +1,196 @@
+package middleware
+
+import (
+	"bufio"
+	"bytes"
+	"net"
+	"strconv"
+	"strings"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/constant"
+	relaycommon "github.com/QuantumNous/new-api/relay/common"
+
+	"github.com/gin-gonic/gin"
+	"github.com/tidwall/gjson"
+)
+
+const (
+	responseOverrideModeUndecided = iota
+	responseOverrideModePassthrough
+	responseOverrideModeJSON
+	responseOverrideModeSSE
+)
+
+// responseOverrideWriter 在写回下游时统一应用当前渠道的响应覆盖，适配器无论以何种方式写出响应体都会经过这里：
+// JSON 响应缓存后在请求结束时整体改写，SSE 响应逐行改写 data 数据块，错误响应和其他类型原样写出
+type responseOverrideWriter struct {
+	gin.ResponseWriter
+	c      *gin.Context // 提供渠道响应覆盖的上下文，对冲请求胜出时切换为对冲请求的上下文
+	mode   int
+	buffer bytes.Buffer // JSON 模式下缓存的响应体，SSE 模式下尚未结束的行
+}
+
+func newResponseOverrideWriter(c *gin.Context) *responseOverrideWriter {
+	return &responseOverrideWriter{ResponseWriter: c.Writer, c: c}
+}
+
+// decide 在首次写出时根据渠道配置、状态码和响应类型确定处理方式
+func (w *responseOverrideWriter) decide() {
+	if w.mode != responseOverrideModeUndecided {
+		return
+	}
+	w.mode = responseOverrideModePassthrough
+	if len(common.GetContextKeyStringMap(w.c, constant.ContextKeyChannelResponseOverride)) == 0 || w.Status() >= 400 {
+		return
+	}
+	contentType := w.Header().Get("Content-Type")
+	switch {
+	case strings.HasPrefix(contentType, "text/event-stream"):
+		w.mode = responseOverrideModeSSE
+	case strings.Contains(contentType, "json"):
+		w.mode = responseOverrideModeJSON
+	}
+}
+
+func (w *responseOverrideWriter) Write(data []byte) (int, error) {
+	w.decide()
+	switch w.mode {
+	case responseOverrideModeJSON:
+		return w.buffer.Write(data)
+	case responseOverrideModeSSE:
+		w.buffer.Write(data)
+		return len(data), w.writeSSELines(false)
+	default:
+		return w.ResponseWriter.Write(data)
+	}
+}
+
+func (w *responseOverrideWriter) WriteString(s string) (int, error) {
+	return w.Write([]byte(s))
+}
+
+func (w *responseOverrideWriter) WriteHeaderNow() {
+	w.decide()
+	// JSON 响应改写后长度会变化，响应头在请求结束时随响应体一起发送
+	if w.mode == responseOverrideModeJSON {
+		return
+	}
+	w.ResponseWriter.WriteHeaderNow()
+}
+
+func (w *responseOverrideWriter) Flush() {
+	if w.mode == responseOverrideModeJSON {
+		return
+	}
+	w.ResponseWriter.Flush()
+}
+
+func (w *responseOverrideWriter) Written() bool {
+	if w.mode == responseOverrideModeJSON && w.buffer.Len() > 0 {
+		return true
+	}
+	return w.ResponseWriter.Written()
+}
+
+func (w *responseOverrideWriter) Size() int {
+	if w.mode == responseOverrideModeJSON && !w.ResponseWriter.Written() {
+		if w.buffer.Len() == 0 {
+			return -1
+		}
+		return w.buffer.Len()
+	}
+	return w.ResponseWriter.Size()
+}
+
+func (w *responseOverrideWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	w.mode = responseOverrideModePassthrough
+	return w.ResponseWriter.Hijack()
+}
+
+// writeSSELines 改写并写出缓存中完整的行，final 为 true 时连同最后不完整的行一起写出
+func (w *responseOverrideWriter) writeSSELines(final bool) error {
+	for {
+		data := w.buffer.Bytes()
+		i := bytes.IndexByte(data, '\n')
+		if i < 0 {
+			break
+		}
+		if _, err := w.ResponseWriter.Write(w.rewriteSSELine(data[:i+1])); err != nil {
+			return err
+		}
+		w.buffer.Next(i + 1)
+	}
+	if final && w.buffer.Len() > 0 {
+		_, err := w.ResponseWriter.Write(w.rewriteSSELine(w.buffer.Bytes()))
+		w.buffer.Reset()
+		return err
+	}
+	return nil
+}
+
+func (w *responseOverrideWriter) rewriteSSELine(line []byte) []byte {
+	content := bytes.TrimRight(line, "\r\n")
+	payload, ok := bytes.CutPrefix(content, []byte("data:"))
+	if !ok {
+		return line
+	}
+	payload = bytes.TrimPrefix(payload, []byte(" "))
+	if !gjson.ValidBytes(payload) {
+		return line
+	}
+	rewritten := relaycommon.ApplyChannelResponseOverride(w.c, payload)
+	result := make([]byte, 0, len(rewritten)+len(line)-len(payload))
+	result = append(result, "data: "...)
+	result = append(result, rewritten...)
+	return append(result, line[len(content):]...)
+}
+
+// finish 在请求处理结束后写出缓存的响应
+func (w *responseOverrideWriter) finish() {
+	switch w.mode {
+	case responseOverrideModeJSON:
+		if w.buffer.Len() == 0 {
+			w.ResponseWriter.WriteHeaderNow()
+			return
+		}
+		data := relaycommon.ApplyChannelResponseOverride(w.c, w.buffer.Bytes())
+		w.buffer.Reset()
+		if w.Header().Get("Content-Length") != "" {
+			w.Header().Set("Content-Length", strconv.Itoa(len(data)))
+		}
+		_, _ = w.ResponseWriter.Write(data)
+	case responseOverrideModeSSE:
+		_ = w.writeSSELines(true)
+	}
+}
+
+// boundResponseOverrideWriter 以另一个上下文的渠道响应覆盖写出，用于对冲请求共享下游响应
+type boundResponseOverrideWriter struct {
+	*responseOverrideWriter
+	c *gin.Context
+}
+
+// WithResponseOverrideContext 返回按 c 中的渠道应用响应覆盖的 writer，w 未启用响应覆盖时原样返回
+func WithResponseOverrideContext(w gin.ResponseWriter, c *gin.Context) gin.ResponseWriter {
+	writer, ok := w.(*responseOverrideWriter)
+	if !ok {
+		return w
+	}
+	return &boundResponseOverrideWriter{responseOverrideWriter: writer, c: c}
+}
+
+func (w *boundResponseOverrideWriter) Write(data []byte) (int, error) {
+	w.responseOverrideWriter.c = w.c
+	return w.responseOverrideWriter.Write(data)
+}
+
+func (w *boundResponseOverrideWriter) WriteString(s string) (int, error) {
+	w.responseOverrideWriter.c = w.c
+	return w.responseOverrideWriter.WriteString(s)
+}
+
+func (w *boundResponseOverrideWriter) WriteHeaderNow() {
+	w.responseOverrideWriter.c = w.c
+	w.responseOverrideWriter.WriteHeaderNow()
+}
@@ -0,0 +1,93 @@
+package middleware
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/constant"
+	"github.com/QuantumNous/new-api/dto"
+	"github.com/QuantumNous/new-api/logger"
+	"github.com/QuantumNous/new-api/service"
+	"github.com/QuantumNous/new-api/setting/operation_setting"
+	"github.com/QuantumNous/new-api/types"
+
+	"github.com/gin-gonic/gin"
+)
+
+// applyRoutingRules 评估路由规则并记录命中结果，未启用或未命中时返回 nil
+func applyRoutingRules(c *gin.Context, modelName string, group string) *service.RoutingDecision {
+	if !operation_setting.RoutingEnabled() {
+		return nil
+	}
+	decision := service.MatchRoutingRule(buildRoutingRequest(c, modelName, group))
+	if decision == nil {
+		return nil
+	}
+	decision.RequestModel = modelName
+	service.SetRoutingDecision(c, decision)
+	logger.LogDebug(c, fmt.Sprintf("routing rule matched: %s", decision.Rule))
+	return decision
+}
+
+func buildRoutingRequest(c *gin.Context, modelName string, group string) *service.RoutingRequest {
+	routingRequest := &service.RoutingRequest{
+		Model:     modelName,
+		Group:     group,
+		UserGroup: common.GetContextKeyString(c, constant.ContextKeyUserGroup),
+		TokenName: c.GetString("token_name"),
+		Header:    c.Request.Header,
+	}
+	request := parseRoutingRequestBody(c)
+	if request == nil {
+		return routingRequest
+	}
+	routingRequest.Stream = request.IsStream(c)
+	meta := request.GetTokenCountMeta()
+	if meta == nil {
+		return routingRequest
+	}
+	routingRequest.HasTools = meta.ToolsCount > 0
+	for _, file := range meta.Files {
+		switch file.FileType {
+		case types.FileTypeImage:
+			routingRequest.HasImage = true
+		case types.FileTypeAudio:
+			routingRequest.HasAudio = true
+		case types.FileTypeVideo:
+			routingRequest.HasVideo = true
+		case types.FileTypeFile:
+			routingRequest.HasFile = true
+		}
+	}
+	// 计数结果缓存在上下文中，后续预扣费计算输入 token 时复用
+	routingRequest.PromptTokens = func() int {
+		return service.CountRequestTextToken(c, meta.CombineText, modelName)
+	}
+	return routingRequest
+}
+
+// parseRoutingRequestBody 按请求路径解析对话类请求，其他请求只能按模型、分组和请求头路由
+func parseRoutingRequestBody(c *gin.Context) dto.Request {
+	path := c.Request.URL.Path
+	var request dto.Request
+	switch {
+	case strings.HasSuffix(path, "/chat/completions"), strings.HasSuffix(path, "/v1/completions"):
+		request = &dto.GeneralOpenAIRequest{}
+	case strings.HasSuffix(path, "/v1/messages"):
+		request = &dto.ClaudeRequest{}
+	case strings.HasSuffix(path, "/v1/responses"):
+		request = &dto.OpenAIResponsesRequest{}
+	case strings.HasPrefix(path, "/v1beta/models/"), strings.HasPrefix(path, "/v1/models/"):
+		if !strings.Contains(path, ":generateContent") && !strings.Contains(path, ":streamGenerateContent") {
+			return nil
+		}
+		request = &dto.GeminiChatRequest{}
+	default:
+		return nil
+	}
+	if err := common.UnmarshalBodyReusable(c, request); err != nil {
+		return nil
+	}
+	return request
+}
@@ -0,0 +1,40 @@
+package middleware
+
+import (
+	"crypto/subtle"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/QuantumNous/new-api/setting/system_setting"
+
+	"github.com/gin-gonic/gin"
+)
+
+func abortWithScimError(c *gin.Context, status int, detail string) {
+	c.Header("Content-Type", "application/scim+json; charset=utf-8")
+	c.AbortWithStatusJSON(status, gin.H{
+		"schemas": []string{"urn:ietf:params:scim:api:messages:2.0:Error"},
+		"status":  strconv.Itoa(status),
+		"detail":  detail,
+	})
+}
+
+// ScimAuth 校验身份提供方携带的 SCIM Bearer 令牌
+func ScimAuth() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		settings := system_setting.GetSCIMSettings()
+		if !settings.Enabled || settings.Token == "" {
+			abortWithScimError(c, http.StatusForbidden, "SCIM provisioning is disabled")
+			return
+		}
+		authorization := c.GetHeader("Authorization")
+		token, ok := strings.CutPrefix(authorization, "Bearer ")
+		if !ok || subtle.ConstantTimeCompare([]byte(strings.TrimSpace(token)), []byte(settings.Token)) != 1 {
+			c.Header("WWW-Authenticate", `Bearer realm="scim"`)
+			abortWithScimError(c, http.StatusUnauthorized, "invalid SCIM bearer token")
+			return
+		}
+		c.Next()
+	}
+}
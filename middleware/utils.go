@@ -5,6 +5,8 @@ import (
 
 	"github.com/QuantumNous/new-api/common"
 	"github.com/QuantumNous/new-api/logger"
+	"github.com/QuantumNous/new-api/service"
+	"github.com/QuantumNous/new-api/types"
 	"github.com/gin-gonic/gin"
 )
 
@@ -25,6 +27,12 @@ func abortWithOpenAiMessage(c *gin.Context, statusCode int, message string, code
 	logger.LogError(c.Request.Context(), fmt.Sprintf("user %d | %s", userId, message))
 }
 
+// abortWithLocalizedMessage 以错误码返回错误，信息取自错误信息目录并按客户端语言渲染
+func abortWithLocalizedMessage(c *gin.Context, statusCode int, errorCode types.ErrorCode, args ...any) {
+	message, _ := types.LocalizeErrorMessage(errorCode, service.GetErrorLanguage(c), args...)
+	abortWithOpenAiMessage(c, statusCode, message, string(errorCode))
+}
+
 func abortWithMidjourneyMessage(c *gin.Context, statusCode int, code int, description string) {
 	c.JSON(statusCode, gin.H{
 		"description": description,
@@ -58,12 +58,12 @@ func GetAllEnableAbilities() []Ability {
 	return abilities
 }
 
-func getPriority(group string, model string, retry int) (int, error) {
+func getPriority(group string, model string, retry int, filter *ChannelFilter) (int, error) {
 
 	var priorities []int
-	err := DB.Model(&Ability{}).
+	err := filter.scope(DB.Model(&Ability{}).
 		Select("DISTINCT(priority)").
-		Where(commonGroupCol+" = ? and model = ? and enabled = ?", group, model, true).
+		Where(commonGroupCol+" = ? and model = ? and enabled = ?", group, model, true)).
 		Order("priority DESC").              // 按优先级降序排序
 		Pluck("priority", &priorities).Error // Pluck用于将查询的结果直接扫描到一个切片中
 
@@ -88,11 +88,11 @@ func getPriority(group string, model string, retry int) (int, error) {
 	return priorityToUse, nil
 }
 
-func getChannelQuery(group string, model string, retry int) (*gorm.DB, error) {
-	maxPrioritySubQuery := DB.Model(&Ability{}).Select("MAX(priority)").Where(commonGroupCol+" = ? and model = ? and enabled = ?", group, model, true)
+func getChannelQuery(group string, model string, retry int, filter *ChannelFilter) (*gorm.DB, error) {
+	maxPrioritySubQuery := filter.scope(DB.Model(&Ability{}).Select("MAX(priority)").Where(commonGroupCol+" = ? and model = ? and enabled = ?", group, model, true))
 	channelQuery := DB.Where(commonGroupCol+" = ? and model = ? and enabled = ? and priority = (?)", group, model, true, maxPrioritySubQuery)
 	if retry != 0 {
-		priority, err := getPriority(group, model, retry)
+		priority, err := getPriority(group, model, retry, filter)
 		if err != nil {
 			return nil, err
 		} else {
@@ -100,14 +100,14 @@ func getChannelQuery(group string, model string, retry int) (*gorm.DB, error) {
 		}
 	}
 
-	return channelQuery, nil
+	return filter.scope(channelQuery), nil
 }
 
-func GetChannel(group string, model string, retry int) (*Channel, error) {
+func GetChannel(group string, model string, retry int, filter *ChannelFilter) (*Channel, error) {
 	var abilities []Ability
 
 	var err error = nil
-	channelQuery, err := getChannelQuery(group, model, retry)
+	channelQuery, err := getChannelQuery(group, model, retry, filter)
 	if err != nil {
 		return nil, err
 	}
@@ -121,15 +121,23 @@ func GetChannel(group string, model string, retry int) (*Channel, error) {
 	}
 	channel := Channel{}
 	if len(abilities) > 0 {
+		// 上游限流额度接近耗尽的渠道降低权重
+		channelIds := make([]int, len(abilities))
+		weights := make([]int, len(abilities))
+		for i, ability_ := range abilities {
+			channelIds[i] = ability_.ChannelId
+			weights[i] = int(ability_.Weight) + 10
+		}
+		weights = applyRateLimitWeights(channelIds, getChannelKeyCounts(channelIds), weights)
 		// Randomly choose one
-		weightSum := uint(0)
-		for _, ability_ := range abilities {
-			weightSum += ability_.Weight + 10
+		weightSum := 0
+		for _, w := range weights {
+			weightSum += w
 		}
 		// Randomly choose one
-		weight := common.GetRandomInt(int(weightSum))
-		for _, ability_ := range abilities {
-			weight -= int(ability_.Weight) + 10
+		weight := common.GetRandomInt(weightSum)
+		for i, ability_ := range abilities {
+			weight -= weights[i]
 			//log.Printf("weight: %d, ability weight: %d", weight, *ability_.Weight)
 			if weight <= 0 {
 				channel.Id = ability_.ChannelId
@@ -337,5 +345,6 @@ func FixAbility() (int, int, error) {
 		}
 	}
 	InitChannelCache()
+	PublishCacheEvent(CacheEventAbility, "")
 	return successCount, failCount, nil
 }
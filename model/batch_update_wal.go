@@ -0,0 +1,149 @@
+package model
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/setting/operation_setting"
+)
+
+// batchUpdateWalRecord 预写日志中的一行，Ledgers 非空时为一笔额度流水，否则为一条批量更新增量
+type batchUpdateWalRecord struct {
+	Type    int           `json:"t,omitempty"`
+	Id      int           `json:"i,omitempty"`
+	Value   int           `json:"v,omitempty"`
+	Ledgers []QuotaLedger `json:"l,omitempty"`
+}
+
+// BatchUpdateCheckpoint 已应用的预写日志分段，与分段内的增量在同一事务中写入，保证分段只会被应用一次
+type BatchUpdateCheckpoint struct {
+	Id        int    `json:"id"`
+	Segment   string `json:"segment" gorm:"type:varchar(128);uniqueIndex"`
+	CreatedAt int64  `json:"created_at" gorm:"bigint;index"`
+}
+
+// 检查点保留时间，超过后的分段不会再被重放
+const batchUpdateCheckpointRetention = 7 * 24 * time.Hour
+
+var batchUpdateWal *os.File
+
+func openBatchUpdateWal() error {
+	file, err := os.OpenFile(common.BatchUpdateWalPath, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return err
+	}
+	batchUpdateWal = file
+	return nil
+}
+
+// appendBatchUpdateWal 调用方需持有 batchUpdateWalLock
+func appendBatchUpdateWal(record batchUpdateWalRecord) {
+	if batchUpdateWal == nil {
+		return
+	}
+	data, err := common.Marshal(record)
+	if err != nil {
+		common.SysLog("failed to marshal batch update wal record: " + err.Error())
+		return
+	}
+	data = append(data, '\n')
+	if _, err := batchUpdateWal.Write(data); err != nil {
+		common.SysLog("failed to write batch update wal: " + err.Error())
+		return
+	}
+	if operation_setting.GetQuotaLedgerSetting().WalSync {
+		_ = batchUpdateWal.Sync()
+	}
+}
+
+// rotateBatchUpdateWal 将当前日志改名为待应用的分段并重新打开日志，返回分段路径；调用方需持有 batchUpdateWalLock
+func rotateBatchUpdateWal() string {
+	if batchUpdateWal == nil {
+		return ""
+	}
+	_ = batchUpdateWal.Close()
+	batchUpdateWal = nil
+	segment := fmt.Sprintf("%s.%d", common.BatchUpdateWalPath, time.Now().UnixNano())
+	if err := os.Rename(common.BatchUpdateWalPath, segment); err != nil {
+		// 无法保留分段时删除日志，避免重启后重复应用本次即将落库的增量
+		common.SysLog("failed to rotate batch update wal: " + err.Error())
+		_ = os.Remove(common.BatchUpdateWalPath)
+		segment = ""
+	}
+	if err := openBatchUpdateWal(); err != nil {
+		common.SysLog("failed to reopen batch update wal, batch updates are no longer crash-safe: " + err.Error())
+	}
+	return segment
+}
+
+func listBatchUpdateWalSegments() []string {
+	segments, err := filepath.Glob(common.BatchUpdateWalPath + ".*")
+	if err != nil {
+		return nil
+	}
+	sort.Strings(segments)
+	return segments
+}
+
+// readBatchUpdateWalSegment 读取分段中的增量和流水
+func readBatchUpdateWalSegment(segment string) ([]map[int]int, []QuotaLedger, error) {
+	file, err := os.Open(segment)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer file.Close()
+
+	stores := make([]map[int]int, BatchUpdateTypeCount)
+	for i := range stores {
+		stores[i] = make(map[int]int)
+	}
+	ledgers := make([]QuotaLedger, 0)
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		var record batchUpdateWalRecord
+		// 进程在写入途中退出时最后一行可能不完整，直接跳过
+		if err := common.Unmarshal(scanner.Bytes(), &record); err != nil {
+			continue
+		}
+		if len(record.Ledgers) > 0 {
+			ledgers = append(ledgers, record.Ledgers...)
+			continue
+		}
+		if record.Type < 0 || record.Type >= BatchUpdateTypeCount {
+			continue
+		}
+		stores[record.Type][record.Id] += record.Value
+	}
+	return stores, ledgers, scanner.Err()
+}
+
+// replayBatchUpdateWalSegments 应用上次未能落库的分段，成功后删除分段文件
+func replayBatchUpdateWalSegments() {
+	for _, segment := range listBatchUpdateWalSegments() {
+		stores, ledgers, err := readBatchUpdateWalSegment(segment)
+		if err != nil {
+			common.SysLog(fmt.Sprintf("failed to read batch update wal segment %s: %v", segment, err))
+			continue
+		}
+		if err := applyBatchUpdates(segment, stores, ledgers); err != nil {
+			common.SysLog(fmt.Sprintf("failed to replay batch update wal segment %s: %v", segment, err))
+			// 保持顺序，后续分段留到下次重放
+			return
+		}
+		_ = os.Remove(segment)
+		common.SysLog("batch update wal segment replayed: " + segment)
+	}
+}
+
+func cleanupBatchUpdateCheckpoints() {
+	before := time.Now().Add(-batchUpdateCheckpointRetention).Unix()
+	if err := DB.Where("created_at < ?", before).Delete(&BatchUpdateCheckpoint{}).Error; err != nil {
+		common.SysLog("failed to cleanup batch update checkpoints: " + err.Error())
+	}
+}
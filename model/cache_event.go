@@ -0,0 +1,153 @@
+package model
+
+import (
+	"context"
+	"sync/atomic"
+	"time"
+
+	"github.com/QuantumNous/new-api/common"
+
+	"github.com/go-redis/redis/v8"
+)
+
+// 节点修改渠道、能力或选项后通过 Redis 发布缓存失效事件，
+// 其他节点收到后立即刷新本地缓存；SyncChannelCache 和 SyncOptions 的定时同步保留作为兜底。
+// 令牌与用户只缓存在共享的 Redis 中，没有节点本地缓存，因此不发布事件，由修改的节点自行延迟二次删除
+
+type CacheEventType string
+
+const (
+	CacheEventChannel CacheEventType = "channel"
+	CacheEventAbility CacheEventType = "ability"
+	CacheEventOption  CacheEventType = "option"
+)
+
+const (
+	cacheEventRedisChannel = "new-api:cache_events"
+	// 合并短时间内的多个渠道事件，批量禁用渠道时只重建一次缓存
+	channelCacheRefreshDelay = 200 * time.Millisecond
+	// 令牌与用户缓存的延迟二次删除，清除并发请求在数据库提交前读取并回填的旧数据
+	cacheRedeleteDelay = time.Second
+)
+
+type CacheEvent struct {
+	Type CacheEventType `json:"type"`
+	Key  string         `json:"key,omitempty"`
+	Node string         `json:"node"`
+}
+
+// 本进程的节点标识，用于忽略自身发布的事件
+var cacheEventNodeId = common.GetRandomString(16)
+
+var channelCacheRefreshPending atomic.Bool
+
+func cacheEventsEnabled() bool {
+	return common.RedisEnabled && common.CacheEventEnabled && common.RDB != nil
+}
+
+// PublishCacheEvent 广播缓存失效事件，key 为空表示该类缓存需要全量刷新
+func PublishCacheEvent(eventType CacheEventType, key string) {
+	if !cacheEventsEnabled() {
+		return
+	}
+	payload, err := common.Marshal(CacheEvent{Type: eventType, Key: key, Node: cacheEventNodeId})
+	if err != nil {
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	if err := common.RDB.Publish(ctx, cacheEventRedisChannel, payload).Err(); err != nil {
+		common.SysLog("failed to publish cache event: " + err.Error())
+	}
+}
+
+// SubscribeCacheEvents 持续接收其他节点的缓存失效事件，订阅断开重连后全量同步一次以弥补期间丢失的事件
+func SubscribeCacheEvents() {
+	if !cacheEventsEnabled() {
+		return
+	}
+	common.SysLog("cache event subscription enabled")
+	ctx := context.Background()
+	pubsub := common.RDB.Subscribe(ctx, cacheEventRedisChannel)
+	defer pubsub.Close()
+	subscribed := false
+	for {
+		message, err := pubsub.Receive(ctx)
+		if err != nil {
+			common.SysLog("cache event subscription error: " + err.Error())
+			time.Sleep(time.Second)
+			continue
+		}
+		switch m := message.(type) {
+		case *redis.Subscription:
+			if m.Kind != "subscribe" {
+				continue
+			}
+			if subscribed {
+				common.SysLog("cache event subscription restored, syncing caches from database")
+				scheduleChannelCacheRefresh()
+				loadOptionsFromDatabase()
+			}
+			subscribed = true
+		case *redis.Message:
+			handleCacheEvent(m.Payload)
+		}
+	}
+}
+
+func handleCacheEvent(payload string) {
+	var event CacheEvent
+	if err := common.UnmarshalJsonStr(payload, &event); err != nil {
+		common.SysLog("invalid cache event: " + err.Error())
+		return
+	}
+	if common.DebugEnabled {
+		common.SysLog("received cache event: " + payload)
+	}
+	// 渠道与选项的本地缓存在发布事件前已由本节点更新
+	if event.Node == cacheEventNodeId {
+		return
+	}
+	switch event.Type {
+	case CacheEventChannel, CacheEventAbility:
+		scheduleChannelCacheRefresh()
+	case CacheEventOption:
+		reloadOption(event.Key)
+	}
+}
+
+func scheduleChannelCacheRefresh() {
+	if !common.MemoryCacheEnabled {
+		return
+	}
+	if !channelCacheRefreshPending.CompareAndSwap(false, true) {
+		return
+	}
+	time.AfterFunc(channelCacheRefreshDelay, func() {
+		channelCacheRefreshPending.Store(false)
+		InitChannelCache()
+	})
+}
+
+func reloadOption(key string) {
+	if key == "" {
+		loadOptionsFromDatabase()
+		return
+	}
+	var option Option
+	if err := DB.Where(&Option{Key: key}).First(&option).Error; err != nil {
+		common.SysLog("failed to reload option " + key + ": " + err.Error())
+		return
+	}
+	if err := updateOptionMap(option.Key, option.Value); err != nil {
+		common.SysLog("failed to update option map: " + err.Error())
+	}
+}
+
+func redeleteCacheKey(key string) {
+	time.AfterFunc(cacheRedeleteDelay, func() {
+		if err := common.RedisDelKey(key); err != nil {
+			common.SysLog("failed to delete cache key " + key + ": " + err.Error())
+		}
+	})
+}
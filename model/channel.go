@@ -6,6 +6,7 @@ import (
 	"errors"
 	"fmt"
 	"math/rand"
+	"strconv"
 	"strings"
 	"sync"
 
@@ -47,6 +48,7 @@ type Channel struct {
 	Setting           *string `json:"setting" gorm:"type:text"` // 渠道额外设置
 	ParamOverride     *string `json:"param_override" gorm:"type:text"`
 	HeaderOverride    *string `json:"header_override" gorm:"type:text"`
+	ResponseOverride  *string `json:"response_override" gorm:"type:text"` // 响应覆盖，与参数覆盖格式相同，作用于响应体和流式数据块
 	Remark            *string `json:"remark" gorm:"type:varchar(255)" validate:"max=255"`
 	// add after v0.8.5
 	ChannelInfo ChannelInfo `json:"channel_info" gorm:"type:json"`
@@ -55,6 +57,8 @@ type Channel struct {
 
 	// cache info
 	Keys []string `json:"-" gorm:"-"`
+	// 上游限流额度（运行时数据，仅用于展示）
+	RateLimitBudgets []ChannelRateLimitBudget `json:"rate_limit_budgets,omitempty" gorm:"-"`
 }
 
 type ChannelInfo struct {
@@ -145,12 +149,27 @@ func (channel *Channel) GetNextEnabledKey() (string, int, *types.NewAPIError) {
 		return "", 0, types.NewError(errors.New("no enabled keys"), types.ErrorCodeChannelNoAvailableKey)
 	}
 
+	// 跳过冷却中的 key
+	enabledIdx = filterAvailableKeys(channel.Id, enabledIdx)
+	candidates := make(map[int]bool, len(enabledIdx))
+	for _, idx := range enabledIdx {
+		candidates[idx] = true
+	}
+
+	var selectedIdx int
 	switch channel.ChannelInfo.MultiKeyMode {
 	case constant.MultiKeyModeRandom:
 		// Randomly pick one enabled key
-		selectedIdx := enabledIdx[rand.Intn(len(enabledIdx))]
-		return keys[selectedIdx], selectedIdx, nil
-	case constant.MultiKeyModePolling:
+		selectedIdx = enabledIdx[rand.Intn(len(enabledIdx))]
+	case constant.MultiKeyModeLeastRecentlyUsed:
+		selectedIdx = pickChannelKeyBy(channel.Id, enabledIdx, func(a, b ChannelKeyState) bool {
+			return a.LastUsedTime < b.LastUsedTime
+		})
+	case constant.MultiKeyModeLeastTokensUsed:
+		selectedIdx = pickChannelKeyBy(channel.Id, enabledIdx, func(a, b ChannelKeyState) bool {
+			return a.UsedTokens < b.UsedTokens
+		})
+	case constant.MultiKeyModePolling, constant.MultiKeyModeCooldown:
 		// Use channel-specific lock to ensure thread-safe polling
 
 		channelInfo, err := CacheGetChannelInfo(channel.Id)
@@ -173,20 +192,23 @@ func (channel *Channel) GetNextEnabledKey() (string, int, *types.NewAPIError) {
 		if start < 0 || start >= len(keys) {
 			start = 0
 		}
+		// Fallback – should not happen, but use first enabled key
+		selectedIdx = enabledIdx[0]
 		for i := 0; i < len(keys); i++ {
 			idx := (start + i) % len(keys)
-			if getStatus(idx) == common.ChannelStatusEnabled {
+			if candidates[idx] {
 				// update polling index for next call (point to the next position)
 				channel.ChannelInfo.MultiKeyPollingIndex = (idx + 1) % len(keys)
-				return keys[idx], idx, nil
+				selectedIdx = idx
+				break
 			}
 		}
-		// Fallback – should not happen, but return first enabled key
-		return keys[enabledIdx[0]], enabledIdx[0], nil
 	default:
 		// Unknown mode, default to first enabled key (or original key string)
-		return keys[enabledIdx[0]], enabledIdx[0], nil
+		selectedIdx = enabledIdx[0]
 	}
+	MarkChannelKeyUsed(channel.Id, selectedIdx)
+	return keys[selectedIdx], selectedIdx, nil
 }
 
 func (channel *Channel) SaveChannelInfo() error {
@@ -629,6 +651,7 @@ func UpdateChannelStatus(channelId int, usingKey string, status int, reason stri
 	}
 
 	shouldUpdateAbilities := false
+	statusSaved := false
 	defer func() {
 		if shouldUpdateAbilities {
 			err := UpdateAbilityStatus(channelId, status == common.ChannelStatusEnabled)
@@ -636,6 +659,10 @@ func UpdateChannelStatus(channelId int, usingKey string, status int, reason stri
 				common.SysLog(fmt.Sprintf("failed to update ability status: channel_id=%d, error=%v", channelId, err))
 			}
 		}
+		if statusSaved {
+			// 通知其他节点立即重建缓存，避免已禁用的渠道在下次定时同步前继续接收流量
+			PublishCacheEvent(CacheEventChannel, strconv.Itoa(channelId))
+		}
 	}()
 	channel, err := GetChannelById(channelId, true)
 	if err != nil {
@@ -668,10 +695,53 @@ func UpdateChannelStatus(channelId int, usingKey string, status int, reason stri
 			common.SysLog(fmt.Sprintf("failed to update channel status: channel_id=%d, status=%d, error=%v", channel.Id, status, err))
 			return false
 		}
+		statusSaved = true
 	}
 	return true
 }
 
+// EnableChannelKey 重新启用多 Key 渠道中的某个 key，若渠道因全部 key 被禁用而自动禁用，则同时恢复渠道
+func EnableChannelKey(channelId int, keyIndex int) error {
+	channel, err := GetChannelById(channelId, true)
+	if err != nil {
+		return err
+	}
+	if !channel.ChannelInfo.IsMultiKey {
+		return errors.New("channel is not multi-key")
+	}
+	enableKey := func(info *ChannelInfo) {
+		delete(info.MultiKeyStatusList, keyIndex)
+		delete(info.MultiKeyDisabledReason, keyIndex)
+		delete(info.MultiKeyDisabledTime, keyIndex)
+	}
+
+	pollingLock := GetChannelPollingLock(channelId)
+	pollingLock.Lock()
+	enableKey(&channel.ChannelInfo)
+	wasAutoDisabled := channel.Status == common.ChannelStatusAutoDisabled
+	if wasAutoDisabled {
+		channel.Status = common.ChannelStatusEnabled
+	}
+	if common.MemoryCacheEnabled {
+		if channelCache, _ := CacheGetChannel(channelId); channelCache != nil {
+			enableKey(&channelCache.ChannelInfo)
+		}
+	}
+	pollingLock.Unlock()
+
+	if err = channel.SaveWithoutKey(); err != nil {
+		return err
+	}
+	if wasAutoDisabled {
+		CacheUpdateChannelStatus(channelId, common.ChannelStatusEnabled)
+		if err = UpdateAbilityStatus(channelId, true); err != nil {
+			return err
+		}
+	}
+	PublishCacheEvent(CacheEventChannel, strconv.Itoa(channelId))
+	return nil
+}
+
 func EnableChannelByTag(tag string) error {
 	err := DB.Model(&Channel{}).Where("tag = ?", tag).Update("status", common.ChannelStatusEnabled).Error
 	if err != nil {
@@ -690,7 +760,7 @@ func DisableChannelByTag(tag string) error {
 	return err
 }
 
-func EditChannelByTag(tag string, newTag *string, modelMapping *string, models *string, group *string, priority *int64, weight *uint, paramOverride *string, headerOverride *string) error {
+func EditChannelByTag(tag string, newTag *string, modelMapping *string, models *string, group *string, priority *int64, weight *uint, paramOverride *string, headerOverride *string, responseOverride *string) error {
 	updateData := Channel{}
 	shouldReCreateAbilities := false
 	updatedTag := tag
@@ -722,6 +792,9 @@ func EditChannelByTag(tag string, newTag *string, modelMapping *string, models *
 	if headerOverride != nil {
 		updateData.HeaderOverride = headerOverride
 	}
+	if responseOverride != nil {
+		updateData.ResponseOverride = responseOverride
+	}
 
 	err := DB.Model(&Channel{}).Where("tag = ?", tag).Updates(updateData).Error
 	if err != nil {
@@ -751,16 +824,15 @@ func UpdateChannelUsedQuota(id int, quota int) {
 		addNewRecord(BatchUpdateTypeChannelUsedQuota, id, quota)
 		return
 	}
-	updateChannelUsedQuota(id, quota)
-}
-
-func updateChannelUsedQuota(id int, quota int) {
-	err := DB.Model(&Channel{}).Where("id = ?", id).Update("used_quota", gorm.Expr("used_quota + ?", quota)).Error
-	if err != nil {
+	if err := updateChannelUsedQuota(DB, id, quota); err != nil {
 		common.SysLog(fmt.Sprintf("failed to update channel used quota: channel_id=%d, delta_quota=%d, error=%v", id, quota, err))
 	}
 }
 
+func updateChannelUsedQuota(tx *gorm.DB, id int, quota int) error {
+	return tx.Model(&Channel{}).Where("id = ?", id).Update("used_quota", gorm.Expr("used_quota + ?", quota)).Error
+}
+
 func DeleteChannelByStatus(status int64) (int64, error) {
 	result := DB.Where("status = ?", status).Delete(&Channel{})
 	return result.RowsAffected, result.Error
@@ -900,6 +972,17 @@ func (channel *Channel) GetParamOverride() map[string]interface{} {
 	return paramOverride
 }
 
+func (channel *Channel) GetResponseOverride() map[string]interface{} {
+	responseOverride := make(map[string]interface{})
+	if channel.ResponseOverride != nil && *channel.ResponseOverride != "" {
+		err := common.Unmarshal([]byte(*channel.ResponseOverride), &responseOverride)
+		if err != nil {
+			common.SysLog(fmt.Sprintf("failed to unmarshal response override: channel_id=%d, error=%v", channel.Id, err))
+		}
+	}
+	return responseOverride
+}
+
 func (channel *Channel) GetHeaderOverride() map[string]interface{} {
 	headerOverride := make(map[string]interface{})
 	if channel.HeaderOverride != nil && *channel.HeaderOverride != "" {
@@ -4,6 +4,7 @@ import (
 	"errors"
 	"fmt"
 	"math/rand"
+	"slices"
 	"sort"
 	"strings"
 	"sync"
@@ -12,6 +13,8 @@ import (
 	"github.com/QuantumNous/new-api/common"
 	"github.com/QuantumNous/new-api/constant"
 	"github.com/QuantumNous/new-api/setting/ratio_setting"
+
+	"gorm.io/gorm"
 )
 
 var group2model2channels map[string]map[string][]int // enabled channel
@@ -70,10 +73,10 @@ func InitChannelCache() {
 	for i, channel := range newChannelId2channel {
 		if channel.ChannelInfo.IsMultiKey {
 			channel.Keys = channel.GetKeys()
-			if channel.ChannelInfo.MultiKeyMode == constant.MultiKeyModePolling {
+			if usesPollingIndex(channel.ChannelInfo.MultiKeyMode) {
 				if oldChannel, ok := channelsIDM[i]; ok {
 					// 存在旧的渠道，如果是多key且轮询，保留轮询索引信息
-					if oldChannel.ChannelInfo.IsMultiKey && oldChannel.ChannelInfo.MultiKeyMode == constant.MultiKeyModePolling {
+					if oldChannel.ChannelInfo.IsMultiKey && usesPollingIndex(oldChannel.ChannelInfo.MultiKeyMode) {
 						channel.ChannelInfo.MultiKeyPollingIndex = oldChannel.ChannelInfo.MultiKeyPollingIndex
 					}
 				}
@@ -85,6 +88,17 @@ func InitChannelCache() {
 	common.SysLog("channels synced from database")
 }
 
+// RefreshChannelCache 重建本节点的渠道缓存，并通知其他节点立即重建
+func RefreshChannelCache() {
+	InitChannelCache()
+	PublishCacheEvent(CacheEventChannel, "")
+}
+
+// usesPollingIndex 轮询和冷却模式都依赖轮询索引
+func usesPollingIndex(mode constant.MultiKeyMode) bool {
+	return mode == constant.MultiKeyModePolling || mode == constant.MultiKeyModeCooldown
+}
+
 func SyncChannelCache(frequency int) {
 	for {
 		time.Sleep(time.Duration(frequency) * time.Second)
@@ -93,10 +107,43 @@ func SyncChannelCache(frequency int) {
 	}
 }
 
-func GetRandomSatisfiedChannel(group string, model string, retry int) (*Channel, error) {
+// ChannelFilter 限定候选渠道，用于路由规则；Tag 与 ChannelIds 同时设置时需同时满足
+type ChannelFilter struct {
+	Tag        string
+	ChannelIds []int
+}
+
+func (f *ChannelFilter) match(channel *Channel) bool {
+	if f == nil {
+		return true
+	}
+	if f.Tag != "" && channel.GetTag() != f.Tag {
+		return false
+	}
+	if len(f.ChannelIds) > 0 && !slices.Contains(f.ChannelIds, channel.Id) {
+		return false
+	}
+	return true
+}
+
+// scope 为能力查询追加过滤条件
+func (f *ChannelFilter) scope(query *gorm.DB) *gorm.DB {
+	if f == nil {
+		return query
+	}
+	if f.Tag != "" {
+		query = query.Where("tag = ?", f.Tag)
+	}
+	if len(f.ChannelIds) > 0 {
+		query = query.Where("channel_id IN ?", f.ChannelIds)
+	}
+	return query
+}
+
+func GetRandomSatisfiedChannel(group string, model string, retry int, filter *ChannelFilter) (*Channel, error) {
 	// if memory cache is disabled, get channel directly from database
 	if !common.MemoryCacheEnabled {
-		return GetChannel(group, model, retry)
+		return GetChannel(group, model, retry, filter)
 	}
 
 	channelSyncLock.RLock()
@@ -111,6 +158,16 @@ func GetRandomSatisfiedChannel(group string, model string, retry int) (*Channel,
 		channels = group2model2channels[group][normalizedModel]
 	}
 
+	if filter != nil {
+		filtered := make([]int, 0, len(channels))
+		for _, channelId := range channels {
+			if channel, ok := channelsIDM[channelId]; ok && filter.match(channel) {
+				filtered = append(filtered, channelId)
+			}
+		}
+		channels = filtered
+	}
+
 	if len(channels) == 0 {
 		return nil, nil
 	}
@@ -173,15 +230,32 @@ func GetRandomSatisfiedChannel(group string, model string, retry int) (*Channel,
 		smoothingFactor = 100
 	}
 
+	// 上游限流额度接近耗尽的渠道降低权重
+	channelIds := make([]int, len(targetChannels))
+	keyCounts := make([]int, len(targetChannels))
+	weights := make([]int, len(targetChannels))
+	for i, channel := range targetChannels {
+		channelIds[i] = channel.Id
+		keyCounts[i] = 1
+		if channel.ChannelInfo.IsMultiKey {
+			keyCounts[i] = channel.ChannelInfo.MultiKeySize
+		}
+		weights[i] = channel.GetWeight()*smoothingFactor + smoothingAdjustment
+	}
+	weights = applyRateLimitWeights(channelIds, keyCounts, weights)
+
 	// Calculate the total weight of all channels up to endIdx
-	totalWeight := sumWeight * smoothingFactor
+	totalWeight := 0
+	for _, weight := range weights {
+		totalWeight += weight
+	}
 
 	// Generate a random value in the range [0, totalWeight)
 	randomWeight := rand.Intn(totalWeight)
 
 	// Find a channel based on its weight
-	for _, channel := range targetChannels {
-		randomWeight -= channel.GetWeight()*smoothingFactor + smoothingAdjustment
+	for i, channel := range targetChannels {
+		randomWeight -= weights[i]
 		if randomWeight < 0 {
 			return channel, nil
 		}
@@ -0,0 +1,171 @@
+package model
+
+import (
+	"sync"
+	"time"
+
+	"github.com/QuantumNous/new-api/common"
+)
+
+// ChannelKeyState 多 Key 渠道中单个 key 的运行时状态，仅保存在当前节点内存中，重启后清零
+type ChannelKeyState struct {
+	LastUsedTime     int64 `json:"last_used_time"`     // 最近一次被选中的时间（毫秒）
+	UsedTokens       int64 `json:"used_tokens"`        // 累计消耗的 token 数
+	CooldownUntil    int64 `json:"cooldown_until"`     // 冷却结束时间（秒），0 表示未冷却
+	CooldownCount    int   `json:"cooldown_count"`     // 连续冷却次数，用于指数退避
+	LastRecoveryTime int64 `json:"last_recovery_time"` // 最近一次自动恢复检测的时间（秒）
+}
+
+type channelKeyStateSet struct {
+	mu     sync.Mutex
+	states map[int]*ChannelKeyState
+}
+
+// channelKeyStates channel id -> *channelKeyStateSet
+var channelKeyStates sync.Map
+
+func getChannelKeyStateSet(channelId int) *channelKeyStateSet {
+	if set, ok := channelKeyStates.Load(channelId); ok {
+		return set.(*channelKeyStateSet)
+	}
+	actual, _ := channelKeyStates.LoadOrStore(channelId, &channelKeyStateSet{states: make(map[int]*ChannelKeyState)})
+	return actual.(*channelKeyStateSet)
+}
+
+// get 调用方需持有 set.mu
+func (set *channelKeyStateSet) get(keyIndex int) *ChannelKeyState {
+	state, ok := set.states[keyIndex]
+	if !ok {
+		state = &ChannelKeyState{}
+		set.states[keyIndex] = state
+	}
+	return state
+}
+
+func MarkChannelKeyUsed(channelId int, keyIndex int) {
+	set := getChannelKeyStateSet(channelId)
+	set.mu.Lock()
+	defer set.mu.Unlock()
+	set.get(keyIndex).LastUsedTime = time.Now().UnixMilli()
+}
+
+func RecordChannelKeyTokens(channelId int, keyIndex int, tokens int) {
+	if tokens <= 0 {
+		return
+	}
+	set := getChannelKeyStateSet(channelId)
+	set.mu.Lock()
+	defer set.mu.Unlock()
+	set.get(keyIndex).UsedTokens += int64(tokens)
+}
+
+// CooldownChannelKey 暂停使用某个 key，retryAfter 为 0 时按 base * 2^n 指数退避，最长不超过 max
+func CooldownChannelKey(channelId int, keyIndex int, retryAfter time.Duration, base time.Duration, max time.Duration) time.Duration {
+	set := getChannelKeyStateSet(channelId)
+	set.mu.Lock()
+	defer set.mu.Unlock()
+	state := set.get(keyIndex)
+	cooldown := retryAfter
+	if cooldown <= 0 {
+		cooldown = base
+		for i := 0; i < state.CooldownCount && cooldown < max; i++ {
+			cooldown *= 2
+		}
+	}
+	if max > 0 && cooldown > max {
+		cooldown = max
+	}
+	state.CooldownCount++
+	state.CooldownUntil = common.GetTimestamp() + int64(cooldown.Seconds())
+	return cooldown
+}
+
+// ResetChannelKeyCooldown 请求成功后清除冷却状态和退避次数
+func ResetChannelKeyCooldown(channelId int, keyIndex int) {
+	set := getChannelKeyStateSet(channelId)
+	set.mu.Lock()
+	defer set.mu.Unlock()
+	if state, ok := set.states[keyIndex]; ok {
+		state.CooldownUntil = 0
+		state.CooldownCount = 0
+	}
+}
+
+// TryMarkChannelKeyRecovery 若距上次恢复检测已超过 interval 则记录本次检测并返回 true
+func TryMarkChannelKeyRecovery(channelId int, keyIndex int, interval time.Duration) bool {
+	set := getChannelKeyStateSet(channelId)
+	set.mu.Lock()
+	defer set.mu.Unlock()
+	state := set.get(keyIndex)
+	now := common.GetTimestamp()
+	if now-state.LastRecoveryTime < int64(interval.Seconds()) {
+		return false
+	}
+	state.LastRecoveryTime = now
+	return true
+}
+
+func ResetChannelKeyStates(channelId int) {
+	channelKeyStates.Delete(channelId)
+}
+
+// GetChannelKeyStates 返回渠道所有 key 的运行时状态副本
+func GetChannelKeyStates(channelId int) map[int]ChannelKeyState {
+	set := getChannelKeyStateSet(channelId)
+	set.mu.Lock()
+	defer set.mu.Unlock()
+	states := make(map[int]ChannelKeyState, len(set.states))
+	for idx, state := range set.states {
+		states[idx] = *state
+	}
+	return states
+}
+
+// filterAvailableKeys 过滤掉冷却中的 key；若全部在冷却中，返回冷却最早结束的 key，避免渠道完全不可用
+func filterAvailableKeys(channelId int, enabledIdx []int) []int {
+	set := getChannelKeyStateSet(channelId)
+	set.mu.Lock()
+	defer set.mu.Unlock()
+	now := common.GetTimestamp()
+	available := make([]int, 0, len(enabledIdx))
+	earliest := -1
+	var earliestUntil int64
+	for _, idx := range enabledIdx {
+		state, ok := set.states[idx]
+		if !ok || state.CooldownUntil <= now {
+			available = append(available, idx)
+			continue
+		}
+		if earliest == -1 || state.CooldownUntil < earliestUntil {
+			earliest = idx
+			earliestUntil = state.CooldownUntil
+		}
+	}
+	if len(available) == 0 && earliest != -1 {
+		available = append(available, earliest)
+	}
+	return available
+}
+
+// pickChannelKeyBy 在候选 key 中选出 less 意义下最小的一个
+func pickChannelKeyBy(channelId int, candidates []int, less func(a, b ChannelKeyState) bool) int {
+	set := getChannelKeyStateSet(channelId)
+	set.mu.Lock()
+	defer set.mu.Unlock()
+	selected := candidates[0]
+	selectedState := ChannelKeyState{}
+	if state, ok := set.states[selected]; ok {
+		selectedState = *state
+	}
+	for _, idx := range candidates[1:] {
+		state := ChannelKeyState{}
+		if s, ok := set.states[idx]; ok {
+			state = *s
+		}
+		if less(state, selectedState) {
+			selected = idx
+			selectedState = state
+		}
+	}
+	return selected
+}
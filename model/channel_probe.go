@@ -0,0 +1,119 @@
+package model
+
+import (
+	"github.com/QuantumNous/new-api/common"
+)
+
+// ChannelProbe 渠道探测历史记录，每次对某渠道的某个模型进行一次测试就记录一条
+type ChannelProbe struct {
+	Id             int    `json:"id"`
+	ChannelId      int    `json:"channel_id" gorm:"index:idx_channel_probe_channel_model,priority:1"`
+	ModelName      string `json:"model_name" gorm:"size:128;index:idx_channel_probe_channel_model,priority:2;default:''"`
+	Success        bool   `json:"success"`
+	StatusCode     int    `json:"status_code" gorm:"default:0"`
+	ErrorMessage   string `json:"error_message" gorm:"type:text"`
+	IsStream       bool   `json:"is_stream"`
+	FirstTokenTime int    `json:"first_token_time" gorm:"default:0"` // in milliseconds, only for stream probes
+	ResponseTime   int    `json:"response_time" gorm:"default:0"`    // in milliseconds
+	CreatedAt      int64  `json:"created_at" gorm:"bigint;index"`
+}
+
+// ChannelProbeStat 按渠道和模型聚合后的探测统计
+type ChannelProbeStat struct {
+	ChannelId         int     `json:"channel_id"`
+	ModelName         string  `json:"model_name"`
+	Total             int     `json:"total"`
+	SuccessCount      int     `json:"success_count"`
+	SuccessRate       float64 `json:"success_rate"`
+	AvgResponseTime   float64 `json:"avg_response_time"`
+	AvgFirstTokenTime float64 `json:"avg_first_token_time"`
+	LastProbeAt       int64   `json:"last_probe_at"`
+}
+
+func RecordChannelProbe(probe *ChannelProbe) error {
+	if probe.CreatedAt == 0 {
+		probe.CreatedAt = common.GetTimestamp()
+	}
+	return DB.Create(probe).Error
+}
+
+// GetChannelProbeStats 统计时间范围内各渠道各模型的成功率和平均延迟，channelId 为 0 时统计所有渠道
+func GetChannelProbeStats(channelId int, startTime int64, endTime int64) ([]*ChannelProbeStat, error) {
+	var stats []*ChannelProbeStat
+	tx := DB.Model(&ChannelProbe{}).Select(
+		"channel_id, model_name, count(*) as total, " +
+			"sum(case when success = " + commonTrueVal + " then 1 else 0 end) as success_count, " +
+			"avg(response_time) as avg_response_time, " +
+			"avg(case when is_stream = " + commonTrueVal + " and first_token_time > 0 then first_token_time else null end) as avg_first_token_time, " +
+			"max(created_at) as last_probe_at")
+	if channelId != 0 {
+		tx = tx.Where("channel_id = ?", channelId)
+	}
+	if startTime != 0 {
+		tx = tx.Where("created_at >= ?", startTime)
+	}
+	if endTime != 0 {
+		tx = tx.Where("created_at <= ?", endTime)
+	}
+	err := tx.Group("channel_id, model_name").Order("channel_id, model_name").Scan(&stats).Error
+	if err != nil {
+		return nil, err
+	}
+	for _, stat := range stats {
+		if stat.Total > 0 {
+			stat.SuccessRate = float64(stat.SuccessCount) / float64(stat.Total)
+		}
+	}
+	return stats, nil
+}
+
+// GetChannelProbeHistory 返回时间范围内的探测记录（按时间升序），用于绘制延迟曲线
+func GetChannelProbeHistory(channelId int, modelName string, startTime int64, endTime int64, limit int) ([]*ChannelProbe, error) {
+	var probes []*ChannelProbe
+	tx := DB.Where("channel_id = ?", channelId)
+	if modelName != "" {
+		tx = tx.Where("model_name = ?", modelName)
+	}
+	if startTime != 0 {
+		tx = tx.Where("created_at >= ?", startTime)
+	}
+	if endTime != 0 {
+		tx = tx.Where("created_at <= ?", endTime)
+	}
+	err := tx.Order("id desc").Limit(limit).Find(&probes).Error
+	if err != nil {
+		return nil, err
+	}
+	// 反转为时间升序
+	for i, j := 0, len(probes)-1; i < j; i, j = i+1, j-1 {
+		probes[i], probes[j] = probes[j], probes[i]
+	}
+	return probes, nil
+}
+
+// IsChannelProbeFailing 判断渠道最近 n 次探测是否全部失败
+func IsChannelProbeFailing(channelId int, n int) (bool, error) {
+	if n <= 0 {
+		return false, nil
+	}
+	var successes []bool
+	err := DB.Model(&ChannelProbe{}).Where("channel_id = ?", channelId).
+		Order("id desc").Limit(n).Pluck("success", &successes).Error
+	if err != nil {
+		return false, err
+	}
+	if len(successes) < n {
+		return false, nil
+	}
+	for _, success := range successes {
+		if success {
+			return false, nil
+		}
+	}
+	return true, nil
+}
+
+func DeleteChannelProbesBefore(timestamp int64) (int64, error) {
+	result := DB.Where("created_at < ?", timestamp).Delete(&ChannelProbe{})
+	return result.RowsAffected, result.Error
+}
@@ -0,0 +1,147 @@
+package model
+
+import (
+	"sort"
+	"sync"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/setting/operation_setting"
+)
+
+// ChannelRateLimitBudget 上游通过响应头告知的限流额度，-1 表示上游未提供该项
+type ChannelRateLimitBudget struct {
+	KeyIndex          int   `json:"key_index"`
+	LimitRequests     int64 `json:"limit_requests"`
+	RemainingRequests int64 `json:"remaining_requests"`
+	ResetRequests     int64 `json:"reset_requests"` // 请求数额度重置时间（秒级时间戳）
+	LimitTokens       int64 `json:"limit_tokens"`
+	RemainingTokens   int64 `json:"remaining_tokens"`
+	ResetTokens       int64 `json:"reset_tokens"` // token 额度重置时间（秒级时间戳）
+	UpdatedAt         int64 `json:"updated_at"`
+}
+
+// remainingRatio 返回剩余额度比例（0-1），已过重置时间或未提供的项视为充足
+func (b *ChannelRateLimitBudget) remainingRatio(now int64) float64 {
+	ratio := 1.0
+	if b.LimitRequests > 0 && b.RemainingRequests >= 0 && b.ResetRequests > now {
+		ratio = min(ratio, float64(b.RemainingRequests)/float64(b.LimitRequests))
+	}
+	if b.LimitTokens > 0 && b.RemainingTokens >= 0 && b.ResetTokens > now {
+		ratio = min(ratio, float64(b.RemainingTokens)/float64(b.LimitTokens))
+	}
+	return ratio
+}
+
+// channelRateLimitBudgets 渠道 ID -> key 索引 -> 限流额度
+var channelRateLimitBudgets = make(map[int]map[int]*ChannelRateLimitBudget)
+var channelRateLimitBudgetsLock sync.RWMutex
+
+// UpdateChannelRateLimitBudget 用最新响应头中的额度覆盖对应渠道和 key 的记录
+func UpdateChannelRateLimitBudget(channelId int, budget ChannelRateLimitBudget) {
+	budget.UpdatedAt = common.GetTimestamp()
+	channelRateLimitBudgetsLock.Lock()
+	defer channelRateLimitBudgetsLock.Unlock()
+	budgets, ok := channelRateLimitBudgets[channelId]
+	if !ok {
+		budgets = make(map[int]*ChannelRateLimitBudget)
+		channelRateLimitBudgets[channelId] = budgets
+	}
+	budgets[budget.KeyIndex] = &budget
+}
+
+// GetChannelRateLimitBudgets 返回渠道各 key 的限流额度，按 key 索引排序
+func GetChannelRateLimitBudgets(channelId int) []ChannelRateLimitBudget {
+	channelRateLimitBudgetsLock.RLock()
+	defer channelRateLimitBudgetsLock.RUnlock()
+	budgets := make([]ChannelRateLimitBudget, 0, len(channelRateLimitBudgets[channelId]))
+	for _, budget := range channelRateLimitBudgets[channelId] {
+		budgets = append(budgets, *budget)
+	}
+	sort.Slice(budgets, func(i, j int) bool {
+		return budgets[i].KeyIndex < budgets[j].KeyIndex
+	})
+	return budgets
+}
+
+// GetChannelRateLimitRatio 返回渠道剩余额度比例，多 key 渠道取最充足的 key；
+// 有 key 尚未上报额度时视为充足，返回 1
+func GetChannelRateLimitRatio(channelId int, keyCount int) float64 {
+	now := common.GetTimestamp()
+	channelRateLimitBudgetsLock.RLock()
+	defer channelRateLimitBudgetsLock.RUnlock()
+	budgets := channelRateLimitBudgets[channelId]
+	if len(budgets) == 0 || len(budgets) < keyCount {
+		return 1
+	}
+	best := 0.0
+	for _, budget := range budgets {
+		best = max(best, budget.remainingRatio(now))
+	}
+	return best
+}
+
+// getChannelKeyCounts 从数据库读取渠道的 key 数量，供未启用内存缓存时的选路使用
+func getChannelKeyCounts(channelIds []int) []int {
+	keyCounts := make([]int, len(channelIds))
+	for i := range keyCounts {
+		keyCounts[i] = 1
+	}
+	if !operation_setting.GetUpstreamRateLimitSetting().Enabled {
+		return keyCounts
+	}
+	// 只有已上报限流额度的渠道才需要 key 数量，都没有时不查库
+	budgetChannelIds := make([]int, 0)
+	channelRateLimitBudgetsLock.RLock()
+	for _, channelId := range channelIds {
+		if len(channelRateLimitBudgets[channelId]) > 0 {
+			budgetChannelIds = append(budgetChannelIds, channelId)
+		}
+	}
+	channelRateLimitBudgetsLock.RUnlock()
+	if len(budgetChannelIds) == 0 {
+		return keyCounts
+	}
+	var channels []*Channel
+	if err := DB.Select("id", "channel_info").Where("id in ?", budgetChannelIds).Find(&channels).Error; err != nil {
+		return keyCounts
+	}
+	sizes := make(map[int]int, len(channels))
+	for _, channel := range channels {
+		if channel.ChannelInfo.IsMultiKey && channel.ChannelInfo.MultiKeySize > 0 {
+			sizes[channel.Id] = channel.ChannelInfo.MultiKeySize
+		}
+	}
+	for i, channelId := range channelIds {
+		if size, ok := sizes[channelId]; ok {
+			keyCounts[i] = size
+		}
+	}
+	return keyCounts
+}
+
+// rateLimitWeightFactor 上游限流额度低于水位线时按比例降低渠道权重，返回 0-1 的系数
+func rateLimitWeightFactor(channelId int, keyCount int) float64 {
+	setting := operation_setting.GetUpstreamRateLimitSetting()
+	if !setting.Enabled || setting.LowWatermark <= 0 {
+		return 1
+	}
+	ratio := GetChannelRateLimitRatio(channelId, keyCount)
+	if ratio >= setting.LowWatermark {
+		return 1
+	}
+	return ratio / setting.LowWatermark
+}
+
+// applyRateLimitWeights 按限流额度调整权重；若全部渠道都已耗尽，则保持原权重
+func applyRateLimitWeights(channelIds []int, keyCounts []int, weights []int) []int {
+	adjusted := make([]int, len(weights))
+	total := 0
+	for i, weight := range weights {
+		adjusted[i] = int(float64(weight) * rateLimitWeightFactor(channelIds[i], keyCounts[i]))
+		total += adjusted[i]
+	}
+	if total == 0 {
+		return weights
+	}
+	return adjusted
+}
@@ -0,0 +1,110 @@
+package model
+
+import (
+	"context"
+	"strconv"
+	"time"
+
+	"github.com/QuantumNous/new-api/common"
+
+	"github.com/go-redis/redis/v8"
+	"gorm.io/gorm"
+)
+
+// JobLease 后台任务的租约，同一时间只有持有未过期租约的节点执行该任务
+type JobLease struct {
+	Name       string `json:"name" gorm:"primaryKey;type:varchar(64)"`
+	Holder     string `json:"holder" gorm:"type:varchar(128)"`
+	AcquiredAt int64  `json:"acquired_at" gorm:"bigint"`
+	RenewedAt  int64  `json:"renewed_at" gorm:"bigint"`
+	ExpiresAt  int64  `json:"expires_at" gorm:"bigint"`
+}
+
+// 未被持有时创建租约，已由 holder 持有时续期，由其他节点持有时返回 0
+var acquireJobLeaseScript = redis.NewScript(`
+local holder = redis.call('HGET', KEYS[1], 'holder')
+if holder == ARGV[1] then
+	redis.call('HSET', KEYS[1], 'renewed_at', ARGV[3])
+	redis.call('PEXPIRE', KEYS[1], ARGV[2])
+	return 1
+end
+if holder then
+	return 0
+end
+redis.call('HSET', KEYS[1], 'holder', ARGV[1], 'acquired_at', ARGV[3], 'renewed_at', ARGV[3])
+redis.call('PEXPIRE', KEYS[1], ARGV[2])
+return 1
+`)
+
+func jobLeaseRedisKey(name string) string {
+	return "job_lease:" + name
+}
+
+// AcquireJobLease 尝试获取或续期任务租约，启用 Redis 时使用 Redis，否则使用数据库
+func AcquireJobLease(name string, holder string, ttl time.Duration) (bool, error) {
+	now := common.GetTimestamp()
+	if common.RedisEnabled {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		acquired, err := acquireJobLeaseScript.Run(ctx, common.RDB, []string{jobLeaseRedisKey(name)},
+			holder, ttl.Milliseconds(), now).Int()
+		return acquired == 1, err
+	}
+
+	expiresAt := now + int64(ttl/time.Second)
+	// 续期自己的租约或接管已过期的租约；acquired_at 按列名排序先于 holder 更新，MySQL 中读取的仍是原持有者
+	result := DB.Model(&JobLease{}).Where("name = ? and (holder = ? or expires_at < ?)", name, holder, now).Updates(map[string]interface{}{
+		"acquired_at": gorm.Expr("CASE WHEN holder = ? THEN acquired_at ELSE ? END", holder, now),
+		"holder":      holder,
+		"renewed_at":  now,
+		"expires_at":  expiresAt,
+	})
+	if result.Error != nil {
+		return false, result.Error
+	}
+	if result.RowsAffected > 0 {
+		return true, nil
+	}
+	var count int64
+	if err := DB.Model(&JobLease{}).Where("name = ?", name).Count(&count).Error; err != nil {
+		return false, err
+	}
+	if count > 0 {
+		return false, nil
+	}
+	// 租约不存在时创建，并发创建时主键冲突的一方失败
+	if err := DB.Create(&JobLease{Name: name, Holder: holder, AcquiredAt: now, RenewedAt: now, ExpiresAt: expiresAt}).Error; err != nil {
+		if DB.Model(&JobLease{}).Where("name = ?", name).Count(&count); count > 0 {
+			return false, nil
+		}
+		return false, err
+	}
+	return true, nil
+}
+
+// GetJobLease 返回任务当前的租约，没有有效租约时返回 nil
+func GetJobLease(name string) (*JobLease, error) {
+	if common.RedisEnabled {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		key := jobLeaseRedisKey(name)
+		values, err := common.RDB.HGetAll(ctx, key).Result()
+		if err != nil || len(values) == 0 {
+			return nil, err
+		}
+		ttl, err := common.RDB.PTTL(ctx, key).Result()
+		if err != nil {
+			return nil, err
+		}
+		lease := &JobLease{Name: name, Holder: values["holder"], ExpiresAt: time.Now().Add(ttl).Unix()}
+		lease.AcquiredAt, _ = strconv.ParseInt(values["acquired_at"], 10, 64)
+		lease.RenewedAt, _ = strconv.ParseInt(values["renewed_at"], 10, 64)
+		return lease, nil
+	}
+	var lease JobLease
+	err := DB.Where("name = ? and expires_at >= ?", name, common.GetTimestamp()).Limit(1).Find(&lease).Error
+	if err != nil || lease.Name == "" {
+		return nil, err
+	}
+	return &lease, nil
+}
@@ -267,6 +267,23 @@ func migrateDB() error {
 		&Setup{},
 		&TwoFA{},
 		&TwoFABackupCode{},
+		&ChannelProbe{},
+		&ModelStatusData{},
+		&ModelIncident{},
+		&ModelStatusMinute{},
+		&QuotaLedger{},
+		&QuotaLedgerDrift{},
+		&BatchUpdateCheckpoint{},
+		&Statement{},
+		&MediaAsset{},
+		&WebhookSubscription{},
+		&WebhookDelivery{},
+		&SubscriptionPlan{},
+		&Subscription{},
+		&PaymentWebhookEvent{},
+		&ScimGroup{},
+		&ScimGroupMember{},
+		&JobLease{},
 	)
 	if err != nil {
 		return err
@@ -300,6 +317,23 @@ func migrateDBFast() error {
 		{&Setup{}, "Setup"},
 		{&TwoFA{}, "TwoFA"},
 		{&TwoFABackupCode{}, "TwoFABackupCode"},
+		{&ChannelProbe{}, "ChannelProbe"},
+		{&ModelStatusData{}, "ModelStatusData"},
+		{&ModelIncident{}, "ModelIncident"},
+		{&ModelStatusMinute{}, "ModelStatusMinute"},
+		{&QuotaLedger{}, "QuotaLedger"},
+		{&QuotaLedgerDrift{}, "QuotaLedgerDrift"},
+		{&BatchUpdateCheckpoint{}, "BatchUpdateCheckpoint"},
+		{&Statement{}, "Statement"},
+		{&MediaAsset{}, "MediaAsset"},
+		{&WebhookSubscription{}, "WebhookSubscription"},
+		{&WebhookDelivery{}, "WebhookDelivery"},
+		{&SubscriptionPlan{}, "SubscriptionPlan"},
+		{&Subscription{}, "Subscription"},
+		{&PaymentWebhookEvent{}, "PaymentWebhookEvent"},
+		{&ScimGroup{}, "ScimGroup"},
+		{&ScimGroupMember{}, "ScimGroupMember"},
+		{&JobLease{}, "JobLease"},
 	}
 	// 动态计算migration数量，确保errChan缓冲区足够大
 	errChan := make(chan error, len(migrations))
@@ -0,0 +1,130 @@
+package model
+
+import (
+	"errors"
+
+	"github.com/QuantumNous/new-api/common"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// 媒体文件来源
+const (
+	MediaSourceMidjourney = "midjourney"
+	MediaSourceImage      = "image"
+	MediaSourceAudio      = "audio"
+	MediaSourceVideo      = "video"
+)
+
+// MediaAsset 持久化保存的生成结果，文件本身保存在本地或 S3 兼容存储中
+type MediaAsset struct {
+	Id          int    `json:"id"`
+	Key         string `json:"key" gorm:"type:varchar(64);uniqueIndex"` // 对外访问标识
+	UserId      int    `json:"user_id" gorm:"index"`
+	Source      string `json:"source" gorm:"type:varchar(32);uniqueIndex:idx_media_asset_source"`
+	SourceId    string `json:"source_id" gorm:"type:varchar(191);uniqueIndex:idx_media_asset_source"` // 任务 ID，同步请求为请求 ID
+	Backend     string `json:"backend" gorm:"type:varchar(16)"`
+	StoragePath string `json:"-" gorm:"type:varchar(512)"`
+	ContentType string `json:"content_type" gorm:"type:varchar(128)"`
+	Size        int64  `json:"size" gorm:"bigint"`
+	Quota       int    `json:"quota" gorm:"default:0"` // 保存时扣除的额度
+	CreatedAt   int64  `json:"created_at" gorm:"bigint;index"`
+	ExpiresAt   int64  `json:"expires_at" gorm:"bigint;index;default:0"` // 0 表示永久保留
+}
+
+// Insert 保存记录，同一来源已保存过时不插入并返回 false
+func (asset *MediaAsset) Insert() (bool, error) {
+	asset.CreatedAt = common.GetTimestamp()
+	result := DB.Clauses(clause.OnConflict{DoNothing: true}).Create(asset)
+	if result.Error != nil {
+		return false, result.Error
+	}
+	return result.RowsAffected > 0, nil
+}
+
+func (asset *MediaAsset) Delete() error {
+	return DB.Delete(asset).Error
+}
+
+func (asset *MediaAsset) IsExpired() bool {
+	return asset.ExpiresAt > 0 && asset.ExpiresAt <= common.GetTimestamp()
+}
+
+func GetMediaAssetByKey(key string) (*MediaAsset, error) {
+	var asset MediaAsset
+	if err := DB.Where(commonKeyCol+" = ?", key).First(&asset).Error; err != nil {
+		return nil, err
+	}
+	return &asset, nil
+}
+
+func GetMediaAssetById(id int) (*MediaAsset, error) {
+	var asset MediaAsset
+	if err := DB.First(&asset, id).Error; err != nil {
+		return nil, err
+	}
+	return &asset, nil
+}
+
+// GetMediaAssetBySource 返回某个任务最近保存的未过期文件，不存在时返回 nil
+func GetMediaAssetBySource(source string, sourceId string) (*MediaAsset, error) {
+	var asset MediaAsset
+	err := DB.Where("source = ? and source_id = ? and (expires_at = 0 or expires_at > ?)", source, sourceId, common.GetTimestamp()).
+		Order("id desc").First(&asset).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &asset, nil
+}
+
+// GetExpiredMediaAssetBySource 返回某个任务已过期但尚未清理的文件，不存在时返回 nil
+func GetExpiredMediaAssetBySource(source string, sourceId string) (*MediaAsset, error) {
+	var asset MediaAsset
+	err := DB.Where("source = ? and source_id = ? and expires_at > 0 and expires_at <= ?", source, sourceId, common.GetTimestamp()).
+		First(&asset).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &asset, nil
+}
+
+func GetMediaAssets(userId int, source string, startIdx int, num int) (assets []*MediaAsset, total int64, err error) {
+	tx := DB.Model(&MediaAsset{})
+	if userId != 0 {
+		tx = tx.Where("user_id = ?", userId)
+	}
+	if source != "" {
+		tx = tx.Where("source = ?", source)
+	}
+	err = tx.Count(&total).Error
+	if err != nil {
+		return nil, 0, err
+	}
+	err = tx.Order("id desc").Limit(num).Offset(startIdx).Find(&assets).Error
+	return assets, total, err
+}
+
+// GetUserMediaUsage 返回用户当前占用的存储空间（字节）和文件数
+func GetUserMediaUsage(userId int) (size int64, count int64, err error) {
+	var result struct {
+		Size  int64
+		Count int64
+	}
+	err = DB.Model(&MediaAsset{}).Select("coalesce(sum(size), 0) as size, count(*) as count").
+		Where("user_id = ?", userId).Scan(&result).Error
+	return result.Size, result.Count, err
+}
+
+// GetExpiredMediaAssets 返回已过期的文件，用于定期清理
+func GetExpiredMediaAssets(limit int) ([]*MediaAsset, error) {
+	var assets []*MediaAsset
+	err := DB.Where("expires_at > 0 and expires_at <= ?", common.GetTimestamp()).Order("id").Limit(limit).Find(&assets).Error
+	return assets, err
+}
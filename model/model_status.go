@@ -0,0 +1,308 @@
+package model
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/QuantumNous/new-api/common"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// ModelStatusData 按小时聚合的模型可用性数据，来源于真实请求和渠道探测
+type ModelStatusData struct {
+	Id           int    `json:"id"`
+	ModelName    string `json:"model_name" gorm:"size:128;index:idx_msd_model_group,priority:1;default:''"`
+	GroupName    string `json:"group" gorm:"size:64;index:idx_msd_model_group,priority:2;default:''"`
+	CreatedAt    int64  `json:"created_at" gorm:"bigint;index"`
+	SuccessCount int    `json:"success_count" gorm:"default:0"`
+	ErrorCount   int    `json:"error_count" gorm:"default:0"`
+}
+
+// ModelIncident 模型故障事件，错误率持续超过阈值时自动开启，恢复后自动关闭
+type ModelIncident struct {
+	Id        int     `json:"id"`
+	ModelName string  `json:"model_name" gorm:"size:128;index;default:''"`
+	GroupName string  `json:"group" gorm:"size:64;default:''"`
+	StartedAt int64   `json:"started_at" gorm:"bigint;index"`
+	EndedAt   int64   `json:"ended_at" gorm:"bigint;default:0"` // 0 表示故障仍在持续
+	ErrorRate float64 `json:"error_rate"`                       // 故障期间观察到的最高错误率
+	Reason    string  `json:"reason" gorm:"type:text"`
+}
+
+// ModelUptime 模型（及分组）在一段时间内的可用性统计
+type ModelUptime struct {
+	ModelName    string  `json:"model_name"`
+	GroupName    string  `json:"group"`
+	SuccessCount int     `json:"success_count"`
+	ErrorCount   int     `json:"error_count"`
+	Uptime       float64 `json:"uptime"` // 0-100，没有数据时为 100
+}
+
+// ModelStatusMinute 按分钟聚合的请求结果，各节点定期写入，用于集群范围的故障检测，只保留最近一段时间
+type ModelStatusMinute struct {
+	Id           int    `json:"id"`
+	ModelName    string `json:"model_name" gorm:"size:128;uniqueIndex:idx_msm_model_group_minute,priority:1;default:''"`
+	GroupName    string `json:"group" gorm:"size:64;uniqueIndex:idx_msm_model_group_minute,priority:2;default:''"`
+	Minute       int64  `json:"minute" gorm:"bigint;uniqueIndex:idx_msm_model_group_minute,priority:3;index"`
+	SuccessCount int    `json:"success_count" gorm:"default:0"`
+	ErrorCount   int    `json:"error_count" gorm:"default:0"`
+}
+
+var cacheModelStatusData = make(map[string]*ModelStatusData)
+var cacheModelStatusDataLock = sync.Mutex{}
+
+// modelStatusWindow 本节点尚未写入数据库的每分钟请求结果
+var modelStatusWindow = make(map[string]*ModelStatusMinute)
+var modelStatusWindowLock = sync.Mutex{}
+
+func modelStatusKey(modelName string, group string) string {
+	return modelName + "\x00" + group
+}
+
+// LogModelStatus 记录一次请求或探测的结果
+func LogModelStatus(modelName string, group string, success bool) {
+	if modelName == "" {
+		return
+	}
+	now := common.GetTimestamp()
+	key := modelStatusKey(modelName, group)
+
+	// 只精确到小时
+	createdAt := now - (now % 3600)
+	cacheKey := fmt.Sprintf("%s-%d", key, createdAt)
+	cacheModelStatusDataLock.Lock()
+	data, ok := cacheModelStatusData[cacheKey]
+	if !ok {
+		data = &ModelStatusData{
+			ModelName: modelName,
+			GroupName: group,
+			CreatedAt: createdAt,
+		}
+		cacheModelStatusData[cacheKey] = data
+	}
+	if success {
+		data.SuccessCount++
+	} else {
+		data.ErrorCount++
+	}
+	cacheModelStatusDataLock.Unlock()
+
+	minute := now - (now % 60)
+	windowKey := fmt.Sprintf("%s-%d", key, minute)
+	modelStatusWindowLock.Lock()
+	bucket, ok := modelStatusWindow[windowKey]
+	if !ok {
+		bucket = &ModelStatusMinute{ModelName: modelName, GroupName: group, Minute: minute}
+		modelStatusWindow[windowKey] = bucket
+	}
+	if success {
+		bucket.SuccessCount++
+	} else {
+		bucket.ErrorCount++
+	}
+	modelStatusWindowLock.Unlock()
+}
+
+func UpdateModelStatusData() {
+	for {
+		time.Sleep(time.Minute)
+		SaveModelStatusCache()
+	}
+}
+
+func SaveModelStatusCache() {
+	cacheModelStatusDataLock.Lock()
+	cache := cacheModelStatusData
+	cacheModelStatusData = make(map[string]*ModelStatusData)
+	cacheModelStatusDataLock.Unlock()
+
+	for _, data := range cache {
+		result := DB.Model(&ModelStatusData{}).
+			Where("model_name = ? and group_name = ? and created_at = ?", data.ModelName, data.GroupName, data.CreatedAt).
+			Updates(map[string]interface{}{
+				"success_count": gorm.Expr("success_count + ?", data.SuccessCount),
+				"error_count":   gorm.Expr("error_count + ?", data.ErrorCount),
+			})
+		if result.Error != nil {
+			common.SysLog(fmt.Sprintf("failed to update model status data: %v", result.Error))
+			continue
+		}
+		if result.RowsAffected == 0 {
+			if err := DB.Create(data).Error; err != nil {
+				common.SysLog(fmt.Sprintf("failed to create model status data: %v", err))
+			}
+		}
+	}
+}
+
+// GetModelUptimes 统计时间范围内各模型的可用性，byGroup 为 true 时按模型和分组统计
+func GetModelUptimes(startTime int64, endTime int64, byGroup bool) ([]*ModelUptime, error) {
+	var uptimes []*ModelUptime
+	columns := "model_name"
+	if byGroup {
+		columns = "model_name, group_name"
+	}
+	tx := DB.Model(&ModelStatusData{}).
+		Select(columns+", sum(success_count) as success_count, sum(error_count) as error_count").
+		Where("created_at >= ? and created_at <= ?", startTime, endTime).
+		Group(columns).
+		Order(columns)
+	if err := tx.Scan(&uptimes).Error; err != nil {
+		return nil, err
+	}
+	for _, uptime := range uptimes {
+		uptime.Uptime = calcUptime(uptime.SuccessCount, uptime.ErrorCount)
+	}
+	return uptimes, nil
+}
+
+func calcUptime(successCount int, errorCount int) float64 {
+	total := successCount + errorCount
+	if total == 0 {
+		return 100
+	}
+	return float64(successCount) * 100 / float64(total)
+}
+
+func GetOpenModelIncidents() ([]*ModelIncident, error) {
+	var incidents []*ModelIncident
+	err := DB.Where("ended_at = 0").Order("started_at desc").Find(&incidents).Error
+	return incidents, err
+}
+
+// GetModelIncidents 返回与时间范围有交集的故障事件
+func GetModelIncidents(startTime int64, endTime int64) ([]*ModelIncident, error) {
+	var incidents []*ModelIncident
+	err := DB.Where("started_at <= ? and (ended_at = 0 or ended_at >= ?)", endTime, startTime).
+		Order("started_at desc").Find(&incidents).Error
+	return incidents, err
+}
+
+// ModelStatusWindowStat 模型（及分组）在故障检测窗口内的请求结果
+type ModelStatusWindowStat struct {
+	ModelName string
+	GroupName string
+	Success   int `gorm:"column:success_count"`
+	Error     int `gorm:"column:error_count"`
+}
+
+// FlushModelStatusWindow 将本节点的每分钟请求结果累加到数据库，各节点都需定期调用
+func FlushModelStatusWindow() {
+	modelStatusWindowLock.Lock()
+	window := modelStatusWindow
+	modelStatusWindow = make(map[string]*ModelStatusMinute)
+	modelStatusWindowLock.Unlock()
+
+	for _, bucket := range window {
+		if err := addModelStatusMinute(bucket); err != nil {
+			common.SysLog(fmt.Sprintf("failed to save model status window: %v", err))
+		}
+	}
+}
+
+func addModelStatusMinute(bucket *ModelStatusMinute) error {
+	// 先累加已有记录，不存在时插入；并发插入冲突时再累加一次
+	for i := 0; i < 2; i++ {
+		result := DB.Model(&ModelStatusMinute{}).
+			Where("model_name = ? and group_name = ? and minute = ?", bucket.ModelName, bucket.GroupName, bucket.Minute).
+			Updates(map[string]interface{}{
+				"success_count": gorm.Expr("success_count + ?", bucket.SuccessCount),
+				"error_count":   gorm.Expr("error_count + ?", bucket.ErrorCount),
+			})
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected > 0 {
+			return nil
+		}
+		result = DB.Clauses(clause.OnConflict{DoNothing: true}).Create(&ModelStatusMinute{
+			ModelName:    bucket.ModelName,
+			GroupName:    bucket.GroupName,
+			Minute:       bucket.Minute,
+			SuccessCount: bucket.SuccessCount,
+			ErrorCount:   bucket.ErrorCount,
+		})
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected > 0 {
+			return nil
+		}
+	}
+	return fmt.Errorf("model status window conflict: model=%s, group=%s", bucket.ModelName, bucket.GroupName)
+}
+
+// GetModelStatusWindow 汇总所有节点最近 windowMinutes 分钟的请求结果，并清理窗口外的数据
+func GetModelStatusWindow(windowMinutes int) ([]ModelStatusWindowStat, error) {
+	since := common.GetTimestamp() - int64(windowMinutes)*60
+	if err := DB.Where("minute < ?", since).Delete(&ModelStatusMinute{}).Error; err != nil {
+		common.SysLog(fmt.Sprintf("failed to clean model status window: %v", err))
+	}
+	stats := make([]ModelStatusWindowStat, 0)
+	err := DB.Model(&ModelStatusMinute{}).
+		Select("model_name, group_name, sum(success_count) as success_count, sum(error_count) as error_count").
+		Where("minute >= ?", since).
+		Group("model_name, group_name").
+		Scan(&stats).Error
+	return stats, err
+}
+
+// CheckModelIncidents 根据集群窗口内的错误率开启或关闭故障事件。请求数达到下限且错误率低于阈值时关闭，
+// 整个窗口内所有节点都没有请求的模型视为恢复；请求数不足时保持原状态
+func CheckModelIncidents(stats []ModelStatusWindowStat, windowMinutes int, errorRateThreshold float64, minRequests int) {
+	now := common.GetTimestamp()
+	active := make(map[string]bool, len(stats))
+	for _, stat := range stats {
+		active[modelStatusKey(stat.ModelName, stat.GroupName)] = true
+		total := stat.Success + stat.Error
+		errorRate := float64(stat.Error) / float64(total)
+		var incident ModelIncident
+		err := DB.Where("model_name = ? and group_name = ? and ended_at = 0", stat.ModelName, stat.GroupName).First(&incident).Error
+		hasOpen := err == nil
+		if err != nil && err != gorm.ErrRecordNotFound {
+			common.SysLog(fmt.Sprintf("failed to query model incident: %v", err))
+			continue
+		}
+		if total >= minRequests && errorRate >= errorRateThreshold {
+			if !hasOpen {
+				incident = ModelIncident{
+					ModelName: stat.ModelName,
+					GroupName: stat.GroupName,
+					StartedAt: now,
+					ErrorRate: errorRate,
+					Reason:    fmt.Sprintf("最近 %d 分钟错误率 %.1f%%（%d/%d）", windowMinutes, errorRate*100, stat.Error, total),
+				}
+				if err := DB.Create(&incident).Error; err != nil {
+					common.SysLog(fmt.Sprintf("failed to create model incident: %v", err))
+				} else {
+					common.SysLog(fmt.Sprintf("model incident opened: model=%s, group=%s, %s", stat.ModelName, stat.GroupName, incident.Reason))
+				}
+			} else if errorRate > incident.ErrorRate {
+				DB.Model(&incident).Update("error_rate", errorRate)
+			}
+		} else if hasOpen && total >= minRequests && errorRate < errorRateThreshold {
+			closeModelIncident(&incident, now)
+		}
+	}
+
+	incidents, err := GetOpenModelIncidents()
+	if err != nil {
+		common.SysLog(fmt.Sprintf("failed to query open model incidents: %v", err))
+		return
+	}
+	for _, incident := range incidents {
+		if !active[modelStatusKey(incident.ModelName, incident.GroupName)] {
+			closeModelIncident(incident, now)
+		}
+	}
+}
+
+func closeModelIncident(incident *ModelIncident, now int64) {
+	if err := DB.Model(incident).Update("ended_at", now).Error; err != nil {
+		common.SysLog(fmt.Sprintf("failed to close model incident: %v", err))
+		return
+	}
+	common.SysLog(fmt.Sprintf("model incident closed: model=%s, group=%s", incident.ModelName, incident.GroupName))
+}
@@ -195,7 +195,9 @@ func UpdateOption(key string, value string) error {
 	// otherwise it will execute Update (with all fields).
 	DB.Save(&option)
 	// Update OptionMap
-	return updateOptionMap(key, value)
+	err := updateOptionMap(key, value)
+	PublishCacheEvent(CacheEventOption, key)
+	return err
 }
 
 func updateOptionMap(key string, value string) (err error) {
@@ -0,0 +1,52 @@
+package model
+
+import (
+	"github.com/QuantumNous/new-api/common"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// PaymentWebhookEvent 已处理的支付平台回调事件，用于回调重放时的幂等判断
+type PaymentWebhookEvent struct {
+	Id        int    `json:"id"`
+	Provider  string `json:"provider" gorm:"type:varchar(32);uniqueIndex:idx_payment_webhook_event"`
+	EventId   string `json:"event_id" gorm:"type:varchar(191);uniqueIndex:idx_payment_webhook_event"`
+	EventType string `json:"event_type" gorm:"type:varchar(64)"`
+	TradeNo   string `json:"trade_no" gorm:"type:varchar(255);index"`
+	CreatedAt int64  `json:"created_at" gorm:"bigint;index"`
+}
+
+// ClaimPaymentWebhookEvent 登记回调事件，事件已登记过时返回 false；唯一索引冲突之外的错误原样返回，以便平台重试
+func ClaimPaymentWebhookEvent(provider string, eventId string, eventType string, tradeNo string) (bool, error) {
+	return claimPaymentWebhookEventTx(DB, &PaymentWebhookEvent{
+		Provider:  provider,
+		EventId:   eventId,
+		EventType: eventType,
+		TradeNo:   tradeNo,
+	})
+}
+
+// claimPaymentWebhookEventTx 在调用方的事务中登记回调事件，与订单处理一同提交或回滚。event 为 nil 时不做登记
+func claimPaymentWebhookEventTx(tx *gorm.DB, event *PaymentWebhookEvent) (bool, error) {
+	if event == nil || event.EventId == "" {
+		return true, nil
+	}
+	event.CreatedAt = common.GetTimestamp()
+	// 并发重复投递时由唯一索引去重，未插入即视为已登记
+	result := tx.Clauses(clause.OnConflict{DoNothing: true}).Create(event)
+	if result.Error != nil {
+		return false, result.Error
+	}
+	return result.RowsAffected > 0, nil
+}
+
+// ReleasePaymentWebhookEvent 事件处理失败时撤销登记，以便平台重试时重新处理
+func ReleasePaymentWebhookEvent(provider string, eventId string) error {
+	return DB.Where("provider = ? and event_id = ?", provider, eventId).Delete(&PaymentWebhookEvent{}).Error
+}
+
+// CleanupPaymentWebhookEvents 清理早于 before 的事件记录
+func CleanupPaymentWebhookEvents(before int64) error {
+	return DB.Where("created_at < ?", before).Delete(&PaymentWebhookEvent{}).Error
+}
@@ -0,0 +1,277 @@
+package model
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/setting/operation_setting"
+
+	"github.com/bytedance/gopkg/util/gopool"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+const (
+	QuotaLedgerTypeOpening      = "opening"       // 启用流水前的期初余额
+	QuotaLedgerTypePreConsume   = "pre_consume"   // 请求前预扣费
+	QuotaLedgerTypeSettle       = "settle"        // 请求结束后按实际用量结算（补扣或退还差额）
+	QuotaLedgerTypeRefund       = "refund"        // 请求或任务失败退还
+	QuotaLedgerTypeTopUp        = "topup"         // 在线充值
+	QuotaLedgerTypeTopUpRefund  = "topup_refund"  // 充值订单退款扣回
+	QuotaLedgerTypeRedemption   = "redemption"    // 兑换码
+	QuotaLedgerTypeReward       = "reward"        // 注册、邀请赠送及邀请额度划转
+	QuotaLedgerTypeAdminAdjust  = "admin_adjust"  // 管理员调整
+	QuotaLedgerTypeSubscription = "subscription"  // 订阅套餐按周期发放
+	QuotaLedgerTypeMediaStorage = "media_storage" // 生成结果持久化存储
+)
+
+// QuotaLedgerAccountUser 用户余额账户，其余账户为 system:<type>
+const QuotaLedgerAccountUser = "user"
+
+// QuotaLedger 额度流水，只追加不修改。每笔交易由两条分录组成：用户账户与对应的系统账户，金额之和为 0
+type QuotaLedger struct {
+	Id            int    `json:"id"`
+	TransactionId string `json:"transaction_id" gorm:"type:varchar(64);uniqueIndex:idx_quota_ledger_transaction,priority:1"`
+	Type          string `json:"type" gorm:"type:varchar(32);index"`
+	Account       string `json:"account" gorm:"type:varchar(64);index:idx_quota_ledger_account_user,priority:1;uniqueIndex:idx_quota_ledger_transaction,priority:2"`
+	UserId        int    `json:"user_id" gorm:"index:idx_quota_ledger_account_user,priority:2"`
+	TokenId       int    `json:"token_id" gorm:"default:0"`
+	Amount        int    `json:"amount"` // 正数为入账，负数为出账
+	Remark        string `json:"remark" gorm:"type:varchar(255);default:''"`
+	CreatedAt     int64  `json:"created_at" gorm:"bigint;index"`
+}
+
+// QuotaLedgerDrift 对账发现的用户余额与流水合计之间的偏差
+type QuotaLedgerDrift struct {
+	Id            int   `json:"id"`
+	UserId        int   `json:"user_id" gorm:"index"`
+	Balance       int   `json:"balance"`        // 用户表中的余额
+	LedgerBalance int   `json:"ledger_balance"` // 流水合计
+	Drift         int   `json:"drift"`          // Balance - LedgerBalance
+	CreatedAt     int64 `json:"created_at" gorm:"bigint;index"`
+}
+
+func buildQuotaLedgers(ledgerType string, userId int, tokenId int, amount int, remark string) []QuotaLedger {
+	return buildQuotaLedgersWithId(common.GetUUID(), ledgerType, userId, tokenId, amount, remark)
+}
+
+func buildQuotaLedgersWithId(transactionId string, ledgerType string, userId int, tokenId int, amount int, remark string) []QuotaLedger {
+	now := common.GetTimestamp()
+	return []QuotaLedger{
+		{TransactionId: transactionId, Type: ledgerType, Account: QuotaLedgerAccountUser, UserId: userId, TokenId: tokenId, Amount: amount, Remark: remark, CreatedAt: now},
+		{TransactionId: transactionId, Type: ledgerType, Account: "system:" + ledgerType, UserId: userId, TokenId: tokenId, Amount: -amount, Remark: remark, CreatedAt: now},
+	}
+}
+
+// 已确认存在期初余额的用户，避免每次记录流水都查询数据库
+var quotaLedgerOpenedUsers sync.Map
+
+// ensureQuotaLedgerOpeningTx 用户首次记录流水时，在同一事务中补记期初余额（余额为 0 时同样记录，作为已开账的标记）。
+// appliedAmount 为本事务中已修改到用户余额、但尚未记录流水的变动量，期初余额为当前余额减去该变动量。
+// 期初流水使用固定的交易号，并发的首次写入由唯一索引去重
+func ensureQuotaLedgerOpeningTx(tx *gorm.DB, userId int, appliedAmount int) error {
+	if _, ok := quotaLedgerOpenedUsers.Load(userId); ok {
+		return nil
+	}
+	var count int64
+	err := tx.Model(&QuotaLedger{}).Where("account = ? and user_id = ?", QuotaLedgerAccountUser, userId).Limit(1).Count(&count).Error
+	if err != nil {
+		return err
+	}
+	if count > 0 {
+		return nil
+	}
+	var user User
+	if err := tx.Select("id", "quota").Where("id = ?", userId).First(&user).Error; err != nil {
+		return err
+	}
+	ledgers := buildQuotaLedgersWithId(fmt.Sprintf("opening:%d", userId), QuotaLedgerTypeOpening, userId, 0, user.Quota-appliedAmount, "")
+	return tx.Clauses(clause.OnConflict{DoNothing: true}).Create(&ledgers).Error
+}
+
+func markQuotaLedgerOpened(userIds ...int) {
+	for _, userId := range userIds {
+		quotaLedgerOpenedUsers.Store(userId, struct{}{})
+	}
+}
+
+// recordQuotaLedgerTx 在调用方的事务中记录额度变动，调用前用户余额已在该事务中完成修改
+func recordQuotaLedgerTx(tx *gorm.DB, ledgerType string, userId int, amount int, remark string) error {
+	if amount == 0 || !operation_setting.GetQuotaLedgerSetting().Enabled {
+		return nil
+	}
+	if err := ensureQuotaLedgerOpeningTx(tx, userId, amount); err != nil {
+		return err
+	}
+	ledgers := buildQuotaLedgers(ledgerType, userId, 0, amount, remark)
+	return tx.Create(&ledgers).Error
+}
+
+// IncreaseUserQuotaWithLedger 增加用户额度并记录额度流水，未启用流水时等同于 IncreaseUserQuota
+func IncreaseUserQuotaWithLedger(id int, quota int, db bool, ledgerType string, tokenId int, remark string) error {
+	if quota < 0 {
+		return errors.New("quota 不能为负数！")
+	}
+	if quota == 0 || !operation_setting.GetQuotaLedgerSetting().Enabled {
+		return IncreaseUserQuota(id, quota, db)
+	}
+	return changeUserQuotaWithLedger(id, quota, db, ledgerType, tokenId, remark)
+}
+
+// DecreaseUserQuotaWithLedger 扣减用户额度并记录额度流水，未启用流水时等同于 DecreaseUserQuota
+func DecreaseUserQuotaWithLedger(id int, quota int, ledgerType string, tokenId int, remark string) error {
+	if quota < 0 {
+		return errors.New("quota 不能为负数！")
+	}
+	if quota == 0 || !operation_setting.GetQuotaLedgerSetting().Enabled {
+		return DecreaseUserQuota(id, quota)
+	}
+	return changeUserQuotaWithLedger(id, -quota, false, ledgerType, tokenId, remark)
+}
+
+// changeUserQuotaWithLedger 修改用户余额并记录流水。直接写库时两者在同一事务中完成；
+// 开启批量更新时余额增量与流水写入同一预写日志分段，随批量更新在同一事务中落库
+func changeUserQuotaWithLedger(userId int, delta int, db bool, ledgerType string, tokenId int, remark string) error {
+	gopool.Go(func() {
+		var err error
+		if delta >= 0 {
+			err = cacheIncrUserQuota(userId, int64(delta))
+		} else {
+			err = cacheDecrUserQuota(userId, int64(-delta))
+		}
+		if err != nil {
+			common.SysLog("failed to update user quota cache: " + err.Error())
+		}
+	})
+	ledgers := buildQuotaLedgers(ledgerType, userId, tokenId, delta, remark)
+	if !db && common.BatchUpdateEnabled {
+		addNewRecordWithLedgers(BatchUpdateTypeUserQuota, userId, delta, ledgers)
+		return nil
+	}
+	err := DB.Transaction(func(tx *gorm.DB) error {
+		if err := increaseUserQuota(tx, userId, delta); err != nil {
+			return err
+		}
+		if err := ensureQuotaLedgerOpeningTx(tx, userId, delta); err != nil {
+			return err
+		}
+		return tx.Create(&ledgers).Error
+	})
+	if err != nil {
+		return err
+	}
+	markQuotaLedgerOpened(userId)
+	return nil
+}
+
+func GetQuotaLedgers(userId int, ledgerType string, startTimestamp int64, endTimestamp int64, startIdx int, num int) (ledgers []*QuotaLedger, total int64, err error) {
+	tx := DB.Model(&QuotaLedger{}).Where("account = ?", QuotaLedgerAccountUser)
+	if userId != 0 {
+		tx = tx.Where("user_id = ?", userId)
+	}
+	if ledgerType != "" {
+		tx = tx.Where("type = ?", ledgerType)
+	}
+	if startTimestamp != 0 {
+		tx = tx.Where("created_at >= ?", startTimestamp)
+	}
+	if endTimestamp != 0 {
+		tx = tx.Where("created_at <= ?", endTimestamp)
+	}
+	err = tx.Count(&total).Error
+	if err != nil {
+		return nil, 0, err
+	}
+	err = tx.Order("id desc").Limit(num).Offset(startIdx).Find(&ledgers).Error
+	return ledgers, total, err
+}
+
+func GetQuotaLedgerDrifts(userId int, startIdx int, num int) (drifts []*QuotaLedgerDrift, total int64, err error) {
+	tx := DB.Model(&QuotaLedgerDrift{})
+	if userId != 0 {
+		tx = tx.Where("user_id = ?", userId)
+	}
+	err = tx.Count(&total).Error
+	if err != nil {
+		return nil, 0, err
+	}
+	err = tx.Order("id desc").Limit(num).Offset(startIdx).Find(&drifts).Error
+	return drifts, total, err
+}
+
+type userLedgerBalance struct {
+	UserId  int
+	Balance int
+}
+
+// 上一轮对账时各用户的偏差，连续两轮偏差相同才记录，避免把对账期间正在进行的扣费误判为偏差；
+// 已记录的偏差在数值变化前不再重复记录
+var lastQuotaLedgerDrifts = make(map[int]int)
+var reportedQuotaLedgerDrifts = make(map[int]int)
+
+// ReconcileQuotaLedger 对比用户余额与流水合计，返回本轮新发现的偏差。尚无流水的用户在首次记录流水时补记期初余额，此处跳过
+func ReconcileQuotaLedger() ([]QuotaLedgerDrift, error) {
+	var balances []userLedgerBalance
+	err := DB.Model(&QuotaLedger{}).Select("user_id, sum(amount) as balance").
+		Where("account = ?", QuotaLedgerAccountUser).Group("user_id").Scan(&balances).Error
+	if err != nil {
+		return nil, err
+	}
+	ledgerBalances := make(map[int]int, len(balances))
+	for _, b := range balances {
+		ledgerBalances[b.UserId] = b.Balance
+	}
+
+	now := common.GetTimestamp()
+	drifts := make([]QuotaLedgerDrift, 0)
+	currentDrifts := make(map[int]int)
+	var users []User
+	err = DB.Model(&User{}).Select("id", "quota").FindInBatches(&users, 1000, func(tx *gorm.DB, batch int) error {
+		for _, user := range users {
+			ledgerBalance, ok := ledgerBalances[user.Id]
+			if !ok {
+				continue
+			}
+			diff := user.Quota - ledgerBalance
+			if diff == 0 {
+				continue
+			}
+			currentDrifts[user.Id] = diff
+			if last, ok := lastQuotaLedgerDrifts[user.Id]; !ok || last != diff {
+				continue
+			}
+			if reported, ok := reportedQuotaLedgerDrifts[user.Id]; ok && reported == diff {
+				continue
+			}
+			drifts = append(drifts, QuotaLedgerDrift{
+				UserId:        user.Id,
+				Balance:       user.Quota,
+				LedgerBalance: ledgerBalance,
+				Drift:         diff,
+				CreatedAt:     now,
+			})
+		}
+		return nil
+	}).Error
+	if err != nil {
+		return nil, err
+	}
+
+	lastQuotaLedgerDrifts = currentDrifts
+	for userId := range reportedQuotaLedgerDrifts {
+		if _, ok := currentDrifts[userId]; !ok {
+			delete(reportedQuotaLedgerDrifts, userId)
+		}
+	}
+	if len(drifts) > 0 {
+		if err := DB.CreateInBatches(&drifts, 100).Error; err != nil {
+			return nil, err
+		}
+		for _, drift := range drifts {
+			reportedQuotaLedgerDrifts[drift.UserId] = drift.Drift
+		}
+	}
+	return drifts, nil
+}
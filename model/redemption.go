@@ -141,6 +141,10 @@ func Redeem(key string, userId int) (quota int, err error) {
 		if err != nil {
 			return err
 		}
+		err = recordQuotaLedgerTx(tx, QuotaLedgerTypeRedemption, userId, redemption.Quota, redemption.Name)
+		if err != nil {
+			return err
+		}
 		redemption.RedeemedTime = common.GetTimestamp()
 		redemption.Status = common.RedemptionCodeStatusUsed
 		redemption.UsedUserId = userId
@@ -0,0 +1,222 @@
+package model
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/QuantumNous/new-api/common"
+
+	"gorm.io/gorm"
+)
+
+// ScimGroup 由身份提供方通过 SCIM 同步的组，成员关系决定用户所在分组
+type ScimGroup struct {
+	Id          int    `json:"id"`
+	DisplayName string `json:"display_name" gorm:"type:varchar(191);uniqueIndex"`
+	ExternalId  string `json:"external_id" gorm:"type:varchar(191);index"`
+	CreatedTime int64  `json:"created_time" gorm:"bigint"`
+	UpdatedTime int64  `json:"updated_time" gorm:"bigint"`
+}
+
+type ScimGroupMember struct {
+	Id      int `json:"id"`
+	GroupId int `json:"group_id" gorm:"uniqueIndex:idx_scim_group_member"`
+	UserId  int `json:"user_id" gorm:"uniqueIndex:idx_scim_group_member;index"`
+}
+
+var (
+	ErrScimGroupNotFound = errors.New("SCIM 组不存在")
+	ErrScimUserNotFound  = errors.New("SCIM 用户不存在")
+)
+
+// GetScimUserById 返回由 SCIM 管理的用户，本地账号和超级管理员不对身份提供方可见
+func GetScimUserById(id int) (*User, error) {
+	var user User
+	err := DB.Where("id = ? and scim_external_id <> '' and role < ?", id, common.RoleRootUser).First(&user).Error
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrScimUserNotFound
+		}
+		return nil, err
+	}
+	return &user, nil
+}
+
+// GetScimUsers 分页查询由 SCIM 管理的用户，column 非空时按该列精确匹配 value
+func GetScimUsers(column string, value string, offset int, limit int) (users []*User, total int64, err error) {
+	tx := DB.Model(&User{}).Where("scim_external_id <> '' and role < ?", common.RoleRootUser)
+	if column != "" {
+		tx = tx.Where(column+" = ?", value)
+	}
+	if err = tx.Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+	err = tx.Order("id asc").Offset(offset).Limit(limit).Find(&users).Error
+	return users, total, err
+}
+
+// UpdateScimAttributes 更新身份提供方管理的用户属性
+func (user *User) UpdateScimAttributes() error {
+	err := DB.Model(user).Select("username", "display_name", "email", "scim_external_id", "status").Updates(user).Error
+	if err != nil {
+		return err
+	}
+	return invalidateUserCache(user.Id)
+}
+
+func (group *ScimGroup) Insert() error {
+	now := common.GetTimestamp()
+	group.CreatedTime = now
+	group.UpdatedTime = now
+	return DB.Create(group).Error
+}
+
+func (group *ScimGroup) Update() error {
+	group.UpdatedTime = common.GetTimestamp()
+	return DB.Model(group).Select("display_name", "external_id", "updated_time").Updates(group).Error
+}
+
+func GetScimGroupById(id int) (*ScimGroup, error) {
+	var group ScimGroup
+	if err := DB.First(&group, id).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrScimGroupNotFound
+		}
+		return nil, err
+	}
+	return &group, nil
+}
+
+// GetScimGroups 分页查询 SCIM 组，column 非空时按该列精确匹配 value
+func GetScimGroups(column string, value string, offset int, limit int) (groups []*ScimGroup, total int64, err error) {
+	tx := DB.Model(&ScimGroup{})
+	if column != "" {
+		tx = tx.Where(column+" = ?", value)
+	}
+	if err = tx.Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+	err = tx.Order("id asc").Offset(offset).Limit(limit).Find(&groups).Error
+	return groups, total, err
+}
+
+// DeleteScimGroup 删除组及其成员关系，返回原成员的用户 ID
+func DeleteScimGroup(id int) ([]int, error) {
+	userIds, err := GetScimGroupMemberIds(id)
+	if err != nil {
+		return nil, err
+	}
+	err = DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("group_id = ?", id).Delete(&ScimGroupMember{}).Error; err != nil {
+			return err
+		}
+		result := tx.Delete(&ScimGroup{}, id)
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return ErrScimGroupNotFound
+		}
+		return nil
+	})
+	return userIds, err
+}
+
+func GetScimGroupMemberIds(groupId int) (userIds []int, err error) {
+	err = DB.Model(&ScimGroupMember{}).Where("group_id = ?", groupId).Order("user_id asc").Pluck("user_id", &userIds).Error
+	return userIds, err
+}
+
+// GetScimGroupMembers 返回组内仍存在的用户（id、用户名）
+func GetScimGroupMembers(groupId int) (users []*User, err error) {
+	err = DB.Select("id", "username").Where("id in (?)", DB.Model(&ScimGroupMember{}).Select("user_id").Where("group_id = ?", groupId)).
+		Order("id asc").Find(&users).Error
+	return users, err
+}
+
+func GetUserScimGroups(userId int) (groups []*ScimGroup, err error) {
+	err = DB.Where("id in (?)", DB.Model(&ScimGroupMember{}).Select("group_id").Where("user_id = ?", userId)).
+		Order("id asc").Find(&groups).Error
+	return groups, err
+}
+
+// AddScimGroupMembers 添加组成员，已是成员的用户忽略，返回实际新增的用户 ID
+func AddScimGroupMembers(groupId int, userIds []int) ([]int, error) {
+	existing, err := GetScimGroupMemberIds(groupId)
+	if err != nil {
+		return nil, err
+	}
+	existingSet := make(map[int]bool, len(existing))
+	for _, id := range existing {
+		existingSet[id] = true
+	}
+	var added []int
+	for _, userId := range userIds {
+		if existingSet[userId] {
+			continue
+		}
+		// 仅允许由 SCIM 管理的用户加入组，避免影响本地账号的分组
+		var count int64
+		if err := DB.Model(&User{}).Where("id = ? and scim_external_id <> ''", userId).Count(&count).Error; err != nil {
+			return added, err
+		}
+		if count == 0 {
+			return added, fmt.Errorf("用户 %d 不存在或不由 SCIM 管理", userId)
+		}
+		if err := DB.Create(&ScimGroupMember{GroupId: groupId, UserId: userId}).Error; err != nil {
+			return added, err
+		}
+		existingSet[userId] = true
+		added = append(added, userId)
+	}
+	return added, nil
+}
+
+// RemoveScimGroupMembers 移除组成员，userIds 为空时移除全部成员，返回实际移除的用户 ID
+func RemoveScimGroupMembers(groupId int, userIds []int) ([]int, error) {
+	existing, err := GetScimGroupMemberIds(groupId)
+	if err != nil {
+		return nil, err
+	}
+	var removed []int
+	if userIds == nil {
+		removed = existing
+	} else {
+		existingSet := make(map[int]bool, len(existing))
+		for _, id := range existing {
+			existingSet[id] = true
+		}
+		for _, id := range userIds {
+			if existingSet[id] {
+				removed = append(removed, id)
+			}
+		}
+	}
+	if len(removed) == 0 {
+		return nil, nil
+	}
+	err = DB.Where("group_id = ? and user_id in ?", groupId, removed).Delete(&ScimGroupMember{}).Error
+	return removed, err
+}
+
+func RemoveUserScimGroupMemberships(userId int) error {
+	return DB.Where("user_id = ?", userId).Delete(&ScimGroupMember{}).Error
+}
+
+// DeprovisionUser 停用用户：禁用账号、清除系统访问令牌并删除全部 API 令牌
+func DeprovisionUser(userId int) (int, error) {
+	err := DB.Model(&User{}).Where("id = ?", userId).Updates(map[string]interface{}{
+		"status":       common.UserStatusDisabled,
+		"access_token": nil,
+	}).Error
+	if err != nil {
+		return 0, err
+	}
+	_ = invalidateUserCache(userId)
+	revoked, err := RevokeUserTokens(userId)
+	if err != nil {
+		return 0, err
+	}
+	RecordLog(userId, LogTypeManage, fmt.Sprintf("用户已被身份提供方停用，撤销令牌 %d 个", revoked))
+	return revoked, nil
+}
@@ -0,0 +1,219 @@
+package model
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/setting/operation_setting"
+
+	"github.com/samber/lo"
+	"gorm.io/gorm"
+)
+
+// StatementLineItem 账单明细，按模型、令牌和分组汇总
+type StatementLineItem struct {
+	ModelName        string  `json:"model_name"`
+	TokenName        string  `json:"token_name"`
+	GroupName        string  `json:"group"`
+	Requests         int     `json:"requests"`
+	PromptTokens     int     `json:"prompt_tokens"`
+	CompletionTokens int     `json:"completion_tokens"`
+	TotalTokens      int     `json:"total_tokens"`
+	Quota            int     `json:"quota"`
+	Amount           float64 `json:"amount" gorm:"-"`
+}
+
+// Statement 按账期生成的账单，生成后不再修改，编号全局顺序递增
+type Statement struct {
+	Id             int                 `json:"id"`
+	Sequence       int                 `json:"sequence" gorm:"uniqueIndex"`
+	InvoiceNo      string              `json:"invoice_no" gorm:"type:varchar(64);uniqueIndex"`
+	UserId         int                 `json:"user_id" gorm:"index;uniqueIndex:idx_statement_subject,priority:1"`                           // 用户账单
+	GroupName      string              `json:"group" gorm:"type:varchar(64);index;default:'';uniqueIndex:idx_statement_subject,priority:2"` // 分组（组织）账单，此时 UserId 为 0
+	Period         string              `json:"period" gorm:"type:varchar(16);index;uniqueIndex:idx_statement_subject,priority:3"`           // 账期，格式 YYYY-MM
+	PeriodStart    int64               `json:"period_start" gorm:"bigint"`                                                                  // 账期开始时间（含）
+	PeriodEnd      int64               `json:"period_end" gorm:"bigint"`                                                                    // 账期结束时间（不含）
+	Currency       string              `json:"currency" gorm:"type:varchar(16)"`                                                            // 账单币种
+	CurrencySymbol string              `json:"currency_symbol" gorm:"type:varchar(16)"`
+	ExchangeRate   float64             `json:"exchange_rate"` // 生成账单时 1 USD 对应的账单币种金额
+	TotalQuota     int                 `json:"total_quota"`
+	TotalAmount    float64             `json:"total_amount"`
+	LineItems      string              `json:"-" gorm:"type:text"` // 明细 JSON
+	Items          []StatementLineItem `json:"items,omitempty" gorm:"-"`
+	EmailSentAt    int64               `json:"email_sent_at" gorm:"bigint;default:0"`
+	CreatedAt      int64               `json:"created_at" gorm:"bigint;index"`
+}
+
+func (statement *Statement) LoadItems() error {
+	if statement.LineItems == "" {
+		statement.Items = []StatementLineItem{}
+		return nil
+	}
+	return common.UnmarshalJsonStr(statement.LineItems, &statement.Items)
+}
+
+// Insert 分配顺序编号并保存账单，编号冲突时重试。同一用户或分组在同一账期只能有一张账单，
+// 并发生成时以先写入的为准，statement 会被替换为已有账单
+func (statement *Statement) Insert() error {
+	items, err := common.Marshal(statement.Items)
+	if err != nil {
+		return err
+	}
+	statement.LineItems = string(items)
+	statement.CreatedAt = common.GetTimestamp()
+	prefix := operation_setting.GetStatementSetting().InvoicePrefix
+	for i := 0; i < 3; i++ {
+		err = DB.Transaction(func(tx *gorm.DB) error {
+			var maxSequence int
+			if err := tx.Model(&Statement{}).Select("coalesce(max(sequence), 0)").Scan(&maxSequence).Error; err != nil {
+				return err
+			}
+			statement.Id = 0
+			statement.Sequence = maxSequence + 1
+			statement.InvoiceNo = fmt.Sprintf("%s%06d", prefix, statement.Sequence)
+			return tx.Create(statement).Error
+		})
+		if err == nil {
+			return nil
+		}
+		existing, lookupErr := GetStatementBySubject(statement.UserId, statement.GroupName, statement.Period)
+		if lookupErr == nil && existing != nil {
+			*statement = *existing
+			return nil
+		}
+	}
+	return err
+}
+
+func MarkStatementEmailSent(id int) error {
+	return DB.Model(&Statement{}).Where("id = ?", id).Update("email_sent_at", common.GetTimestamp()).Error
+}
+
+// GetStatementBySubject 返回指定用户或分组在某一账期的账单，不存在时返回 nil
+func GetStatementBySubject(userId int, groupName string, period string) (*Statement, error) {
+	var statement Statement
+	err := DB.Where("user_id = ? and group_name = ? and period = ?", userId, groupName, period).First(&statement).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &statement, statement.LoadItems()
+}
+
+func GetStatementById(id int) (*Statement, error) {
+	var statement Statement
+	if err := DB.First(&statement, id).Error; err != nil {
+		return nil, err
+	}
+	return &statement, statement.LoadItems()
+}
+
+func GetStatements(userId int, groupName string, period string, startIdx int, num int) (statements []*Statement, total int64, err error) {
+	tx := DB.Model(&Statement{})
+	if userId != 0 {
+		tx = tx.Where("user_id = ?", userId)
+	}
+	if groupName != "" {
+		tx = tx.Where("group_name = ?", groupName)
+	}
+	if period != "" {
+		tx = tx.Where("period = ?", period)
+	}
+	err = tx.Count(&total).Error
+	if err != nil {
+		return nil, 0, err
+	}
+	err = tx.Omit("line_items").Order("id desc").Limit(num).Offset(startIdx).Find(&statements).Error
+	return statements, total, err
+}
+
+// GetUserIdsByGroup 返回分组内的全部用户，用于生成组织账单
+func GetUserIdsByGroup(groupName string) ([]int, error) {
+	var ids []int
+	err := DB.Model(&User{}).Where(commonGroupCol+" = ?", groupName).Pluck("id", &ids).Error
+	return ids, err
+}
+
+// statementUserIdBatchSize 分组账单按批查询用户消费，避免 in 条件的参数超过数据库限制
+const statementUserIdBatchSize = 500
+
+// GetStatementLineItems 汇总账期内的消费明细。优先使用消费日志按模型、令牌和分组汇总；
+// 未开启消费日志或日志已被清理时，退回使用数据看板的 QuotaData 按模型汇总
+func GetStatementLineItems(userIds []int, startTime int64, endTime int64) ([]StatementLineItem, error) {
+	items := make([]StatementLineItem, 0)
+	if len(userIds) == 0 {
+		return items, nil
+	}
+	index := make(map[string]int)
+	for _, chunk := range lo.Chunk(userIds, statementUserIdBatchSize) {
+		var batch []StatementLineItem
+		err := LOG_DB.Table("logs").
+			Select("model_name, token_name, "+logGroupCol+" as group_name, count(*) as requests, sum(prompt_tokens) as prompt_tokens, sum(completion_tokens) as completion_tokens, sum(prompt_tokens) + sum(completion_tokens) as total_tokens, sum(quota) as quota").
+			Where("user_id in ? and type = ? and created_at >= ? and created_at < ?", chunk, LogTypeConsume, startTime, endTime).
+			Group("model_name, token_name, " + logGroupCol).
+			Scan(&batch).Error
+		if err != nil {
+			return nil, err
+		}
+		items = mergeStatementLineItems(items, index, batch)
+	}
+	if len(items) == 0 {
+		for _, chunk := range lo.Chunk(userIds, statementUserIdBatchSize) {
+			var batch []StatementLineItem
+			err := DB.Table("quota_data").
+				Select("model_name, sum(count) as requests, sum(token_used) as total_tokens, sum(quota) as quota").
+				Where("user_id in ? and created_at >= ? and created_at < ?", chunk, startTime, endTime).
+				Group("model_name").
+				Scan(&batch).Error
+			if err != nil {
+				return nil, err
+			}
+			items = mergeStatementLineItems(items, index, batch)
+		}
+	}
+	sort.SliceStable(items, func(i, j int) bool {
+		if items[i].ModelName != items[j].ModelName {
+			return items[i].ModelName < items[j].ModelName
+		}
+		return items[i].TokenName < items[j].TokenName
+	})
+	return items, nil
+}
+
+// mergeStatementLineItems 合并各批次的汇总结果，模型、令牌和分组相同的明细累加
+func mergeStatementLineItems(items []StatementLineItem, index map[string]int, batch []StatementLineItem) []StatementLineItem {
+	for _, item := range batch {
+		key := item.ModelName + "\x00" + item.TokenName + "\x00" + item.GroupName
+		i, ok := index[key]
+		if !ok {
+			index[key] = len(items)
+			items = append(items, item)
+			continue
+		}
+		items[i].Requests += item.Requests
+		items[i].PromptTokens += item.PromptTokens
+		items[i].CompletionTokens += item.CompletionTokens
+		items[i].TotalTokens += item.TotalTokens
+		items[i].Quota += item.Quota
+	}
+	return items
+}
+
+// GetConsumedUserIds 返回时间范围内有消费记录的用户，用于每月自动生成账单
+func GetConsumedUserIds(startTime int64, endTime int64) ([]int, error) {
+	var ids []int
+	err := LOG_DB.Table("logs").
+		Where("type = ? and created_at >= ? and created_at < ?", LogTypeConsume, startTime, endTime).
+		Distinct("user_id").Pluck("user_id", &ids).Error
+	if err != nil || len(ids) > 0 {
+		return ids, err
+	}
+	err = DB.Table("quota_data").
+		Where("created_at >= ? and created_at < ?", startTime, endTime).
+		Distinct("user_id").Pluck("user_id", &ids).Error
+	return ids, err
+}
@@ -0,0 +1,387 @@
+package model
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/logger"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+const (
+	SubscriptionPeriodDay   = "day"
+	SubscriptionPeriodWeek  = "week"
+	SubscriptionPeriodMonth = "month"
+	SubscriptionPeriodYear  = "year"
+)
+
+const (
+	SubscriptionStatusPending = "pending"  // 已发起支付，尚未付款
+	SubscriptionStatusActive  = "active"   // 当前周期已付款
+	SubscriptionStatusPastDue = "past_due" // 周期已结束但未续费，处于宽限期
+	SubscriptionStatusExpired = "expired"  // 已到期或已取消
+)
+
+// SubscriptionPlan 订阅套餐，每个周期发放固定额度，可选将用户切换到指定分组
+type SubscriptionPlan struct {
+	Id             int     `json:"id"`
+	Name           string  `json:"name" gorm:"type:varchar(64)"`
+	Description    string  `json:"description" gorm:"type:text"`
+	Price          float64 `json:"price"`                                    // 每周期价格，用于易支付下单和套餐变更时按比例折算
+	Currency       string  `json:"currency" gorm:"type:varchar(16)"`         // 仅用于展示
+	PeriodUnit     string  `json:"period_unit" gorm:"type:varchar(16)"`      // day/week/month/year
+	PeriodCount    int     `json:"period_count" gorm:"default:1"`            // 每个周期包含的 PeriodUnit 数
+	QuotaPerPeriod int     `json:"quota_per_period"`                         // 每个周期发放的额度
+	Group          string  `json:"group" gorm:"type:varchar(64);default:''"` // 订阅期间用户所在分组，为空时不切换
+	StripePriceId  string  `json:"stripe_price_id" gorm:"type:varchar(128)"`
+	CreemProductId string  `json:"creem_product_id" gorm:"type:varchar(128)"`
+	Enabled        bool    `json:"enabled" gorm:"default:true"`
+	Sort           int     `json:"sort" gorm:"default:0"`
+	CreatedTime    int64   `json:"created_time" gorm:"bigint"`
+	UpdatedTime    int64   `json:"updated_time" gorm:"bigint"`
+}
+
+// Subscription 用户订阅，每个用户同一时间最多有一个未到期的订阅
+type Subscription struct {
+	Id                     int    `json:"id"`
+	UserId                 int    `json:"user_id" gorm:"index"`
+	PlanId                 int    `json:"plan_id" gorm:"index"`
+	PendingPlanId          int    `json:"pending_plan_id" gorm:"default:0"`              // 下个周期生效的套餐
+	Reference              string `json:"reference" gorm:"type:varchar(64);uniqueIndex"` // 本地订阅编号，作为支付平台的订单引用
+	Provider               string `json:"provider" gorm:"type:varchar(32)"`
+	ProviderSubscriptionId string `json:"provider_subscription_id" gorm:"type:varchar(128);index"`
+	ProviderCustomerId     string `json:"provider_customer_id" gorm:"type:varchar(128)"`
+	Status                 string `json:"status" gorm:"type:varchar(16);index"`
+	CurrentPeriodStart     int64  `json:"current_period_start" gorm:"bigint"`
+	CurrentPeriodEnd       int64  `json:"current_period_end" gorm:"bigint;index"`
+	GrantedPeriodEnd       int64  `json:"granted_period_end" gorm:"bigint;default:0"` // 已发放额度的最后一个周期结束时间，保证每个周期只发放一次
+	CancelAtPeriodEnd      bool   `json:"cancel_at_period_end" gorm:"default:false"`
+	PreviousGroup          string `json:"previous_group" gorm:"type:varchar(64);default:''"` // 切换分组前的原分组，到期后恢复
+	CreatedTime            int64  `json:"created_time" gorm:"bigint"`
+	UpdatedTime            int64  `json:"updated_time" gorm:"bigint"`
+}
+
+// NextPeriodEnd 返回从 start 开始的一个周期的结束时间
+func (plan *SubscriptionPlan) NextPeriodEnd(start int64) int64 {
+	count := plan.PeriodCount
+	if count <= 0 {
+		count = 1
+	}
+	t := time.Unix(start, 0)
+	switch plan.PeriodUnit {
+	case SubscriptionPeriodDay:
+		t = t.AddDate(0, 0, count)
+	case SubscriptionPeriodWeek:
+		t = t.AddDate(0, 0, 7*count)
+	case SubscriptionPeriodYear:
+		t = t.AddDate(count, 0, 0)
+	default:
+		t = t.AddDate(0, count, 0)
+	}
+	return t.Unix()
+}
+
+func (plan *SubscriptionPlan) Insert() error {
+	plan.CreatedTime = common.GetTimestamp()
+	plan.UpdatedTime = plan.CreatedTime
+	return DB.Create(plan).Error
+}
+
+func (plan *SubscriptionPlan) Update() error {
+	plan.UpdatedTime = common.GetTimestamp()
+	return DB.Model(plan).Select("name", "description", "price", "currency", "period_unit", "period_count",
+		"quota_per_period", "group", "stripe_price_id", "creem_product_id", "enabled", "sort", "updated_time").Updates(plan).Error
+}
+
+func DeleteSubscriptionPlan(id int) error {
+	var count int64
+	err := DB.Model(&Subscription{}).Where("(plan_id = ? or pending_plan_id = ?) and status <> ?", id, id, SubscriptionStatusExpired).Count(&count).Error
+	if err != nil {
+		return err
+	}
+	if count > 0 {
+		return errors.New("仍有未到期的订阅使用该套餐，请先禁用套餐")
+	}
+	return DB.Delete(&SubscriptionPlan{}, id).Error
+}
+
+func GetSubscriptionPlans(enabledOnly bool) (plans []*SubscriptionPlan, err error) {
+	tx := DB.Model(&SubscriptionPlan{})
+	if enabledOnly {
+		tx = tx.Where("enabled = ?", true)
+	}
+	err = tx.Order("sort desc, id asc").Find(&plans).Error
+	return plans, err
+}
+
+func GetSubscriptionPlanById(id int) (*SubscriptionPlan, error) {
+	var plan SubscriptionPlan
+	if err := DB.First(&plan, id).Error; err != nil {
+		return nil, errors.New("套餐不存在")
+	}
+	return &plan, nil
+}
+
+func (subscription *Subscription) Insert() error {
+	subscription.CreatedTime = common.GetTimestamp()
+	subscription.UpdatedTime = subscription.CreatedTime
+	return DB.Create(subscription).Error
+}
+
+func GetSubscriptionById(id int) (*Subscription, error) {
+	var subscription Subscription
+	if err := DB.First(&subscription, id).Error; err != nil {
+		return nil, errors.New("订阅不存在")
+	}
+	return &subscription, nil
+}
+
+func GetSubscriptionByReference(reference string) (*Subscription, error) {
+	var subscription Subscription
+	if err := DB.Where("reference = ?", reference).First(&subscription).Error; err != nil {
+		return nil, errors.New("订阅不存在")
+	}
+	return &subscription, nil
+}
+
+func GetSubscriptionByProviderId(provider string, providerSubscriptionId string) (*Subscription, error) {
+	var subscription Subscription
+	err := DB.Where("provider = ? and provider_subscription_id = ?", provider, providerSubscriptionId).First(&subscription).Error
+	if err != nil {
+		return nil, errors.New("订阅不存在")
+	}
+	return &subscription, nil
+}
+
+// GetUserSubscription 返回用户当前未到期的订阅（生效中或宽限期内），没有时返回 nil
+func GetUserSubscription(userId int) (*Subscription, error) {
+	var subscription Subscription
+	err := DB.Where("user_id = ? and status in ?", userId, []string{SubscriptionStatusActive, SubscriptionStatusPastDue}).
+		Order("id desc").First(&subscription).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &subscription, nil
+}
+
+func GetSubscriptions(userId int, status string, startIdx int, num int) (subscriptions []*Subscription, total int64, err error) {
+	tx := DB.Model(&Subscription{})
+	if userId != 0 {
+		tx = tx.Where("user_id = ?", userId)
+	}
+	if status != "" {
+		tx = tx.Where("status = ?", status)
+	}
+	if err = tx.Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+	err = tx.Order("id desc").Limit(num).Offset(startIdx).Find(&subscriptions).Error
+	return subscriptions, total, err
+}
+
+// ExpirePendingSubscriptions 将超过 before 仍未付款的订阅标记为到期
+func ExpirePendingSubscriptions(before int64) (int64, error) {
+	result := DB.Model(&Subscription{}).Where("status = ? and created_time < ?", SubscriptionStatusPending, before).
+		Updates(map[string]interface{}{"status": SubscriptionStatusExpired, "updated_time": common.GetTimestamp()})
+	return result.RowsAffected, result.Error
+}
+
+// GetLapsedSubscriptions 返回当前周期已结束的生效中或宽限期订阅
+func GetLapsedSubscriptions(now int64) (subscriptions []*Subscription, err error) {
+	err = DB.Where("status in ? and current_period_end < ?", []string{SubscriptionStatusActive, SubscriptionStatusPastDue}, now).
+		Find(&subscriptions).Error
+	return subscriptions, err
+}
+
+func UpdateSubscriptionFields(id int, fields map[string]interface{}) error {
+	fields["updated_time"] = common.GetTimestamp()
+	return DB.Model(&Subscription{}).Where("id = ?", id).Updates(fields).Error
+}
+
+// switchSubscriptionGroupTx 将用户切换到套餐分组，并记录原分组以便到期后恢复
+func switchSubscriptionGroupTx(tx *gorm.DB, subscription *Subscription, plan *SubscriptionPlan) (string, error) {
+	if plan.Group == "" {
+		return "", nil
+	}
+	var user User
+	if err := tx.Select("id", "group").First(&user, subscription.UserId).Error; err != nil {
+		return "", err
+	}
+	if user.Group == plan.Group {
+		return "", nil
+	}
+	if subscription.PreviousGroup == "" {
+		subscription.PreviousGroup = user.Group
+	}
+	if err := tx.Model(&User{}).Where("id = ?", user.Id).Update("group", plan.Group).Error; err != nil {
+		return "", err
+	}
+	return plan.Group, nil
+}
+
+// RenewSubscription 确认订阅的一个付费周期：发放周期额度、切换分组并更新周期时间。
+// 以周期结束时间保证幂等，同一周期重复回调不会重复发放额度
+func RenewSubscription(subscriptionId int, periodStart int64, periodEnd int64, remark string) error {
+	var (
+		subscription Subscription
+		plan         *SubscriptionPlan
+		newGroup     string
+		granted      bool
+	)
+	err := DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&subscription, subscriptionId).Error; err != nil {
+			return errors.New("订阅不存在")
+		}
+		if periodEnd <= subscription.GrantedPeriodEnd {
+			return nil
+		}
+		// 以已发放周期为条件先行占位，即使数据库不支持行级锁，同一周期重复回调也只发放一次
+		result := tx.Model(&Subscription{}).Where("id = ? and granted_period_end < ?", subscription.Id, periodEnd).Update("granted_period_end", periodEnd)
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return nil
+		}
+		if subscription.PendingPlanId != 0 {
+			subscription.PlanId = subscription.PendingPlanId
+			subscription.PendingPlanId = 0
+		}
+		var err error
+		plan = &SubscriptionPlan{}
+		if err = tx.First(plan, subscription.PlanId).Error; err != nil {
+			return errors.New("套餐不存在")
+		}
+		if newGroup, err = switchSubscriptionGroupTx(tx, &subscription, plan); err != nil {
+			return err
+		}
+		if plan.QuotaPerPeriod > 0 {
+			if err = tx.Model(&User{}).Where("id = ?", subscription.UserId).Update("quota", gorm.Expr("quota + ?", plan.QuotaPerPeriod)).Error; err != nil {
+				return err
+			}
+			if err = recordQuotaLedgerTx(tx, QuotaLedgerTypeSubscription, subscription.UserId, plan.QuotaPerPeriod, subscription.Reference); err != nil {
+				return err
+			}
+		}
+		subscription.Status = SubscriptionStatusActive
+		subscription.CurrentPeriodStart = periodStart
+		subscription.CurrentPeriodEnd = periodEnd
+		subscription.GrantedPeriodEnd = periodEnd
+		subscription.UpdatedTime = common.GetTimestamp()
+		granted = true
+		return tx.Save(&subscription).Error
+	})
+	if err != nil || !granted {
+		return err
+	}
+	if plan.QuotaPerPeriod > 0 {
+		_ = cacheIncrUserQuota(subscription.UserId, int64(plan.QuotaPerPeriod))
+	}
+	if newGroup != "" {
+		_ = updateUserGroupCache(subscription.UserId, newGroup)
+	}
+	RecordLog(subscription.UserId, LogTypeTopup, fmt.Sprintf("订阅套餐 %s 续期成功，发放额度: %s，周期至 %s%s",
+		plan.Name, logger.LogQuota(plan.QuotaPerPeriod), time.Unix(periodEnd, 0).Format("2006-01-02 15:04:05"), remark))
+	return nil
+}
+
+// ChangeSubscriptionPlan 在当前周期内立即切换套餐，并按剩余时间比例补发额度差
+func ChangeSubscriptionPlan(subscriptionId int, planId int, quotaDelta int) error {
+	var (
+		subscription Subscription
+		plan         SubscriptionPlan
+		newGroup     string
+		changed      bool
+	)
+	err := DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&subscription, subscriptionId).Error; err != nil {
+			return errors.New("订阅不存在")
+		}
+		if err := tx.First(&plan, planId).Error; err != nil {
+			return errors.New("套餐不存在")
+		}
+		// 以原套餐为条件先行切换，重复请求不会重复补发额度
+		result := tx.Model(&Subscription{}).Where("id = ? and plan_id <> ?", subscription.Id, planId).Update("plan_id", planId)
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return nil
+		}
+		var err error
+		if newGroup, err = switchSubscriptionGroupTx(tx, &subscription, &plan); err != nil {
+			return err
+		}
+		if quotaDelta > 0 {
+			if err = tx.Model(&User{}).Where("id = ?", subscription.UserId).Update("quota", gorm.Expr("quota + ?", quotaDelta)).Error; err != nil {
+				return err
+			}
+			if err = recordQuotaLedgerTx(tx, QuotaLedgerTypeSubscription, subscription.UserId, quotaDelta, subscription.Reference); err != nil {
+				return err
+			}
+		}
+		subscription.PlanId = planId
+		subscription.PendingPlanId = 0
+		subscription.UpdatedTime = common.GetTimestamp()
+		changed = true
+		return tx.Save(&subscription).Error
+	})
+	if err != nil || !changed {
+		return err
+	}
+	if quotaDelta > 0 {
+		_ = cacheIncrUserQuota(subscription.UserId, int64(quotaDelta))
+	}
+	if newGroup != "" {
+		_ = updateUserGroupCache(subscription.UserId, newGroup)
+	}
+	RecordLog(subscription.UserId, LogTypeTopup, fmt.Sprintf("订阅套餐变更为 %s，按比例补发额度: %s", plan.Name, logger.LogQuota(quotaDelta)))
+	return nil
+}
+
+// ExpireSubscription 结束订阅，用户仍在套餐分组时恢复为订阅前的分组
+func ExpireSubscription(subscriptionId int, reason string) error {
+	var (
+		subscription  Subscription
+		restoredGroup string
+	)
+	err := DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&subscription, subscriptionId).Error; err != nil {
+			return errors.New("订阅不存在")
+		}
+		if subscription.Status == SubscriptionStatusExpired {
+			return nil
+		}
+		var plan SubscriptionPlan
+		if err := tx.First(&plan, subscription.PlanId).Error; err == nil && plan.Group != "" && subscription.PreviousGroup != "" {
+			var user User
+			if err := tx.Select("id", "group").First(&user, subscription.UserId).Error; err != nil {
+				return err
+			}
+			if user.Group == plan.Group {
+				if err := tx.Model(&User{}).Where("id = ?", user.Id).Update("group", subscription.PreviousGroup).Error; err != nil {
+					return err
+				}
+				restoredGroup = subscription.PreviousGroup
+			}
+		}
+		subscription.Status = SubscriptionStatusExpired
+		subscription.UpdatedTime = common.GetTimestamp()
+		return tx.Save(&subscription).Error
+	})
+	if err != nil {
+		return err
+	}
+	if restoredGroup != "" {
+		_ = updateUserGroupCache(subscription.UserId, restoredGroup)
+	}
+	RecordLog(subscription.UserId, LogTypeSystem, fmt.Sprintf("订阅 %s 已结束：%s", subscription.Reference, reason))
+	return nil
+}
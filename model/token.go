@@ -35,6 +35,7 @@ type Token struct {
 	QuotaResetStartTime int64 `json:"quota_reset_start_time" gorm:"bigint;default:0"` // 重置周期开始时间
 	QuotaResetEndTime   int64 `json:"quota_reset_end_time" gorm:"bigint;default:0"`   // 重置周期结束时间
 	LastQuotaResetTime  int64 `json:"last_quota_reset_time" gorm:"bigint;default:0"`  // 上次重置时间
+	HedgeEnabled        bool  `json:"hedge_enabled" gorm:"default:false"`             // 是否启用对冲请求
 }
 
 func (token *Token) Clean() {
@@ -78,21 +79,30 @@ func SearchUserTokens(userId int, keyword string, token string) (tokens []*Token
 	return tokens, err
 }
 
+// 令牌校验失败的原因，调用方可通过 errors.Is 区分
+var (
+	ErrTokenNotProvided    = errors.New("未提供令牌")
+	ErrTokenInvalid        = errors.New("无效的令牌")
+	ErrTokenExpired        = errors.New("该令牌已过期")
+	ErrTokenUnavailable    = errors.New("该令牌状态不可用")
+	ErrTokenQuotaExhausted = errors.New("该令牌额度已用尽")
+)
+
 func ValidateUserToken(key string) (token *Token, err error) {
 	if key == "" {
-		return nil, errors.New("未提供令牌")
+		return nil, ErrTokenNotProvided
 	}
 	token, err = GetTokenByKey(key, false)
 	if err == nil {
 		if token.Status == common.TokenStatusExhausted {
 			keyPrefix := key[:3]
 			keySuffix := key[len(key)-3:]
-			return token, errors.New("该令牌额度已用尽 TokenStatusExhausted[sk-" + keyPrefix + "***" + keySuffix + "]")
+			return token, fmt.Errorf("%w TokenStatusExhausted[sk-%s***%s]", ErrTokenQuotaExhausted, keyPrefix, keySuffix)
 		} else if token.Status == common.TokenStatusExpired {
-			return token, errors.New("该令牌已过期")
+			return token, ErrTokenExpired
 		}
 		if token.Status != common.TokenStatusEnabled {
-			return token, errors.New("该令牌状态不可用")
+			return token, ErrTokenUnavailable
 		}
 		if token.ExpiredTime != -1 && token.ExpiredTime < common.GetTimestamp() {
 			if !common.RedisEnabled {
@@ -102,7 +112,7 @@ func ValidateUserToken(key string) (token *Token, err error) {
 					common.SysLog("failed to update token status" + err.Error())
 				}
 			}
-			return token, errors.New("该令牌已过期")
+			return token, ErrTokenExpired
 		}
 		if !token.UnlimitedQuota && token.RemainQuota <= 0 {
 			if !common.RedisEnabled {
@@ -115,11 +125,11 @@ func ValidateUserToken(key string) (token *Token, err error) {
 			}
 			keyPrefix := key[:3]
 			keySuffix := key[len(key)-3:]
-			return token, errors.New(fmt.Sprintf("[sk-%s***%s] 该令牌额度已用尽 !token.UnlimitedQuota && token.RemainQuota = %d", keyPrefix, keySuffix, token.RemainQuota))
+			return token, fmt.Errorf("[sk-%s***%s] %w !token.UnlimitedQuota && token.RemainQuota = %d", keyPrefix, keySuffix, ErrTokenQuotaExhausted, token.RemainQuota)
 		}
 		return token, nil
 	}
-	return nil, errors.New("无效的令牌")
+	return nil, ErrTokenInvalid
 }
 
 func GetTokenByIds(id int, userId int) (*Token, error) {
@@ -179,6 +189,33 @@ func (token *Token) Insert() error {
 	return err
 }
 
+// EnsureUserGroupToken 用户没有指定分组的令牌时创建一个不限额度、永不过期的令牌，返回是否新建
+func EnsureUserGroupToken(userId int, group string, name string) (bool, error) {
+	var count int64
+	if err := DB.Model(&Token{}).Where("user_id = ? and "+commonGroupCol+" = ?", userId, group).Count(&count).Error; err != nil {
+		return false, err
+	}
+	if count > 0 {
+		return false, nil
+	}
+	key, err := common.GenerateKey()
+	if err != nil {
+		return false, err
+	}
+	now := common.GetTimestamp()
+	token := &Token{
+		UserId:         userId,
+		Name:           name,
+		Key:            key,
+		CreatedTime:    now,
+		AccessedTime:   now,
+		ExpiredTime:    -1,
+		UnlimitedQuota: true,
+		Group:          group,
+	}
+	return true, token.Insert()
+}
+
 // Update Make sure your token's fields is completed, because this will update non-zero values
 func (token *Token) Update() (err error) {
 	defer func() {
@@ -193,7 +230,7 @@ func (token *Token) Update() (err error) {
 	}()
 	err = DB.Model(token).Select("name", "status", "expired_time", "remain_quota", "unlimited_quota",
 		"model_limits_enabled", "model_limits", "allow_ips", "group",
-		"quota_reset_enabled", "quota_reset_amount", "quota_reset_start_time", "quota_reset_end_time").Updates(token).Error
+		"quota_reset_enabled", "quota_reset_amount", "quota_reset_start_time", "quota_reset_end_time", "hedge_enabled").Updates(token).Error
 	return err
 }
 
@@ -286,11 +323,11 @@ func IncreaseTokenQuota(id int, key string, quota int) (err error) {
 		addNewRecord(BatchUpdateTypeTokenQuota, id, quota)
 		return nil
 	}
-	return increaseTokenQuota(id, quota)
+	return increaseTokenQuota(DB, id, quota)
 }
 
-func increaseTokenQuota(id int, quota int) (err error) {
-	err = DB.Model(&Token{}).Where("id = ?", id).Updates(
+func increaseTokenQuota(tx *gorm.DB, id int, quota int) (err error) {
+	err = tx.Model(&Token{}).Where("id = ?", id).Updates(
 		map[string]interface{}{
 			"remain_quota":  gorm.Expr("remain_quota + ?", quota),
 			"used_quota":    gorm.Expr("used_quota - ?", quota),
@@ -330,6 +367,14 @@ func decreaseTokenQuota(id int, quota int) (err error) {
 	return err
 }
 
+// GetUserTokensExpiringBefore 返回用户在指定时间段内过期的已启用令牌
+func GetUserTokensExpiringBefore(userId int, after int64, before int64) ([]*Token, error) {
+	var tokens []*Token
+	err := DB.Where("user_id = ? and status = ? and expired_time > ? and expired_time <= ?", userId, common.TokenStatusEnabled, after, before).
+		Find(&tokens).Error
+	return tokens, err
+}
+
 // CountUserTokens returns total number of tokens for the given user, used for pagination
 func CountUserTokens(userId int) (int64, error) {
 	var total int64
@@ -337,6 +382,28 @@ func CountUserTokens(userId int) (int64, error) {
 	return total, err
 }
 
+// RevokeUserTokens 删除用户的全部令牌并清除缓存，返回删除数量
+func RevokeUserTokens(userId int) (int, error) {
+	var tokens []Token
+	if err := DB.Where("user_id = ?", userId).Find(&tokens).Error; err != nil {
+		return 0, err
+	}
+	if len(tokens) == 0 {
+		return 0, nil
+	}
+	if err := DB.Where("user_id = ?", userId).Delete(&Token{}).Error; err != nil {
+		return 0, err
+	}
+	if common.RedisEnabled {
+		gopool.Go(func() {
+			for _, t := range tokens {
+				_ = cacheDeleteToken(t.Key)
+			}
+		})
+	}
+	return len(tokens), nil
+}
+
 // BatchDeleteTokens 删除指定用户的一组令牌，返回成功删除数量
 func BatchDeleteTokens(ids []int, userId int) (int, error) {
 	if len(ids) == 0 {
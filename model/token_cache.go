@@ -24,6 +24,7 @@ func cacheDeleteToken(key string) error {
 	if err != nil {
 		return err
 	}
+	redeleteCacheKey(fmt.Sprintf("token:%s", key))
 	return nil
 }
 
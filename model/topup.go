@@ -3,12 +3,14 @@ package model
 import (
 	"errors"
 	"fmt"
+	"math"
 
 	"github.com/QuantumNous/new-api/common"
 	"github.com/QuantumNous/new-api/logger"
 
 	"github.com/shopspring/decimal"
 	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 )
 
 type TopUp struct {
@@ -21,8 +23,17 @@ type TopUp struct {
 	CreateTime    int64   `json:"create_time"`
 	CompleteTime  int64   `json:"complete_time"`
 	Status        string  `json:"status"`
+	// 支付平台侧的订单号（Stripe Checkout Session、Creem Checkout），用于主动查询订单
+	ProviderOrderId string `json:"provider_order_id" gorm:"type:varchar(128)"`
+	// 支付平台侧的付款号（Stripe PaymentIntent、Creem Order、易支付订单号），用于退款
+	ProviderPaymentId string  `json:"provider_payment_id" gorm:"type:varchar(128);index"`
+	RefundedMoney     float64 `json:"refunded_money" gorm:"default:0"`
+	RefundedQuota     int     `json:"refunded_quota" gorm:"default:0"`
+	RefundTime        int64   `json:"refund_time" gorm:"bigint;default:0"`
 }
 
+var ErrTopUpNotFound = errors.New("充值订单不存在")
+
 func (topUp *TopUp) Insert() error {
 	var err error
 	err = DB.Create(topUp).Error
@@ -55,54 +66,6 @@ func GetTopUpByTradeNo(tradeNo string) *TopUp {
 	return topUp
 }
 
-func Recharge(referenceId string, customerId string) (err error) {
-	if referenceId == "" {
-		return errors.New("未提供支付单号")
-	}
-
-	var quota float64
-	topUp := &TopUp{}
-
-	refCol := "`trade_no`"
-	if common.UsingPostgreSQL {
-		refCol = `"trade_no"`
-	}
-
-	err = DB.Transaction(func(tx *gorm.DB) error {
-		err := tx.Set("gorm:query_option", "FOR UPDATE").Where(refCol+" = ?", referenceId).First(topUp).Error
-		if err != nil {
-			return errors.New("充值订单不存在")
-		}
-
-		if topUp.Status != common.TopUpStatusPending {
-			return errors.New("充值订单状态错误")
-		}
-
-		topUp.CompleteTime = common.GetTimestamp()
-		topUp.Status = common.TopUpStatusSuccess
-		err = tx.Save(topUp).Error
-		if err != nil {
-			return err
-		}
-
-		quota = topUp.Money * common.QuotaPerUnit
-		err = tx.Model(&User{}).Where("id = ?", topUp.UserId).Updates(map[string]interface{}{"stripe_customer": customerId, "quota": gorm.Expr("quota + ?", quota)}).Error
-		if err != nil {
-			return err
-		}
-
-		return nil
-	})
-
-	if err != nil {
-		return errors.New("充值失败，" + err.Error())
-	}
-
-	RecordLog(topUp.UserId, LogTypeTopup, fmt.Sprintf("使用在线充值成功，充值金额: %v，支付金额：%d", logger.FormatQuota(int(quota)), topUp.Amount))
-
-	return nil
-}
-
 func GetUserTopUps(userId int, pageInfo *common.PageInfo) (topups []*TopUp, total int64, err error) {
 	// Start transaction
 	tx := DB.Begin()
@@ -234,143 +197,239 @@ func SearchAllTopUps(keyword string, pageInfo *common.PageInfo) (topups []*TopUp
 	return topups, total, nil
 }
 
-// ManualCompleteTopUp 管理员手动完成订单并给用户充值
-func ManualCompleteTopUp(tradeNo string) error {
+func GetTopUpByProviderPaymentId(providerPaymentId string) *TopUp {
+	if providerPaymentId == "" {
+		return nil
+	}
+	var topUp *TopUp
+	if err := DB.Where("provider_payment_id = ?", providerPaymentId).First(&topUp).Error; err != nil {
+		return nil
+	}
+	return topUp
+}
+
+// GetPendingTopUps 返回创建时间在 [after, before) 之间仍待支付的订单，供对账任务主动查询
+func GetPendingTopUps(after int64, before int64, limit int) (topUps []*TopUp, err error) {
+	err = DB.Where("status = ? and create_time >= ? and create_time < ?", common.TopUpStatusPending, after, before).
+		Order("id asc").Limit(limit).Find(&topUps).Error
+	return topUps, err
+}
+
+// ExpireTopUps 将创建时间早于 before 仍待支付的订单标记为过期
+func ExpireTopUps(before int64) (int64, error) {
+	result := DB.Model(&TopUp{}).Where("status = ? and create_time < ?", common.TopUpStatusPending, before).
+		Update("status", common.TopUpStatusExpired)
+	return result.RowsAffected, result.Error
+}
+
+func ExpireTopUp(tradeNo string) error {
+	return DB.Model(&TopUp{}).Where("trade_no = ? and status = ?", tradeNo, common.TopUpStatusPending).
+		Update("status", common.TopUpStatusExpired).Error
+}
+
+// topUpQuota 计算订单对应的充值额度：
+// - Stripe 订单：Money 代表经分组倍率换算后的美元数量，* QuotaPerUnit
+// - Creem 订单：Amount 即为产品配置的充值额度
+// - 其他订单（如易支付）：Amount 为美元数量，* QuotaPerUnit
+func topUpQuota(topUp *TopUp) int {
+	dQuotaPerUnit := decimal.NewFromFloat(common.QuotaPerUnit)
+	switch topUp.PaymentMethod {
+	case "stripe":
+		return int(decimal.NewFromFloat(topUp.Money).Mul(dQuotaPerUnit).IntPart())
+	case "creem", "":
+		return int(topUp.Amount)
+	default:
+		return int(decimal.NewFromInt(topUp.Amount).Mul(dQuotaPerUnit).IntPart())
+	}
+}
+
+// TopUpCompletion 支付完成时由支付平台回传的附加信息
+type TopUpCompletion struct {
+	ProviderPaymentId string
+	StripeCustomer    string
+	// 用户未设置邮箱时使用支付时填写的邮箱
+	CustomerEmail string
+	// 触发完成的支付回调事件，与订单在同一事务中登记，重复投递时不再处理
+	WebhookEvent *PaymentWebhookEvent
+}
+
+// CompleteTopUp 完成充值订单并给用户充值。已完成的订单直接返回，已过期的订单仍可完成（用户在过期后付款）
+func CompleteTopUp(tradeNo string, completion *TopUpCompletion, source string) error {
 	if tradeNo == "" {
 		return errors.New("未提供订单号")
 	}
+	if completion == nil {
+		completion = &TopUpCompletion{}
+	}
 
 	refCol := "`trade_no`"
 	if common.UsingPostgreSQL {
 		refCol = `"trade_no"`
 	}
 
-	var userId int
-	var quotaToAdd int
-	var payMoney float64
-
+	var (
+		topUp      = &TopUp{}
+		quotaToAdd int
+		completed  bool
+	)
 	err := DB.Transaction(func(tx *gorm.DB) error {
-		topUp := &TopUp{}
 		// 行级锁，避免并发补单
-		if err := tx.Set("gorm:query_option", "FOR UPDATE").Where(refCol+" = ?", tradeNo).First(topUp).Error; err != nil {
-			return errors.New("充值订单不存在")
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Where(refCol+" = ?", tradeNo).First(topUp).Error; err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return ErrTopUpNotFound
+			}
+			return err
 		}
-
-		// 幂等处理：已成功直接返回
-		if topUp.Status == common.TopUpStatusSuccess {
-			return nil
+		if claimed, err := claimPaymentWebhookEventTx(tx, completion.WebhookEvent); err != nil || !claimed {
+			return err
 		}
-
-		if topUp.Status != common.TopUpStatusPending {
-			return errors.New("订单状态不是待支付，无法补单")
+		if topUp.Status == common.TopUpStatusSuccess || topUp.Status == common.TopUpStatusRefunded {
+			return nil
 		}
-
-		// 计算应充值额度：
-		// - Stripe 订单：Money 代表经分组倍率换算后的美元数量，直接 * QuotaPerUnit
-		// - 其他订单（如易支付）：Amount 为美元数量，* QuotaPerUnit
-		if topUp.PaymentMethod == "stripe" {
-			dQuotaPerUnit := decimal.NewFromFloat(common.QuotaPerUnit)
-			quotaToAdd = int(decimal.NewFromFloat(topUp.Money).Mul(dQuotaPerUnit).IntPart())
-		} else {
-			dAmount := decimal.NewFromInt(topUp.Amount)
-			dQuotaPerUnit := decimal.NewFromFloat(common.QuotaPerUnit)
-			quotaToAdd = int(dAmount.Mul(dQuotaPerUnit).IntPart())
+		if topUp.Status != common.TopUpStatusPending && topUp.Status != common.TopUpStatusExpired {
+			return errors.New("充值订单状态错误")
 		}
+		quotaToAdd = topUpQuota(topUp)
 		if quotaToAdd <= 0 {
 			return errors.New("无效的充值额度")
 		}
 
-		// 标记完成
 		topUp.CompleteTime = common.GetTimestamp()
 		topUp.Status = common.TopUpStatusSuccess
-		if err := tx.Save(topUp).Error; err != nil {
-			return err
+		if completion.ProviderPaymentId != "" {
+			topUp.ProviderPaymentId = completion.ProviderPaymentId
+		}
+		// 按原状态条件更新，即使数据库不支持行级锁，并发完成同一订单时也只有一方充值
+		result := tx.Model(&TopUp{}).
+			Where("id = ? and status in ?", topUp.Id, []string{common.TopUpStatusPending, common.TopUpStatusExpired}).
+			Updates(map[string]interface{}{
+				"complete_time":       topUp.CompleteTime,
+				"status":              topUp.Status,
+				"provider_payment_id": topUp.ProviderPaymentId,
+			})
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return nil
 		}
 
-		// 增加用户额度（立即写库，保持一致性）
-		if err := tx.Model(&User{}).Where("id = ?", topUp.UserId).Update("quota", gorm.Expr("quota + ?", quotaToAdd)).Error; err != nil {
+		updateFields := map[string]interface{}{
+			"quota": gorm.Expr("quota + ?", quotaToAdd),
+		}
+		if completion.StripeCustomer != "" {
+			updateFields["stripe_customer"] = completion.StripeCustomer
+		}
+		if completion.CustomerEmail != "" {
+			var user User
+			if err := tx.Select("id", "email").Where("id = ?", topUp.UserId).First(&user).Error; err != nil {
+				return err
+			}
+			if user.Email == "" {
+				updateFields["email"] = completion.CustomerEmail
+			}
+		}
+		if err := tx.Model(&User{}).Where("id = ?", topUp.UserId).Updates(updateFields).Error; err != nil {
 			return err
 		}
-
-		userId = topUp.UserId
-		payMoney = topUp.Money
-		return nil
+		completed = true
+		return recordQuotaLedgerTx(tx, QuotaLedgerTypeTopUp, topUp.UserId, quotaToAdd, topUp.TradeNo)
 	})
-
-	if err != nil {
+	if err != nil || !completed {
 		return err
 	}
 
-	// 事务外记录日志，避免阻塞
-	RecordLog(userId, LogTypeTopup, fmt.Sprintf("管理员补单成功，充值金额: %v，支付金额：%f", logger.FormatQuota(quotaToAdd), payMoney))
+	_ = cacheIncrUserQuota(topUp.UserId, int64(quotaToAdd))
+	RecordLog(topUp.UserId, LogTypeTopup, fmt.Sprintf("%s成功，充值金额: %v，支付金额：%.2f", source, logger.FormatQuota(quotaToAdd), topUp.Money))
+	if _, err := EnqueueWebhookEvent(topUp.UserId, WebhookEventTopUpCompleted+":"+topUp.TradeNo, WebhookEventTopUpCompleted, map[string]any{
+		"trade_no":       topUp.TradeNo,
+		"payment_method": topUp.PaymentMethod,
+		"amount":         topUp.Amount,
+		"money":          topUp.Money,
+		"quota":          quotaToAdd,
+		"complete_time":  topUp.CompleteTime,
+	}); err != nil {
+		common.SysError("failed to enqueue top-up webhook event: " + err.Error())
+	}
 	return nil
 }
-func RechargeCreem(referenceId string, customerEmail string, customerName string) (err error) {
-	if referenceId == "" {
-		return errors.New("未提供支付单号")
-	}
-
-	var quota int64
-	topUp := &TopUp{}
 
-	refCol := "`trade_no`"
-	if common.UsingPostgreSQL {
-		refCol = `"trade_no"`
-	}
-
-	err = DB.Transaction(func(tx *gorm.DB) error {
-		err := tx.Set("gorm:query_option", "FOR UPDATE").Where(refCol+" = ?", referenceId).First(topUp).Error
-		if err != nil {
-			return errors.New("充值订单不存在")
-		}
+// ManualCompleteTopUp 管理员手动完成订单并给用户充值
+func ManualCompleteTopUp(tradeNo string) error {
+	return CompleteTopUp(tradeNo, nil, "管理员补单")
+}
 
-		if topUp.Status != common.TopUpStatusPending {
-			return errors.New("充值订单状态错误")
+// RefundTopUp 记录充值订单退款，并按退款金额占订单金额的比例从用户余额扣回额度。
+// cumulative 为 true 时 money 为该订单累计退款金额（如 Stripe charge.refunded），否则为本次退款金额；
+// 以累计退款金额保证同一笔退款重复通知时不会重复扣回。event 为触发退款的支付回调事件，与退款在同一事务中登记
+func RefundTopUp(tradeNo string, money float64, cumulative bool, reason string, event *PaymentWebhookEvent) (int, error) {
+	var (
+		topUp         = &TopUp{}
+		quotaToDeduct int
+	)
+	err := DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Where("trade_no = ?", tradeNo).First(topUp).Error; err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return ErrTopUpNotFound
+			}
+			return err
 		}
-
-		topUp.CompleteTime = common.GetTimestamp()
-		topUp.Status = common.TopUpStatusSuccess
-		err = tx.Save(topUp).Error
-		if err != nil {
+		if claimed, err := claimPaymentWebhookEventTx(tx, event); err != nil || !claimed {
 			return err
 		}
-
-		// Creem 直接使用 Amount 作为充值额度（整数）
-		quota = topUp.Amount
-
-		// 构建更新字段，优先使用邮箱，如果邮箱为空则使用用户名
-		updateFields := map[string]interface{}{
-			"quota": gorm.Expr("quota + ?", quota),
+		if topUp.Status != common.TopUpStatusSuccess && topUp.Status != common.TopUpStatusRefunded {
+			return errors.New("只能对已完成的充值订单退款")
 		}
-
-		// 如果有客户邮箱，尝试更新用户邮箱（仅当用户邮箱为空时）
-		if customerEmail != "" {
-			// 先检查用户当前邮箱是否为空
-			var user User
-			err = tx.Where("id = ?", topUp.UserId).First(&user).Error
-			if err != nil {
-				return err
-			}
-
-			// 如果用户邮箱为空，则更新为支付时使用的邮箱
-			if user.Email == "" {
-				updateFields["email"] = customerEmail
-			}
+		target := money
+		if !cumulative {
+			target = topUp.RefundedMoney + money
+		}
+		target = math.Min(target, topUp.Money)
+		// 按比例换算的金额可能有不足一分的误差，视为已处理
+		if target-topUp.RefundedMoney < 0.005 {
+			return nil
 		}
 
-		err = tx.Model(&User{}).Where("id = ?", topUp.UserId).Updates(updateFields).Error
-		if err != nil {
+		totalQuota := topUpQuota(topUp)
+		refundedQuota := totalQuota
+		if topUp.Money > 0 && target < topUp.Money {
+			refundedQuota = int(decimal.NewFromInt(int64(totalQuota)).Mul(decimal.NewFromFloat(target / topUp.Money)).IntPart())
+		}
+		previousRefundedQuota := topUp.RefundedQuota
+		deduct := refundedQuota - previousRefundedQuota
+
+		topUp.RefundedMoney = target
+		topUp.RefundedQuota = refundedQuota
+		topUp.RefundTime = common.GetTimestamp()
+		if target >= topUp.Money {
+			topUp.Status = common.TopUpStatusRefunded
+		}
+		// 以读取时的已退额度为条件更新，并发处理同一退款时只有一方扣回
+		result := tx.Model(&TopUp{}).
+			Where("id = ? and refunded_quota = ?", topUp.Id, previousRefundedQuota).
+			Updates(map[string]interface{}{
+				"refunded_money": topUp.RefundedMoney,
+				"refunded_quota": topUp.RefundedQuota,
+				"refund_time":    topUp.RefundTime,
+				"status":         topUp.Status,
+			})
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 || deduct <= 0 {
+			return nil
+		}
+		quotaToDeduct = deduct
+		// 用户已消费的部分同样扣回，余额可能变为负数
+		if err := tx.Model(&User{}).Where("id = ?", topUp.UserId).Update("quota", gorm.Expr("quota - ?", quotaToDeduct)).Error; err != nil {
 			return err
 		}
-
-		return nil
+		return recordQuotaLedgerTx(tx, QuotaLedgerTypeTopUpRefund, topUp.UserId, -quotaToDeduct, topUp.TradeNo)
 	})
-
-	if err != nil {
-		return errors.New("充值失败，" + err.Error())
+	if err != nil || quotaToDeduct <= 0 {
+		return 0, err
 	}
-
-	RecordLog(topUp.UserId, LogTypeTopup, fmt.Sprintf("使用Creem充值成功，充值额度: %v，支付金额：%.2f", quota, topUp.Money))
-
-	return nil
+	_ = cacheDecrUserQuota(topUp.UserId, int64(quotaToDeduct))
+	RecordLog(topUp.UserId, LogTypeTopup, fmt.Sprintf("充值订单 %s 退款 %.2f，扣回额度: %v，原因：%s", topUp.TradeNo, topUp.RefundedMoney, logger.FormatQuota(quotaToDeduct), reason))
+	return quotaToDeduct, nil
 }
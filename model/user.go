@@ -46,6 +46,9 @@ type User struct {
 	Setting          string         `json:"setting" gorm:"type:text;column:setting"`
 	Remark           string         `json:"remark,omitempty" gorm:"type:varchar(255)" validate:"max=255"`
 	StripeCustomer   string         `json:"stripe_customer" gorm:"type:varchar(64);column:stripe_customer;index"`
+	LdapId           string         `json:"ldap_id" gorm:"column:ldap_id;index"`
+	// 由 SCIM 创建或接管的用户的外部 ID，非空表示用户生命周期由身份提供方管理
+	ScimExternalId string `json:"scim_external_id" gorm:"column:scim_external_id;index"`
 }
 
 func (user *User) ToBaseUser() *UserBase {
@@ -367,6 +370,9 @@ func (user *User) TransferAffQuotaToQuota(quota int) error {
 	if err := tx.Save(user).Error; err != nil {
 		return err
 	}
+	if err := recordQuotaLedgerTx(tx, QuotaLedgerTypeReward, user.Id, quota, "邀请额度划转"); err != nil {
+		return err
+	}
 
 	// 提交事务
 	return tx.Commit().Error
@@ -391,9 +397,15 @@ func (user *User) Insert(inviterId int) error {
 		user.SetSetting(defaultSetting)
 	}
 
-	result := DB.Create(user)
-	if result.Error != nil {
-		return result.Error
+	// 注册赠送的额度随用户一起写入，流水在同一事务中记录
+	err = DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(user).Error; err != nil {
+			return err
+		}
+		return recordQuotaLedgerTx(tx, QuotaLedgerTypeReward, user.Id, user.Quota, "新用户注册赠送")
+	})
+	if err != nil {
+		return err
 	}
 
 	// 用户创建成功后，根据角色初始化边栏配置
@@ -416,7 +428,7 @@ func (user *User) Insert(inviterId int) error {
 	}
 	if inviterId != 0 {
 		if common.QuotaForInvitee > 0 {
-			_ = IncreaseUserQuota(user.Id, common.QuotaForInvitee, true)
+			_ = IncreaseUserQuotaWithLedger(user.Id, common.QuotaForInvitee, true, QuotaLedgerTypeReward, 0, "使用邀请码赠送")
 			RecordLog(user.Id, LogTypeSystem, fmt.Sprintf("使用邀请码赠送 %s", logger.LogQuota(common.QuotaForInvitee)))
 		}
 		if common.QuotaForInviter > 0 {
@@ -446,7 +458,8 @@ func (user *User) Update(updatePassword bool) error {
 	return updateUserCache(*user)
 }
 
-func (user *User) Edit(updatePassword bool) error {
+// Edit 更新用户信息，额度变化作为管理员调整记录到额度流水，quotaRemark 为流水备注
+func (user *User) Edit(updatePassword bool, quotaRemark string) error {
 	var err error
 	if updatePassword {
 		user.Password, err = common.Password2Hash(user.Password)
@@ -467,8 +480,17 @@ func (user *User) Edit(updatePassword bool) error {
 		updates["password"] = newUser.Password
 	}
 
-	DB.First(&user, user.Id)
-	if err = DB.Model(user).Updates(updates).Error; err != nil {
+	err = DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Set("gorm:query_option", "FOR UPDATE").First(&user, user.Id).Error; err != nil {
+			return err
+		}
+		originQuota := user.Quota
+		if err := tx.Model(user).Updates(updates).Error; err != nil {
+			return err
+		}
+		return recordQuotaLedgerTx(tx, QuotaLedgerTypeAdminAdjust, user.Id, newUser.Quota-originQuota, quotaRemark)
+	})
+	if err != nil {
 		return err
 	}
 
@@ -547,6 +569,63 @@ func (user *User) FillUserByOidcId() error {
 	return nil
 }
 
+// SyncGroupAndRole 按外部身份源同步用户分组与角色，group 为空或 role 为 0 时保持不变，超级管理员的角色不会被修改。
+// 用户的生效订阅切换了分组时，只更新订阅到期后恢复的分组
+func (user *User) SyncGroupAndRole(group string, role int) error {
+	updates := map[string]interface{}{}
+	err := DB.Transaction(func(tx *gorm.DB) error {
+		if group != "" && group != user.Group {
+			result := tx.Model(&Subscription{}).
+				Where("user_id = ? and status in ? and previous_group <> ''", user.Id, []string{SubscriptionStatusActive, SubscriptionStatusPastDue}).
+				Update("previous_group", group)
+			if result.Error != nil {
+				return result.Error
+			}
+			if result.RowsAffected == 0 {
+				updates["group"] = group
+			}
+		}
+		if role != 0 && role != user.Role && user.Role != common.RoleRootUser {
+			updates["role"] = role
+		}
+		if len(updates) == 0 {
+			return nil
+		}
+		return tx.Model(&User{}).Where("id = ?", user.Id).Updates(updates).Error
+	})
+	if err != nil || len(updates) == 0 {
+		return err
+	}
+	if group, ok := updates["group"]; ok {
+		user.Group = group.(string)
+	}
+	if role, ok := updates["role"]; ok {
+		user.Role = role.(int)
+	}
+	return invalidateUserCache(user.Id)
+}
+
+func (user *User) FillUserByLdapId() error {
+	if user.LdapId == "" {
+		return errors.New("ldap id 为空！")
+	}
+	DB.Where(User{LdapId: user.LdapId}).First(user)
+	return nil
+}
+
+// GetScimUserForLink 返回可以与外部登录方式关联的 SCIM 用户，field 为 username 或 email
+func GetScimUserForLink(field string, value string) (*User, error) {
+	if value == "" || (field != "username" && field != "email") {
+		return nil, errors.New("invalid field")
+	}
+	var user User
+	err := DB.Where(field+" = ? and scim_external_id <> ''", value).First(&user).Error
+	if err != nil {
+		return nil, err
+	}
+	return &user, nil
+}
+
 func (user *User) FillUserByWeChatId() error {
 	if user.WeChatId == "" {
 		return errors.New("WeChat id 为空！")
@@ -582,6 +661,10 @@ func IsOidcIdAlreadyTaken(oidcId string) bool {
 	return DB.Where("oidc_id = ?", oidcId).Find(&User{}).RowsAffected == 1
 }
 
+func IsLdapIdAlreadyTaken(ldapId string) bool {
+	return DB.Where("ldap_id = ?", ldapId).Find(&User{}).RowsAffected == 1
+}
+
 func IsTelegramIdAlreadyTaken(telegramId string) bool {
 	return DB.Unscoped().Where("telegram_id = ?", telegramId).Find(&User{}).RowsAffected == 1
 }
@@ -764,11 +847,11 @@ func IncreaseUserQuota(id int, quota int, db bool) (err error) {
 		addNewRecord(BatchUpdateTypeUserQuota, id, quota)
 		return nil
 	}
-	return increaseUserQuota(id, quota)
+	return increaseUserQuota(DB, id, quota)
 }
 
-func increaseUserQuota(id int, quota int) (err error) {
-	err = DB.Model(&User{}).Where("id = ?", id).Update("quota", gorm.Expr("quota + ?", quota)).Error
+func increaseUserQuota(tx *gorm.DB, id int, quota int) (err error) {
+	err = tx.Model(&User{}).Where("id = ?", id).Update("quota", gorm.Expr("quota + ?", quota)).Error
 	if err != nil {
 		return err
 	}
@@ -848,22 +931,16 @@ func updateUserUsedQuotaAndRequestCount(id int, quota int, count int) {
 	//}
 }
 
-func updateUserUsedQuota(id int, quota int) {
-	err := DB.Model(&User{}).Where("id = ?", id).Updates(
+func updateUserUsedQuota(tx *gorm.DB, id int, quota int) error {
+	return tx.Model(&User{}).Where("id = ?", id).Updates(
 		map[string]interface{}{
 			"used_quota": gorm.Expr("used_quota + ?", quota),
 		},
 	).Error
-	if err != nil {
-		common.SysLog("failed to update user used quota: " + err.Error())
-	}
 }
 
-func updateUserRequestCount(id int, count int) {
-	err := DB.Model(&User{}).Where("id = ?", id).Update("request_count", gorm.Expr("request_count + ?", count)).Error
-	if err != nil {
-		common.SysLog("failed to update user request count: " + err.Error())
-	}
+func updateUserRequestCount(tx *gorm.DB, id int, count int) error {
+	return tx.Model(&User{}).Where("id = ?", id).Update("request_count", gorm.Expr("request_count + ?", count)).Error
 }
 
 // GetUsernameById gets username from Redis first, falls back to DB if needed
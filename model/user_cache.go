@@ -54,7 +54,11 @@ func invalidateUserCache(userId int) error {
 	if !common.RedisEnabled {
 		return nil
 	}
-	return common.RedisDelKey(getUserCacheKey(userId))
+	if err := common.RedisDelKey(getUserCacheKey(userId)); err != nil {
+		return err
+	}
+	redeleteCacheKey(getUserCacheKey(userId))
+	return nil
 }
 
 // updateUserCache updates all user cache fields using hash
@@ -2,6 +2,9 @@ package model
 
 import (
 	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
 	"sync"
 	"time"
 
@@ -23,6 +26,13 @@ const (
 var batchUpdateStores []map[int]int
 var batchUpdateLocks []sync.Mutex
 
+// 额度流水与增量一起批量落库
+var batchUpdateLedgers []QuotaLedger
+var batchUpdateLedgerLock sync.Mutex
+
+// batchUpdateWalLock 保证写入预写日志与更新内存中的增量是原子的，轮转日志时内存增量与日志分段一一对应
+var batchUpdateWalLock sync.Mutex
+
 func init() {
 	for i := 0; i < BatchUpdateTypeCount; i++ {
 		batchUpdateStores = append(batchUpdateStores, make(map[int]int))
@@ -31,15 +41,52 @@ func init() {
 }
 
 func InitBatchUpdater() {
+	// 上次进程退出时未落库的日志作为一个分段重放
+	batchUpdateWalLock.Lock()
+	if info, err := os.Stat(common.BatchUpdateWalPath); err == nil && info.Size() > 0 {
+		segment := fmt.Sprintf("%s.%d", common.BatchUpdateWalPath, time.Now().UnixNano())
+		if err := os.Rename(common.BatchUpdateWalPath, segment); err != nil {
+			common.SysLog("failed to rotate batch update wal: " + err.Error())
+		}
+	}
+	if err := openBatchUpdateWal(); err != nil {
+		common.SysLog("failed to open batch update wal, batch updates are not crash-safe: " + err.Error())
+	}
+	batchUpdateWalLock.Unlock()
+	replayBatchUpdateWalSegments()
+
 	gopool.Go(func() {
+		lastCleanup := time.Now()
 		for {
 			time.Sleep(time.Duration(common.BatchUpdateInterval) * time.Second)
 			batchUpdate()
+			if time.Since(lastCleanup) > time.Hour {
+				cleanupBatchUpdateCheckpoints()
+				lastCleanup = time.Now()
+			}
 		}
 	})
 }
 
 func addNewRecord(type_ int, id int, value int) {
+	batchUpdateWalLock.Lock()
+	defer batchUpdateWalLock.Unlock()
+	addNewRecordLocked(type_, id, value)
+}
+
+// addNewRecordWithLedgers 增量与对应的流水在同一次加锁中写入，保证落在同一预写日志分段
+func addNewRecordWithLedgers(type_ int, id int, value int, ledgers []QuotaLedger) {
+	batchUpdateWalLock.Lock()
+	defer batchUpdateWalLock.Unlock()
+	addNewRecordLocked(type_, id, value)
+	appendBatchUpdateWal(batchUpdateWalRecord{Ledgers: ledgers})
+	batchUpdateLedgerLock.Lock()
+	defer batchUpdateLedgerLock.Unlock()
+	batchUpdateLedgers = append(batchUpdateLedgers, ledgers...)
+}
+
+func addNewRecordLocked(type_ int, id int, value int) {
+	appendBatchUpdateWal(batchUpdateWalRecord{Type: type_, Id: id, Value: value})
 	batchUpdateLocks[type_].Lock()
 	defer batchUpdateLocks[type_].Unlock()
 	if _, ok := batchUpdateStores[type_][id]; !ok {
@@ -50,6 +97,9 @@ func addNewRecord(type_ int, id int, value int) {
 }
 
 func batchUpdate() {
+	// 先重放之前落库失败的分段，保证按顺序应用
+	replayBatchUpdateWalSegments()
+
 	// check if there's any data to update
 	hasData := false
 	for i := 0; i < BatchUpdateTypeCount; i++ {
@@ -61,40 +111,106 @@ func batchUpdate() {
 		}
 		batchUpdateLocks[i].Unlock()
 	}
+	batchUpdateLedgerLock.Lock()
+	if len(batchUpdateLedgers) > 0 {
+		hasData = true
+	}
+	batchUpdateLedgerLock.Unlock()
 
 	if !hasData {
 		return
 	}
 
 	common.SysLog("batch update started")
+	batchUpdateWalLock.Lock()
+	segment := rotateBatchUpdateWal()
+	stores := make([]map[int]int, BatchUpdateTypeCount)
 	for i := 0; i < BatchUpdateTypeCount; i++ {
 		batchUpdateLocks[i].Lock()
-		store := batchUpdateStores[i]
+		stores[i] = batchUpdateStores[i]
 		batchUpdateStores[i] = make(map[int]int)
 		batchUpdateLocks[i].Unlock()
-		// TODO: maybe we can combine updates with same key?
-		for key, value := range store {
-			switch i {
-			case BatchUpdateTypeUserQuota:
-				err := increaseUserQuota(key, value)
-				if err != nil {
-					common.SysLog("failed to batch update user quota: " + err.Error())
+	}
+	batchUpdateLedgerLock.Lock()
+	ledgers := batchUpdateLedgers
+	batchUpdateLedgers = nil
+	batchUpdateLedgerLock.Unlock()
+	batchUpdateWalLock.Unlock()
+
+	if err := applyBatchUpdates(segment, stores, ledgers); err != nil {
+		// 分段文件保留，下一轮重放
+		common.SysLog("failed to batch update: " + err.Error())
+		return
+	}
+	if segment != "" {
+		_ = os.Remove(segment)
+	}
+	common.SysLog("batch update finished")
+}
+
+// applyBatchUpdates 在同一事务中应用增量、写入流水并记录分段检查点
+func applyBatchUpdates(segment string, stores []map[int]int, ledgers []QuotaLedger) error {
+	ledgerUserIds := make([]int, 0)
+	seen := make(map[int]bool)
+	for _, ledger := range ledgers {
+		if ledger.Account == QuotaLedgerAccountUser && !seen[ledger.UserId] {
+			seen[ledger.UserId] = true
+			ledgerUserIds = append(ledgerUserIds, ledger.UserId)
+		}
+	}
+	err := DB.Transaction(func(tx *gorm.DB) error {
+		if segment != "" {
+			name := filepath.Base(segment)
+			var count int64
+			if err := tx.Model(&BatchUpdateCheckpoint{}).Where("segment = ?", name).Count(&count).Error; err != nil {
+				return err
+			}
+			if count > 0 {
+				// 已应用过，仅是文件未删除
+				return nil
+			}
+			if err := tx.Create(&BatchUpdateCheckpoint{Segment: name, CreatedAt: common.GetTimestamp()}).Error; err != nil {
+				return err
+			}
+		}
+		// 期初余额须在应用本分段的增量之前读取
+		for _, userId := range ledgerUserIds {
+			if err := ensureQuotaLedgerOpeningTx(tx, userId, 0); err != nil {
+				return err
+			}
+		}
+		for i, store := range stores {
+			for key, value := range store {
+				var err error
+				switch i {
+				case BatchUpdateTypeUserQuota:
+					err = increaseUserQuota(tx, key, value)
+				case BatchUpdateTypeTokenQuota:
+					err = increaseTokenQuota(tx, key, value)
+				case BatchUpdateTypeUsedQuota:
+					err = updateUserUsedQuota(tx, key, value)
+				case BatchUpdateTypeRequestCount:
+					err = updateUserRequestCount(tx, key, value)
+				case BatchUpdateTypeChannelUsedQuota:
+					err = updateChannelUsedQuota(tx, key, value)
 				}
-			case BatchUpdateTypeTokenQuota:
-				err := increaseTokenQuota(key, value)
 				if err != nil {
-					common.SysLog("failed to batch update token quota: " + err.Error())
+					return fmt.Errorf("batch update type %d id %d: %w", i, key, err)
 				}
-			case BatchUpdateTypeUsedQuota:
-				updateUserUsedQuota(key, value)
-			case BatchUpdateTypeRequestCount:
-				updateUserRequestCount(key, value)
-			case BatchUpdateTypeChannelUsedQuota:
-				updateChannelUsedQuota(key, value)
 			}
 		}
+		if len(ledgers) > 0 {
+			if err := tx.CreateInBatches(&ledgers, 100).Error; err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return err
 	}
-	common.SysLog("batch update finished")
+	markQuotaLedgerOpened(ledgerUserIds...)
+	return nil
 }
 
 func RecordExist(err error) (bool, error) {
@@ -0,0 +1,278 @@
+package model
+
+import (
+	"errors"
+	"strings"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/setting/operation_setting"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// 用户事件类型
+const (
+	WebhookEventTaskSucceeded     = "task.succeeded"
+	WebhookEventTaskFailed        = "task.failed"
+	WebhookEventTokenExpiring     = "token.expiring"
+	WebhookEventTokenQuotaExhaust = "token.quota_exhausted"
+	WebhookEventTopUpCompleted    = "topup.completed"
+	WebhookEventPing              = "ping"
+)
+
+var WebhookEventTypes = []string{
+	WebhookEventTaskSucceeded,
+	WebhookEventTaskFailed,
+	WebhookEventTokenExpiring,
+	WebhookEventTokenQuotaExhaust,
+	WebhookEventTopUpCompleted,
+}
+
+// 投递状态
+const (
+	WebhookDeliveryStatusPending = "pending"
+	WebhookDeliveryStatusSuccess = "success"
+	WebhookDeliveryStatusFailed  = "failed"
+)
+
+// WebhookSubscription 用户的事件订阅，Events 为逗号分隔的事件类型，为空表示订阅全部事件
+type WebhookSubscription struct {
+	Id        int    `json:"id"`
+	UserId    int    `json:"user_id" gorm:"index"`
+	Name      string `json:"name" gorm:"type:varchar(64)"`
+	Url       string `json:"url" gorm:"type:varchar(512)"`
+	Secret    string `json:"secret" gorm:"type:varchar(128)"`
+	Events    string `json:"events" gorm:"type:varchar(512)"`
+	Enabled   bool   `json:"enabled" gorm:"default:true"`
+	CreatedAt int64  `json:"created_at" gorm:"bigint"`
+	UpdatedAt int64  `json:"updated_at" gorm:"bigint"`
+}
+
+// WebhookDelivery 一次事件投递，同时作为持久化的投递队列和投递记录
+type WebhookDelivery struct {
+	Id             int    `json:"id"`
+	SubscriptionId int    `json:"subscription_id" gorm:"index;uniqueIndex:idx_webhook_delivery_event,priority:1"`
+	UserId         int    `json:"user_id" gorm:"index"`
+	EventId        string `json:"event_id" gorm:"type:varchar(128);index;uniqueIndex:idx_webhook_delivery_event,priority:2"` // 同一事件的所有投递共用，用于去重
+	EventType      string `json:"event_type" gorm:"type:varchar(64)"`
+	Payload        string `json:"payload" gorm:"type:text"`
+	Status         string `json:"status" gorm:"type:varchar(16);index:idx_webhook_delivery_due"`
+	Attempts       int    `json:"attempts" gorm:"default:0"`
+	NextAttemptAt  int64  `json:"next_attempt_at" gorm:"bigint;index:idx_webhook_delivery_due"`
+	LastStatusCode int    `json:"last_status_code"`
+	LastError      string `json:"last_error" gorm:"type:text"`
+	CreatedAt      int64  `json:"created_at" gorm:"bigint;index"`
+	DeliveredAt    int64  `json:"delivered_at" gorm:"bigint"`
+}
+
+// Subscribes 判断订阅是否包含指定事件，ping 事件总是投递
+func (subscription *WebhookSubscription) Subscribes(eventType string) bool {
+	if subscription.Events == "" || eventType == WebhookEventPing {
+		return true
+	}
+	for _, event := range strings.Split(subscription.Events, ",") {
+		if strings.TrimSpace(event) == eventType {
+			return true
+		}
+	}
+	return false
+}
+
+func (subscription *WebhookSubscription) Insert() error {
+	subscription.CreatedAt = common.GetTimestamp()
+	subscription.UpdatedAt = subscription.CreatedAt
+	return DB.Create(subscription).Error
+}
+
+func (subscription *WebhookSubscription) Update() error {
+	subscription.UpdatedAt = common.GetTimestamp()
+	return DB.Model(subscription).Select("name", "url", "secret", "events", "enabled", "updated_at").Updates(subscription).Error
+}
+
+func (subscription *WebhookSubscription) Delete() error {
+	return DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("subscription_id = ?", subscription.Id).Delete(&WebhookDelivery{}).Error; err != nil {
+			return err
+		}
+		return tx.Delete(subscription).Error
+	})
+}
+
+func GetWebhookSubscriptionById(id int, userId int) (*WebhookSubscription, error) {
+	var subscription WebhookSubscription
+	if err := DB.Where("id = ? and user_id = ?", id, userId).First(&subscription).Error; err != nil {
+		return nil, err
+	}
+	return &subscription, nil
+}
+
+func GetUserWebhookSubscriptions(userId int) ([]*WebhookSubscription, error) {
+	var subscriptions []*WebhookSubscription
+	err := DB.Where("user_id = ?", userId).Order("id").Find(&subscriptions).Error
+	return subscriptions, err
+}
+
+func CountUserWebhookSubscriptions(userId int) (int64, error) {
+	var count int64
+	err := DB.Model(&WebhookSubscription{}).Where("user_id = ?", userId).Count(&count).Error
+	return count, err
+}
+
+// GetWebhookSubscribedUserIds 返回订阅了指定事件的用户，用于定期扫描类事件（如令牌即将过期）
+func GetWebhookSubscribedUserIds(eventType string) ([]int, error) {
+	var subscriptions []*WebhookSubscription
+	if err := DB.Select("user_id", "events").Where("enabled = ?", true).Find(&subscriptions).Error; err != nil {
+		return nil, err
+	}
+	seen := make(map[int]bool)
+	var userIds []int
+	for _, subscription := range subscriptions {
+		if !seen[subscription.UserId] && subscription.Subscribes(eventType) {
+			seen[subscription.UserId] = true
+			userIds = append(userIds, subscription.UserId)
+		}
+	}
+	return userIds, nil
+}
+
+// WebhookEvent 投递给用户的事件负载
+type WebhookEvent struct {
+	Id        string `json:"id"`
+	Type      string `json:"type"`
+	CreatedAt int64  `json:"created_at"`
+	Data      any    `json:"data"`
+}
+
+// NewWebhookEventPayload 序列化事件负载，同一事件投递给不同订阅时负载相同
+func NewWebhookEventPayload(eventId string, eventType string, data any) (string, error) {
+	payload, err := common.Marshal(WebhookEvent{
+		Id:        eventId,
+		Type:      eventType,
+		CreatedAt: common.GetTimestamp(),
+		Data:      data,
+	})
+	return string(payload), err
+}
+
+// EnqueueWebhookEvent 为用户所有订阅了该事件的已启用订阅创建待投递记录。
+// eventId 相同的事件只入队一次，返回新创建的投递，由定时任务或调用方负责发送
+func EnqueueWebhookEvent(userId int, eventId string, eventType string, data any) ([]*WebhookDelivery, error) {
+	if !operation_setting.GetWebhookSetting().Enabled {
+		return nil, nil
+	}
+	var subscriptions []*WebhookSubscription
+	if err := DB.Where("user_id = ? and enabled = ?", userId, true).Find(&subscriptions).Error; err != nil {
+		return nil, err
+	}
+	payload, err := NewWebhookEventPayload(eventId, eventType, data)
+	if err != nil {
+		return nil, err
+	}
+	now := common.GetTimestamp()
+	var deliveries []*WebhookDelivery
+	for _, subscription := range subscriptions {
+		if !subscription.Subscribes(eventType) {
+			continue
+		}
+		deliveries = append(deliveries, &WebhookDelivery{
+			SubscriptionId: subscription.Id,
+			UserId:         userId,
+			EventId:        eventId,
+			EventType:      eventType,
+			Payload:        payload,
+			Status:         WebhookDeliveryStatusPending,
+			NextAttemptAt:  now,
+			CreatedAt:      now,
+		})
+	}
+	// 依赖 (subscription_id, event_id) 唯一索引去重，多个节点同时入队同一事件时只有一方写入成功
+	var created []*WebhookDelivery
+	for _, delivery := range deliveries {
+		result := DB.Clauses(clause.OnConflict{DoNothing: true}).Create(delivery)
+		if result.Error != nil {
+			return created, result.Error
+		}
+		if result.RowsAffected > 0 {
+			created = append(created, delivery)
+		}
+	}
+	return created, nil
+}
+
+func (delivery *WebhookDelivery) Insert() error {
+	delivery.CreatedAt = common.GetTimestamp()
+	return DB.Create(delivery).Error
+}
+
+func GetWebhookDeliveryById(id int, userId int) (*WebhookDelivery, error) {
+	var delivery WebhookDelivery
+	if err := DB.Where("id = ? and user_id = ?", id, userId).First(&delivery).Error; err != nil {
+		return nil, err
+	}
+	return &delivery, nil
+}
+
+func GetUserWebhookDeliveries(userId int, subscriptionId int, status string, startIdx int, num int) (deliveries []*WebhookDelivery, total int64, err error) {
+	tx := DB.Model(&WebhookDelivery{}).Where("user_id = ?", userId)
+	if subscriptionId != 0 {
+		tx = tx.Where("subscription_id = ?", subscriptionId)
+	}
+	if status != "" {
+		tx = tx.Where("status = ?", status)
+	}
+	if err = tx.Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+	err = tx.Order("id desc").Limit(num).Offset(startIdx).Find(&deliveries).Error
+	return deliveries, total, err
+}
+
+// GetDueWebhookDeliveries 返回到达重试时间的待投递记录
+func GetDueWebhookDeliveries(now int64, limit int) ([]*WebhookDelivery, error) {
+	var deliveries []*WebhookDelivery
+	err := DB.Where("status = ? and next_attempt_at <= ?", WebhookDeliveryStatusPending, now).
+		Order("next_attempt_at").Limit(limit).Find(&deliveries).Error
+	return deliveries, err
+}
+
+// ClaimWebhookDelivery 以乐观锁认领一次投递并将下次尝试时间推迟到 leaseUntil，
+// 避免事件触发节点的即时投递与定时重试同时发送
+func ClaimWebhookDelivery(delivery *WebhookDelivery, leaseUntil int64) (bool, error) {
+	result := DB.Model(&WebhookDelivery{}).
+		Where("id = ? and status = ? and next_attempt_at = ?", delivery.Id, WebhookDeliveryStatusPending, delivery.NextAttemptAt).
+		Update("next_attempt_at", leaseUntil)
+	if result.Error != nil {
+		return false, result.Error
+	}
+	if result.RowsAffected == 0 {
+		return false, nil
+	}
+	delivery.NextAttemptAt = leaseUntil
+	return true, nil
+}
+
+func (delivery *WebhookDelivery) SaveResult() error {
+	return DB.Model(delivery).Select("status", "attempts", "next_attempt_at", "last_status_code", "last_error", "delivered_at").
+		Updates(delivery).Error
+}
+
+// ResetWebhookDelivery 将投递重新放入队列，用于手动重新投递
+func ResetWebhookDelivery(delivery *WebhookDelivery) error {
+	if delivery.Status == WebhookDeliveryStatusPending {
+		return errors.New("投递仍在队列中")
+	}
+	delivery.Status = WebhookDeliveryStatusPending
+	delivery.Attempts = 0
+	delivery.NextAttemptAt = common.GetTimestamp()
+	delivery.LastError = ""
+	delivery.LastStatusCode = 0
+	delivery.DeliveredAt = 0
+	return delivery.SaveResult()
+}
+
+// DeleteWebhookDeliveriesBefore 删除早于指定时间且已结束的投递记录
+func DeleteWebhookDeliveriesBefore(before int64) (int64, error) {
+	result := DB.Where("created_at < ? and status <> ?", before, WebhookDeliveryStatusPending).Delete(&WebhookDelivery{})
+	return result.RowsAffected, result.Error
+}
@@ -11,6 +11,7 @@ import (
 	"time"
 
 	common2 "github.com/QuantumNous/new-api/common"
+	constant2 "github.com/QuantumNous/new-api/constant"
 	"github.com/QuantumNous/new-api/logger"
 	"github.com/QuantumNous/new-api/relay/common"
 	"github.com/QuantumNous/new-api/relay/constant"
@@ -264,8 +265,11 @@ func doRequest(c *gin.Context, req *http.Request, info *common.RelayInfo) (*http
 		client = service.GetHttpClient()
 	}
 
+	// 对冲请求共用下游的 Writer，流式响应头在 Claim 成功后再设置
+	hedgeAttempt := common.GetHedgeAttempt(c)
+
 	var stopPinger context.CancelFunc
-	if info.IsStream {
+	if info.IsStream && hedgeAttempt == nil {
 		helper.SetEventStreamHeaders(c)
 		// 处理流式请求的 ping 保活
 		generalSettings := operation_setting.GetGeneralSetting()
@@ -284,14 +288,47 @@ func doRequest(c *gin.Context, req *http.Request, info *common.RelayInfo) (*http
 		}
 	}
 
-	resp, err := client.Do(req)
-	if err != nil {
-		logger.LogError(c, "do request failed: "+err.Error())
-		return nil, types.NewError(err, types.ErrorCodeDoRequestFailed, types.ErrOptionWithHideErrMsg("upstream error: do request failed"))
+	// 对冲请求在另一方胜出后取消
+	if hedgeAttempt != nil {
+		req = req.WithContext(hedgeAttempt.Ctx)
+	}
+
+	startTime := time.Now()
+	var resp *http.Response
+	if info.ChannelType == constant2.ChannelTypeReplay {
+		// 回放渠道不请求上游，按请求指纹读取录制文件
+		resp, err = service.ReplayCassette(c, info.ChannelOtherSettings.Replay)
+		if err != nil {
+			logger.LogError(c, "replay cassette failed: "+err.Error())
+			return nil, types.NewError(err, types.ErrorCodeDoRequestFailed, types.ErrOptionWithSkipRetry())
+		}
+	} else {
+		resp, err = client.Do(req)
+		if err != nil {
+			logger.LogError(c, "do request failed: "+err.Error())
+			return nil, types.NewError(err, types.ErrorCodeDoRequestFailed, types.ErrOptionWithHideErrMsg("upstream error: do request failed"))
+		}
 	}
 	if resp == nil {
 		return nil, errors.New("resp is nil")
 	}
+	// 仅成功的响应参与对冲竞争，落败方直接丢弃响应，不写回下游也不计费
+	if hedgeAttempt != nil && resp.StatusCode < http.StatusBadRequest && !hedgeAttempt.Claim() {
+		service.CloseResponseBodyGracefully(resp)
+		return nil, types.NewError(errors.New("hedged request lost the race"), types.ErrorCodeHedgeLost, types.ErrOptionWithSkipRetry())
+	}
+	if hedgeAttempt != nil && info.IsStream && resp.StatusCode < http.StatusBadRequest {
+		helper.SetEventStreamHeaders(c)
+	}
+	// 记录上游限流额度，供渠道选择时参考
+	keyIndex := 0
+	if info.ChannelIsMultiKey {
+		keyIndex = info.ChannelMultiKeyIndex
+	}
+	service.UpdateChannelRateLimitFromHeader(info.ChannelId, keyIndex, resp.Header)
+	if info.ChannelOtherSettings.RecordTraffic {
+		service.RecordCassette(c, info, req, resp, startTime)
+	}
 
 	_ = req.Body.Close()
 	_ = c.Request.Body.Close()
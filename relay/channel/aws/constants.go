@@ -27,6 +27,43 @@ var awsModelIDMap = map[string]string{
 	"nova-reel-v1:0":    "amazon.nova-reel-v1:0",
 	"nova-reel-v1:1":    "amazon.nova-reel-v1:1",
 	"nova-sonic-v1:0":   "amazon.nova-sonic-v1:0",
+	// Llama models
+	"llama3-8b-instruct-v1:0":           "meta.llama3-8b-instruct-v1:0",
+	"llama3-70b-instruct-v1:0":          "meta.llama3-70b-instruct-v1:0",
+	"llama3-1-8b-instruct-v1:0":         "meta.llama3-1-8b-instruct-v1:0",
+	"llama3-1-70b-instruct-v1:0":        "meta.llama3-1-70b-instruct-v1:0",
+	"llama3-1-405b-instruct-v1:0":       "meta.llama3-1-405b-instruct-v1:0",
+	"llama3-2-11b-instruct-v1:0":        "meta.llama3-2-11b-instruct-v1:0",
+	"llama3-2-90b-instruct-v1:0":        "meta.llama3-2-90b-instruct-v1:0",
+	"llama3-3-70b-instruct-v1:0":        "meta.llama3-3-70b-instruct-v1:0",
+	"llama4-scout-17b-instruct-v1:0":    "meta.llama4-scout-17b-instruct-v1:0",
+	"llama4-maverick-17b-instruct-v1:0": "meta.llama4-maverick-17b-instruct-v1:0",
+	// Mistral models
+	"mistral-7b-instruct-v0:2":   "mistral.mistral-7b-instruct-v0:2",
+	"mixtral-8x7b-instruct-v0:1": "mistral.mixtral-8x7b-instruct-v0:1",
+	"mistral-small-2402-v1:0":    "mistral.mistral-small-2402-v1:0",
+	"mistral-large-2402-v1:0":    "mistral.mistral-large-2402-v1:0",
+	"mistral-large-2407-v1:0":    "mistral.mistral-large-2407-v1:0",
+	"pixtral-large-2502-v1:0":    "mistral.pixtral-large-2502-v1:0",
+	// Cohere Command models
+	"command-r-v1:0":      "cohere.command-r-v1:0",
+	"command-r-plus-v1:0": "cohere.command-r-plus-v1:0",
+	// DeepSeek models
+	"deepseek-r1-v1:0": "deepseek.r1-v1:0",
+	"deepseek-v3-v1:0": "deepseek.v3-v1:0",
+	// Qwen models
+	"qwen3-32b-v1:0":             "qwen.qwen3-32b-v1:0",
+	"qwen3-235b-a22b-2507-v1:0":  "qwen.qwen3-235b-a22b-2507-v1:0",
+	"qwen3-coder-30b-a3b-v1:0":   "qwen.qwen3-coder-30b-a3b-v1:0",
+	"qwen3-coder-480b-a35b-v1:0": "qwen.qwen3-coder-480b-a35b-v1:0",
+	// Embedding models
+	"titan-embed-text-v1":          "amazon.titan-embed-text-v1",
+	"titan-embed-text-v2:0":        "amazon.titan-embed-text-v2:0",
+	"cohere-embed-english-v3":      "cohere.embed-english-v3",
+	"cohere-embed-multilingual-v3": "cohere.embed-multilingual-v3",
+	// Rerank models
+	"cohere-rerank-v3-5:0": "cohere.rerank-v3-5:0",
+	"amazon-rerank-v1:0":   "amazon.rerank-v1:0",
 }
 
 var awsModelCanCrossRegionMap = map[string]map[string]bool{
@@ -118,6 +155,35 @@ var awsModelCanCrossRegionMap = map[string]map[string]bool{
 		"eu":   true,
 		"apac": true,
 	},
+	// Llama 3.1 及之后的模型和 DeepSeek R1 只能通过跨区域推理配置调用
+	"meta.llama3-1-8b-instruct-v1:0": {
+		"us": true,
+	},
+	"meta.llama3-1-70b-instruct-v1:0": {
+		"us": true,
+	},
+	"meta.llama3-2-11b-instruct-v1:0": {
+		"us": true,
+	},
+	"meta.llama3-2-90b-instruct-v1:0": {
+		"us": true,
+	},
+	"meta.llama3-3-70b-instruct-v1:0": {
+		"us": true,
+	},
+	"meta.llama4-scout-17b-instruct-v1:0": {
+		"us": true,
+	},
+	"meta.llama4-maverick-17b-instruct-v1:0": {
+		"us": true,
+	},
+	"mistral.pixtral-large-2502-v1:0": {
+		"us": true,
+		"eu": true,
+	},
+	"deepseek.r1-v1:0": {
+		"us": true,
+	},
 }
 
 var awsRegionCrossModelPrefixMap = map[string]string{
@@ -128,7 +194,15 @@ var awsRegionCrossModelPrefixMap = map[string]string{
 
 var ChannelName = "aws"
 
-// 判断是否为Nova模型
-func isNovaModel(modelId string) bool {
-	return strings.Contains(modelId, "nova-")
+// 判断是否为Claude模型，Claude 模型使用 InvokeModel 调用，其余对话模型使用 Converse API
+func isClaudeModel(modelId string) bool {
+	return strings.Contains(modelId, "anthropic.")
+}
+
+func isTitanEmbeddingModel(modelId string) bool {
+	return strings.Contains(modelId, "amazon.titan-embed")
+}
+
+func isCohereEmbeddingModel(modelId string) bool {
+	return strings.Contains(modelId, "cohere.embed")
 }
@@ -48,68 +48,76 @@ func formatRequest(requestBody io.Reader, requestHeader http.Header) (*AwsClaude
 	return &awsClaudeRequest, nil
 }
 
-// NovaMessage Nova模型使用messages-v1格式
-type NovaMessage struct {
-	Role    string        `json:"role"`
-	Content []NovaContent `json:"content"`
+// AwsTitanEmbeddingRequest Titan 文本嵌入请求，每次调用只接受一条输入
+type AwsTitanEmbeddingRequest struct {
+	InputText  string `json:"inputText"`
+	Dimensions int    `json:"dimensions,omitempty"` // 仅 v2 支持：256、512、1024
+	Normalize  *bool  `json:"normalize,omitempty"`  // 仅 v2 支持
 }
 
-type NovaContent struct {
+type AwsTitanEmbeddingResponse struct {
+	Embedding           []float64 `json:"embedding"`
+	InputTextTokenCount int       `json:"inputTextTokenCount"`
+}
+
+// AwsCohereEmbeddingRequest Cohere 嵌入请求，一次调用最多 96 条输入
+type AwsCohereEmbeddingRequest struct {
+	Texts     []string `json:"texts"`
+	InputType string   `json:"input_type"`
+	Truncate  string   `json:"truncate,omitempty"`
+}
+
+type AwsCohereEmbeddingResponse struct {
+	Id         string      `json:"id"`
+	Embeddings [][]float64 `json:"embeddings"`
+}
+
+// AwsRerankRequest Bedrock Agent Runtime Rerank 请求
+type AwsRerankRequest struct {
+	Queries                []AwsRerankQuery          `json:"queries"`
+	Sources                []AwsRerankSource         `json:"sources"`
+	RerankingConfiguration AwsRerankingConfiguration `json:"rerankingConfiguration"`
+}
+
+type AwsRerankQuery struct {
+	Type      string        `json:"type"`
+	TextQuery AwsRerankText `json:"textQuery"`
+}
+
+type AwsRerankText struct {
 	Text string `json:"text"`
 }
 
-type NovaRequest struct {
-	SchemaVersion   string               `json:"schemaVersion"`             // 请求版本，例如 "1.0"
-	Messages        []NovaMessage        `json:"messages"`                  // 对话消息列表
-	InferenceConfig *NovaInferenceConfig `json:"inferenceConfig,omitempty"` // 推理配置，可选
+type AwsRerankSource struct {
+	Type                 string                  `json:"type"`
+	InlineDocumentSource AwsRerankInlineDocument `json:"inlineDocumentSource"`
 }
 
-type NovaInferenceConfig struct {
-	MaxTokens     int      `json:"maxTokens,omitempty"`     // 最大生成的 token 数
-	Temperature   float64  `json:"temperature,omitempty"`   // 随机性 (默认 0.7, 范围 0-1)
-	TopP          float64  `json:"topP,omitempty"`          // nucleus sampling (默认 0.9, 范围 0-1)
-	TopK          int      `json:"topK,omitempty"`          // 限制候选 token 数 (默认 50, 范围 0-128)
-	StopSequences []string `json:"stopSequences,omitempty"` // 停止生成的序列
+type AwsRerankInlineDocument struct {
+	Type         string         `json:"type"`
+	TextDocument *AwsRerankText `json:"textDocument,omitempty"`
+	JsonDocument any            `json:"jsonDocument,omitempty"`
 }
 
-// 转换OpenAI请求为Nova格式
-func convertToNovaRequest(req *dto.GeneralOpenAIRequest) *NovaRequest {
-	novaMessages := make([]NovaMessage, len(req.Messages))
-	for i, msg := range req.Messages {
-		novaMessages[i] = NovaMessage{
-			Role:    msg.Role,
-			Content: []NovaContent{{Text: msg.StringContent()}},
-		}
-	}
+type AwsRerankingConfiguration struct {
+	Type                          string                           `json:"type"`
+	BedrockRerankingConfiguration AwsBedrockRerankingConfiguration `json:"bedrockRerankingConfiguration"`
+}
 
-	novaReq := &NovaRequest{
-		SchemaVersion: "messages-v1",
-		Messages:      novaMessages,
-	}
+type AwsBedrockRerankingConfiguration struct {
+	NumberOfResults    int                         `json:"numberOfResults,omitempty"`
+	ModelConfiguration AwsRerankModelConfiguration `json:"modelConfiguration"`
+}
 
-	// 设置推理配置
-	if req.MaxTokens != 0 || (req.Temperature != nil && *req.Temperature != 0) || req.TopP != 0 || req.TopK != 0 || req.Stop != nil {
-		novaReq.InferenceConfig = &NovaInferenceConfig{}
-		if req.MaxTokens != 0 {
-			novaReq.InferenceConfig.MaxTokens = int(req.MaxTokens)
-		}
-		if req.Temperature != nil && *req.Temperature != 0 {
-			novaReq.InferenceConfig.Temperature = *req.Temperature
-		}
-		if req.TopP != 0 {
-			novaReq.InferenceConfig.TopP = req.TopP
-		}
-		if req.TopK != 0 {
-			novaReq.InferenceConfig.TopK = req.TopK
-		}
-		if req.Stop != nil {
-			if stopSequences := parseStopSequences(req.Stop); len(stopSequences) > 0 {
-				novaReq.InferenceConfig.StopSequences = stopSequences
-			}
-		}
-	}
+type AwsRerankModelConfiguration struct {
+	ModelArn string `json:"modelArn"`
+}
 
-	return novaReq
+type AwsRerankResponse struct {
+	Results []struct {
+		Index          int     `json:"index"`
+		RelevanceScore float64 `json:"relevanceScore"`
+	} `json:"results"`
 }
 
 // parseStopSequences 解析停止序列，支持字符串或字符串数组
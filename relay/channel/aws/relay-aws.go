@@ -1,7 +1,6 @@
 package aws
 
 import (
-	"encoding/json"
 	"fmt"
 	"io"
 	"net/http"
@@ -11,6 +10,7 @@ import (
 	"github.com/QuantumNous/new-api/dto"
 	"github.com/QuantumNous/new-api/relay/channel/claude"
 	relaycommon "github.com/QuantumNous/new-api/relay/common"
+	relayconstant "github.com/QuantumNous/new-api/relay/constant"
 	"github.com/QuantumNous/new-api/relay/helper"
 	"github.com/QuantumNous/new-api/service"
 	"github.com/QuantumNous/new-api/types"
@@ -25,48 +25,68 @@ import (
 	"github.com/aws/smithy-go/auth/bearer"
 )
 
-func newAwsClient(c *gin.Context, info *relaycommon.RelayInfo) (*bedrockruntime.Client, error) {
-	var (
-		httpClient *http.Client
-		err        error
-	)
+// awsSecret 渠道密钥，API Key 格式为 <api-key>|<region>，AK/SK 格式为 <ak>|<sk>|<region>
+type awsSecret struct {
+	ApiKey    string
+	AccessKey string
+	SecretKey string
+	Region    string
+}
+
+func parseAwsSecret(key string) (*awsSecret, error) {
+	parts := strings.Split(key, "|")
+	switch len(parts) {
+	case 2:
+		return &awsSecret{ApiKey: parts[0], Region: parts[1]}, nil
+	case 3:
+		return &awsSecret{AccessKey: parts[0], SecretKey: parts[1], Region: parts[2]}, nil
+	default:
+		return nil, errors.New("invalid aws secret key")
+	}
+}
+
+func newAwsHttpClient(info *relaycommon.RelayInfo) (*http.Client, error) {
 	if info.ChannelSetting.Proxy != "" {
-		httpClient, err = service.NewProxyHttpClient(info.ChannelSetting.Proxy)
+		httpClient, err := service.NewProxyHttpClient(info.ChannelSetting.Proxy)
 		if err != nil {
 			return nil, fmt.Errorf("new proxy http client failed: %w", err)
 		}
-	} else {
-		httpClient = service.GetHttpClient()
+		return httpClient, nil
 	}
+	return service.GetHttpClient(), nil
+}
 
-	awsSecret := strings.Split(info.ApiKey, "|")
-	var client *bedrockruntime.Client
-	switch len(awsSecret) {
-	case 2:
-		apiKey := awsSecret[0]
-		region := awsSecret[1]
-		client = bedrockruntime.New(bedrockruntime.Options{
-			Region:                  region,
-			BearerAuthTokenProvider: bearer.StaticTokenProvider{Token: bearer.Token{Value: apiKey}},
-			HTTPClient:              httpClient,
-		})
-	case 3:
-		ak := awsSecret[0]
-		sk := awsSecret[1]
-		region := awsSecret[2]
-		client = bedrockruntime.New(bedrockruntime.Options{
-			Region:      region,
-			Credentials: aws.NewCredentialsCache(credentials.NewStaticCredentialsProvider(ak, sk, "")),
-			HTTPClient:  httpClient,
-		})
-	default:
-		return nil, errors.New("invalid aws secret key")
+func newAwsClient(c *gin.Context, info *relaycommon.RelayInfo) (*bedrockruntime.Client, error) {
+	httpClient, err := newAwsHttpClient(info)
+	if err != nil {
+		return nil, err
+	}
+	secret, err := parseAwsSecret(info.ApiKey)
+	if err != nil {
+		return nil, err
 	}
 
-	return client, nil
+	options := bedrockruntime.Options{
+		Region:     secret.Region,
+		HTTPClient: httpClient,
+	}
+	if secret.ApiKey != "" {
+		options.BearerAuthTokenProvider = bearer.StaticTokenProvider{Token: bearer.Token{Value: secret.ApiKey}}
+	} else {
+		options.Credentials = aws.NewCredentialsCache(credentials.NewStaticCredentialsProvider(secret.AccessKey, secret.SecretKey, ""))
+	}
+	// 渠道填写了 Base URL 时使用自定义地址，便于接入 Bedrock 兼容的代理或本地模拟服务
+	if info.ChannelBaseUrl != "" {
+		options.BaseEndpoint = aws.String(strings.TrimSuffix(info.ChannelBaseUrl, "/"))
+	}
+	return bedrockruntime.New(options), nil
 }
 
 func doAwsClientRequest(c *gin.Context, info *relaycommon.RelayInfo, a *Adaptor, requestBody io.Reader) (any, error) {
+	if info.RelayMode == relayconstant.RelayModeRerank {
+		return doAwsRerankRequest(c, info, requestBody)
+	}
+
 	awsCli, err := newAwsClient(c, info)
 	if err != nil {
 		return nil, types.NewError(err, types.ErrorCodeChannelAwsClientError)
@@ -82,61 +102,73 @@ func doAwsClientRequest(c *gin.Context, info *relaycommon.RelayInfo, a *Adaptor,
 		awsModelId = awsModelCrossRegion(awsModelId, awsRegionPrefix)
 	}
 
+	if info.RelayMode == relayconstant.RelayModeEmbeddings {
+		awsReq, err := buildAwsEmbeddingRequest(requestBody, awsModelId)
+		if err != nil {
+			return nil, types.NewError(errors.Wrap(err, "build aws embedding request fail"), types.ErrorCodeBadRequestBody)
+		}
+		a.AwsReq = awsReq
+		return nil, nil
+	}
+
+	// 非 Claude 模型通过 Converse API 调用，Claude 格式的请求仍走 InvokeModel
+	if !isClaudeModel(awsModelId) && info.RelayFormat != types.RelayFormatClaude {
+		var openaiReq dto.GeneralOpenAIRequest
+		if err := common.DecodeJson(requestBody, &openaiReq); err != nil {
+			return nil, types.NewError(errors.Wrap(err, "decode converse request fail"), types.ErrorCodeBadRequestBody)
+		}
+		converseReq, err := convertOpenAI2ConverseInput(c, &openaiReq, awsModelId)
+		if err != nil {
+			return nil, types.NewError(errors.Wrap(err, "convert converse request fail"), types.ErrorCodeBadRequestBody)
+		}
+		if info.IsStream {
+			a.AwsReq = &bedrockruntime.ConverseStreamInput{
+				ModelId:                      converseReq.ModelId,
+				Messages:                     converseReq.Messages,
+				System:                       converseReq.System,
+				InferenceConfig:              converseReq.InferenceConfig,
+				ToolConfig:                   converseReq.ToolConfig,
+				AdditionalModelRequestFields: converseReq.AdditionalModelRequestFields,
+			}
+		} else {
+			a.AwsReq = converseReq
+		}
+		return nil, nil
+	}
+
 	// init empty request.header
 	requestHeader := http.Header{}
 	a.SetupRequestHeader(c, &requestHeader, info)
 
-	if isNovaModel(awsModelId) {
-		var novaReq *NovaRequest
-		err = common.DecodeJson(requestBody, &novaReq)
-		if err != nil {
-			return nil, types.NewError(errors.Wrap(err, "decode nova request fail"), types.ErrorCodeBadRequestBody)
-		}
+	awsClaudeReq, err := formatRequest(requestBody, requestHeader)
+	if err != nil {
+		return nil, types.NewError(errors.Wrap(err, "format aws request fail"), types.ErrorCodeBadRequestBody)
+	}
 
-		// 使用InvokeModel API，但使用Nova格式的请求体
-		awsReq := &bedrockruntime.InvokeModelInput{
+	if info.IsStream {
+		awsReq := &bedrockruntime.InvokeModelWithResponseStreamInput{
 			ModelId:     aws.String(awsModelId),
 			Accept:      aws.String("application/json"),
 			ContentType: aws.String("application/json"),
 		}
-
-		reqBody, err := common.Marshal(novaReq)
+		awsReq.Body, err = common.Marshal(awsClaudeReq)
 		if err != nil {
-			return nil, types.NewError(errors.Wrap(err, "marshal nova request"), types.ErrorCodeBadResponseBody)
+			return nil, types.NewError(errors.Wrap(err, "marshal aws request fail"), types.ErrorCodeBadRequestBody)
 		}
-		awsReq.Body = reqBody
+		a.AwsReq = awsReq
 		return nil, nil
 	} else {
-		awsClaudeReq, err := formatRequest(requestBody, requestHeader)
-		if err != nil {
-			return nil, types.NewError(errors.Wrap(err, "format aws request fail"), types.ErrorCodeBadRequestBody)
+		awsReq := &bedrockruntime.InvokeModelInput{
+			ModelId:     aws.String(awsModelId),
+			Accept:      aws.String("application/json"),
+			ContentType: aws.String("application/json"),
 		}
-
-		if info.IsStream {
-			awsReq := &bedrockruntime.InvokeModelWithResponseStreamInput{
-				ModelId:     aws.String(awsModelId),
-				Accept:      aws.String("application/json"),
-				ContentType: aws.String("application/json"),
-			}
-			awsReq.Body, err = common.Marshal(awsClaudeReq)
-			if err != nil {
-				return nil, types.NewError(errors.Wrap(err, "marshal aws request fail"), types.ErrorCodeBadRequestBody)
-			}
-			a.AwsReq = awsReq
-			return nil, nil
-		} else {
-			awsReq := &bedrockruntime.InvokeModelInput{
-				ModelId:     aws.String(awsModelId),
-				Accept:      aws.String("application/json"),
-				ContentType: aws.String("application/json"),
-			}
-			awsReq.Body, err = common.Marshal(awsClaudeReq)
-			if err != nil {
-				return nil, types.NewError(errors.Wrap(err, "marshal aws request fail"), types.ErrorCodeBadRequestBody)
-			}
-			a.AwsReq = awsReq
-			return nil, nil
+		awsReq.Body, err = common.Marshal(awsClaudeReq)
+		if err != nil {
+			return nil, types.NewError(errors.Wrap(err, "marshal aws request fail"), types.ErrorCodeBadRequestBody)
 		}
+		a.AwsReq = awsReq
+		return nil, nil
 	}
 }
 
@@ -232,56 +264,3 @@ func awsStreamHandler(c *gin.Context, info *relaycommon.RelayInfo, a *Adaptor) (
 	claude.HandleStreamFinalResponse(c, info, claudeInfo, claude.RequestModeMessage)
 	return nil, claudeInfo.Usage
 }
-
-// Nova模型处理函数
-func handleNovaRequest(c *gin.Context, info *relaycommon.RelayInfo, a *Adaptor) (*types.NewAPIError, *dto.Usage) {
-
-	awsResp, err := a.AwsClient.InvokeModel(c.Request.Context(), a.AwsReq.(*bedrockruntime.InvokeModelInput))
-	if err != nil {
-		return types.NewError(errors.Wrap(err, "InvokeModel"), types.ErrorCodeChannelAwsClientError), nil
-	}
-
-	// 解析Nova响应
-	var novaResp struct {
-		Output struct {
-			Message struct {
-				Content []struct {
-					Text string `json:"text"`
-				} `json:"content"`
-			} `json:"message"`
-		} `json:"output"`
-		Usage struct {
-			InputTokens  int `json:"inputTokens"`
-			OutputTokens int `json:"outputTokens"`
-			TotalTokens  int `json:"totalTokens"`
-		} `json:"usage"`
-	}
-
-	if err := json.Unmarshal(awsResp.Body, &novaResp); err != nil {
-		return types.NewError(errors.Wrap(err, "unmarshal nova response"), types.ErrorCodeBadResponseBody), nil
-	}
-
-	// 构造OpenAI格式响应
-	response := dto.OpenAITextResponse{
-		Id:      helper.GetResponseID(c),
-		Object:  "chat.completion",
-		Created: common.GetTimestamp(),
-		Model:   info.UpstreamModelName,
-		Choices: []dto.OpenAITextResponseChoice{{
-			Index: 0,
-			Message: dto.Message{
-				Role:    "assistant",
-				Content: novaResp.Output.Message.Content[0].Text,
-			},
-			FinishReason: "stop",
-		}},
-		Usage: dto.Usage{
-			PromptTokens:     novaResp.Usage.InputTokens,
-			CompletionTokens: novaResp.Usage.OutputTokens,
-			TotalTokens:      novaResp.Usage.TotalTokens,
-		},
-	}
-
-	c.JSON(http.StatusOK, response)
-	return nil, &response.Usage
-}
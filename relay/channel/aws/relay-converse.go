@@ -0,0 +1,417 @@
+package aws
+
+import (
+	"encoding/base64"
+	"net/http"
+	"strings"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/dto"
+	"github.com/QuantumNous/new-api/logger"
+	relaycommon "github.com/QuantumNous/new-api/relay/common"
+	"github.com/QuantumNous/new-api/relay/helper"
+	"github.com/QuantumNous/new-api/service"
+	"github.com/QuantumNous/new-api/types"
+
+	"github.com/gin-gonic/gin"
+	"github.com/pkg/errors"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/bedrockruntime"
+	"github.com/aws/aws-sdk-go-v2/service/bedrockruntime/document"
+	bedrockruntimeTypes "github.com/aws/aws-sdk-go-v2/service/bedrockruntime/types"
+)
+
+// convertOpenAI2ConverseInput 将 OpenAI 请求转换为 Converse 请求，Llama、Mistral、Cohere、DeepSeek、Qwen、Nova 等模型共用
+func convertOpenAI2ConverseInput(c *gin.Context, request *dto.GeneralOpenAIRequest, modelId string) (*bedrockruntime.ConverseInput, error) {
+	input := &bedrockruntime.ConverseInput{
+		ModelId: aws.String(modelId),
+	}
+	for i := range request.Messages {
+		message := &request.Messages[i]
+		switch message.Role {
+		case "system", "developer":
+			if text := message.StringContent(); text != "" {
+				input.System = append(input.System, &bedrockruntimeTypes.SystemContentBlockMemberText{Value: text})
+			}
+			continue
+		case "tool":
+			// 工具结果以 user 消息回传
+			input.Messages = appendConverseMessage(input.Messages, bedrockruntimeTypes.ConversationRoleUser, &bedrockruntimeTypes.ContentBlockMemberToolResult{
+				Value: bedrockruntimeTypes.ToolResultBlock{
+					ToolUseId: aws.String(message.ToolCallId),
+					Content: []bedrockruntimeTypes.ToolResultContentBlock{
+						&bedrockruntimeTypes.ToolResultContentBlockMemberText{Value: message.StringContent()},
+					},
+				},
+			})
+			continue
+		}
+
+		role := bedrockruntimeTypes.ConversationRoleUser
+		if message.Role == "assistant" {
+			role = bedrockruntimeTypes.ConversationRoleAssistant
+		}
+		blocks, err := convertConverseContent(c, message)
+		if err != nil {
+			return nil, err
+		}
+		if role == bedrockruntimeTypes.ConversationRoleAssistant {
+			for _, toolCall := range message.ParseToolCalls() {
+				arguments := make(map[string]any)
+				if toolCall.Function.Arguments != "" {
+					if err := common.UnmarshalJsonStr(toolCall.Function.Arguments, &arguments); err != nil {
+						return nil, errors.Wrap(err, "tool call arguments is not a json object")
+					}
+				}
+				blocks = append(blocks, &bedrockruntimeTypes.ContentBlockMemberToolUse{
+					Value: bedrockruntimeTypes.ToolUseBlock{
+						ToolUseId: aws.String(toolCall.ID),
+						Name:      aws.String(toolCall.Function.Name),
+						Input:     document.NewLazyDocument(arguments),
+					},
+				})
+			}
+		}
+		if len(blocks) == 0 {
+			continue
+		}
+		input.Messages = appendConverseMessage(input.Messages, role, blocks...)
+	}
+
+	config := &bedrockruntimeTypes.InferenceConfiguration{
+		StopSequences: parseStopSequences(request.Stop),
+	}
+	if maxTokens := request.GetMaxTokens(); maxTokens > 0 {
+		config.MaxTokens = aws.Int32(int32(maxTokens))
+	}
+	if request.Temperature != nil {
+		config.Temperature = aws.Float32(float32(*request.Temperature))
+	}
+	if request.TopP != 0 {
+		config.TopP = aws.Float32(float32(request.TopP))
+	}
+	input.InferenceConfig = config
+
+	if len(request.Tools) > 0 {
+		toolConfig := &bedrockruntimeTypes.ToolConfiguration{
+			ToolChoice: convertConverseToolChoice(request.ToolChoice),
+		}
+		for _, tool := range request.Tools {
+			if tool.Type != "" && tool.Type != "function" {
+				continue
+			}
+			parameters := tool.Function.Parameters
+			if parameters == nil {
+				parameters = map[string]any{"type": "object", "properties": map[string]any{}}
+			}
+			spec := bedrockruntimeTypes.ToolSpecification{
+				Name:        aws.String(tool.Function.Name),
+				InputSchema: &bedrockruntimeTypes.ToolInputSchemaMemberJson{Value: document.NewLazyDocument(parameters)},
+			}
+			if tool.Function.Description != "" {
+				spec.Description = aws.String(tool.Function.Description)
+			}
+			toolConfig.Tools = append(toolConfig.Tools, &bedrockruntimeTypes.ToolMemberToolSpec{Value: spec})
+		}
+		if len(toolConfig.Tools) > 0 {
+			input.ToolConfig = toolConfig
+		}
+	}
+	return input, nil
+}
+
+// appendConverseMessage Converse 要求 user 与 assistant 消息交替出现，连续的同角色消息合并为一条
+func appendConverseMessage(messages []bedrockruntimeTypes.Message, role bedrockruntimeTypes.ConversationRole, blocks ...bedrockruntimeTypes.ContentBlock) []bedrockruntimeTypes.Message {
+	if len(messages) > 0 && messages[len(messages)-1].Role == role {
+		messages[len(messages)-1].Content = append(messages[len(messages)-1].Content, blocks...)
+		return messages
+	}
+	return append(messages, bedrockruntimeTypes.Message{Role: role, Content: blocks})
+}
+
+func convertConverseContent(c *gin.Context, message *dto.Message) ([]bedrockruntimeTypes.ContentBlock, error) {
+	var blocks []bedrockruntimeTypes.ContentBlock
+	if message.IsStringContent() {
+		if text := message.StringContent(); text != "" {
+			blocks = append(blocks, &bedrockruntimeTypes.ContentBlockMemberText{Value: text})
+		}
+		return blocks, nil
+	}
+	for _, content := range message.ParseContent() {
+		switch content.Type {
+		case dto.ContentTypeText:
+			if content.Text != "" {
+				blocks = append(blocks, &bedrockruntimeTypes.ContentBlockMemberText{Value: content.Text})
+			}
+		case dto.ContentTypeImageURL:
+			imageUrl := content.GetImageMedia()
+			if imageUrl == nil {
+				continue
+			}
+			var mimeType, base64Data string
+			if strings.HasPrefix(imageUrl.Url, "http") {
+				fileData, err := service.GetFileBase64FromUrl(c, imageUrl.Url, "formatting image for Bedrock Converse")
+				if err != nil {
+					return nil, errors.Wrap(err, "get file base64 from url failed")
+				}
+				mimeType, base64Data = fileData.MimeType, fileData.Base64Data
+			} else {
+				var err error
+				mimeType, base64Data, err = service.DecodeBase64FileData(imageUrl.Url)
+				if err != nil {
+					return nil, err
+				}
+			}
+			data, err := base64.StdEncoding.DecodeString(base64Data)
+			if err != nil {
+				return nil, errors.Wrap(err, "decode image base64 failed")
+			}
+			format := strings.TrimPrefix(mimeType, "image/")
+			if format == "jpg" {
+				format = "jpeg"
+			}
+			blocks = append(blocks, &bedrockruntimeTypes.ContentBlockMemberImage{
+				Value: bedrockruntimeTypes.ImageBlock{
+					Format: bedrockruntimeTypes.ImageFormat(format),
+					Source: &bedrockruntimeTypes.ImageSourceMemberBytes{Value: data},
+				},
+			})
+		}
+	}
+	return blocks, nil
+}
+
+// convertConverseToolChoice Converse 不支持 none，按默认的 auto 处理
+func convertConverseToolChoice(toolChoice any) bedrockruntimeTypes.ToolChoice {
+	switch choice := toolChoice.(type) {
+	case string:
+		switch choice {
+		case "required":
+			return &bedrockruntimeTypes.ToolChoiceMemberAny{}
+		case "auto":
+			return &bedrockruntimeTypes.ToolChoiceMemberAuto{}
+		}
+	case map[string]any:
+		if function, ok := choice["function"].(map[string]any); ok {
+			if name, ok := function["name"].(string); ok && name != "" {
+				return &bedrockruntimeTypes.ToolChoiceMemberTool{Value: bedrockruntimeTypes.SpecificToolChoice{Name: aws.String(name)}}
+			}
+		}
+	}
+	return nil
+}
+
+func converseFinishReason(stopReason bedrockruntimeTypes.StopReason) string {
+	switch stopReason {
+	case bedrockruntimeTypes.StopReasonToolUse:
+		return "tool_calls"
+	case bedrockruntimeTypes.StopReasonMaxTokens:
+		return "length"
+	case bedrockruntimeTypes.StopReasonContentFiltered, bedrockruntimeTypes.StopReasonGuardrailIntervened:
+		return "content_filter"
+	default:
+		return "stop"
+	}
+}
+
+func converseUsage(tokenUsage *bedrockruntimeTypes.TokenUsage) *dto.Usage {
+	usage := &dto.Usage{}
+	if tokenUsage == nil {
+		return usage
+	}
+	usage.PromptTokens = int(aws.ToInt32(tokenUsage.InputTokens))
+	usage.CompletionTokens = int(aws.ToInt32(tokenUsage.OutputTokens))
+	usage.TotalTokens = int(aws.ToInt32(tokenUsage.TotalTokens))
+	usage.PromptTokensDetails.CachedTokens = int(aws.ToInt32(tokenUsage.CacheReadInputTokens))
+	usage.PromptTokensDetails.CachedCreationTokens = int(aws.ToInt32(tokenUsage.CacheWriteInputTokens))
+	return usage
+}
+
+// completeConverseUsage 上游未返回用量时按请求和响应文本估算
+func completeConverseUsage(usage *dto.Usage, responseText string, info *relaycommon.RelayInfo) *dto.Usage {
+	if usage.PromptTokens == 0 {
+		usage.PromptTokens = info.PromptTokens
+	}
+	if usage.CompletionTokens == 0 {
+		usage = service.ResponseText2Usage(responseText, info.UpstreamModelName, usage.PromptTokens)
+	}
+	usage.TotalTokens = usage.PromptTokens + usage.CompletionTokens
+	return usage
+}
+
+func converseHandler(c *gin.Context, info *relaycommon.RelayInfo, a *Adaptor) (*types.NewAPIError, *dto.Usage) {
+	awsResp, err := a.AwsClient.Converse(c.Request.Context(), a.AwsReq.(*bedrockruntime.ConverseInput))
+	if err != nil {
+		return types.NewOpenAIError(errors.Wrap(err, "Converse"), types.ErrorCodeAwsInvokeError, http.StatusInternalServerError), nil
+	}
+
+	var responseText, reasoningText strings.Builder
+	var toolCalls []dto.ToolCallResponse
+	if output, ok := awsResp.Output.(*bedrockruntimeTypes.ConverseOutputMemberMessage); ok {
+		for _, block := range output.Value.Content {
+			switch v := block.(type) {
+			case *bedrockruntimeTypes.ContentBlockMemberText:
+				responseText.WriteString(v.Value)
+			case *bedrockruntimeTypes.ContentBlockMemberReasoningContent:
+				if reasoning, ok := v.Value.(*bedrockruntimeTypes.ReasoningContentBlockMemberReasoningText); ok {
+					reasoningText.WriteString(aws.ToString(reasoning.Value.Text))
+				}
+			case *bedrockruntimeTypes.ContentBlockMemberToolUse:
+				arguments := []byte("{}")
+				if v.Value.Input != nil {
+					if data, err := v.Value.Input.MarshalSmithyDocument(); err == nil {
+						arguments = data
+					}
+				}
+				toolCalls = append(toolCalls, dto.ToolCallResponse{
+					ID:   aws.ToString(v.Value.ToolUseId),
+					Type: "function",
+					Function: dto.FunctionResponse{
+						Name:      aws.ToString(v.Value.Name),
+						Arguments: string(arguments),
+					},
+				})
+			}
+		}
+	}
+
+	message := dto.Message{
+		Role:             "assistant",
+		ReasoningContent: reasoningText.String(),
+	}
+	message.SetStringContent(responseText.String())
+	if len(toolCalls) > 0 {
+		message.SetToolCalls(toolCalls)
+	}
+	usage := completeConverseUsage(converseUsage(awsResp.Usage), responseText.String(), info)
+	response := dto.OpenAITextResponse{
+		Id:      helper.GetResponseID(c),
+		Object:  "chat.completion",
+		Created: common.GetTimestamp(),
+		Model:   info.UpstreamModelName,
+		Choices: []dto.OpenAITextResponseChoice{{
+			Index:        0,
+			Message:      message,
+			FinishReason: converseFinishReason(awsResp.StopReason),
+		}},
+		Usage: *usage,
+	}
+	jsonResponse, err := common.Marshal(response)
+	if err != nil {
+		return types.NewOpenAIError(err, types.ErrorCodeBadResponseBody, http.StatusInternalServerError), nil
+	}
+	c.Writer.Header().Set("Content-Type", "application/json")
+	service.IOCopyBytesGracefully(c, nil, jsonResponse)
+	return nil, usage
+}
+
+func converseStreamHandler(c *gin.Context, info *relaycommon.RelayInfo, a *Adaptor) (*types.NewAPIError, *dto.Usage) {
+	awsResp, err := a.AwsClient.ConverseStream(c.Request.Context(), a.AwsReq.(*bedrockruntime.ConverseStreamInput))
+	if err != nil {
+		return types.NewOpenAIError(errors.Wrap(err, "ConverseStream"), types.ErrorCodeAwsInvokeError, http.StatusInternalServerError), nil
+	}
+	stream := awsResp.GetStream()
+	defer stream.Close()
+
+	helper.SetEventStreamHeaders(c)
+	responseId := helper.GetResponseID(c)
+	created := common.GetTimestamp()
+	model := info.UpstreamModelName
+	usage := &dto.Usage{}
+	finishReason := "stop"
+	var responseText strings.Builder
+	// Converse 的内容块序号到 OpenAI tool_calls 序号的映射
+	toolCallIndexes := make(map[int32]int)
+
+	newChunk := func() dto.ChatCompletionsStreamResponse {
+		return dto.ChatCompletionsStreamResponse{
+			Id:      responseId,
+			Object:  "chat.completion.chunk",
+			Created: created,
+			Model:   model,
+			Choices: []dto.ChatCompletionsStreamResponseChoice{{
+				Index: 0,
+				Delta: dto.ChatCompletionsStreamResponseChoiceDelta{Role: "assistant"},
+			}},
+		}
+	}
+	sendChunk := func(chunk dto.ChatCompletionsStreamResponse) {
+		if err := helper.ObjectData(c, chunk); err != nil {
+			logger.LogError(c, "converse stream write error: "+err.Error())
+		}
+	}
+
+	if start := helper.GenerateStartEmptyResponse(responseId, created, model, nil); start != nil {
+		_ = helper.ObjectData(c, start)
+	}
+	for event := range stream.Events() {
+		info.SetFirstResponseTime()
+		switch v := event.(type) {
+		case *bedrockruntimeTypes.ConverseStreamOutputMemberContentBlockStart:
+			toolUse, ok := v.Value.Start.(*bedrockruntimeTypes.ContentBlockStartMemberToolUse)
+			if !ok {
+				continue
+			}
+			index := len(toolCallIndexes)
+			toolCallIndexes[aws.ToInt32(v.Value.ContentBlockIndex)] = index
+			chunk := newChunk()
+			chunk.Choices[0].Delta.ToolCalls = []dto.ToolCallResponse{{
+				Index: common.GetPointer(index),
+				ID:    aws.ToString(toolUse.Value.ToolUseId),
+				Type:  "function",
+				Function: dto.FunctionResponse{
+					Name: aws.ToString(toolUse.Value.Name),
+				},
+			}}
+			sendChunk(chunk)
+		case *bedrockruntimeTypes.ConverseStreamOutputMemberContentBlockDelta:
+			chunk := newChunk()
+			switch delta := v.Value.Delta.(type) {
+			case *bedrockruntimeTypes.ContentBlockDeltaMemberText:
+				if delta.Value == "" {
+					continue
+				}
+				responseText.WriteString(delta.Value)
+				chunk.Choices[0].Delta.SetContentString(delta.Value)
+			case *bedrockruntimeTypes.ContentBlockDeltaMemberReasoningContent:
+				reasoning, ok := delta.Value.(*bedrockruntimeTypes.ReasoningContentBlockDeltaMemberText)
+				if !ok || reasoning.Value == "" {
+					continue
+				}
+				chunk.Choices[0].Delta.SetReasoningContent(reasoning.Value)
+			case *bedrockruntimeTypes.ContentBlockDeltaMemberToolUse:
+				chunk.Choices[0].Delta.ToolCalls = []dto.ToolCallResponse{{
+					Index: common.GetPointer(toolCallIndexes[aws.ToInt32(v.Value.ContentBlockIndex)]),
+					Type:  "function",
+					Function: dto.FunctionResponse{
+						Arguments: aws.ToString(delta.Value.Input),
+					},
+				}}
+			default:
+				continue
+			}
+			sendChunk(chunk)
+		case *bedrockruntimeTypes.ConverseStreamOutputMemberMessageStop:
+			finishReason = converseFinishReason(v.Value.StopReason)
+		case *bedrockruntimeTypes.ConverseStreamOutputMemberMetadata:
+			usage = converseUsage(v.Value.Usage)
+		}
+	}
+	if err := stream.Err(); err != nil {
+		logger.LogError(c, "converse stream error: "+err.Error())
+	}
+
+	usage = completeConverseUsage(usage, responseText.String(), info)
+
+	if stop := helper.GenerateStopResponse(responseId, created, model, finishReason); stop != nil {
+		_ = helper.ObjectData(c, stop)
+	}
+	if info.ShouldIncludeUsage {
+		if final := helper.GenerateFinalUsageResponse(responseId, created, model, *usage); final != nil {
+			_ = helper.ObjectData(c, final)
+		}
+	}
+	helper.Done(c)
+	return nil, usage
+}
@@ -0,0 +1,132 @@
+package aws
+
+import (
+	"io"
+	"net/http"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/dto"
+	relaycommon "github.com/QuantumNous/new-api/relay/common"
+	"github.com/QuantumNous/new-api/service"
+	"github.com/QuantumNous/new-api/types"
+
+	"github.com/gin-gonic/gin"
+	"github.com/pkg/errors"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/bedrockruntime"
+)
+
+// awsEmbeddingRequest 一次嵌入请求对应的 InvokeModel 调用：Titan 每条输入单独调用，Cohere 一次调用处理全部输入
+type awsEmbeddingRequest struct {
+	Inputs []*bedrockruntime.InvokeModelInput
+	Cohere bool
+}
+
+func buildAwsEmbeddingRequest(requestBody io.Reader, awsModelId string) (*awsEmbeddingRequest, error) {
+	var request dto.EmbeddingRequest
+	if err := common.DecodeJson(requestBody, &request); err != nil {
+		return nil, err
+	}
+	inputs := request.ParseInput()
+	if len(inputs) == 0 {
+		return nil, errors.New("input is empty")
+	}
+
+	newInvokeModelInput := func(body any) (*bedrockruntime.InvokeModelInput, error) {
+		data, err := common.Marshal(body)
+		if err != nil {
+			return nil, err
+		}
+		return &bedrockruntime.InvokeModelInput{
+			ModelId:     aws.String(awsModelId),
+			Accept:      aws.String("application/json"),
+			ContentType: aws.String("application/json"),
+			Body:        data,
+		}, nil
+	}
+
+	awsReq := &awsEmbeddingRequest{}
+	switch {
+	case isTitanEmbeddingModel(awsModelId):
+		for _, input := range inputs {
+			titanReq := AwsTitanEmbeddingRequest{InputText: input}
+			// v1 不支持 dimensions 和 normalize 参数
+			if awsModelId != "amazon.titan-embed-text-v1" {
+				titanReq.Dimensions = request.Dimensions
+				titanReq.Normalize = common.GetPointer(true)
+			}
+			invokeInput, err := newInvokeModelInput(titanReq)
+			if err != nil {
+				return nil, err
+			}
+			awsReq.Inputs = append(awsReq.Inputs, invokeInput)
+		}
+	case isCohereEmbeddingModel(awsModelId):
+		invokeInput, err := newInvokeModelInput(AwsCohereEmbeddingRequest{
+			Texts:     inputs,
+			InputType: "search_document",
+			Truncate:  "END",
+		})
+		if err != nil {
+			return nil, err
+		}
+		awsReq.Inputs = append(awsReq.Inputs, invokeInput)
+		awsReq.Cohere = true
+	default:
+		return nil, errors.Errorf("model %s does not support embeddings", awsModelId)
+	}
+	return awsReq, nil
+}
+
+func awsEmbeddingHandler(c *gin.Context, info *relaycommon.RelayInfo, a *Adaptor) (*types.NewAPIError, *dto.Usage) {
+	awsReq := a.AwsReq.(*awsEmbeddingRequest)
+	response := dto.OpenAIEmbeddingResponse{
+		Object: "list",
+		Model:  info.UpstreamModelName,
+	}
+	usage := &dto.Usage{}
+	for _, input := range awsReq.Inputs {
+		awsResp, err := a.AwsClient.InvokeModel(c.Request.Context(), input)
+		if err != nil {
+			return types.NewOpenAIError(errors.Wrap(err, "InvokeModel"), types.ErrorCodeAwsInvokeError, http.StatusInternalServerError), nil
+		}
+		if awsReq.Cohere {
+			var cohereResp AwsCohereEmbeddingResponse
+			if err := common.Unmarshal(awsResp.Body, &cohereResp); err != nil {
+				return types.NewOpenAIError(err, types.ErrorCodeBadResponseBody, http.StatusInternalServerError), nil
+			}
+			for _, embedding := range cohereResp.Embeddings {
+				response.Data = append(response.Data, dto.OpenAIEmbeddingResponseItem{
+					Object:    "embedding",
+					Index:     len(response.Data),
+					Embedding: embedding,
+				})
+			}
+			continue
+		}
+		var titanResp AwsTitanEmbeddingResponse
+		if err := common.Unmarshal(awsResp.Body, &titanResp); err != nil {
+			return types.NewOpenAIError(err, types.ErrorCodeBadResponseBody, http.StatusInternalServerError), nil
+		}
+		response.Data = append(response.Data, dto.OpenAIEmbeddingResponseItem{
+			Object:    "embedding",
+			Index:     len(response.Data),
+			Embedding: titanResp.Embedding,
+		})
+		usage.PromptTokens += titanResp.InputTextTokenCount
+	}
+	// Cohere 不返回 token 用量，按本地估算计费
+	if usage.PromptTokens == 0 {
+		usage.PromptTokens = info.PromptTokens
+	}
+	usage.TotalTokens = usage.PromptTokens
+	response.Usage = *usage
+	jsonResponse, err := common.Marshal(response)
+	if err != nil {
+		return types.NewOpenAIError(err, types.ErrorCodeBadResponseBody, http.StatusInternalServerError), nil
+	}
+	c.Writer.Header().Set("Content-Type", "application/json")
+	service.IOCopyBytesGracefully(c, nil, jsonResponse)
+	return nil, usage
+}
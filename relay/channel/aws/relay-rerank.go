@@ -0,0 +1,138 @@
+package aws
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/dto"
+	relaycommon "github.com/QuantumNous/new-api/relay/common"
+	"github.com/QuantumNous/new-api/service"
+	"github.com/QuantumNous/new-api/types"
+
+	"github.com/gin-gonic/gin"
+	"github.com/pkg/errors"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	v4 "github.com/aws/aws-sdk-go-v2/aws/signer/v4"
+)
+
+// doAwsRerankRequest 调用 Bedrock Agent Runtime 的 Rerank 接口。SDK 未包含该服务，
+// 因此直接发送 HTTP 请求，API Key 使用 Bearer 认证，AK/SK 使用 SigV4 签名
+func doAwsRerankRequest(c *gin.Context, info *relaycommon.RelayInfo, requestBody io.Reader) (*http.Response, error) {
+	secret, err := parseAwsSecret(info.ApiKey)
+	if err != nil {
+		return nil, err
+	}
+	var request dto.RerankRequest
+	if err := common.DecodeJson(requestBody, &request); err != nil {
+		return nil, err
+	}
+
+	awsModelId := getAwsModelID(info.UpstreamModelName)
+	rerankReq := AwsRerankRequest{
+		Queries: []AwsRerankQuery{{
+			Type:      "TEXT",
+			TextQuery: AwsRerankText{Text: request.Query},
+		}},
+		RerankingConfiguration: AwsRerankingConfiguration{
+			Type: "BEDROCK_RERANKING_MODEL",
+			BedrockRerankingConfiguration: AwsBedrockRerankingConfiguration{
+				NumberOfResults: request.TopN,
+				ModelConfiguration: AwsRerankModelConfiguration{
+					ModelArn: fmt.Sprintf("arn:aws:bedrock:%s::foundation-model/%s", secret.Region, awsModelId),
+				},
+			},
+		},
+	}
+	if rerankReq.RerankingConfiguration.BedrockRerankingConfiguration.NumberOfResults <= 0 {
+		rerankReq.RerankingConfiguration.BedrockRerankingConfiguration.NumberOfResults = len(request.Documents)
+	}
+	for _, document := range request.Documents {
+		source := AwsRerankSource{Type: "INLINE"}
+		if text, ok := document.(string); ok {
+			source.InlineDocumentSource = AwsRerankInlineDocument{Type: "TEXT", TextDocument: &AwsRerankText{Text: text}}
+		} else {
+			source.InlineDocumentSource = AwsRerankInlineDocument{Type: "JSON", JsonDocument: document}
+		}
+		rerankReq.Sources = append(rerankReq.Sources, source)
+	}
+	body, err := common.Marshal(rerankReq)
+	if err != nil {
+		return nil, err
+	}
+
+	baseURL := fmt.Sprintf("https://bedrock-agent-runtime.%s.amazonaws.com", secret.Region)
+	if info.ChannelBaseUrl != "" {
+		baseURL = strings.TrimSuffix(info.ChannelBaseUrl, "/")
+	}
+	req, err := http.NewRequestWithContext(c.Request.Context(), http.MethodPost, baseURL+"/rerank", bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Accept", "application/json")
+	if secret.ApiKey != "" {
+		req.Header.Set("Authorization", "Bearer "+secret.ApiKey)
+	} else {
+		payloadHash := sha256.Sum256(body)
+		credentials := aws.Credentials{AccessKeyID: secret.AccessKey, SecretAccessKey: secret.SecretKey}
+		if err := v4.NewSigner().SignHTTP(c.Request.Context(), credentials, req, hex.EncodeToString(payloadHash[:]), "bedrock", secret.Region, time.Now()); err != nil {
+			return nil, errors.Wrap(err, "sign aws rerank request")
+		}
+	}
+
+	httpClient, err := newAwsHttpClient(info)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	return resp, nil
+}
+
+func awsRerankHandler(c *gin.Context, info *relaycommon.RelayInfo, resp *http.Response) (*types.NewAPIError, *dto.Usage) {
+	responseBody, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return types.NewOpenAIError(err, types.ErrorCodeReadResponseBodyFailed, http.StatusInternalServerError), nil
+	}
+	service.CloseResponseBodyGracefully(resp)
+
+	var awsResp AwsRerankResponse
+	if err := common.Unmarshal(responseBody, &awsResp); err != nil {
+		return types.NewOpenAIError(err, types.ErrorCodeBadResponseBody, http.StatusInternalServerError), nil
+	}
+	results := make([]dto.RerankResponseResult, 0, len(awsResp.Results))
+	for _, result := range awsResp.Results {
+		rerankResult := dto.RerankResponseResult{
+			Index:          result.Index,
+			RelevanceScore: result.RelevanceScore,
+		}
+		if info.ReturnDocuments && result.Index >= 0 && result.Index < len(info.Documents) {
+			rerankResult.Document = info.Documents[result.Index]
+		}
+		results = append(results, rerankResult)
+	}
+	rerankResp := dto.RerankResponse{
+		Results: results,
+		Usage: dto.Usage{
+			PromptTokens: info.PromptTokens,
+			TotalTokens:  info.PromptTokens,
+		},
+	}
+	jsonResponse, err := common.Marshal(rerankResp)
+	if err != nil {
+		return types.NewOpenAIError(err, types.ErrorCodeBadResponseBody, http.StatusInternalServerError), nil
+	}
+	c.Writer.Header().Set("Content-Type", "application/json")
+	service.IOCopyBytesGracefully(c, nil, jsonResponse)
+	return nil, &rerankResp.Usage
+}
@@ -10,6 +10,7 @@ import (
 	"github.com/QuantumNous/new-api/relay/channel"
 	"github.com/QuantumNous/new-api/relay/channel/openai"
 	relaycommon "github.com/QuantumNous/new-api/relay/common"
+	"github.com/QuantumNous/new-api/relay/common_handler"
 	relayconstant "github.com/QuantumNous/new-api/relay/constant"
 	"github.com/QuantumNous/new-api/types"
 
@@ -17,6 +18,7 @@ import (
 )
 
 type Adaptor struct {
+	RerankFormat dto.RerankFormat
 }
 
 func (a *Adaptor) ConvertGeminiRequest(*gin.Context, *relaycommon.RelayInfo, *dto.GeminiChatRequest) (any, error) {
@@ -45,12 +47,20 @@ func (a *Adaptor) ConvertImageRequest(c *gin.Context, info *relaycommon.RelayInf
 }
 
 func (a *Adaptor) Init(info *relaycommon.RelayInfo) {
+	a.RerankFormat = info.ChannelOtherSettings.RerankFormat
 }
 
 func (a *Adaptor) GetRequestURL(info *relaycommon.RelayInfo) (string, error) {
 	if info.RelayMode == relayconstant.RelayModeEmbeddings {
 		return info.ChannelBaseUrl + "/api/embed", nil
 	}
+	if info.RelayMode == relayconstant.RelayModeRerank {
+		if requestURL := common_handler.GetRerankRequestURL(info.ChannelBaseUrl, a.RerankFormat); requestURL != "" {
+			return requestURL, nil
+		}
+		// Ollama 官方暂未提供重排序接口，默认按 jina 格式请求提供该接口的分支版本
+		return info.ChannelBaseUrl + "/api/rerank", nil
+	}
 	if strings.Contains(info.RequestURLPath, "/v1/completions") || info.RelayMode == relayconstant.RelayModeCompletions {
 		return info.ChannelBaseUrl + "/api/generate", nil
 	}
@@ -75,7 +85,7 @@ func (a *Adaptor) ConvertOpenAIRequest(c *gin.Context, info *relaycommon.RelayIn
 }
 
 func (a *Adaptor) ConvertRerankRequest(c *gin.Context, relayMode int, request dto.RerankRequest) (any, error) {
-	return nil, nil
+	return common_handler.ConvertRerankRequestByFormat(a.RerankFormat, request), nil
 }
 
 func (a *Adaptor) ConvertEmbeddingRequest(c *gin.Context, info *relaycommon.RelayInfo, request dto.EmbeddingRequest) (any, error) {
@@ -94,6 +104,8 @@ func (a *Adaptor) DoResponse(c *gin.Context, resp *http.Response, info *relaycom
 	switch info.RelayMode {
 	case relayconstant.RelayModeEmbeddings:
 		return ollamaEmbeddingHandler(c, info, resp)
+	case relayconstant.RelayModeRerank:
+		return common_handler.RerankHandler(c, info, resp)
 	default:
 		if info.IsStream {
 			return ollamaStreamHandler(c, info, resp)
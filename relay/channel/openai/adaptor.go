@@ -36,6 +36,7 @@ import (
 type Adaptor struct {
 	ChannelType    int
 	ResponseFormat string
+	RerankFormat   dto.RerankFormat
 }
 
 // parseReasoningEffortFromModelSuffix 从模型名称中解析推理级别
@@ -96,6 +97,7 @@ func (a *Adaptor) ConvertClaudeRequest(c *gin.Context, info *relaycommon.RelayIn
 
 func (a *Adaptor) Init(info *relaycommon.RelayInfo) {
 	a.ChannelType = info.ChannelType
+	a.RerankFormat = info.ChannelOtherSettings.RerankFormat
 
 	// initialize ThinkingContentInfo when thinking_to_content is enabled
 	if info.ChannelSetting.ThinkingToContent {
@@ -119,6 +121,11 @@ func (a *Adaptor) GetRequestURL(info *relaycommon.RelayInfo) (string, error) {
 			info.ChannelBaseUrl = baseUrl
 		}
 	}
+	if info.RelayMode == relayconstant.RelayModeRerank {
+		if requestURL := common_handler.GetRerankRequestURL(info.ChannelBaseUrl, a.RerankFormat); requestURL != "" {
+			return requestURL, nil
+		}
+	}
 	switch info.ChannelType {
 	case constant.ChannelTypeAzure:
 		apiVersion := info.ApiVersion
@@ -335,7 +342,7 @@ func (a *Adaptor) ConvertOpenAIRequest(c *gin.Context, info *relaycommon.RelayIn
 }
 
 func (a *Adaptor) ConvertRerankRequest(c *gin.Context, relayMode int, request dto.RerankRequest) (any, error) {
-	return request, nil
+	return common_handler.ConvertRerankRequestByFormat(a.RerankFormat, request), nil
 }
 
 func (a *Adaptor) ConvertEmbeddingRequest(c *gin.Context, info *relaycommon.RelayInfo, request dto.EmbeddingRequest) (any, error) {
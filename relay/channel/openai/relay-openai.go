@@ -1,6 +1,7 @@
 package openai
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
 	"io"
@@ -11,8 +12,10 @@ import (
 	"github.com/QuantumNous/new-api/constant"
 	"github.com/QuantumNous/new-api/dto"
 	"github.com/QuantumNous/new-api/logger"
+	"github.com/QuantumNous/new-api/model"
 	"github.com/QuantumNous/new-api/relay/channel/openrouter"
 	relaycommon "github.com/QuantumNous/new-api/relay/common"
+	relayconstant "github.com/QuantumNous/new-api/relay/constant"
 	"github.com/QuantumNous/new-api/relay/helper"
 	"github.com/QuantumNous/new-api/service"
 
@@ -374,6 +377,18 @@ func OpenaiTTSHandler(c *gin.Context, resp *http.Response, info *relaycommon.Rel
 	usage := &dto.Usage{}
 	usage.PromptTokens = info.PromptTokens
 	usage.TotalTokens = info.PromptTokens
+	// 开启语音持久化时边转发边缓存，转发完成后再保存。保存可能因空间或大小限制失败，
+	// 因此不提前返回访问链接，保存成功后可在文件列表中获取
+	var mediaAsset *model.MediaAsset
+	var mediaCapture *service.MediaCapture
+	if service.MediaStorageEnabled(model.MediaSourceAudio) {
+		mediaAsset = service.NewMediaAsset(info.UserId, model.MediaSourceAudio, c.GetString(common.RequestIdKey))
+		mediaCapture = service.NewMediaCapture()
+		resp.Body = struct {
+			io.Reader
+			io.Closer
+		}{io.TeeReader(resp.Body, mediaCapture), resp.Body}
+	}
 	for k, v := range resp.Header {
 		c.Writer.Header().Set(k, v[0])
 	}
@@ -389,6 +404,18 @@ func OpenaiTTSHandler(c *gin.Context, resp *http.Response, info *relaycommon.Rel
 			logger.LogError(c, err.Error())
 		}
 	}
+	if mediaAsset != nil {
+		contentType := resp.Header.Get("Content-Type")
+		gopool.Go(func() {
+			data, err := mediaCapture.Bytes()
+			if err == nil {
+				err = service.StoreMediaAsset(context.Background(), mediaAsset, contentType, data)
+			}
+			if err != nil {
+				common.SysError(fmt.Sprintf("failed to persist audio %s: %s", mediaAsset.Key, err.Error()))
+			}
+		})
+	}
 	return usage
 }
 
@@ -664,6 +691,11 @@ func OpenaiHandlerWithUsage(c *gin.Context, info *relaycommon.RelayInfo, resp *h
 		return nil, types.NewOpenAIError(err, types.ErrorCodeBadResponseBody, http.StatusInternalServerError)
 	}
 
+	// 图片生成结果持久化保存后，以网关签名链接替换上游临时链接
+	if info.RelayMode == relayconstant.RelayModeImagesGenerations || info.RelayMode == relayconstant.RelayModeImagesEdits {
+		responseBody = service.PersistImageResponse(c, info.UserId, responseBody)
+	}
+
 	// 写入新的 response body
 	service.IOCopyBytesGracefully(c, resp, responseBody)
 
@@ -0,0 +1,39 @@
+package replay
+
+import (
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/constant"
+	"github.com/QuantumNous/new-api/relay/channel"
+	"github.com/QuantumNous/new-api/relay/channel/openai"
+	relaycommon "github.com/QuantumNous/new-api/relay/common"
+)
+
+// Adaptor 回放渠道使用录制时渠道类型的适配器转换请求和响应，
+// 上游请求在 channel.DoApiRequest 中被替换为读取录制文件，便于离线复现和回归适配器的转换逻辑
+type Adaptor struct {
+	channel.Adaptor
+	// GetAdaptor 按 API 类型获取适配器，由 relay 包注入以避免循环依赖
+	GetAdaptor func(apiType int) channel.Adaptor
+}
+
+func (a *Adaptor) Init(info *relaycommon.RelayInfo) {
+	a.Adaptor = &openai.Adaptor{}
+	if info.ChannelMeta != nil && info.ChannelOtherSettings.Replay != nil && a.GetAdaptor != nil {
+		channelType := info.ChannelOtherSettings.Replay.ChannelType
+		if channelType != constant.ChannelTypeReplay {
+			apiType, _ := common.ChannelType2APIType(channelType)
+			if adaptor := a.GetAdaptor(apiType); adaptor != nil {
+				a.Adaptor = adaptor
+			}
+		}
+	}
+	a.Adaptor.Init(info)
+}
+
+func (a *Adaptor) GetModelList() []string {
+	return ModelList
+}
+
+func (a *Adaptor) GetChannelName() string {
+	return ChannelName
+}
@@ -0,0 +1,6 @@
+package replay
+
+// 回放渠道的模型取决于录制内容，不提供默认模型列表
+var ModelList []string
+
+var ChannelName = "replay"
@@ -0,0 +1,54 @@
+package simulator
+
+import (
+	"errors"
+	"io"
+	"net/http"
+
+	"github.com/QuantumNous/new-api/dto"
+	"github.com/QuantumNous/new-api/relay/channel/openai"
+	relaycommon "github.com/QuantumNous/new-api/relay/common"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Adaptor 模拟渠道沿用 OpenAI 的请求转换和响应处理，只在本地生成上游响应，
+// 因此请求仍会完整经过计费、日志、重试和自动禁用等流程
+type Adaptor struct {
+	openai.Adaptor
+	simulator dto.ChannelSimulator
+}
+
+func (a *Adaptor) Init(info *relaycommon.RelayInfo) {
+	a.Adaptor.Init(info)
+	if info.ChannelMeta != nil && info.ChannelOtherSettings.Simulator != nil {
+		a.simulator = *info.ChannelOtherSettings.Simulator
+	}
+}
+
+func (a *Adaptor) GetRequestURL(info *relaycommon.RelayInfo) (string, error) {
+	return "simulator://local" + info.RequestURLPath, nil
+}
+
+func (a *Adaptor) SetupRequestHeader(c *gin.Context, req *http.Header, info *relaycommon.RelayInfo) error {
+	return nil
+}
+
+func (a *Adaptor) DoRequest(c *gin.Context, info *relaycommon.RelayInfo, requestBody io.Reader) (any, error) {
+	if requestBody == nil {
+		return nil, errors.New("request body is nil")
+	}
+	body, err := io.ReadAll(requestBody)
+	if err != nil {
+		return nil, err
+	}
+	return simulate(c, info, &a.simulator, body, a.ResponseFormat)
+}
+
+func (a *Adaptor) GetModelList() []string {
+	return ModelList
+}
+
+func (a *Adaptor) GetChannelName() string {
+	return ChannelName
+}
@@ -0,0 +1,12 @@
+package simulator
+
+// 默认提供常见模型名，便于直接使用已有的模型倍率进行计费压测
+var ModelList = []string{
+	"gpt-4o-mini",
+	"text-embedding-3-small",
+	"dall-e-3",
+	"tts-1",
+	"whisper-1",
+}
+
+var ChannelName = "simulator"
@@ -0,0 +1,431 @@
+package simulator
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math/rand"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/dto"
+	relaycommon "github.com/QuantumNous/new-api/relay/common"
+	relayconstant "github.com/QuantumNous/new-api/relay/constant"
+	"github.com/QuantumNous/new-api/relay/helper"
+	"github.com/QuantumNous/new-api/types"
+
+	"github.com/gin-gonic/gin"
+	"github.com/tidwall/gjson"
+)
+
+const (
+	defaultOutputTokens        = 64
+	defaultTimeout             = 30 * time.Second
+	defaultEmbeddingDimensions = 1536
+	speechSampleRate           = 24000
+	maxSpeechSeconds           = 30
+	maxEmbeddingDimensions     = 8192
+	maxEmbeddingInputs         = 2048
+	maxImageCount              = 10
+	// 1x1 透明 PNG
+	simulatedImageBase64 = "iVBORw0KGgoAAAANSUhEUgAAAAEAAAABCAQAAAC1HAwCAAAAC0lEQVR42mNkYAAAAAYAAjCB0C8AAAAASUVORK5CYII="
+)
+
+var simulatedWords = strings.Fields("the quick brown fox jumps over a lazy dog while simulated tokens stream through the gateway")
+
+// ValidateSimulator 校验模拟渠道配置，未配置时使用默认值
+func ValidateSimulator(sim *dto.ChannelSimulator) error {
+	if sim == nil {
+		return nil
+	}
+	rates := []float64{sim.RateLimitRate, sim.ServerErrorRate, sim.TimeoutRate, sim.MalformedRate, sim.DisconnectRate}
+	for _, rate := range rates {
+		if rate < 0 || rate > 1 {
+			return errors.New("模拟渠道的错误比例必须在 0 到 1 之间")
+		}
+	}
+	if sim.RateLimitRate+sim.ServerErrorRate+sim.TimeoutRate > 1 || sim.MalformedRate+sim.DisconnectRate > 1 {
+		return errors.New("模拟渠道的请求错误比例之和、流式错误比例之和均不能超过 1")
+	}
+	if sim.TTFTMs < 0 || sim.TokensPerSecond < 0 || sim.OutputTokens < 0 || sim.PromptTokens < 0 || sim.CompletionTokens < 0 || sim.TimeoutMs < 0 {
+		return errors.New("模拟渠道的延迟、速度和用量不能为负数")
+	}
+	return nil
+}
+
+// simulate 按渠道配置在本地生成上游响应，错误注入的各比例互斥，按一次随机数依次判定
+func simulate(c *gin.Context, info *relaycommon.RelayInfo, sim *dto.ChannelSimulator, body []byte, responseFormat string) (*http.Response, error) {
+	ctx := c.Request.Context()
+	roll := rand.Float64()
+	switch {
+	case roll < sim.TimeoutRate:
+		timeout := defaultTimeout
+		if sim.TimeoutMs > 0 {
+			timeout = time.Duration(sim.TimeoutMs) * time.Millisecond
+		}
+		if !sleep(ctx, timeout) {
+			return nil, ctx.Err()
+		}
+		return nil, fmt.Errorf("simulated upstream timeout after %s", timeout)
+	case roll < sim.TimeoutRate+sim.RateLimitRate:
+		return errorResponse(http.StatusTooManyRequests, "rate_limit_error", "rate_limit_exceeded", "simulated rate limit")
+	case roll < sim.TimeoutRate+sim.RateLimitRate+sim.ServerErrorRate:
+		return errorResponse(http.StatusInternalServerError, "server_error", "internal_error", "simulated upstream error")
+	}
+
+	request := gjson.ParseBytes(body)
+	switch {
+	case info.RelayMode == relayconstant.RelayModeChatCompletions, info.RelayMode == relayconstant.RelayModeCompletions,
+		info.RelayFormat == types.RelayFormatClaude, info.RelayFormat == types.RelayFormatGemini:
+		return simulateText(ctx, info, sim, request)
+	case info.RelayMode == relayconstant.RelayModeEmbeddings:
+		return simulateEmbedding(ctx, info, sim, request)
+	case info.RelayMode == relayconstant.RelayModeImagesGenerations, info.RelayMode == relayconstant.RelayModeImagesEdits:
+		return simulateImage(ctx, sim, request)
+	case info.RelayMode == relayconstant.RelayModeAudioSpeech:
+		return simulateSpeech(ctx, sim, request)
+	case info.RelayMode == relayconstant.RelayModeAudioTranscription, info.RelayMode == relayconstant.RelayModeAudioTranslation:
+		return simulateTranscription(ctx, sim, responseFormat)
+	}
+	return errorResponse(http.StatusBadRequest, "invalid_request_error", "unsupported_endpoint", "the simulator does not support this endpoint")
+}
+
+// sleep 等待指定时长，请求被取消时返回 false
+func sleep(ctx context.Context, d time.Duration) bool {
+	if d <= 0 {
+		return true
+	}
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}
+
+func ttft(sim *dto.ChannelSimulator) time.Duration {
+	return time.Duration(sim.TTFTMs) * time.Millisecond
+}
+
+func tokenInterval(sim *dto.ChannelSimulator) time.Duration {
+	if sim.TokensPerSecond <= 0 {
+		return 0
+	}
+	return time.Duration(float64(time.Second) / sim.TokensPerSecond)
+}
+
+func simulatedUsage(info *relaycommon.RelayInfo, sim *dto.ChannelSimulator, completionTokens int) dto.Usage {
+	promptTokens := sim.PromptTokens
+	if promptTokens == 0 {
+		promptTokens = info.PromptTokens
+	}
+	// 嵌入等没有输出的接口不使用输出用量配置
+	if sim.CompletionTokens > 0 && completionTokens > 0 {
+		completionTokens = sim.CompletionTokens
+	}
+	return dto.Usage{
+		PromptTokens:     promptTokens,
+		CompletionTokens: completionTokens,
+		TotalTokens:      promptTokens + completionTokens,
+	}
+}
+
+func simulatedWord(i int) string {
+	word := simulatedWords[i%len(simulatedWords)]
+	if i == 0 {
+		return word
+	}
+	return " " + word
+}
+
+func jsonResponse(statusCode int, v any) (*http.Response, error) {
+	data, err := common.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	return rawResponse(statusCode, "application/json", data), nil
+}
+
+func rawResponse(statusCode int, contentType string, data []byte) *http.Response {
+	header := http.Header{}
+	header.Set("Content-Type", contentType)
+	return &http.Response{
+		StatusCode:    statusCode,
+		Header:        header,
+		Body:          io.NopCloser(bytes.NewReader(data)),
+		ContentLength: int64(len(data)),
+	}
+}
+
+func errorResponse(statusCode int, errorType string, code string, message string) (*http.Response, error) {
+	return jsonResponse(statusCode, gin.H{
+		"error": gin.H{
+			"message": message,
+			"type":    errorType,
+			"code":    code,
+		},
+	})
+}
+
+func simulateText(ctx context.Context, info *relaycommon.RelayInfo, sim *dto.ChannelSimulator, request gjson.Result) (*http.Response, error) {
+	outputTokens := sim.OutputTokens
+	if outputTokens <= 0 {
+		outputTokens = defaultOutputTokens
+	}
+	finishReason := "stop"
+	maxTokens := int(request.Get("max_completion_tokens").Int())
+	if maxTokens == 0 {
+		maxTokens = int(request.Get("max_tokens").Int())
+	}
+	if maxTokens > 0 && maxTokens < outputTokens {
+		outputTokens = maxTokens
+		finishReason = "length"
+	}
+	s := &textSimulation{
+		id:           "chatcmpl-sim-" + common.GetUUID(),
+		created:      common.GetTimestamp(),
+		model:        info.UpstreamModelName,
+		isCompletion: info.RelayMode == relayconstant.RelayModeCompletions,
+		outputTokens: outputTokens,
+		finishReason: finishReason,
+		usage:        simulatedUsage(info, sim, outputTokens),
+	}
+	if !info.IsStream {
+		if !sleep(ctx, ttft(sim)+time.Duration(outputTokens)*tokenInterval(sim)) {
+			return nil, ctx.Err()
+		}
+		return jsonResponse(http.StatusOK, s.fullResponse())
+	}
+	reader, writer := io.Pipe()
+	go s.stream(ctx, sim, writer)
+	header := http.Header{}
+	header.Set("Content-Type", "text/event-stream")
+	return &http.Response{StatusCode: http.StatusOK, Header: header, Body: reader}, nil
+}
+
+type textSimulation struct {
+	id           string
+	created      int64
+	model        string
+	isCompletion bool
+	outputTokens int
+	finishReason string
+	usage        dto.Usage
+}
+
+func (s *textSimulation) object() string {
+	if s.isCompletion {
+		return "text_completion"
+	}
+	return "chat.completion"
+}
+
+func (s *textSimulation) fullResponse() any {
+	var text strings.Builder
+	for i := 0; i < s.outputTokens; i++ {
+		text.WriteString(simulatedWord(i))
+	}
+	if s.isCompletion {
+		return gin.H{
+			"id":      s.id,
+			"object":  s.object(),
+			"created": s.created,
+			"model":   s.model,
+			"choices": []gin.H{{"index": 0, "text": text.String(), "finish_reason": s.finishReason}},
+			"usage":   s.usage,
+		}
+	}
+	choice := dto.OpenAITextResponseChoice{Index: 0, Message: dto.Message{Role: "assistant"}, FinishReason: s.finishReason}
+	choice.Message.SetStringContent(text.String())
+	return dto.OpenAITextResponse{
+		Id:      s.id,
+		Model:   s.model,
+		Object:  s.object(),
+		Created: s.created,
+		Choices: []dto.OpenAITextResponseChoice{choice},
+		Usage:   s.usage,
+	}
+}
+
+func (s *textSimulation) chunk(text string, finishReason *string) any {
+	if s.isCompletion {
+		return gin.H{
+			"id":      s.id,
+			"object":  s.object(),
+			"created": s.created,
+			"model":   s.model,
+			"choices": []gin.H{{"index": 0, "text": text, "finish_reason": finishReason}},
+		}
+	}
+	chunk := helper.GenerateStartEmptyResponse(s.id, s.created, s.model, nil)
+	chunk.Choices[0].Delta.SetContentString(text)
+	chunk.Choices[0].FinishReason = finishReason
+	return chunk
+}
+
+// stream 按首字延迟和输出速度逐个写入数据块，并按配置比例插入无法解析的数据块或中途断开
+func (s *textSimulation) stream(ctx context.Context, sim *dto.ChannelSimulator, writer *io.PipeWriter) {
+	defer writer.Close()
+	malformedAt, disconnectAt := -1, -1
+	roll := rand.Float64()
+	if roll < sim.MalformedRate {
+		malformedAt = rand.Intn(s.outputTokens)
+	} else if roll < sim.MalformedRate+sim.DisconnectRate {
+		disconnectAt = rand.Intn(s.outputTokens)
+	}
+	write := func(data string) bool {
+		_, err := io.WriteString(writer, "data: "+data+"\n\n")
+		return err == nil
+	}
+	writeObject := func(v any) bool {
+		data, err := common.Marshal(v)
+		return err == nil && write(string(data))
+	}
+
+	if !sleep(ctx, ttft(sim)) {
+		writer.CloseWithError(ctx.Err())
+		return
+	}
+	interval := tokenInterval(sim)
+	for i := 0; i < s.outputTokens; i++ {
+		if i > 0 && !sleep(ctx, interval) {
+			writer.CloseWithError(ctx.Err())
+			return
+		}
+		if i == disconnectAt {
+			writer.CloseWithError(io.ErrUnexpectedEOF)
+			return
+		}
+		if i == malformedAt && !write(`{"id":"`+s.id+`","choices":[{"delta":`) {
+			return
+		}
+		if !writeObject(s.chunk(simulatedWord(i), nil)) {
+			return
+		}
+	}
+	finishReason := s.finishReason
+	if !writeObject(s.chunk("", &finishReason)) {
+		return
+	}
+	usage := s.usage
+	if !writeObject(gin.H{
+		"id":      s.id,
+		"object":  s.object(),
+		"created": s.created,
+		"model":   s.model,
+		"choices": []any{},
+		"usage":   &usage,
+	}) {
+		return
+	}
+	write("[DONE]")
+}
+
+func simulateEmbedding(ctx context.Context, info *relaycommon.RelayInfo, sim *dto.ChannelSimulator, request gjson.Result) (*http.Response, error) {
+	if !sleep(ctx, ttft(sim)) {
+		return nil, ctx.Err()
+	}
+	count := 1
+	if input := request.Get("input"); input.IsArray() {
+		items := input.Array()
+		// 数字数组表示单条已分词的输入
+		if len(items) > 0 && items[0].Type != gjson.Number {
+			count = len(items)
+		}
+	}
+	dimensions := int(request.Get("dimensions").Int())
+	if dimensions <= 0 {
+		dimensions = defaultEmbeddingDimensions
+	}
+	if count > maxEmbeddingInputs {
+		return errorResponse(http.StatusBadRequest, "invalid_request_error", "invalid_value", fmt.Sprintf("input must not contain more than %d items", maxEmbeddingInputs))
+	}
+	if dimensions > maxEmbeddingDimensions {
+		return errorResponse(http.StatusBadRequest, "invalid_request_error", "invalid_value", fmt.Sprintf("dimensions must not exceed %d", maxEmbeddingDimensions))
+	}
+	response := dto.EmbeddingResponse{
+		Object: "list",
+		Model:  info.UpstreamModelName,
+		Data:   make([]dto.EmbeddingResponseItem, count),
+		Usage:  simulatedUsage(info, sim, 0),
+	}
+	for i := range response.Data {
+		embedding := make([]float64, dimensions)
+		for j := range embedding {
+			embedding[j] = rand.Float64()*2 - 1
+		}
+		response.Data[i] = dto.EmbeddingResponseItem{Object: "embedding", Index: i, Embedding: embedding}
+	}
+	return jsonResponse(http.StatusOK, response)
+}
+
+func simulateImage(ctx context.Context, sim *dto.ChannelSimulator, request gjson.Result) (*http.Response, error) {
+	if !sleep(ctx, ttft(sim)) {
+		return nil, ctx.Err()
+	}
+	n := int(request.Get("n").Int())
+	if n <= 0 {
+		n = 1
+	}
+	if n > maxImageCount {
+		return errorResponse(http.StatusBadRequest, "invalid_request_error", "invalid_value", fmt.Sprintf("n must not exceed %d", maxImageCount))
+	}
+	response := dto.ImageResponse{Created: common.GetTimestamp(), Data: make([]dto.ImageData, n)}
+	for i := range response.Data {
+		if request.Get("response_format").String() == "b64_json" {
+			response.Data[i].B64Json = simulatedImageBase64
+		} else {
+			response.Data[i].Url = "data:image/png;base64," + simulatedImageBase64
+		}
+	}
+	return jsonResponse(http.StatusOK, response)
+}
+
+// simulateSpeech 按输入长度返回静音的 WAV 音频
+func simulateSpeech(ctx context.Context, sim *dto.ChannelSimulator, request gjson.Result) (*http.Response, error) {
+	if !sleep(ctx, ttft(sim)) {
+		return nil, ctx.Err()
+	}
+	seconds := len([]rune(request.Get("input").String()))/15 + 1
+	if seconds > maxSpeechSeconds {
+		seconds = maxSpeechSeconds
+	}
+	dataSize := seconds * speechSampleRate * 2
+	var buf bytes.Buffer
+	buf.WriteString("RIFF")
+	_ = binary.Write(&buf, binary.LittleEndian, uint32(36+dataSize))
+	buf.WriteString("WAVEfmt ")
+	// PCM 格式、单声道、16 位采样
+	_ = binary.Write(&buf, binary.LittleEndian, struct {
+		ChunkSize     uint32
+		AudioFormat   uint16
+		Channels      uint16
+		SampleRate    uint32
+		ByteRate      uint32
+		BlockAlign    uint16
+		BitsPerSample uint16
+	}{16, 1, 1, speechSampleRate, speechSampleRate * 2, 2, 16})
+	buf.WriteString("data")
+	_ = binary.Write(&buf, binary.LittleEndian, uint32(dataSize))
+	buf.Write(make([]byte, dataSize))
+	return rawResponse(http.StatusOK, "audio/wav", buf.Bytes()), nil
+}
+
+func simulateTranscription(ctx context.Context, sim *dto.ChannelSimulator, responseFormat string) (*http.Response, error) {
+	if !sleep(ctx, ttft(sim)) {
+		return nil, ctx.Err()
+	}
+	text := "this is a simulated transcription"
+	switch responseFormat {
+	case "text", "srt", "vtt":
+		return rawResponse(http.StatusOK, "text/plain; charset=utf-8", []byte(text)), nil
+	}
+	return jsonResponse(http.StatusOK, gin.H{"text": text})
+}
@@ -0,0 +1,120 @@
+package template
+
+import (
+	"errors"
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/QuantumNous/new-api/dto"
+	"github.com/QuantumNous/new-api/relay/channel"
+	"github.com/QuantumNous/new-api/relay/channel/openai"
+	relaycommon "github.com/QuantumNous/new-api/relay/common"
+	"github.com/QuantumNous/new-api/relay/constant"
+	"github.com/QuantumNous/new-api/types"
+
+	"github.com/gin-gonic/gin"
+)
+
+type Adaptor struct {
+	template *dto.ChannelTemplate
+}
+
+func (a *Adaptor) ConvertGeminiRequest(*gin.Context, *relaycommon.RelayInfo, *dto.GeminiChatRequest) (any, error) {
+	return nil, errors.New("not implemented")
+}
+
+func (a *Adaptor) ConvertClaudeRequest(*gin.Context, *relaycommon.RelayInfo, *dto.ClaudeRequest) (any, error) {
+	return nil, errors.New("not implemented")
+}
+
+func (a *Adaptor) ConvertAudioRequest(c *gin.Context, info *relaycommon.RelayInfo, request dto.AudioRequest) (io.Reader, error) {
+	return nil, errors.New("not implemented")
+}
+
+func (a *Adaptor) ConvertImageRequest(c *gin.Context, info *relaycommon.RelayInfo, request dto.ImageRequest) (any, error) {
+	return nil, errors.New("not implemented")
+}
+
+func (a *Adaptor) Init(info *relaycommon.RelayInfo) {
+	if info.ChannelMeta != nil {
+		a.template = info.ChannelOtherSettings.Template
+	}
+}
+
+func (a *Adaptor) GetRequestURL(info *relaycommon.RelayInfo) (string, error) {
+	if a.template == nil {
+		return "", errors.New("channel template is not configured")
+	}
+	if info.RelayMode != constant.RelayModeChatCompletions {
+		return "", errors.New("template channel only supports chat completions")
+	}
+	requestURL := a.template.RequestURL
+	if info.IsStream && a.template.StreamRequestURL != "" {
+		requestURL = a.template.StreamRequestURL
+	}
+	requestURL = strings.ReplaceAll(requestURL, "{base_url}", strings.TrimSuffix(info.ChannelBaseUrl, "/"))
+	requestURL = strings.ReplaceAll(requestURL, "{model}", info.UpstreamModelName)
+	return requestURL, nil
+}
+
+func (a *Adaptor) SetupRequestHeader(c *gin.Context, req *http.Header, info *relaycommon.RelayInfo) error {
+	channel.SetupApiRequestHeader(info, c, req)
+	authHeader := "Authorization"
+	authValue := "Bearer {api_key}"
+	if a.template != nil && a.template.AuthHeader != "" {
+		authHeader = a.template.AuthHeader
+	}
+	if a.template != nil && a.template.AuthValue != "" {
+		authValue = a.template.AuthValue
+	}
+	req.Set(authHeader, strings.ReplaceAll(authValue, "{api_key}", info.ApiKey))
+	return nil
+}
+
+func (a *Adaptor) ConvertOpenAIRequest(c *gin.Context, info *relaycommon.RelayInfo, request *dto.GeneralOpenAIRequest) (any, error) {
+	if request == nil {
+		return nil, errors.New("request is nil")
+	}
+	if a.template == nil || len(a.template.RequestMapping) == 0 {
+		return request, nil
+	}
+	return convertOpenAIRequest(a.template, request)
+}
+
+func (a *Adaptor) ConvertRerankRequest(c *gin.Context, relayMode int, request dto.RerankRequest) (any, error) {
+	return nil, errors.New("not implemented")
+}
+
+func (a *Adaptor) ConvertEmbeddingRequest(c *gin.Context, info *relaycommon.RelayInfo, request dto.EmbeddingRequest) (any, error) {
+	return nil, errors.New("not implemented")
+}
+
+func (a *Adaptor) ConvertOpenAIResponsesRequest(c *gin.Context, info *relaycommon.RelayInfo, request dto.OpenAIResponsesRequest) (any, error) {
+	return nil, errors.New("not implemented")
+}
+
+func (a *Adaptor) DoRequest(c *gin.Context, info *relaycommon.RelayInfo, requestBody io.Reader) (any, error) {
+	return channel.DoApiRequest(a, c, info, requestBody)
+}
+
+func (a *Adaptor) DoResponse(c *gin.Context, resp *http.Response, info *relaycommon.RelayInfo) (usage any, err *types.NewAPIError) {
+	if info.IsStream {
+		if a.template == nil || streamContentPath(a.template) == "" {
+			return openai.OaiStreamHandler(c, info, resp)
+		}
+		return templateStreamHandler(c, info, resp, a.template)
+	}
+	if a.template == nil || a.template.ContentPath == "" {
+		return openai.OpenaiHandler(c, info, resp)
+	}
+	return templateHandler(c, info, resp, a.template)
+}
+
+func (a *Adaptor) GetModelList() []string {
+	return ModelList
+}
+
+func (a *Adaptor) GetChannelName() string {
+	return ChannelName
+}
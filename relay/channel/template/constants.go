@@ -0,0 +1,6 @@
+package template
+
+// 模板渠道的模型由管理员在渠道中自行配置
+var ModelList = []string{}
+
+var ChannelName = "template"
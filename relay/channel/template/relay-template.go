@@ -0,0 +1,335 @@
+package template
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"regexp"
+	"strings"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/dto"
+	"github.com/QuantumNous/new-api/logger"
+	relaycommon "github.com/QuantumNous/new-api/relay/common"
+	"github.com/QuantumNous/new-api/relay/helper"
+	"github.com/QuantumNous/new-api/service"
+	"github.com/QuantumNous/new-api/types"
+
+	"github.com/gin-gonic/gin"
+	"github.com/tidwall/gjson"
+)
+
+const defaultDoneSentinel = "[DONE]"
+
+var placeholderRegex = regexp.MustCompile(`\{\{\s*([^{}]+?)\s*\}\}`)
+
+// ValidateTemplate 校验模板渠道配置
+func ValidateTemplate(template *dto.ChannelTemplate) error {
+	if template == nil {
+		return errors.New("模板渠道必须配置模板")
+	}
+	if template.RequestURL == "" {
+		return errors.New("模板渠道必须配置请求地址")
+	}
+	return nil
+}
+
+// templateVariables 请求模板中以 $ 开头的变量，便于接入只接受单段提示词的上游
+func templateVariables(request *dto.GeneralOpenAIRequest) map[string]string {
+	var prompt, system []string
+	lastUserMessage := ""
+	for i := range request.Messages {
+		message := &request.Messages[i]
+		content := message.StringContent()
+		switch message.Role {
+		case "system", "developer":
+			system = append(system, content)
+		case "user":
+			lastUserMessage = content
+		}
+		prompt = append(prompt, fmt.Sprintf("%s: %s", message.Role, content))
+	}
+	if len(request.Messages) == 0 {
+		if text, ok := request.Prompt.(string); ok {
+			prompt = append(prompt, text)
+			lastUserMessage = text
+		}
+	}
+	return map[string]string{
+		"$prompt":            strings.Join(prompt, "\n"),
+		"$system":            strings.Join(system, "\n"),
+		"$last_user_message": lastUserMessage,
+	}
+}
+
+func convertOpenAIRequest(template *dto.ChannelTemplate, request *dto.GeneralOpenAIRequest) (any, error) {
+	source, err := common.Marshal(request)
+	if err != nil {
+		return nil, err
+	}
+	renderer := &requestRenderer{source: gjson.ParseBytes(source), variables: templateVariables(request)}
+	rendered, _ := renderer.render(template.RequestMapping)
+	return rendered, nil
+}
+
+type requestRenderer struct {
+	source    gjson.Result
+	variables map[string]string
+}
+
+// lookup 返回占位符对应的值，路径不存在时 ok 为 false
+func (r *requestRenderer) lookup(path string) (value gjson.Result, variable string, ok bool) {
+	if strings.HasPrefix(path, "$") {
+		variable, ok = r.variables[path]
+		return gjson.Result{}, variable, ok
+	}
+	value = r.source.Get(path)
+	return value, "", value.Exists()
+}
+
+// render 渲染模板值，整个字符串为单个占位符时保留原类型，取值不存在的字段会被省略
+func (r *requestRenderer) render(value any) (any, bool) {
+	switch v := value.(type) {
+	case map[string]any:
+		rendered := make(map[string]any, len(v))
+		for key, item := range v {
+			if renderedItem, ok := r.render(item); ok {
+				rendered[key] = renderedItem
+			}
+		}
+		return rendered, true
+	case []any:
+		rendered := make([]any, 0, len(v))
+		for _, item := range v {
+			if renderedItem, ok := r.render(item); ok {
+				rendered = append(rendered, renderedItem)
+			}
+		}
+		return rendered, true
+	case string:
+		if match := placeholderRegex.FindStringSubmatch(v); match != nil && match[0] == v {
+			result, variable, ok := r.lookup(match[1])
+			if !ok {
+				return nil, false
+			}
+			if strings.HasPrefix(match[1], "$") {
+				return variable, true
+			}
+			return result.Value(), true
+		}
+		return placeholderRegex.ReplaceAllStringFunc(v, func(placeholder string) string {
+			path := placeholderRegex.FindStringSubmatch(placeholder)[1]
+			result, variable, ok := r.lookup(path)
+			if !ok {
+				return ""
+			}
+			if strings.HasPrefix(path, "$") {
+				return variable
+			}
+			return result.String()
+		}), true
+	}
+	return value, true
+}
+
+func streamContentPath(template *dto.ChannelTemplate) string {
+	return common.GetStringIfEmpty(template.StreamContentPath, template.ContentPath)
+}
+
+func getPathString(result gjson.Result, path string) string {
+	if path == "" {
+		return ""
+	}
+	return result.Get(path).String()
+}
+
+func getPathInt(result gjson.Result, path string) int {
+	if path == "" {
+		return 0
+	}
+	return int(result.Get(path).Int())
+}
+
+// completeUsage 上游未返回用量时按请求和响应文本估算
+func completeUsage(usage *dto.Usage, responseText string, info *relaycommon.RelayInfo) *dto.Usage {
+	if usage.PromptTokens == 0 {
+		usage.PromptTokens = info.PromptTokens
+	}
+	if usage.CompletionTokens == 0 {
+		usage = service.ResponseText2Usage(responseText, info.UpstreamModelName, usage.PromptTokens)
+	}
+	usage.TotalTokens = usage.PromptTokens + usage.CompletionTokens
+	return usage
+}
+
+func templateHandler(c *gin.Context, info *relaycommon.RelayInfo, resp *http.Response, template *dto.ChannelTemplate) (*dto.Usage, *types.NewAPIError) {
+	responseBody, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, types.NewOpenAIError(err, types.ErrorCodeReadResponseBodyFailed, http.StatusInternalServerError)
+	}
+	service.CloseResponseBodyGracefully(resp)
+	if !gjson.ValidBytes(responseBody) {
+		return nil, types.NewOpenAIError(errors.New("invalid response body"), types.ErrorCodeBadResponseBody, http.StatusInternalServerError)
+	}
+	result := gjson.ParseBytes(responseBody)
+	content := getPathString(result, template.ContentPath)
+	usage := &dto.Usage{
+		PromptTokens:     getPathInt(result, template.PromptTokensPath),
+		CompletionTokens: getPathInt(result, template.CompletionTokensPath),
+	}
+	usage = completeUsage(usage, content, info)
+
+	message := dto.Message{Role: "assistant"}
+	message.SetStringContent(content)
+	message.ReasoningContent = getPathString(result, template.ReasoningPath)
+	fullResponse := dto.OpenAITextResponse{
+		Id:      helper.GetResponseID(c),
+		Object:  "chat.completion",
+		Created: common.GetTimestamp(),
+		Model:   info.UpstreamModelName,
+		Choices: []dto.OpenAITextResponseChoice{{
+			Index:        0,
+			Message:      message,
+			FinishReason: common.GetStringIfEmpty(getPathString(result, template.FinishReasonPath), "stop"),
+		}},
+		Usage: *usage,
+	}
+	jsonResponse, err := common.Marshal(fullResponse)
+	if err != nil {
+		return nil, types.NewOpenAIError(err, types.ErrorCodeBadResponseBody, http.StatusInternalServerError)
+	}
+	resp.Header.Set("Content-Type", "application/json")
+	service.IOCopyBytesGracefully(c, resp, jsonResponse)
+	return usage, nil
+}
+
+// splitStream 按模板配置的分隔符切分流式响应，默认按行切分
+func splitStream(delimiter string) bufio.SplitFunc {
+	if delimiter == "" || delimiter == "\n" {
+		return bufio.ScanLines
+	}
+	sep := []byte(delimiter)
+	return func(data []byte, atEOF bool) (advance int, token []byte, err error) {
+		if atEOF && len(data) == 0 {
+			return 0, nil, nil
+		}
+		if i := bytes.Index(data, sep); i >= 0 {
+			return i + len(sep), data[:i], nil
+		}
+		if atEOF {
+			return len(data), data, nil
+		}
+		return 0, nil, nil
+	}
+}
+
+// chunkData 提取数据块中的数据，SSE 事件只保留 data: 行，其余格式按整块处理
+func chunkData(chunk string) string {
+	var dataLines []string
+	for _, line := range strings.Split(chunk, "\n") {
+		if data, ok := strings.CutPrefix(strings.TrimSpace(line), "data:"); ok {
+			dataLines = append(dataLines, strings.TrimSpace(data))
+		}
+	}
+	if len(dataLines) == 0 {
+		return strings.TrimSpace(chunk)
+	}
+	return strings.Join(dataLines, "\n")
+}
+
+func templateStreamHandler(c *gin.Context, info *relaycommon.RelayInfo, resp *http.Response, template *dto.ChannelTemplate) (*dto.Usage, *types.NewAPIError) {
+	if resp == nil || resp.Body == nil {
+		return nil, types.NewOpenAIError(errors.New("empty response"), types.ErrorCodeBadResponse, http.StatusBadRequest)
+	}
+	defer service.CloseResponseBodyGracefully(resp)
+
+	contentPath := streamContentPath(template)
+	reasoningPath := common.GetStringIfEmpty(template.StreamReasoningPath, template.ReasoningPath)
+	finishReasonPath := common.GetStringIfEmpty(template.StreamFinishReasonPath, template.FinishReasonPath)
+	doneSentinel := common.GetStringIfEmpty(template.DoneSentinel, defaultDoneSentinel)
+
+	helper.SetEventStreamHeaders(c)
+	scanner := bufio.NewScanner(resp.Body)
+	scanner.Buffer(make([]byte, helper.InitialScannerBufferSize), helper.MaxScannerBufferSize)
+	scanner.Split(splitStream(template.StreamDelimiter))
+
+	responseId := helper.GetResponseID(c)
+	created := common.GetTimestamp()
+	model := info.UpstreamModelName
+	usage := &dto.Usage{}
+	finishReason := "stop"
+	var responseText strings.Builder
+
+	if start := helper.GenerateStartEmptyResponse(responseId, created, model, nil); start != nil {
+		_ = helper.ObjectData(c, start)
+	}
+	for scanner.Scan() {
+		data := chunkData(scanner.Text())
+		if data == "" {
+			continue
+		}
+		if data == doneSentinel {
+			break
+		}
+		if !gjson.Valid(data) {
+			continue
+		}
+		info.SetFirstResponseTime()
+		chunk := gjson.Parse(data)
+		content := getPathString(chunk, contentPath)
+		reasoning := getPathString(chunk, reasoningPath)
+		if content != "" || reasoning != "" {
+			responseText.WriteString(content)
+			delta := dto.ChatCompletionsStreamResponse{
+				Id:      responseId,
+				Object:  "chat.completion.chunk",
+				Created: created,
+				Model:   model,
+				Choices: []dto.ChatCompletionsStreamResponseChoice{{
+					Index: 0,
+					Delta: dto.ChatCompletionsStreamResponseChoiceDelta{Role: "assistant"},
+				}},
+			}
+			if content != "" {
+				delta.Choices[0].Delta.SetContentString(content)
+			}
+			if reasoning != "" {
+				delta.Choices[0].Delta.SetReasoningContent(reasoning)
+			}
+			if err := helper.ObjectData(c, delta); err != nil {
+				logger.LogError(c, "template stream write error: "+err.Error())
+			}
+		}
+		if reason := getPathString(chunk, finishReasonPath); reason != "" {
+			finishReason = reason
+		}
+		if promptTokens := getPathInt(chunk, template.PromptTokensPath); promptTokens > 0 {
+			usage.PromptTokens = promptTokens
+		}
+		if completionTokens := getPathInt(chunk, template.CompletionTokensPath); completionTokens > 0 {
+			usage.CompletionTokens = completionTokens
+		}
+		if template.DonePath != "" && chunk.Get(template.DonePath).Bool() {
+			break
+		}
+	}
+	if err := scanner.Err(); err != nil && err != io.EOF {
+		logger.LogError(c, "template stream scan error: "+err.Error())
+	}
+
+	usage = completeUsage(usage, responseText.String(), info)
+
+	if stop := helper.GenerateStopResponse(responseId, created, model, finishReason); stop != nil {
+		_ = helper.ObjectData(c, stop)
+	}
+	if info.ShouldIncludeUsage {
+		if final := helper.GenerateFinalUsageResponse(responseId, created, model, *usage); final != nil {
+			_ = helper.ObjectData(c, final)
+		}
+	}
+	helper.Done(c)
+	return usage, nil
+}
@@ -26,6 +26,7 @@ const (
 	RequestModeClaude = 1
 	RequestModeGemini = 2
 	RequestModeLlama  = 3
+	RequestModeRerank = 4
 )
 
 var claudeModelMap = map[string]string{
@@ -74,7 +75,9 @@ func (a *Adaptor) ConvertImageRequest(c *gin.Context, info *relaycommon.RelayInf
 }
 
 func (a *Adaptor) Init(info *relaycommon.RelayInfo) {
-	if strings.HasPrefix(info.UpstreamModelName, "claude") {
+	if info.RelayMode == constant.RelayModeRerank {
+		a.RequestMode = RequestModeRerank
+	} else if strings.HasPrefix(info.UpstreamModelName, "claude") {
 		a.RequestMode = RequestModeClaude
 	} else if strings.Contains(info.UpstreamModelName, "llama") ||
 		// open source models
@@ -206,6 +209,8 @@ func (a *Adaptor) GetRequestURL(info *relaycommon.RelayInfo) (string, error) {
 		return a.getRequestUrl(info, model, suffix)
 	} else if a.RequestMode == RequestModeLlama {
 		return a.getRequestUrl(info, "", "")
+	} else if a.RequestMode == RequestModeRerank {
+		return a.getRankRequestUrl(info)
 	}
 	return "", errors.New("unsupported request mode")
 }
@@ -309,7 +314,7 @@ func (a *Adaptor) ConvertOpenAIRequest(c *gin.Context, info *relaycommon.RelayIn
 }
 
 func (a *Adaptor) ConvertRerankRequest(c *gin.Context, relayMode int, request dto.RerankRequest) (any, error) {
-	return nil, nil
+	return convertRerankRequest(request), nil
 }
 
 func (a *Adaptor) ConvertEmbeddingRequest(c *gin.Context, info *relaycommon.RelayInfo, request dto.EmbeddingRequest) (any, error) {
@@ -327,6 +332,9 @@ func (a *Adaptor) DoRequest(c *gin.Context, info *relaycommon.RelayInfo, request
 }
 
 func (a *Adaptor) DoResponse(c *gin.Context, resp *http.Response, info *relaycommon.RelayInfo) (usage any, err *types.NewAPIError) {
+	if a.RequestMode == RequestModeRerank {
+		return vertexRerankHandler(c, info, resp)
+	}
 	if info.IsStream {
 		switch a.RequestMode {
 		case RequestModeClaude:
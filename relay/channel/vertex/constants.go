@@ -10,6 +10,10 @@ var ModelList = []string{
 	//"gemini-1.5-pro-001", "gemini-1.5-flash-001", "gemini-pro", "gemini-pro-vision",
 
 	"meta/llama3-405b-instruct-maas",
+
+	"semantic-ranker-default@latest",
+	"semantic-ranker-default-004",
+	"semantic-ranker-fast-004",
 }
 
 var ChannelName = "vertex-ai"
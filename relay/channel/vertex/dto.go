@@ -35,3 +35,22 @@ func copyRequest(req *dto.ClaudeRequest, version string) *VertexAIClaudeRequest
 		Thinking:         req.Thinking,
 	}
 }
+
+// VertexRankRequest Discovery Engine 排序接口请求
+type VertexRankRequest struct {
+	Model                         string             `json:"model,omitempty"`
+	Query                         string             `json:"query"`
+	Records                       []VertexRankRecord `json:"records"`
+	TopN                          int                `json:"topN,omitempty"`
+	IgnoreRecordDetailsInResponse bool               `json:"ignoreRecordDetailsInResponse"`
+}
+
+type VertexRankRecord struct {
+	Id      string  `json:"id"`
+	Content string  `json:"content,omitempty"`
+	Score   float64 `json:"score,omitempty"`
+}
+
+type VertexRankResponse struct {
+	Records []VertexRankRecord `json:"records"`
+}
@@ -0,0 +1,89 @@
+package vertex
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/dto"
+	relaycommon "github.com/QuantumNous/new-api/relay/common"
+	"github.com/QuantumNous/new-api/relay/common_handler"
+	"github.com/QuantumNous/new-api/service"
+	"github.com/QuantumNous/new-api/types"
+
+	"github.com/gin-gonic/gin"
+)
+
+// getRankRequestUrl 返回 Discovery Engine 默认排序配置的地址，该接口仅支持服务账号认证
+func (a *Adaptor) getRankRequestUrl(info *relaycommon.RelayInfo) (string, error) {
+	if info.ChannelOtherSettings.VertexKeyType == dto.VertexKeyTypeAPIKey {
+		return "", errors.New("vertex ranking api requires service account credentials")
+	}
+	adc := &Credentials{}
+	if err := common.Unmarshal([]byte(info.ApiKey), adc); err != nil {
+		return "", fmt.Errorf("failed to decode credentials file: %w", err)
+	}
+	a.AccountCredentials = *adc
+	return fmt.Sprintf(
+		"https://discoveryengine.googleapis.com/v1/projects/%s/locations/global/rankingConfigs/default_ranking_config:rank",
+		adc.ProjectID,
+	), nil
+}
+
+func convertRerankRequest(request dto.RerankRequest) *VertexRankRequest {
+	rankReq := &VertexRankRequest{
+		Model:                         request.Model,
+		Query:                         request.Query,
+		TopN:                          request.TopN,
+		IgnoreRecordDetailsInResponse: true,
+	}
+	// 记录 id 使用文档下标，便于按下标还原结果
+	for i, text := range common_handler.GetRerankDocumentTexts(request.Documents) {
+		rankReq.Records = append(rankReq.Records, VertexRankRecord{
+			Id:      strconv.Itoa(i),
+			Content: text,
+		})
+	}
+	return rankReq
+}
+
+func vertexRerankHandler(c *gin.Context, info *relaycommon.RelayInfo, resp *http.Response) (*dto.Usage, *types.NewAPIError) {
+	responseBody, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, types.NewOpenAIError(err, types.ErrorCodeReadResponseBodyFailed, http.StatusInternalServerError)
+	}
+	service.CloseResponseBodyGracefully(resp)
+
+	var rankResp VertexRankResponse
+	if err := common.Unmarshal(responseBody, &rankResp); err != nil {
+		return nil, types.NewOpenAIError(err, types.ErrorCodeBadResponseBody, http.StatusInternalServerError)
+	}
+	results := make([]dto.RerankResponseResult, 0, len(rankResp.Records))
+	for _, record := range rankResp.Records {
+		index, err := strconv.Atoi(record.Id)
+		if err != nil {
+			return nil, types.NewOpenAIError(fmt.Errorf("invalid record id: %s", record.Id), types.ErrorCodeBadResponseBody, http.StatusInternalServerError)
+		}
+		results = append(results, dto.RerankResponseResult{
+			Index:          index,
+			RelevanceScore: record.Score,
+		})
+	}
+	// 排序接口不返回 token 用量，按本地估算计费
+	rerankResp := dto.RerankResponse{
+		Results: common_handler.NormalizeRerankResults(info, results),
+		Usage: dto.Usage{
+			PromptTokens: info.PromptTokens,
+			TotalTokens:  info.PromptTokens,
+		},
+	}
+	jsonResponse, err := common.Marshal(rerankResp)
+	if err != nil {
+		return nil, types.NewOpenAIError(err, types.ErrorCodeBadResponseBody, http.StatusInternalServerError)
+	}
+	service.IOCopyBytesGracefully(c, resp, jsonResponse)
+	return &rerankResp.Usage, nil
+}
@@ -0,0 +1,115 @@
+package common
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/QuantumNous/new-api/constant"
+
+	"github.com/gin-gonic/gin"
+)
+
+// HedgeRace 一次对冲请求中主请求与对冲请求之间的竞争，先收到上游响应的一方胜出
+type HedgeRace struct {
+	mu        sync.Mutex
+	threshold time.Duration
+	winner    *HedgeAttempt
+	attempts  []*HedgeAttempt
+	claimed   chan struct{}
+}
+
+// HedgeAttempt 参与竞争的单个请求，Ctx 在另一方胜出后会被取消
+type HedgeAttempt struct {
+	race      *HedgeRace
+	ChannelId int
+	Ctx       context.Context
+	cancel    context.CancelFunc
+}
+
+func NewHedgeRace(threshold time.Duration) *HedgeRace {
+	return &HedgeRace{threshold: threshold, claimed: make(chan struct{})}
+}
+
+// NewAttempt 基于 parent 创建一个可被取消的请求，若已有请求胜出则直接取消
+func (r *HedgeRace) NewAttempt(parent context.Context, channelId int) *HedgeAttempt {
+	ctx, cancel := context.WithCancel(parent)
+	attempt := &HedgeAttempt{race: r, ChannelId: channelId, Ctx: ctx, cancel: cancel}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.attempts = append(r.attempts, attempt)
+	if r.winner != nil {
+		cancel()
+	}
+	return attempt
+}
+
+// Claimed 在有请求胜出后关闭
+func (r *HedgeRace) Claimed() <-chan struct{} {
+	return r.claimed
+}
+
+func (r *HedgeRace) Winner() *HedgeAttempt {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.winner
+}
+
+// Info 返回用于记录到日志 admin_info 的对冲信息，未发起对冲请求时返回 nil
+func (r *HedgeRace) Info() map[string]interface{} {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if len(r.attempts) < 2 {
+		return nil
+	}
+	channels := make([]int, 0, len(r.attempts))
+	for _, attempt := range r.attempts {
+		channels = append(channels, attempt.ChannelId)
+	}
+	info := map[string]interface{}{
+		"channels":     channels,
+		"threshold_ms": r.threshold.Milliseconds(),
+	}
+	if r.winner != nil {
+		info["winner_channel"] = r.winner.ChannelId
+	}
+	return info
+}
+
+// Claim 尝试成为胜出方，成功时取消其他请求；已有其他请求胜出时返回 false
+func (a *HedgeAttempt) Claim() bool {
+	r := a.race
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.winner != nil {
+		return r.winner == a
+	}
+	r.winner = a
+	close(r.claimed)
+	for _, attempt := range r.attempts {
+		if attempt != a {
+			attempt.cancel()
+		}
+	}
+	return true
+}
+
+// Race 返回请求所属的竞争
+func (a *HedgeAttempt) Race() *HedgeRace {
+	return a.race
+}
+
+// Release 释放请求占用的资源，应在请求结束后调用
+func (a *HedgeAttempt) Release() {
+	a.cancel()
+}
+
+// GetHedgeAttempt 返回当前上下文所属的对冲请求，未启用对冲时返回 nil
+func GetHedgeAttempt(c *gin.Context) *HedgeAttempt {
+	if v, ok := c.Get(string(constant.ContextKeyHedgeAttempt)); ok {
+		if attempt, ok := v.(*HedgeAttempt); ok {
+			return attempt
+		}
+	}
+	return nil
+}
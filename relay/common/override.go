@@ -38,7 +38,7 @@ func ApplyParamOverride(jsonData []byte, paramOverride map[string]interface{}) (
 	// 尝试断言为操作格式
 	if operations, ok := tryParseOperations(paramOverride); ok {
 		// 使用新方法
-		result, err := applyOperations(string(jsonData), operations)
+		result, err := applyOperations(string(jsonData), operations, false)
 		return []byte(result), err
 	}
 
@@ -304,7 +304,8 @@ func applyOperationsLegacy(jsonData []byte, paramOverride map[string]interface{}
 	return json.Marshal(reqMap)
 }
 
-func applyOperations(jsonStr string, operations []ParamOperation) (string, error) {
+// applyOperations 依次执行操作，lenient 为 true 时跳过源路径或目标路径不存在的 move、prepend、append
+func applyOperations(jsonStr string, operations []ParamOperation, lenient bool) (string, error) {
 	result := jsonStr
 	for _, op := range operations {
 		// 检查条件是否满足
@@ -319,6 +320,9 @@ func applyOperations(jsonStr string, operations []ParamOperation) (string, error
 		opPath := processNegativeIndex(result, op.Path)
 		opFrom := processNegativeIndex(result, op.From)
 		opTo := processNegativeIndex(result, op.To)
+		if lenient && skipMissingPath(result, op.Mode, opPath, opFrom) {
+			continue
+		}
 
 		switch op.Mode {
 		case "delete":
@@ -344,6 +348,16 @@ func applyOperations(jsonStr string, operations []ParamOperation) (string, error
 	return result, nil
 }
 
+func skipMissingPath(jsonStr, mode, path, fromPath string) bool {
+	switch mode {
+	case "move":
+		return !gjson.Get(jsonStr, fromPath).Exists()
+	case "prepend", "append":
+		return !gjson.Get(jsonStr, path).Exists()
+	}
+	return false
+}
+
 func moveValue(jsonStr, fromPath, toPath string) (string, error) {
 	sourceValue := gjson.Get(jsonStr, fromPath)
 	if !sourceValue.Exists() {
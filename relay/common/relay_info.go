@@ -4,6 +4,7 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
+	"maps"
 	"strings"
 	"time"
 
@@ -41,6 +42,7 @@ type ClaudeConvertInfo struct {
 type RerankerInfo struct {
 	Documents       []any
 	ReturnDocuments bool
+	TopN            int
 }
 
 type BuildInToolInfo struct {
@@ -80,6 +82,7 @@ type RelayInfo struct {
 	UsingGroup        string // 使用的分组
 	UserGroup         string // 用户所在分组
 	TokenUnlimited    bool
+	TokenRemainQuota  int // 鉴权时令牌的剩余额度，仅限额令牌有效
 	StartTime         time.Time
 	FirstResponseTime time.Time
 	isFirstResponse   bool
@@ -298,6 +301,7 @@ func GenRelayInfoRerank(c *gin.Context, request *dto.RerankRequest) *RelayInfo {
 	info.RerankerInfo = &RerankerInfo{
 		Documents:       request.Documents,
 		ReturnDocuments: request.GetReturnDocuments(),
+		TopN:            request.TopN,
 	}
 	return info
 }
@@ -393,9 +397,10 @@ func genBaseRelayInfo(c *gin.Context, request dto.Request) *RelayInfo {
 		OriginModelName: common.GetContextKeyString(c, constant.ContextKeyOriginalModel),
 		PromptTokens:    common.GetContextKeyInt(c, constant.ContextKeyPromptTokens),
 
-		TokenId:        common.GetContextKeyInt(c, constant.ContextKeyTokenId),
-		TokenKey:       common.GetContextKeyString(c, constant.ContextKeyTokenKey),
-		TokenUnlimited: common.GetContextKeyBool(c, constant.ContextKeyTokenUnlimited),
+		TokenId:          common.GetContextKeyInt(c, constant.ContextKeyTokenId),
+		TokenKey:         common.GetContextKeyString(c, constant.ContextKeyTokenKey),
+		TokenUnlimited:   common.GetContextKeyBool(c, constant.ContextKeyTokenUnlimited),
+		TokenRemainQuota: c.GetInt("token_quota"),
 
 		isFirstResponse: true,
 		RelayMode:       relayconstant.Path2RelayMode(c.Request.URL.Path),
@@ -478,6 +483,43 @@ func (info *RelayInfo) HasSendResponse() bool {
 	return info.FirstResponseTime.After(info.StartTime)
 }
 
+// Clone 复制 relayInfo 及其可变的嵌套字段，供并发执行的请求各自修改
+func (info *RelayInfo) Clone() *RelayInfo {
+	clone := *info
+	clone.PriceData.OtherRatios = maps.Clone(info.PriceData.OtherRatios)
+	if info.ChannelMeta != nil {
+		channelMeta := *info.ChannelMeta
+		channelMeta.ParamOverride = maps.Clone(info.ChannelMeta.ParamOverride)
+		channelMeta.HeadersOverride = maps.Clone(info.ChannelMeta.HeadersOverride)
+		clone.ChannelMeta = &channelMeta
+	}
+	if info.ClaudeConvertInfo != nil {
+		claudeConvertInfo := *info.ClaudeConvertInfo
+		if info.ClaudeConvertInfo.Usage != nil {
+			usage := *info.ClaudeConvertInfo.Usage
+			claudeConvertInfo.Usage = &usage
+		}
+		clone.ClaudeConvertInfo = &claudeConvertInfo
+	}
+	if info.RerankerInfo != nil {
+		rerankerInfo := *info.RerankerInfo
+		clone.RerankerInfo = &rerankerInfo
+	}
+	if info.ResponsesUsageInfo != nil {
+		builtInTools := make(map[string]*BuildInToolInfo, len(info.ResponsesUsageInfo.BuiltInTools))
+		for name, tool := range info.ResponsesUsageInfo.BuiltInTools {
+			toolInfo := *tool
+			builtInTools[name] = &toolInfo
+		}
+		clone.ResponsesUsageInfo = &ResponsesUsageInfo{BuiltInTools: builtInTools}
+	}
+	if info.TaskRelayInfo != nil {
+		taskRelayInfo := *info.TaskRelayInfo
+		clone.TaskRelayInfo = &taskRelayInfo
+	}
+	return &clone
+}
+
 type TaskRelayInfo struct {
 	Action       string
 	OriginTaskID string
@@ -0,0 +1,71 @@
+package common
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/constant"
+	"github.com/QuantumNous/new-api/logger"
+
+	"github.com/gin-gonic/gin"
+	"github.com/tidwall/gjson"
+)
+
+// 响应覆盖中字符串值可使用的变量
+const ResponseOverrideVarOriginalModel = "{{original_model}}"
+
+// ApplyResponseOverride 对响应体或单个流式数据块应用响应覆盖，格式与参数覆盖相同。
+// 流式数据块往往只包含部分字段，因此 move、prepend、append 的路径不存在时直接跳过
+func ApplyResponseOverride(jsonData []byte, responseOverride map[string]interface{}, originalModel string) ([]byte, error) {
+	if len(responseOverride) == 0 {
+		return jsonData, nil
+	}
+	if operations, ok := tryParseOperations(responseOverride); ok {
+		for i := range operations {
+			operations[i].Value = resolveResponseOverrideValue(operations[i].Value, originalModel)
+		}
+		result, err := applyOperations(string(jsonData), operations, true)
+		return []byte(result), err
+	}
+	legacy := make(map[string]interface{}, len(responseOverride))
+	for key, value := range responseOverride {
+		legacy[key] = resolveResponseOverrideValue(value, originalModel)
+	}
+	return applyOperationsLegacy(jsonData, legacy)
+}
+
+func resolveResponseOverrideValue(value interface{}, originalModel string) interface{} {
+	switch v := value.(type) {
+	case string:
+		return strings.ReplaceAll(v, ResponseOverrideVarOriginalModel, originalModel)
+	case []interface{}:
+		resolved := make([]interface{}, len(v))
+		for i, item := range v {
+			resolved[i] = resolveResponseOverrideValue(item, originalModel)
+		}
+		return resolved
+	case map[string]interface{}:
+		resolved := make(map[string]interface{}, len(v))
+		for key, item := range v {
+			resolved[key] = resolveResponseOverrideValue(item, originalModel)
+		}
+		return resolved
+	}
+	return value
+}
+
+// ApplyChannelResponseOverride 按当前渠道的响应覆盖改写将要返回给客户端的 JSON 数据，
+// 非 JSON 数据或改写失败时原样返回，避免影响已完成的上游请求
+func ApplyChannelResponseOverride(c *gin.Context, data []byte) []byte {
+	responseOverride := common.GetContextKeyStringMap(c, constant.ContextKeyChannelResponseOverride)
+	if len(responseOverride) == 0 || !gjson.ValidBytes(data) {
+		return data
+	}
+	result, err := ApplyResponseOverride(data, responseOverride, common.GetContextKeyString(c, constant.ContextKeyOriginalModel))
+	if err != nil {
+		logger.LogWarn(c, fmt.Sprintf("failed to apply response override: %s", err.Error()))
+		return data
+	}
+	return result
+}
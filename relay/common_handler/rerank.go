@@ -25,7 +25,18 @@ func RerankHandler(c *gin.Context, info *relaycommon.RelayInfo, resp *http.Respo
 		println("reranker response body: ", string(responseBody))
 	}
 	var jinaResp dto.RerankResponse
-	if info.ChannelType == constant.ChannelTypeXinference {
+	if format := info.ChannelOtherSettings.RerankFormat; format == dto.RerankFormatTEI || format == dto.RerankFormatVllmScore {
+		var rerankResp *dto.RerankResponse
+		if format == dto.RerankFormatTEI {
+			rerankResp, err = parseTeiRerankResponse(info, responseBody)
+		} else {
+			rerankResp, err = parseVllmScoreResponse(info, responseBody)
+		}
+		if err != nil {
+			return nil, types.NewOpenAIError(err, types.ErrorCodeBadResponseBody, http.StatusInternalServerError)
+		}
+		jinaResp = *rerankResp
+	} else if info.ChannelType == constant.ChannelTypeXinference {
 		var xinRerankResponse xinference.XinRerankResponse
 		err = common.Unmarshal(responseBody, &xinRerankResponse)
 		if err != nil {
@@ -66,6 +77,10 @@ func RerankHandler(c *gin.Context, info *relaycommon.RelayInfo, resp *http.Respo
 		if err != nil {
 			return nil, types.NewOpenAIError(err, types.ErrorCodeBadResponseBody, http.StatusInternalServerError)
 		}
+		// 部分自托管服务不返回用量，按本地估算计费
+		if jinaResp.Usage.TotalTokens == 0 {
+			jinaResp.Usage.TotalTokens = info.PromptTokens
+		}
 		jinaResp.Usage.PromptTokens = jinaResp.Usage.TotalTokens
 	}
 
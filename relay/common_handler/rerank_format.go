@@ -0,0 +1,165 @@
+package common_handler
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/dto"
+	relaycommon "github.com/QuantumNous/new-api/relay/common"
+)
+
+// TeiRerankRequest HuggingFace Text Embeddings Inference 的 /rerank 请求
+type TeiRerankRequest struct {
+	Query    string   `json:"query"`
+	Texts    []string `json:"texts"`
+	Truncate bool     `json:"truncate"`
+}
+
+type TeiRerankResult struct {
+	Index int     `json:"index"`
+	Score float64 `json:"score"`
+	Text  string  `json:"text,omitempty"`
+}
+
+// VllmScoreRequest vLLM 的 /v1/score 请求，text_1 为查询，text_2 为待打分的文档
+type VllmScoreRequest struct {
+	Model string   `json:"model"`
+	Text1 string   `json:"text_1"`
+	Text2 []string `json:"text_2"`
+}
+
+type VllmScoreResponse struct {
+	Data []struct {
+		Index int     `json:"index"`
+		Score float64 `json:"score"`
+	} `json:"data"`
+	Usage *dto.Usage `json:"usage,omitempty"`
+}
+
+// GetRerankRequestURL 返回 TEI、vLLM 格式的重排序地址，jina 格式返回空字符串，由调用方沿用原有地址
+func GetRerankRequestURL(baseUrl string, format dto.RerankFormat) string {
+	baseUrl = strings.TrimSuffix(baseUrl, "/")
+	switch format {
+	case dto.RerankFormatTEI:
+		return baseUrl + "/rerank"
+	case dto.RerankFormatVllmScore:
+		return baseUrl + "/v1/score"
+	}
+	return ""
+}
+
+// ConvertRerankRequestByFormat 按上游格式转换重排序请求，jina 格式原样返回
+func ConvertRerankRequestByFormat(format dto.RerankFormat, request dto.RerankRequest) any {
+	switch format {
+	case dto.RerankFormatTEI:
+		return TeiRerankRequest{
+			Query:    request.Query,
+			Texts:    GetRerankDocumentTexts(request.Documents),
+			Truncate: true,
+		}
+	case dto.RerankFormatVllmScore:
+		return VllmScoreRequest{
+			Model: request.Model,
+			Text1: request.Query,
+			Text2: GetRerankDocumentTexts(request.Documents),
+		}
+	}
+	return request
+}
+
+// GetRerankDocumentTexts 将文档转换为纯文本，支持字符串和 {"text": ...} 对象，其余类型序列化为 JSON
+func GetRerankDocumentTexts(documents []any) []string {
+	texts := make([]string, 0, len(documents))
+	for _, document := range documents {
+		switch doc := document.(type) {
+		case string:
+			texts = append(texts, doc)
+			continue
+		case map[string]any:
+			if text, ok := doc["text"].(string); ok {
+				texts = append(texts, text)
+				continue
+			}
+		}
+		data, err := common.Marshal(document)
+		if err != nil {
+			texts = append(texts, fmt.Sprintf("%v", document))
+			continue
+		}
+		texts = append(texts, string(data))
+	}
+	return texts
+}
+
+// NormalizeRerankResults 将上游结果按相关度降序排列并截取 top_n，需要时按下标回填原始文档
+func NormalizeRerankResults(info *relaycommon.RelayInfo, results []dto.RerankResponseResult) []dto.RerankResponseResult {
+	sort.SliceStable(results, func(i, j int) bool {
+		return results[i].RelevanceScore > results[j].RelevanceScore
+	})
+	if info.RerankerInfo == nil {
+		return results
+	}
+	if info.TopN > 0 && len(results) > info.TopN {
+		results = results[:info.TopN]
+	}
+	for i := range results {
+		if !info.ReturnDocuments {
+			results[i].Document = nil
+			continue
+		}
+		if results[i].Document == nil && results[i].Index >= 0 && results[i].Index < len(info.Documents) {
+			results[i].Document = info.Documents[results[i].Index]
+		}
+	}
+	return results
+}
+
+func parseTeiRerankResponse(info *relaycommon.RelayInfo, responseBody []byte) (*dto.RerankResponse, error) {
+	var teiResults []TeiRerankResult
+	if err := common.Unmarshal(responseBody, &teiResults); err != nil {
+		return nil, err
+	}
+	results := make([]dto.RerankResponseResult, 0, len(teiResults))
+	for _, result := range teiResults {
+		results = append(results, dto.RerankResponseResult{
+			Index:          result.Index,
+			RelevanceScore: result.Score,
+		})
+	}
+	// TEI 不返回用量，按本地估算计费
+	return &dto.RerankResponse{
+		Results: NormalizeRerankResults(info, results),
+		Usage: dto.Usage{
+			PromptTokens: info.PromptTokens,
+			TotalTokens:  info.PromptTokens,
+		},
+	}, nil
+}
+
+func parseVllmScoreResponse(info *relaycommon.RelayInfo, responseBody []byte) (*dto.RerankResponse, error) {
+	var vllmResp VllmScoreResponse
+	if err := common.Unmarshal(responseBody, &vllmResp); err != nil {
+		return nil, err
+	}
+	results := make([]dto.RerankResponseResult, 0, len(vllmResp.Data))
+	for _, item := range vllmResp.Data {
+		results = append(results, dto.RerankResponseResult{
+			Index:          item.Index,
+			RelevanceScore: item.Score,
+		})
+	}
+	usage := dto.Usage{
+		PromptTokens: info.PromptTokens,
+		TotalTokens:  info.PromptTokens,
+	}
+	if vllmResp.Usage != nil && vllmResp.Usage.PromptTokens > 0 {
+		usage.PromptTokens = vllmResp.Usage.PromptTokens
+		usage.TotalTokens = vllmResp.Usage.PromptTokens
+	}
+	return &dto.RerankResponse{
+		Results: NormalizeRerankResults(info, results),
+		Usage:   usage,
+	}, nil
+}
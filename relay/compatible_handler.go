@@ -379,6 +379,9 @@ func postConsumeQuota(ctx *gin.Context, relayInfo *relaycommon.RelayInfo, usage
 		}
 		model.UpdateUserUsedQuotaAndRequestCount(relayInfo.UserId, quota)
 		model.UpdateChannelUsedQuota(relayInfo.ChannelId, quota)
+		if relayInfo.ChannelIsMultiKey {
+			model.RecordChannelKeyTokens(relayInfo.ChannelId, relayInfo.ChannelMultiKeyIndex, totalTokens)
+		}
 	}
 
 	quotaDelta := quota - relayInfo.FinalPreConsumedQuota
@@ -0,0 +1,261 @@
+package relay
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math"
+	"net/http"
+	"sort"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/constant"
+	"github.com/QuantumNous/new-api/dto"
+	relaycommon "github.com/QuantumNous/new-api/relay/common"
+	"github.com/QuantumNous/new-api/service"
+	"github.com/QuantumNous/new-api/types"
+
+	"github.com/gin-gonic/gin"
+	"golang.org/x/sync/errgroup"
+)
+
+// 同一请求的子批次最多同时发送的数量
+const embeddingBatchConcurrency = 4
+
+// 各渠道类型单次嵌入请求的最大输入条数，渠道未配置 embedding_batch_size 时使用
+var embeddingDefaultBatchSizes = map[int]int{
+	constant.ChannelTypeOpenAI: 2048,
+	constant.ChannelTypeAzure:  2048,
+	constant.ChannelTypeCohere: 96,
+	constant.ChannelTypeAws:    96,
+	constant.ChannelTypeGemini: 100,
+	constant.ChannelTypeAli:    10,
+	constant.ChannelTypeBaidu:  16,
+}
+
+// embeddingPlan 网关对嵌入请求的额外处理：拆分子批次、截断维度、在本地编码 base64
+type embeddingPlan struct {
+	batchSize    int // 大于 0 时按该条数拆分 input
+	dimensions   int // 大于 0 时将向量截断到该维度并重新归一化
+	encodeBase64 bool
+}
+
+// newEmbeddingPlan 根据渠道能力判断是否需要网关处理，无需处理时返回 nil，请求原样转发
+func newEmbeddingPlan(info *relaycommon.RelayInfo, request *dto.EmbeddingRequest) *embeddingPlan {
+	settings := info.ChannelOtherSettings
+	plan := &embeddingPlan{}
+	batchSize := settings.EmbeddingBatchSize
+	if batchSize == 0 {
+		batchSize = embeddingDefaultBatchSizes[info.ChannelType]
+	}
+	if inputs, ok := request.Input.([]any); ok && batchSize > 0 && len(inputs) > batchSize && isEmbeddingInputList(inputs) {
+		plan.batchSize = batchSize
+	}
+	if request.Dimensions > 0 && settings.EmbeddingNoDimensions {
+		plan.dimensions = request.Dimensions
+	}
+	// 截断维度需要浮点向量，此时同样由网关编码 base64
+	if request.EncodingFormat == "base64" && (settings.EmbeddingNoBase64 || plan.dimensions > 0) {
+		plan.encodeBase64 = true
+	}
+	if plan.batchSize == 0 && plan.dimensions == 0 && !plan.encodeBase64 {
+		return nil
+	}
+	return plan
+}
+
+// isEmbeddingInputList 判断 input 是否为多条输入（字符串或 token 数组的列表），单条 token 数组不能拆分
+func isEmbeddingInputList(inputs []any) bool {
+	for _, input := range inputs {
+		switch input.(type) {
+		case string, []any:
+		default:
+			return false
+		}
+	}
+	return true
+}
+
+func (p *embeddingPlan) splitInput(input any) []any {
+	inputs, ok := input.([]any)
+	if !ok || p.batchSize <= 0 || len(inputs) <= p.batchSize || !isEmbeddingInputList(inputs) {
+		return []any{input}
+	}
+	batches := make([]any, 0, (len(inputs)+p.batchSize-1)/p.batchSize)
+	for start := 0; start < len(inputs); start += p.batchSize {
+		batches = append(batches, inputs[start:min(start+p.batchSize, len(inputs))])
+	}
+	return batches
+}
+
+// processEmbedding 按计划截断并归一化向量，需要时编码为 base64（float32 小端序，与 OpenAI 一致）
+func (p *embeddingPlan) processEmbedding(embedding any) (any, error) {
+	if p.dimensions == 0 && !p.encodeBase64 {
+		return embedding, nil
+	}
+	values, ok := embedding.([]any)
+	if !ok {
+		return nil, fmt.Errorf("unexpected embedding type %T", embedding)
+	}
+	vector := make([]float64, 0, len(values))
+	for _, value := range values {
+		number, ok := value.(float64)
+		if !ok {
+			return nil, fmt.Errorf("unexpected embedding value type %T", value)
+		}
+		vector = append(vector, number)
+	}
+	if p.dimensions > 0 && len(vector) > p.dimensions {
+		// Matryoshka 表示学习的向量前若干维可单独使用，截断后需重新归一化
+		vector = vector[:p.dimensions]
+		var norm float64
+		for _, value := range vector {
+			norm += value * value
+		}
+		if norm = math.Sqrt(norm); norm > 0 {
+			for i := range vector {
+				vector[i] /= norm
+			}
+		}
+	}
+	if !p.encodeBase64 {
+		return vector, nil
+	}
+	data := make([]byte, 4*len(vector))
+	for i, value := range vector {
+		binary.LittleEndian.PutUint32(data[4*i:], math.Float32bits(float32(value)))
+	}
+	return base64.StdEncoding.EncodeToString(data), nil
+}
+
+// relayEmbeddingBatches 将请求拆分为子批次并发发送到同一渠道，按顺序合并结果后统一处理维度和编码
+func relayEmbeddingBatches(c *gin.Context, info *relaycommon.RelayInfo, request *dto.EmbeddingRequest, plan *embeddingPlan) *types.NewAPIError {
+	upstreamRequest := *request
+	if plan.dimensions > 0 {
+		upstreamRequest.Dimensions = 0
+	}
+	if plan.encodeBase64 {
+		upstreamRequest.EncodingFormat = ""
+	}
+	batches := plan.splitInput(upstreamRequest.Input)
+	responses := make([]*dto.FlexibleEmbeddingResponse, len(batches))
+
+	g, ctx := errgroup.WithContext(c.Request.Context())
+	g.SetLimit(embeddingBatchConcurrency)
+	for i, input := range batches {
+		g.Go(func() error {
+			batchRequest := upstreamRequest
+			batchRequest.Input = input
+			response, newAPIError := doEmbeddingBatch(c, ctx, info, &batchRequest, len(batches) > 1)
+			if newAPIError != nil {
+				return newAPIError
+			}
+			responses[i] = response
+			return nil
+		})
+	}
+	if err := g.Wait(); err != nil {
+		settled := settleFailedEmbeddingBatches(c, info, responses)
+		var newAPIError *types.NewAPIError
+		if !errors.As(err, &newAPIError) {
+			newAPIError = types.NewOpenAIError(err, types.ErrorCodeDoRequestFailed, http.StatusInternalServerError)
+		}
+		if settled {
+			// 已按成功的子批次结算，重试会重新发送全部子批次并再次计费，因此不再重试
+			if types.IsChannelError(newAPIError) {
+				newAPIError = types.NewErrorWithStatusCode(newAPIError.Err, types.ErrorCodeDoRequestFailed, newAPIError.StatusCode, types.ErrOptionWithSkipRetry())
+			} else {
+				types.ErrOptionWithSkipRetry()(newAPIError)
+			}
+		}
+		return newAPIError
+	}
+
+	merged := dto.FlexibleEmbeddingResponse{Object: "list", Model: responses[0].Model}
+	if merged.Model == "" {
+		merged.Model = info.UpstreamModelName
+	}
+	usage := &dto.Usage{}
+	offset := 0
+	for i, response := range responses {
+		for _, item := range response.Data {
+			embedding, err := plan.processEmbedding(item.Embedding)
+			if err != nil {
+				return types.NewOpenAIError(err, types.ErrorCodeBadResponseBody, http.StatusInternalServerError)
+			}
+			item.Index += offset
+			item.Embedding = embedding
+			merged.Data = append(merged.Data, item)
+		}
+		if inputs, ok := batches[i].([]any); ok {
+			offset += len(inputs)
+		} else {
+			offset += len(response.Data)
+		}
+		usage.PromptTokens += response.Usage.PromptTokens
+		usage.TotalTokens += response.Usage.TotalTokens
+	}
+	sort.SliceStable(merged.Data, func(i, j int) bool {
+		return merged.Data[i].Index < merged.Data[j].Index
+	})
+	merged.Usage = *usage
+	data, err := common.Marshal(merged)
+	if err != nil {
+		return types.NewOpenAIError(err, types.ErrorCodeBadResponseBody, http.StatusInternalServerError)
+	}
+	c.Writer.Header().Set("Content-Type", "application/json")
+	service.IOCopyBytesGracefully(c, nil, data)
+	postConsumeQuota(c, info, usage, "")
+	return nil
+}
+
+// settleFailedEmbeddingBatches 部分子批次失败时按已成功子批次的用量结算，上游已产生的费用不随失败返还。
+// 返回是否已结算
+func settleFailedEmbeddingBatches(c *gin.Context, info *relaycommon.RelayInfo, responses []*dto.FlexibleEmbeddingResponse) bool {
+	usage := &dto.Usage{}
+	for _, response := range responses {
+		if response == nil {
+			continue
+		}
+		usage.PromptTokens += response.Usage.PromptTokens
+		usage.TotalTokens += response.Usage.TotalTokens
+	}
+	if usage.TotalTokens == 0 {
+		return false
+	}
+	postConsumeQuota(c, info, usage, "部分子批次失败，按成功的子批次计费")
+	// 预扣费已在结算中抵扣，避免请求失败后再次返还
+	info.FinalPreConsumedQuota = 0
+	return true
+}
+
+// doEmbeddingBatch 在独立的上下文中发送一个子批次并捕获适配器输出，split 为 true 时按子批次重新估算输入用量
+func doEmbeddingBatch(c *gin.Context, ctx context.Context, info *relaycommon.RelayInfo, request *dto.EmbeddingRequest, split bool) (*dto.FlexibleEmbeddingResponse, *types.NewAPIError) {
+	writer := newRealtimeCaptureWriter(nil)
+	subCtx := c.Copy()
+	subCtx.Request = c.Request.Clone(ctx)
+	subCtx.Writer = writer
+
+	// 适配器可能修改渠道信息，各子批次使用独立的副本
+	batchInfo := *info
+	channelMeta := *info.ChannelMeta
+	batchInfo.ChannelMeta = &channelMeta
+	if split {
+		batchInfo.PromptTokens = service.CountTokenInput(request.Input, info.UpstreamModelName)
+	}
+	adaptor := GetAdaptor(info.ApiType)
+	adaptor.Init(&batchInfo)
+
+	usage, newAPIError := doEmbeddingRequest(subCtx, &batchInfo, adaptor, request)
+	if newAPIError != nil {
+		return nil, newAPIError
+	}
+	var response dto.FlexibleEmbeddingResponse
+	if err := common.Unmarshal(writer.Bytes(), &response); err != nil {
+		return nil, types.NewOpenAIError(err, types.ErrorCodeBadResponseBody, http.StatusInternalServerError)
+	}
+	response.Usage = *usage
+	return &response, nil
+}
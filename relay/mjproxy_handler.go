@@ -22,6 +22,7 @@ import (
 	"github.com/QuantumNous/new-api/setting"
 	"github.com/QuantumNous/new-api/setting/system_setting"
 
+	"github.com/bytedance/gopkg/util/gopool"
 	"github.com/gin-gonic/gin"
 )
 
@@ -34,6 +35,12 @@ func RelayMidjourneyImage(c *gin.Context) {
 		})
 		return
 	}
+	// 已持久化保存的图片直接从存储返回，不再依赖上游图片链接
+	if asset, err := model.GetMediaAssetBySource(model.MediaSourceMidjourney, midjourneyTask.MjId); err == nil && asset != nil {
+		if err := service.ServeMediaAsset(c, asset); err == nil {
+			return
+		}
+	}
 	var httpClient *http.Client
 	if channel, err := model.CacheGetChannel(midjourneyTask.ChannelId); err == nil {
 		proxy := channel.GetSetting().Proxy
@@ -119,6 +126,16 @@ func RelayMidjourneyNotify(c *gin.Context) *dto.MidjourneyResponse {
 			Description: "update_midjourney_task_failed",
 		}
 	}
+	if midjourneyTask.Status == "SUCCESS" {
+		gopool.Go(func() {
+			service.PersistMidjourneyImage(midjourneyTask)
+		})
+	}
+	if midjourneyTask.Status == "SUCCESS" || midjourneyTask.Status == "FAILURE" {
+		gopool.Go(func() {
+			service.NotifyMidjourneyWebhook(midjourneyTask)
+		})
+	}
 
 	return nil
 }
@@ -0,0 +1,1063 @@
+package relay
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"mime/multipart"
+	"net"
+	"net/http"
+	"slices"
+	"strings"
+	"sync"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/constant"
+	"github.com/QuantumNous/new-api/dto"
+	"github.com/QuantumNous/new-api/logger"
+	"github.com/QuantumNous/new-api/middleware"
+	relaycommon "github.com/QuantumNous/new-api/relay/common"
+	"github.com/QuantumNous/new-api/relay/helper"
+	"github.com/QuantumNous/new-api/service"
+	"github.com/QuantumNous/new-api/setting/model_setting"
+	"github.com/QuantumNous/new-api/types"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gorilla/websocket"
+)
+
+// 上游原生支持 Realtime WebSocket 的渠道类型，其余渠道的实时请求由网关模拟
+var realtimeUpstreamChannels = map[int]bool{
+	constant.ChannelTypeOpenAI: true,
+	constant.ChannelTypeAzure:  true,
+}
+
+const (
+	// Realtime 协议的 pcm16 音频为 24kHz 单声道 16 位小端
+	realtimePcm16SampleRate = 24000
+	// 每个 response.audio.delta 事件携带 0.5 秒音频
+	realtimeAudioChunkSize = realtimePcm16SampleRate
+)
+
+func shouldEmulateRealtime(info *relaycommon.RelayInfo) bool {
+	if !model_setting.GetRealtimeEmulationSettings().Enabled {
+		return false
+	}
+	return info.ChannelOtherSettings.RealtimeEmulation || !realtimeUpstreamChannels[info.ChannelType]
+}
+
+type realtimeEmulator struct {
+	c    *gin.Context
+	info *relaycommon.RelayInfo
+
+	writeLock sync.Mutex
+
+	session     dto.RealtimeSession
+	items       []dto.RealtimeItem
+	audioBuffer []byte
+	sumUsage    *dto.RealtimeUsage
+
+	cancelLock     sync.Mutex
+	cancelResponse context.CancelFunc
+}
+
+// RealtimeEmulationHelper 在客户端 WebSocket 上实现 Realtime 事件协议，每次 response.create 转换为一次流式对话补全，
+// 语音输入通过转写模型转为文本，语音输出通过语音合成模型生成
+func RealtimeEmulationHelper(c *gin.Context, info *relaycommon.RelayInfo) *types.NewAPIError {
+	if GetAdaptor(info.ApiType) == nil {
+		return types.NewError(fmt.Errorf("invalid api type: %d", info.ApiType), types.ErrorCodeInvalidApiType, types.ErrOptionWithSkipRetry())
+	}
+	info.IsStream = true
+	settings := model_setting.GetRealtimeEmulationSettings()
+	e := &realtimeEmulator{
+		c:    c,
+		info: info,
+		session: dto.RealtimeSession{
+			Modalities:              []string{"text"},
+			Voice:                   settings.DefaultVoice,
+			InputAudioFormat:        info.InputAudioFormat,
+			OutputAudioFormat:       info.OutputAudioFormat,
+			InputAudioTranscription: dto.InputAudioTranscription{Model: settings.TranscriptionModel},
+			ToolChoice:              "auto",
+		},
+		sumUsage: &dto.RealtimeUsage{},
+	}
+	if err := e.send(&dto.RealtimeEvent{Type: dto.RealtimeEventTypeSessionCreated, Session: e.sessionSnapshot()}); err != nil {
+		return types.NewError(err, types.ErrorCodeBadResponse)
+	}
+	logger.LogInfo(c, fmt.Sprintf("realtime emulation started, channel type: %d, model: %s", info.ChannelType, info.OriginModelName))
+
+	events := make(chan *dto.RealtimeEvent, 64)
+	go e.readClient(events)
+	for event := range events {
+		if err := e.handleEvent(event); err != nil {
+			logger.LogError(c, "realtime emulation error: "+err.Error())
+			break
+		}
+	}
+	e.cancelCurrentResponse()
+
+	service.PostWssConsumeQuota(c, info, info.UpstreamModelName, e.sumUsage, "实时接口模拟")
+	return nil
+}
+
+// readClient 读取客户端事件，response.cancel 需要在响应生成期间处理，因此直接取消当前响应
+func (e *realtimeEmulator) readClient(events chan<- *dto.RealtimeEvent) {
+	defer close(events)
+	for {
+		_, message, err := e.info.ClientWs.ReadMessage()
+		if err != nil {
+			if !websocket.IsCloseError(err, websocket.CloseNormalClosure, websocket.CloseGoingAway) {
+				logger.LogError(e.c, "error reading from client: "+err.Error())
+			}
+			e.cancelCurrentResponse()
+			return
+		}
+		event := &dto.RealtimeEvent{}
+		if err := common.Unmarshal(message, event); err != nil {
+			_ = e.sendError("invalid_json", "invalid event: "+err.Error())
+			continue
+		}
+		if event.Type == dto.RealtimeEventTypeResponseCancel {
+			e.cancelCurrentResponse()
+			continue
+		}
+		events <- event
+	}
+}
+
+func (e *realtimeEmulator) handleEvent(event *dto.RealtimeEvent) error {
+	switch event.Type {
+	case dto.RealtimeEventTypeSessionUpdate:
+		if event.Session != nil {
+			e.updateSession(event.Session)
+		}
+		return e.send(&dto.RealtimeEvent{Type: dto.RealtimeEventTypeSessionUpdated, Session: e.sessionSnapshot()})
+	case dto.RealtimeEventTypeConversationCreate:
+		return e.createItem(event)
+	case dto.RealtimeEventTypeConversationDelete:
+		for i, item := range e.items {
+			if item.Id == event.ItemId {
+				e.items = append(e.items[:i], e.items[i+1:]...)
+				return e.send(&dto.RealtimeEvent{Type: dto.RealtimeEventConversationItemDeleted, ItemId: event.ItemId})
+			}
+		}
+		return e.sendError("item_not_found", fmt.Sprintf("item %s does not exist", event.ItemId))
+	case dto.RealtimeEventInputAudioBufferAppend:
+		audio, err := base64.StdEncoding.DecodeString(event.Audio)
+		if err != nil {
+			return e.sendError("invalid_audio", "audio must be base64 encoded")
+		}
+		e.audioBuffer = append(e.audioBuffer, audio...)
+		return nil
+	case dto.RealtimeEventInputAudioBufferCommit:
+		return e.commitAudioBuffer(event)
+	case dto.RealtimeEventInputAudioBufferClear:
+		e.audioBuffer = nil
+		return e.send(&dto.RealtimeEvent{Type: dto.RealtimeEventInputAudioBufferCleared})
+	case dto.RealtimeEventTypeResponseCreate:
+		return e.createResponse(event.Response)
+	default:
+		return e.sendError("unsupported_event", fmt.Sprintf("event type %s is not supported in realtime emulation", event.Type))
+	}
+}
+
+// updateSession 合并 session.update 中给出的字段；模拟模式不做语音活动检测，由客户端提交音频缓冲区
+func (e *realtimeEmulator) updateSession(session *dto.RealtimeSession) {
+	if session.Modalities != nil {
+		e.session.Modalities = session.Modalities
+	}
+	if session.Instructions != "" {
+		e.session.Instructions = session.Instructions
+	}
+	if session.Voice != "" {
+		e.session.Voice = session.Voice
+	}
+	if session.InputAudioFormat != "" {
+		e.session.InputAudioFormat = session.InputAudioFormat
+	}
+	if session.OutputAudioFormat != "" {
+		e.session.OutputAudioFormat = session.OutputAudioFormat
+	}
+	if session.InputAudioTranscription.Model != "" {
+		e.session.InputAudioTranscription = session.InputAudioTranscription
+	}
+	if session.Tools != nil {
+		e.session.Tools = session.Tools
+		e.info.RealtimeTools = session.Tools
+	}
+	if session.ToolChoice != "" {
+		e.session.ToolChoice = session.ToolChoice
+	}
+	if session.Temperature > 0 {
+		e.session.Temperature = session.Temperature
+	}
+}
+
+func (e *realtimeEmulator) sessionSnapshot() *dto.RealtimeSession {
+	session := e.session
+	session.TurnDetection = nil
+	return &session
+}
+
+func (e *realtimeEmulator) createItem(event *dto.RealtimeEvent) error {
+	if event.Item == nil {
+		return e.sendError("missing_item", "item is required")
+	}
+	item := *event.Item
+	if item.Type == "" {
+		item.Type = "message"
+	}
+	switch item.Type {
+	case "message":
+		if item.Role != "user" && item.Role != "assistant" && item.Role != "system" {
+			return e.sendError("invalid_role", fmt.Sprintf("invalid item role: %s", item.Role))
+		}
+	case "function_call", "function_call_output":
+		if item.CallId == "" {
+			return e.sendError("missing_call_id", "call_id is required for function call items")
+		}
+	default:
+		return e.sendError("invalid_item_type", fmt.Sprintf("invalid item type: %s", item.Type))
+	}
+
+	// 音频内容需转写为文本后才能交给对话模型
+	var audios [][]byte
+	content := make([]dto.RealtimeContent, len(item.Content))
+	copy(content, item.Content)
+	item.Content = content
+	for i := range item.Content {
+		if item.Content[i].Audio == "" {
+			continue
+		}
+		audio, err := base64.StdEncoding.DecodeString(item.Content[i].Audio)
+		if err != nil {
+			return e.sendError("invalid_audio", "audio must be base64 encoded")
+		}
+		item.Content[i].Audio = ""
+		if item.Content[i].Transcript == "" {
+			audios = append(audios, audio)
+		}
+	}
+	if err := e.appendItem(item); err != nil {
+		return err
+	}
+	for i, audio := range audios {
+		if err := e.transcribeItem(item.Id, i, audio); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (e *realtimeEmulator) appendItem(item dto.RealtimeItem) error {
+	if item.Id == "" {
+		item.Id = "item_" + common.GetRandomString(20)
+	}
+	item.Object = "realtime.item"
+	item.Status = "completed"
+	previousItemId := ""
+	if len(e.items) > 0 {
+		previousItemId = e.items[len(e.items)-1].Id
+	}
+	e.items = append(e.items, item)
+	return e.send(&dto.RealtimeEvent{Type: dto.RealtimeEventConversationItemCreated, PreviousItemId: previousItemId, Item: &item})
+}
+
+func (e *realtimeEmulator) commitAudioBuffer(event *dto.RealtimeEvent) error {
+	if len(e.audioBuffer) == 0 {
+		return e.sendError("input_audio_buffer_commit_empty", "input audio buffer is empty")
+	}
+	audio := e.audioBuffer
+	e.audioBuffer = nil
+	item := dto.RealtimeItem{
+		Id:      "item_" + common.GetRandomString(20),
+		Type:    "message",
+		Role:    "user",
+		Content: []dto.RealtimeContent{{Type: "input_audio"}},
+	}
+	previousItemId := ""
+	if len(e.items) > 0 {
+		previousItemId = e.items[len(e.items)-1].Id
+	}
+	if err := e.send(&dto.RealtimeEvent{Type: dto.RealtimeEventInputAudioBufferCommitted, PreviousItemId: previousItemId, ItemId: item.Id}); err != nil {
+		return err
+	}
+	if err := e.appendItem(item); err != nil {
+		return err
+	}
+	return e.transcribeItem(item.Id, 0, audio)
+}
+
+// transcribeItem 转写消息中第 index 段音频，结果写回会话中的对应内容
+func (e *realtimeEmulator) transcribeItem(itemId string, index int, audio []byte) error {
+	transcript, err := e.transcribe(audio)
+	if err != nil {
+		logger.LogError(e.c, "realtime emulation transcription failed: "+err.Error())
+		return e.send(&dto.RealtimeEvent{
+			Type:         dto.RealtimeEventInputAudioTranscriptionFailed,
+			ItemId:       itemId,
+			ContentIndex: common.GetPointer(index),
+			Error:        &types.OpenAIError{Message: err.Error(), Type: "transcription_error"},
+		})
+	}
+	for i := range e.items {
+		if e.items[i].Id != itemId {
+			continue
+		}
+		audioIndex := 0
+		for j := range e.items[i].Content {
+			if e.items[i].Content[j].Type != "input_audio" {
+				continue
+			}
+			if audioIndex == index {
+				e.items[i].Content[j].Transcript = transcript
+				break
+			}
+			audioIndex++
+		}
+	}
+	return e.send(&dto.RealtimeEvent{
+		Type:         dto.RealtimeEventInputAudioTranscriptionCompleted,
+		ItemId:       itemId,
+		ContentIndex: common.GetPointer(index),
+		Transcript:   transcript,
+	})
+}
+
+func (e *realtimeEmulator) createResponse(options *dto.RealtimeResponse) error {
+	modalities := e.session.Modalities
+	instructions := e.session.Instructions
+	voice := e.session.Voice
+	if options != nil {
+		if options.Modalities != nil {
+			modalities = options.Modalities
+		}
+		if options.Instructions != "" {
+			instructions = options.Instructions
+		}
+		if options.Voice != "" {
+			voice = options.Voice
+		}
+	}
+
+	builder := &realtimeResponseBuilder{
+		e:          e,
+		responseId: "resp_" + common.GetRandomString(20),
+		withAudio:  slices.Contains(modalities, "audio"),
+	}
+	if err := e.send(&dto.RealtimeEvent{Type: dto.RealtimeEventResponseCreated, Response: &dto.RealtimeResponse{
+		Id:     builder.responseId,
+		Object: "realtime.response",
+		Status: "in_progress",
+	}}); err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithCancel(e.c.Request.Context())
+	e.cancelLock.Lock()
+	e.cancelResponse = cancel
+	e.cancelLock.Unlock()
+	defer func() {
+		e.cancelLock.Lock()
+		e.cancelResponse = nil
+		e.cancelLock.Unlock()
+		cancel()
+	}()
+
+	status := "completed"
+	usage, newAPIError := e.streamCompletion(ctx, builder, instructions)
+	if builder.sendErr != nil {
+		return builder.sendErr
+	}
+	if ctx.Err() != nil {
+		status = "cancelled"
+		if usage == nil {
+			usage = builder.estimateUsage()
+		}
+	} else if newAPIError != nil {
+		status = "failed"
+		logger.LogError(e.c, "realtime emulation completion failed: "+newAPIError.Error())
+		if err := e.sendError(string(newAPIError.GetErrorCode()), newAPIError.Error()); err != nil {
+			return err
+		}
+	}
+
+	var audio []byte
+	if builder.withAudio && status == "completed" && builder.text.Len() > 0 {
+		var err error
+		audio, err = e.synthesize(ctx, builder.text.String(), voice)
+		if err != nil {
+			logger.LogError(e.c, "realtime emulation speech synthesis failed: "+err.Error())
+			if err := e.sendError("speech_synthesis_failed", err.Error()); err != nil {
+				return err
+			}
+		}
+	}
+	if err := builder.finish(audio, status); err != nil {
+		return err
+	}
+	e.items = append(e.items, builder.outputs...)
+
+	realtimeUsage := &dto.RealtimeUsage{}
+	if usage != nil {
+		realtimeUsage.InputTokens = usage.PromptTokens
+		realtimeUsage.OutputTokens = usage.CompletionTokens
+		realtimeUsage.TotalTokens = usage.PromptTokens + usage.CompletionTokens
+		realtimeUsage.InputTokenDetails.TextTokens = usage.PromptTokens
+		realtimeUsage.InputTokenDetails.CachedTokens = usage.PromptTokensDetails.CachedTokens
+		realtimeUsage.OutputTokenDetails.TextTokens = usage.CompletionTokens
+	}
+	if err := e.send(&dto.RealtimeEvent{Type: dto.RealtimeEventTypeResponseDone, Response: &dto.RealtimeResponse{
+		Id:     builder.responseId,
+		Object: "realtime.response",
+		Status: status,
+		Output: builder.outputs,
+		Usage:  realtimeUsage,
+	}}); err != nil {
+		return err
+	}
+	if realtimeUsage.TotalTokens == 0 {
+		return nil
+	}
+	return e.consumeUsage(realtimeUsage)
+}
+
+// consumeUsage 与上游实时接口一致，每次响应完成后立即扣费，会话结束时统一记录日志
+func (e *realtimeEmulator) consumeUsage(usage *dto.RealtimeUsage) error {
+	e.sumUsage.TotalTokens += usage.TotalTokens
+	e.sumUsage.InputTokens += usage.InputTokens
+	e.sumUsage.OutputTokens += usage.OutputTokens
+	e.sumUsage.InputTokenDetails.TextTokens += usage.InputTokenDetails.TextTokens
+	e.sumUsage.InputTokenDetails.CachedTokens += usage.InputTokenDetails.CachedTokens
+	e.sumUsage.OutputTokenDetails.TextTokens += usage.OutputTokenDetails.TextTokens
+	if err := service.PreWssConsumeQuota(e.c, e.info, usage); err != nil {
+		_ = e.sendError("insufficient_quota", err.Error())
+		return err
+	}
+	return nil
+}
+
+func (e *realtimeEmulator) cancelCurrentResponse() {
+	e.cancelLock.Lock()
+	defer e.cancelLock.Unlock()
+	if e.cancelResponse != nil {
+		e.cancelResponse()
+	}
+}
+
+func (e *realtimeEmulator) send(event *dto.RealtimeEvent) error {
+	if event.EventId == "" {
+		event.EventId = "event_" + common.GetRandomString(20)
+	}
+	e.writeLock.Lock()
+	defer e.writeLock.Unlock()
+	return helper.WssObject(e.c, e.info.ClientWs, event)
+}
+
+func (e *realtimeEmulator) sendError(code string, message string) error {
+	return e.send(&dto.RealtimeEvent{
+		Type: dto.RealtimeEventTypeError,
+		Error: &types.OpenAIError{
+			Message: message,
+			Type:    "invalid_request_error",
+			Code:    code,
+		},
+	})
+}
+
+// buildMessages 将会话中的条目转换为对话消息，连续的函数调用合并到同一条 assistant 消息中
+func (e *realtimeEmulator) buildMessages(instructions string) []dto.Message {
+	messages := make([]dto.Message, 0, len(e.items)+1)
+	if instructions == "" {
+		instructions = e.info.ChannelSetting.SystemPrompt
+	}
+	if instructions != "" {
+		messages = append(messages, dto.Message{Role: "system", Content: instructions})
+	}
+	var toolCalls []dto.ToolCallRequest
+	flushToolCalls := func() {
+		if len(toolCalls) == 0 {
+			return
+		}
+		last := len(messages) - 1
+		if last >= 0 && messages[last].Role == "assistant" && len(messages[last].ToolCalls) == 0 {
+			messages[last].SetToolCalls(toolCalls)
+		} else {
+			message := dto.Message{Role: "assistant", Content: ""}
+			message.SetToolCalls(toolCalls)
+			messages = append(messages, message)
+		}
+		toolCalls = nil
+	}
+	for _, item := range e.items {
+		if item.Type == "function_call" {
+			name := ""
+			if item.Name != nil {
+				name = *item.Name
+			}
+			toolCalls = append(toolCalls, dto.ToolCallRequest{
+				ID:       item.CallId,
+				Type:     "function",
+				Function: dto.FunctionRequest{Name: name, Arguments: item.Arguments},
+			})
+			continue
+		}
+		flushToolCalls()
+		switch item.Type {
+		case "message":
+			parts := make([]string, 0, len(item.Content))
+			for _, content := range item.Content {
+				if content.Text != "" {
+					parts = append(parts, content.Text)
+				} else if content.Transcript != "" {
+					parts = append(parts, content.Transcript)
+				}
+			}
+			messages = append(messages, dto.Message{Role: item.Role, Content: strings.Join(parts, "\n")})
+		case "function_call_output":
+			messages = append(messages, dto.Message{Role: "tool", ToolCallId: item.CallId, Content: item.Output})
+		}
+	}
+	flushToolCalls()
+	return messages
+}
+
+// streamCompletion 按普通的流式对话补全请求调用渠道适配器，适配器写出的 OpenAI 流式数据由 builder 转换为实时事件
+func (e *realtimeEmulator) streamCompletion(ctx context.Context, builder *realtimeResponseBuilder, instructions string) (*dto.Usage, *types.NewAPIError) {
+	request := &dto.GeneralOpenAIRequest{
+		Model:    e.info.OriginModelName,
+		Messages: e.buildMessages(instructions),
+		Stream:   true,
+	}
+	if e.session.Temperature > 0 {
+		request.Temperature = common.GetPointer(e.session.Temperature)
+	}
+	for _, tool := range e.session.Tools {
+		request.Tools = append(request.Tools, dto.ToolCallRequest{
+			Type: "function",
+			Function: dto.FunctionRequest{
+				Name:        tool.Name,
+				Description: tool.Description,
+				Parameters:  tool.Parameters,
+			},
+		})
+	}
+	if len(request.Tools) > 0 && e.session.ToolChoice != "" {
+		request.ToolChoice = e.session.ToolChoice
+	}
+	body, err := common.Marshal(request)
+	if err != nil {
+		return nil, types.NewError(err, types.ErrorCodeJsonMarshalFailed)
+	}
+
+	writer := newRealtimeCaptureWriter(builder.handleStreamData)
+	subCtx := newRealtimeSubContext(e.c, ctx, "/v1/chat/completions", "application/json", body, writer)
+	info := relaycommon.GenRelayInfoOpenAI(subCtx, request)
+	info.InitChannelMeta(subCtx)
+	info.DisablePing = true
+	info.PriceData = e.info.PriceData
+	if err := helper.ModelMappedHelper(subCtx, info, request); err != nil {
+		return nil, types.NewError(err, types.ErrorCodeChannelModelMappedError)
+	}
+	info.ShouldIncludeUsage = true
+	builder.promptTokens = service.CountTextToken(request.GetTokenCountMeta().CombineText, e.info.OriginModelName)
+	info.SetPromptTokens(builder.promptTokens)
+	if info.SupportStreamOptions {
+		request.StreamOptions = &dto.StreamOptions{IncludeUsage: true}
+	}
+
+	adaptor := GetAdaptor(info.ApiType)
+	adaptor.Init(info)
+	convertedRequest, err := adaptor.ConvertOpenAIRequest(subCtx, info, request)
+	if err != nil {
+		return nil, types.NewError(err, types.ErrorCodeConvertRequestFailed)
+	}
+	jsonData, err := common.Marshal(convertedRequest)
+	if err != nil {
+		return nil, types.NewError(err, types.ErrorCodeJsonMarshalFailed)
+	}
+	jsonData, err = relaycommon.RemoveDisabledFields(jsonData, info.ChannelOtherSettings)
+	if err != nil {
+		return nil, types.NewError(err, types.ErrorCodeConvertRequestFailed)
+	}
+	if len(info.ParamOverride) > 0 {
+		jsonData, err = relaycommon.ApplyParamOverride(jsonData, info.ParamOverride)
+		if err != nil {
+			return nil, types.NewError(err, types.ErrorCodeChannelParamOverrideInvalid)
+		}
+	}
+
+	statusCodeMappingStr := e.c.GetString("status_code_mapping")
+	resp, err := adaptor.DoRequest(subCtx, info, bytes.NewBuffer(jsonData))
+	if err != nil {
+		return nil, types.NewOpenAIError(err, types.ErrorCodeDoRequestFailed, http.StatusInternalServerError)
+	}
+	var httpResp *http.Response
+	if resp != nil {
+		httpResp = resp.(*http.Response)
+		if httpResp.StatusCode != http.StatusOK {
+			newAPIError := service.RelayErrorHandler(ctx, httpResp, false)
+			service.ResetStatusCode(newAPIError, statusCodeMappingStr)
+			return nil, newAPIError
+		}
+	}
+	usage, newAPIError := adaptor.DoResponse(subCtx, httpResp, info)
+	writer.flushEvents()
+	if newAPIError != nil {
+		service.ResetStatusCode(newAPIError, statusCodeMappingStr)
+		return nil, newAPIError
+	}
+	if usage == nil {
+		return nil, nil
+	}
+	return usage.(*dto.Usage), nil
+}
+
+// transcribe 通过转写模型将 pcm16 音频转为文本
+func (e *realtimeEmulator) transcribe(audio []byte) (string, error) {
+	if e.session.InputAudioFormat != "pcm16" {
+		return "", fmt.Errorf("input audio format %s is not supported in realtime emulation", e.session.InputAudioFormat)
+	}
+	modelName := e.session.InputAudioTranscription.Model
+	if modelName == "" {
+		return "", errors.New("transcription model is not configured")
+	}
+	var body bytes.Buffer
+	form := multipart.NewWriter(&body)
+	_ = form.WriteField("model", modelName)
+	_ = form.WriteField("response_format", "json")
+	part, err := form.CreateFormFile("file", "audio.wav")
+	if err != nil {
+		return "", err
+	}
+	if _, err := part.Write(pcm16ToWav(audio, realtimePcm16SampleRate)); err != nil {
+		return "", err
+	}
+	if err := form.Close(); err != nil {
+		return "", err
+	}
+
+	request := &dto.AudioRequest{Model: modelName, ResponseFormat: "json"}
+	output, err := e.relayAudio(e.c.Request.Context(), "/v1/audio/transcriptions", form.FormDataContentType(), body.Bytes(), request)
+	if err != nil {
+		return "", err
+	}
+	var result struct {
+		Text string `json:"text"`
+	}
+	if err := common.Unmarshal(output, &result); err != nil {
+		return "", fmt.Errorf("invalid transcription response: %w", err)
+	}
+	return result.Text, nil
+}
+
+// synthesize 通过语音合成模型生成 pcm16 音频
+func (e *realtimeEmulator) synthesize(ctx context.Context, text string, voice string) ([]byte, error) {
+	if e.session.OutputAudioFormat != "pcm16" {
+		return nil, fmt.Errorf("output audio format %s is not supported in realtime emulation", e.session.OutputAudioFormat)
+	}
+	modelName := model_setting.GetRealtimeEmulationSettings().SpeechModel
+	if modelName == "" {
+		return nil, errors.New("speech model is not configured")
+	}
+	request := &dto.AudioRequest{Model: modelName, Input: text, Voice: voice, ResponseFormat: "pcm"}
+	body, err := common.Marshal(request)
+	if err != nil {
+		return nil, err
+	}
+	return e.relayAudio(ctx, "/v1/audio/speech", "application/json", body, request)
+}
+
+// relayAudio 为音频模型单独选择渠道并按普通音频请求转发和计费，返回适配器写出的响应内容
+func (e *realtimeEmulator) relayAudio(ctx context.Context, path string, contentType string, body []byte, request *dto.AudioRequest) ([]byte, error) {
+	writer := newRealtimeCaptureWriter(nil)
+	subCtx := newRealtimeSubContext(e.c, ctx, path, contentType, body, writer)
+	// 会话命中的路由规则只针对对话模型
+	service.SetRoutingDecision(subCtx, nil)
+	channel, _, err := service.CacheGetRandomSatisfiedChannel(subCtx, e.info.UsingGroup, request.Model, 0)
+	if err != nil {
+		return nil, err
+	}
+	if channel == nil {
+		return nil, fmt.Errorf("no available channel for model %s", request.Model)
+	}
+	if newAPIError := middleware.SetupContextForSelectedChannel(subCtx, channel, request.Model); newAPIError != nil {
+		return nil, newAPIError
+	}
+
+	info := relaycommon.GenRelayInfoOpenAIAudio(subCtx, request)
+	meta := request.GetTokenCountMeta()
+	tokens, err := service.CountRequestToken(subCtx, meta, info)
+	if err != nil {
+		return nil, err
+	}
+	info.SetPromptTokens(tokens)
+	priceData, err := helper.ModelPriceHelper(subCtx, info, tokens, meta)
+	if err != nil {
+		return nil, err
+	}
+	if !priceData.FreeModel {
+		if newAPIError := service.PreConsumeQuota(subCtx, priceData.QuotaToPreConsume, info); newAPIError != nil {
+			return nil, newAPIError
+		}
+	}
+	if newAPIError := AudioHelper(subCtx, info); newAPIError != nil {
+		if info.FinalPreConsumedQuota != 0 {
+			service.ReturnPreConsumedQuota(subCtx, info)
+		}
+		return nil, newAPIError
+	}
+	return writer.Bytes(), nil
+}
+
+func newRealtimeSubContext(c *gin.Context, ctx context.Context, path string, contentType string, body []byte, writer *realtimeCaptureWriter) *gin.Context {
+	request, _ := http.NewRequestWithContext(ctx, http.MethodPost, path, bytes.NewReader(body))
+	request.Header.Set("Content-Type", contentType)
+	subCtx := c.Copy()
+	subCtx.Request = request
+	subCtx.Writer = writer
+	subCtx.Set(common.KeyRequestBody, body)
+	return subCtx
+}
+
+func pcm16ToWav(pcm []byte, sampleRate int) []byte {
+	var buf bytes.Buffer
+	buf.WriteString("RIFF")
+	_ = binary.Write(&buf, binary.LittleEndian, uint32(36+len(pcm)))
+	buf.WriteString("WAVEfmt ")
+	_ = binary.Write(&buf, binary.LittleEndian, uint32(16))
+	_ = binary.Write(&buf, binary.LittleEndian, uint16(1)) // PCM
+	_ = binary.Write(&buf, binary.LittleEndian, uint16(1)) // 单声道
+	_ = binary.Write(&buf, binary.LittleEndian, uint32(sampleRate))
+	_ = binary.Write(&buf, binary.LittleEndian, uint32(sampleRate*2))
+	_ = binary.Write(&buf, binary.LittleEndian, uint16(2))
+	_ = binary.Write(&buf, binary.LittleEndian, uint16(16))
+	buf.WriteString("data")
+	_ = binary.Write(&buf, binary.LittleEndian, uint32(len(pcm)))
+	buf.Write(pcm)
+	return buf.Bytes()
+}
+
+type realtimeFunctionCall struct {
+	item      *dto.RealtimeItem
+	index     int
+	arguments strings.Builder
+}
+
+// realtimeResponseBuilder 将一次流式对话补全的增量转换为 response.* 事件
+type realtimeResponseBuilder struct {
+	e          *realtimeEmulator
+	responseId string
+	withAudio  bool
+
+	message      *dto.RealtimeItem
+	messageIndex int
+	text         strings.Builder
+	calls        map[int]*realtimeFunctionCall
+	callOrder    []int
+	outputs      []dto.RealtimeItem
+	outputCount  int
+	sendErr      error
+	// 本地估算的输入用量，响应被取消且上游未返回用量时按估算计费
+	promptTokens int
+}
+
+// estimateUsage 按已生成的文本和工具参数估算输出用量
+func (b *realtimeResponseBuilder) estimateUsage() *dto.Usage {
+	var output strings.Builder
+	output.WriteString(b.text.String())
+	for _, call := range b.calls {
+		output.WriteString(call.arguments.String())
+	}
+	completionTokens := service.CountTextToken(output.String(), b.e.info.OriginModelName)
+	return &dto.Usage{
+		PromptTokens:     b.promptTokens,
+		CompletionTokens: completionTokens,
+		TotalTokens:      b.promptTokens + completionTokens,
+	}
+}
+
+func (b *realtimeResponseBuilder) sendEvent(event *dto.RealtimeEvent) {
+	if b.sendErr != nil {
+		return
+	}
+	event.ResponseId = b.responseId
+	if err := b.e.send(event); err != nil {
+		b.sendErr = err
+		b.e.cancelCurrentResponse()
+	}
+}
+
+func (b *realtimeResponseBuilder) handleStreamData(data string) {
+	if data == "[DONE]" {
+		return
+	}
+	var chunk dto.ChatCompletionsStreamResponse
+	if err := common.UnmarshalJsonStr(data, &chunk); err != nil {
+		return
+	}
+	for _, choice := range chunk.Choices {
+		if content := choice.Delta.GetContentString(); content != "" {
+			b.appendText(content)
+		}
+		for _, toolCall := range choice.Delta.ToolCalls {
+			b.appendToolCall(toolCall)
+		}
+	}
+}
+
+func (b *realtimeResponseBuilder) appendText(delta string) {
+	b.e.info.SetFirstResponseTime()
+	if b.message == nil {
+		b.message = &dto.RealtimeItem{
+			Id:      "item_" + common.GetRandomString(20),
+			Object:  "realtime.item",
+			Type:    "message",
+			Status:  "in_progress",
+			Role:    "assistant",
+			Content: []dto.RealtimeContent{},
+		}
+		b.messageIndex = b.outputCount
+		b.outputCount++
+		b.sendEvent(&dto.RealtimeEvent{Type: dto.RealtimeEventResponseOutputItemAdded, OutputIndex: common.GetPointer(b.messageIndex), Item: b.message})
+		b.sendEvent(&dto.RealtimeEvent{
+			Type:         dto.RealtimeEventResponseContentPartAdded,
+			ItemId:       b.message.Id,
+			OutputIndex:  common.GetPointer(b.messageIndex),
+			ContentIndex: common.GetPointer(0),
+			Part:         b.contentPart(""),
+		})
+	}
+	b.text.WriteString(delta)
+	eventType := dto.RealtimeEventResponseTextDelta
+	if b.withAudio {
+		eventType = dto.RealtimeEventResponseAudioTranscriptionDelta
+	}
+	b.sendEvent(&dto.RealtimeEvent{
+		Type:         eventType,
+		ItemId:       b.message.Id,
+		OutputIndex:  common.GetPointer(b.messageIndex),
+		ContentIndex: common.GetPointer(0),
+		Delta:        delta,
+	})
+}
+
+func (b *realtimeResponseBuilder) appendToolCall(toolCall dto.ToolCallResponse) {
+	b.e.info.SetFirstResponseTime()
+	index := 0
+	if toolCall.Index != nil {
+		index = *toolCall.Index
+	}
+	if b.calls == nil {
+		b.calls = make(map[int]*realtimeFunctionCall)
+	}
+	call, ok := b.calls[index]
+	if !ok {
+		callId := toolCall.ID
+		if callId == "" {
+			callId = "call_" + common.GetRandomString(20)
+		}
+		name := toolCall.Function.Name
+		call = &realtimeFunctionCall{
+			item: &dto.RealtimeItem{
+				Id:     "item_" + common.GetRandomString(20),
+				Object: "realtime.item",
+				Type:   "function_call",
+				Status: "in_progress",
+				Name:   &name,
+				CallId: callId,
+			},
+			index: b.outputCount,
+		}
+		b.outputCount++
+		b.calls[index] = call
+		b.callOrder = append(b.callOrder, index)
+		b.sendEvent(&dto.RealtimeEvent{Type: dto.RealtimeEventResponseOutputItemAdded, OutputIndex: common.GetPointer(call.index), Item: call.item})
+	}
+	if toolCall.Function.Arguments == "" {
+		return
+	}
+	call.arguments.WriteString(toolCall.Function.Arguments)
+	b.sendEvent(&dto.RealtimeEvent{
+		Type:        dto.RealtimeEventResponseFunctionCallArgumentsDelta,
+		ItemId:      call.item.Id,
+		OutputIndex: common.GetPointer(call.index),
+		CallId:      call.item.CallId,
+		Delta:       toolCall.Function.Arguments,
+	})
+}
+
+func (b *realtimeResponseBuilder) contentPart(text string) *dto.RealtimeContent {
+	if b.withAudio {
+		return &dto.RealtimeContent{Type: "audio", Transcript: text}
+	}
+	return &dto.RealtimeContent{Type: "text", Text: text}
+}
+
+// finish 发送各输出条目的结束事件，语音输出时先分片发送合成的音频；响应未正常完成时条目标记为 incomplete
+func (b *realtimeResponseBuilder) finish(audio []byte, status string) error {
+	itemStatus := "completed"
+	if status != "completed" {
+		itemStatus = "incomplete"
+	}
+	outputs := make([]dto.RealtimeItem, b.outputCount)
+	if b.message != nil {
+		text := b.text.String()
+		outputIndex := common.GetPointer(b.messageIndex)
+		contentIndex := common.GetPointer(0)
+		if b.withAudio {
+			for offset := 0; offset < len(audio); offset += realtimeAudioChunkSize {
+				end := min(offset+realtimeAudioChunkSize, len(audio))
+				b.sendEvent(&dto.RealtimeEvent{
+					Type:         dto.RealtimeEventResponseAudioDelta,
+					ItemId:       b.message.Id,
+					OutputIndex:  outputIndex,
+					ContentIndex: contentIndex,
+					Delta:        base64.StdEncoding.EncodeToString(audio[offset:end]),
+				})
+			}
+			b.sendEvent(&dto.RealtimeEvent{Type: dto.RealtimeEventResponseAudioDone, ItemId: b.message.Id, OutputIndex: outputIndex, ContentIndex: contentIndex})
+			b.sendEvent(&dto.RealtimeEvent{Type: dto.RealtimeEventResponseAudioTranscriptionDone, ItemId: b.message.Id, OutputIndex: outputIndex, ContentIndex: contentIndex, Transcript: text})
+		} else {
+			b.sendEvent(&dto.RealtimeEvent{Type: dto.RealtimeEventResponseTextDone, ItemId: b.message.Id, OutputIndex: outputIndex, ContentIndex: contentIndex, Text: text})
+		}
+		part := b.contentPart(text)
+		b.sendEvent(&dto.RealtimeEvent{Type: dto.RealtimeEventResponseContentPartDone, ItemId: b.message.Id, OutputIndex: outputIndex, ContentIndex: contentIndex, Part: part})
+		b.message.Status = itemStatus
+		b.message.Content = []dto.RealtimeContent{*part}
+		b.sendEvent(&dto.RealtimeEvent{Type: dto.RealtimeEventResponseOutputItemDone, OutputIndex: outputIndex, Item: b.message})
+		outputs[b.messageIndex] = *b.message
+	}
+	for _, index := range b.callOrder {
+		call := b.calls[index]
+		call.item.Arguments = call.arguments.String()
+		call.item.Status = itemStatus
+		b.sendEvent(&dto.RealtimeEvent{
+			Type:        dto.RealtimeEventResponseFunctionCallArgumentsDone,
+			ItemId:      call.item.Id,
+			OutputIndex: common.GetPointer(call.index),
+			CallId:      call.item.CallId,
+			Name:        *call.item.Name,
+			Arguments:   call.item.Arguments,
+		})
+		b.sendEvent(&dto.RealtimeEvent{Type: dto.RealtimeEventResponseOutputItemDone, OutputIndex: common.GetPointer(call.index), Item: call.item})
+		outputs[call.index] = *call.item
+	}
+	b.outputs = outputs
+	return b.sendErr
+}
+
+// realtimeCaptureWriter 代替下游连接接收适配器的输出：onData 不为空时按 SSE 事件逐条回调 data 内容，否则缓存完整响应
+type realtimeCaptureWriter struct {
+	mu      sync.Mutex
+	header  http.Header
+	status  int
+	size    int
+	buffer  bytes.Buffer
+	onData  func(data string)
+	written bool
+}
+
+var _ gin.ResponseWriter = (*realtimeCaptureWriter)(nil)
+
+func newRealtimeCaptureWriter(onData func(data string)) *realtimeCaptureWriter {
+	return &realtimeCaptureWriter{header: http.Header{}, status: http.StatusOK, onData: onData}
+}
+
+func (w *realtimeCaptureWriter) Header() http.Header {
+	return w.header
+}
+
+func (w *realtimeCaptureWriter) Write(data []byte) (int, error) {
+	w.mu.Lock()
+	w.written = true
+	w.size += len(data)
+	w.buffer.Write(data)
+	w.mu.Unlock()
+	if w.onData != nil {
+		w.dispatchEvents(false)
+	}
+	return len(data), nil
+}
+
+func (w *realtimeCaptureWriter) WriteString(s string) (int, error) {
+	return w.Write([]byte(s))
+}
+
+// dispatchEvents 取出缓冲区中完整的 SSE 事件并回调，final 为 true 时同时处理末尾不完整的事件
+func (w *realtimeCaptureWriter) dispatchEvents(final bool) {
+	var events []string
+	w.mu.Lock()
+	for {
+		content := w.buffer.String()
+		end := strings.Index(content, "\n\n")
+		if end < 0 {
+			if final && strings.TrimSpace(content) != "" {
+				events = append(events, content)
+				w.buffer.Reset()
+			}
+			break
+		}
+		events = append(events, content[:end])
+		w.buffer.Next(end + 2)
+	}
+	w.mu.Unlock()
+	for _, event := range events {
+		for _, line := range strings.Split(event, "\n") {
+			if data, ok := strings.CutPrefix(strings.TrimRight(line, "\r"), "data:"); ok {
+				w.onData(strings.TrimSpace(data))
+			}
+		}
+	}
+}
+
+func (w *realtimeCaptureWriter) flushEvents() {
+	if w.onData != nil {
+		w.dispatchEvents(true)
+	}
+}
+
+func (w *realtimeCaptureWriter) Bytes() []byte {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return bytes.Clone(w.buffer.Bytes())
+}
+
+func (w *realtimeCaptureWriter) WriteHeader(statusCode int) {
+	if statusCode > 0 && !w.written {
+		w.status = statusCode
+	}
+}
+
+func (w *realtimeCaptureWriter) WriteHeaderNow() {}
+
+func (w *realtimeCaptureWriter) Status() int {
+	return w.status
+}
+
+func (w *realtimeCaptureWriter) Size() int {
+	return w.size
+}
+
+func (w *realtimeCaptureWriter) Written() bool {
+	return w.written
+}
+
+func (w *realtimeCaptureWriter) Flush() {}
+
+func (w *realtimeCaptureWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	return nil, nil, errors.New("realtime emulation writer does not support hijacking")
+}
+
+func (w *realtimeCaptureWriter) CloseNotify() <-chan bool {
+	return make(chan bool)
+}
+
+func (w *realtimeCaptureWriter) Pusher() http.Pusher {
+	return nil
+}
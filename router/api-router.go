@@ -17,6 +17,8 @@ func SetApiRouter(router *gin.Engine) {
 		apiRouter.POST("/setup", controller.PostSetup)
 		apiRouter.GET("/status", controller.GetStatus)
 		apiRouter.GET("/uptime/status", controller.GetUptimeKumaStatus)
+		apiRouter.GET("/status/models", controller.GetModelStatus)
+		apiRouter.GET("/status/sla", middleware.AdminAuth(), controller.GetModelSLAReport)
 		apiRouter.GET("/models", middleware.UserAuth(), controller.DashboardListModels)
 		apiRouter.GET("/status/test", middleware.AdminAuth(), controller.TestStatus)
 		apiRouter.GET("/notice", controller.GetNotice)
@@ -31,6 +33,7 @@ func SetApiRouter(router *gin.Engine) {
 		apiRouter.POST("/user/reset", middleware.CriticalRateLimit(), controller.ResetPassword)
 		apiRouter.GET("/oauth/github", middleware.CriticalRateLimit(), controller.GitHubOAuth)
 		apiRouter.GET("/oauth/oidc", middleware.CriticalRateLimit(), controller.OidcAuth)
+		apiRouter.GET("/oauth/oidc/state", middleware.CriticalRateLimit(), controller.GenerateOidcAuthState)
 		apiRouter.GET("/oauth/linuxdo", middleware.CriticalRateLimit(), controller.LinuxdoOAuth)
 		apiRouter.GET("/oauth/state", middleware.CriticalRateLimit(), controller.GenerateOAuthCode)
 		apiRouter.GET("/oauth/wechat", middleware.CriticalRateLimit(), controller.WeChatAuth)
@@ -56,6 +59,7 @@ func SetApiRouter(router *gin.Engine) {
 			userRoute.POST("/register", middleware.CriticalRateLimit(), middleware.TurnstileCheck(), controller.Register)
 			userRoute.POST("/login", middleware.CriticalRateLimit(), middleware.TurnstileCheck(), controller.Login)
 			userRoute.POST("/login/2fa", middleware.CriticalRateLimit(), controller.Verify2FALogin)
+			userRoute.POST("/login/ldap", middleware.CriticalRateLimit(), controller.LdapLogin)
 			userRoute.POST("/passkey/login/begin", middleware.CriticalRateLimit(), controller.PasskeyLoginBegin)
 			userRoute.POST("/passkey/login/finish", middleware.CriticalRateLimit(), controller.PasskeyLoginFinish)
 			//userRoute.POST("/tokenlog", middleware.CriticalRateLimit(), controller.TokenLog)
@@ -104,6 +108,7 @@ func SetApiRouter(router *gin.Engine) {
 				adminRoute.GET("/", controller.GetAllUsers)
 				adminRoute.GET("/topup", controller.GetAllTopUps)
 				adminRoute.POST("/topup/complete", controller.AdminCompleteTopUp)
+				adminRoute.POST("/topup/refund", controller.AdminRefundTopUp)
 				adminRoute.GET("/search", controller.SearchUsers)
 				adminRoute.GET("/:id", controller.GetUser)
 				adminRoute.POST("/", controller.CreateUser)
@@ -142,6 +147,8 @@ func SetApiRouter(router *gin.Engine) {
 			channelRoute.POST("/:id/key", middleware.RootAuth(), middleware.CriticalRateLimit(), middleware.DisableCache(), middleware.SecureVerificationRequired(), controller.GetChannelKey)
 			channelRoute.GET("/test", controller.TestAllChannels)
 			channelRoute.GET("/test/:id", controller.TestChannel)
+			channelRoute.GET("/probe/stats", controller.GetChannelProbeStats)
+			channelRoute.GET("/probe/:id", controller.GetChannelProbeHistory)
 			channelRoute.GET("/update_balance", controller.UpdateAllChannelsBalance)
 			channelRoute.GET("/update_balance/:id", controller.UpdateChannelBalance)
 			channelRoute.POST("/", controller.AddChannel)
@@ -204,6 +211,57 @@ func SetApiRouter(router *gin.Engine) {
 		logRoute.GET("/content", middleware.AdminAuth(), controller.GetContentLogs)
 		logRoute.GET("/content/:id", middleware.AdminAuth(), controller.GetContentLogDetail)
 
+		ledgerRoute := apiRouter.Group("/quota_ledger")
+		ledgerRoute.GET("/", middleware.AdminAuth(), controller.GetQuotaLedgers)
+		ledgerRoute.GET("/drift", middleware.AdminAuth(), controller.GetQuotaLedgerDrifts)
+		ledgerRoute.GET("/self", middleware.UserAuth(), controller.GetSelfQuotaLedgers)
+
+		apiRouter.GET("/job/leaders", middleware.RootAuth(), controller.GetJobLeaders)
+
+		subscriptionRoute := apiRouter.Group("/subscription")
+		subscriptionRoute.GET("/epay/notify", controller.SubscriptionEpayNotify)
+		subscriptionRoute.GET("/plans", middleware.UserAuth(), controller.GetSubscriptionPlans)
+		subscriptionRoute.GET("/self", middleware.UserAuth(), controller.GetSelfSubscription)
+		subscriptionRoute.POST("/subscribe", middleware.UserAuth(), middleware.CriticalRateLimit(), controller.Subscribe)
+		subscriptionRoute.POST("/self/cancel", middleware.UserAuth(), controller.CancelSelfSubscription)
+		subscriptionRoute.POST("/self/change/preview", middleware.UserAuth(), controller.PreviewSelfSubscriptionChange)
+		subscriptionRoute.POST("/self/change", middleware.UserAuth(), middleware.CriticalRateLimit(), controller.ChangeSelfSubscription)
+		subscriptionRoute.GET("/", middleware.AdminAuth(), controller.GetAllSubscriptions)
+		subscriptionRoute.POST("/:id/expire", middleware.AdminAuth(), controller.AdminExpireSubscription)
+		subscriptionRoute.GET("/plan", middleware.AdminAuth(), controller.GetAllSubscriptionPlans)
+		subscriptionRoute.POST("/plan", middleware.AdminAuth(), controller.AddSubscriptionPlan)
+		subscriptionRoute.PUT("/plan", middleware.AdminAuth(), controller.UpdateSubscriptionPlan)
+		subscriptionRoute.DELETE("/plan/:id", middleware.AdminAuth(), controller.DeleteSubscriptionPlan)
+
+		statementRoute := apiRouter.Group("/statement")
+		statementRoute.GET("/", middleware.AdminAuth(), controller.GetStatements)
+		statementRoute.POST("/", middleware.AdminAuth(), controller.GenerateStatement)
+		statementRoute.GET("/self", middleware.UserAuth(), controller.GetSelfStatements)
+		statementRoute.GET("/self/:id", middleware.UserAuth(), controller.GetSelfStatement)
+		statementRoute.GET("/self/:id/download", middleware.UserAuth(), controller.DownloadSelfStatement)
+		statementRoute.GET("/:id", middleware.AdminAuth(), controller.GetStatement)
+		statementRoute.GET("/:id/download", middleware.AdminAuth(), controller.DownloadStatement)
+
+		mediaRoute := apiRouter.Group("/media")
+		mediaRoute.GET("/", middleware.AdminAuth(), controller.GetAllMediaAssets)
+		mediaRoute.DELETE("/:id", middleware.AdminAuth(), controller.DeleteMediaAsset)
+		mediaRoute.GET("/self", middleware.UserAuth(), controller.GetSelfMediaAssets)
+		mediaRoute.GET("/self/usage", middleware.UserAuth(), controller.GetSelfMediaUsage)
+		mediaRoute.DELETE("/self/:id", middleware.UserAuth(), controller.DeleteSelfMediaAsset)
+
+		webhookRoute := apiRouter.Group("/webhook")
+		webhookRoute.Use(middleware.UserAuth())
+		{
+			webhookRoute.GET("/events", controller.GetWebhookEventTypes)
+			webhookRoute.GET("/self", controller.GetSelfWebhookSubscriptions)
+			webhookRoute.POST("/self", controller.CreateSelfWebhookSubscription)
+			webhookRoute.PUT("/self/:id", controller.UpdateSelfWebhookSubscription)
+			webhookRoute.DELETE("/self/:id", controller.DeleteSelfWebhookSubscription)
+			webhookRoute.POST("/self/:id/ping", controller.PingSelfWebhookSubscription)
+			webhookRoute.GET("/self/deliveries", controller.GetSelfWebhookDeliveries)
+			webhookRoute.POST("/self/deliveries/:id/redeliver", controller.RedeliverSelfWebhookDelivery)
+		}
+
 		dataRoute := apiRouter.Group("/data")
 		dataRoute.GET("/", middleware.AdminAuth(), controller.GetAllQuotaDates)
 		dataRoute.GET("/self", middleware.UserAuth(), controller.GetUserQuotaDates)
@@ -161,6 +161,9 @@ func SetRelayRouter(router *gin.Engine) {
 	registerMjRouterGroup(relayMjModeRouter)
 	//relayMjRouter.Use()
 
+	// 持久化保存的生成结果，通过签名链接访问
+	router.GET("/media/:key", controller.GetMediaAsset)
+
 	relaySunoRouter := router.Group("/suno")
 	relaySunoRouter.Use(middleware.TokenAuth(), middleware.Distribute())
 	{
@@ -0,0 +1,402 @@
+package service
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/dto"
+	relaycommon "github.com/QuantumNous/new-api/relay/common"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	cassetteVersion  = 1
+	cassetteRedacted = "[REDACTED]"
+	// 单次录制的响应体上限，超过时放弃本次录制，避免大文件响应（如视频、音频）占用过多内存
+	cassetteMaxResponseBytes = 32 << 20
+)
+
+// 录制时整体替换取值的请求头和查询参数，均为小写
+var cassetteSensitiveHeaders = map[string]bool{
+	"authorization":        true,
+	"proxy-authorization":  true,
+	"cookie":               true,
+	"set-cookie":           true,
+	"x-api-key":            true,
+	"api-key":              true,
+	"x-goog-api-key":       true,
+	"x-amz-security-token": true,
+}
+
+var cassetteSensitiveQueries = map[string]bool{
+	"key":          true,
+	"api_key":      true,
+	"api-key":      true,
+	"access_token": true,
+	"token":        true,
+	"signature":    true,
+}
+
+// Cassette 一次上游请求的录制结果，响应体按读取顺序分块保存并记录相对时间，用于原样回放流式响应
+type Cassette struct {
+	Version     int              `json:"version"`
+	Fingerprint string           `json:"fingerprint"`
+	ChannelType int              `json:"channel_type"`
+	Model       string           `json:"model"`
+	RelayMode   int              `json:"relay_mode"`
+	IsStream    bool             `json:"is_stream"`
+	RecordedAt  int64            `json:"recorded_at"`
+	Request     CassetteRequest  `json:"request"`
+	Response    CassetteResponse `json:"response"`
+}
+
+type CassetteRequest struct {
+	Method     string            `json:"method"`
+	Path       string            `json:"path"` // 客户端请求路径
+	ClientBody string            `json:"client_body,omitempty"`
+	URL        string            `json:"url"` // 上游请求地址
+	Header     map[string]string `json:"header"`
+	Body       string            `json:"body,omitempty"`
+}
+
+type CassetteResponse struct {
+	StatusCode    int               `json:"status_code"`
+	Header        map[string]string `json:"header"`
+	HeaderDelayMs int64             `json:"header_delay_ms"` // 发出请求到收到响应头的耗时
+	Chunks        []CassetteChunk   `json:"chunks"`
+	Error         string            `json:"error,omitempty"` // 读取响应体时上游中断的错误
+}
+
+type CassetteChunk struct {
+	OffsetMs int64  `json:"offset_ms"` // 相对收到响应头的时间
+	Data     string `json:"data"`
+	Base64   bool   `json:"base64,omitempty"` // 非 UTF-8 数据（如音频）按 base64 保存
+}
+
+// CassetteFingerprint 根据客户端请求计算录制指纹。JSON 请求体按键排序后参与计算，multipart 请求体按解析后的
+// 字段和文件内容计算（原始请求体含随机分隔符）。与上游请求体无关，因此适配器的转换逻辑变化后仍能命中原有录制
+func CassetteFingerprint(c *gin.Context) string {
+	body, _ := common.GetRequestBody(c)
+	if form, ok := cassetteMultipartBody(c); ok {
+		body = form
+	} else {
+		var parsed any
+		if err := common.Unmarshal(body, &parsed); err == nil {
+			if canonical, err := common.Marshal(parsed); err == nil {
+				body = canonical
+			}
+		}
+	}
+	hash := sha256.New()
+	hash.Write([]byte(c.Request.Method + " " + c.Request.URL.Path + "\n"))
+	hash.Write(body)
+	return hex.EncodeToString(hash.Sum(nil))[:32]
+}
+
+// cassetteMultipartBody 将 multipart 请求体转换为与分隔符无关的表示：字段取值，文件取文件名和内容摘要
+func cassetteMultipartBody(c *gin.Context) ([]byte, bool) {
+	if !strings.HasPrefix(c.Request.Header.Get("Content-Type"), "multipart/form-data") {
+		return nil, false
+	}
+	form, err := common.ParseMultipartFormReusable(c)
+	if err != nil {
+		return nil, false
+	}
+	defer form.RemoveAll()
+	files := make(map[string][]string, len(form.File))
+	for name, headers := range form.File {
+		for _, header := range headers {
+			digest := header.Filename
+			if file, err := header.Open(); err == nil {
+				hash := sha256.New()
+				_, _ = io.Copy(hash, file)
+				_ = file.Close()
+				digest += ":" + hex.EncodeToString(hash.Sum(nil))
+			}
+			files[name] = append(files[name], digest)
+		}
+	}
+	data, err := common.Marshal(map[string]any{"fields": form.Value, "files": files})
+	if err != nil {
+		return nil, false
+	}
+	return data, true
+}
+
+func cassettePath(channelType int, fingerprint string) string {
+	return filepath.Join(common.CassetteDir, strconv.Itoa(channelType), fingerprint+".json")
+}
+
+// RecordCassette 包装上游响应体，响应体关闭时将脱敏后的请求和带时间信息的响应写入录制文件，
+// 同一指纹的录制会被覆盖
+func RecordCassette(c *gin.Context, info *relaycommon.RelayInfo, req *http.Request, resp *http.Response, startTime time.Time) {
+	secrets := cassetteSecrets(info.ApiKey)
+	clientBody, _ := common.GetRequestBody(c)
+	cassette := &Cassette{
+		Version:     cassetteVersion,
+		Fingerprint: CassetteFingerprint(c),
+		ChannelType: info.ChannelType,
+		Model:       info.UpstreamModelName,
+		RelayMode:   info.RelayMode,
+		IsStream:    info.IsStream,
+		RecordedAt:  common.GetTimestamp(),
+		Request: CassetteRequest{
+			Method:     req.Method,
+			Path:       c.Request.URL.Path,
+			ClientBody: redactCassetteSecrets(string(clientBody), secrets),
+			URL:        sanitizeCassetteURL(req.URL, secrets),
+			Header:     sanitizeCassetteHeader(req.Header, secrets),
+		},
+		Response: CassetteResponse{
+			StatusCode:    resp.StatusCode,
+			Header:        sanitizeCassetteHeader(resp.Header, secrets),
+			HeaderDelayMs: time.Since(startTime).Milliseconds(),
+		},
+	}
+	// 请求体已被发送，只能通过 GetBody 重新获取
+	if req.GetBody != nil {
+		if body, err := req.GetBody(); err == nil {
+			data, _ := io.ReadAll(body)
+			_ = body.Close()
+			if utf8.Valid(data) {
+				cassette.Request.Body = redactCassetteSecrets(string(data), secrets)
+			}
+		}
+	}
+	resp.Body = &cassetteRecorder{ReadCloser: resp.Body, cassette: cassette, start: time.Now()}
+}
+
+type cassetteRecorder struct {
+	io.ReadCloser
+	cassette *Cassette
+	start    time.Time
+	once     sync.Once
+	size     int64
+	oversize bool
+}
+
+func (r *cassetteRecorder) Read(p []byte) (int, error) {
+	n, err := r.ReadCloser.Read(p)
+	if n > 0 && !r.oversize {
+		r.size += int64(n)
+		if r.size > cassetteMaxResponseBytes {
+			r.oversize = true
+			r.cassette.Response.Chunks = nil
+			return n, err
+		}
+		chunk := CassetteChunk{OffsetMs: time.Since(r.start).Milliseconds()}
+		if utf8.Valid(p[:n]) {
+			chunk.Data = string(p[:n])
+		} else {
+			chunk.Data = base64.StdEncoding.EncodeToString(p[:n])
+			chunk.Base64 = true
+		}
+		r.cassette.Response.Chunks = append(r.cassette.Response.Chunks, chunk)
+	}
+	if err != nil && !errors.Is(err, io.EOF) {
+		r.cassette.Response.Error = err.Error()
+	}
+	return n, err
+}
+
+func (r *cassetteRecorder) Close() error {
+	err := r.ReadCloser.Close()
+	r.once.Do(func() {
+		if r.oversize {
+			common.SysLog(fmt.Sprintf("cassette %s not saved: response exceeds %d MB", r.cassette.Fingerprint, cassetteMaxResponseBytes>>20))
+			return
+		}
+		if saveErr := saveCassette(r.cassette); saveErr != nil {
+			common.SysError("failed to save cassette: " + saveErr.Error())
+		}
+	})
+	return err
+}
+
+func saveCassette(cassette *Cassette) error {
+	path := cassettePath(cassette.ChannelType, cassette.Fingerprint)
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	data, err := common.Marshal(cassette)
+	if err != nil {
+		return err
+	}
+	// 先在同一目录写入临时文件再重命名，避免回放时读到写了一半的录制；临时文件名唯一，同一指纹并发录制互不干扰
+	tmp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".*.tmp")
+	if err != nil {
+		return err
+	}
+	_, err = tmp.Write(data)
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Chmod(tmp.Name(), 0644)
+	}
+	if err == nil {
+		err = os.Rename(tmp.Name(), path)
+	}
+	if err != nil {
+		_ = os.Remove(tmp.Name())
+	}
+	return err
+}
+
+// LoadCassette 读取指定渠道类型下的录制文件。优先按指纹文件名查找，
+// 找不到时扫描目录匹配文件内的指纹，以便直接放入随问题反馈附带的录制文件
+func LoadCassette(channelType int, fingerprint string) (*Cassette, error) {
+	if cassette, err := readCassette(cassettePath(channelType, fingerprint)); err == nil {
+		return cassette, nil
+	}
+	paths, _ := filepath.Glob(filepath.Join(common.CassetteDir, strconv.Itoa(channelType), "*.json"))
+	for _, path := range paths {
+		cassette, err := readCassette(path)
+		if err == nil && cassette.Fingerprint == fingerprint {
+			return cassette, nil
+		}
+	}
+	return nil, fmt.Errorf("no cassette recorded for channel type %d with fingerprint %s", channelType, fingerprint)
+}
+
+func readCassette(path string) (*Cassette, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var cassette Cassette
+	if err := common.Unmarshal(data, &cassette); err != nil {
+		return nil, err
+	}
+	return &cassette, nil
+}
+
+// ReplayCassette 按当前请求的指纹读取录制文件并构造上游响应，默认按录制的时间间隔返回数据块
+func ReplayCassette(c *gin.Context, replay *dto.ChannelReplay) (*http.Response, error) {
+	if replay == nil || replay.ChannelType == 0 {
+		return nil, errors.New("replay channel is not configured")
+	}
+	cassette, err := LoadCassette(replay.ChannelType, CassetteFingerprint(c))
+	if err != nil {
+		return nil, err
+	}
+	ctx := c.Request.Context()
+	if !replay.IgnoreTiming && !waitCassette(ctx, time.Duration(cassette.Response.HeaderDelayMs)*time.Millisecond) {
+		return nil, ctx.Err()
+	}
+	header := http.Header{}
+	for key, value := range cassette.Response.Header {
+		header.Set(key, value)
+	}
+	header.Del("Content-Length")
+	reader, writer := io.Pipe()
+	go playCassette(ctx, cassette, replay.IgnoreTiming, writer)
+	return &http.Response{
+		StatusCode: cassette.Response.StatusCode,
+		Header:     header,
+		Body:       reader,
+	}, nil
+}
+
+func playCassette(ctx context.Context, cassette *Cassette, ignoreTiming bool, writer *io.PipeWriter) {
+	start := time.Now()
+	for _, chunk := range cassette.Response.Chunks {
+		if !ignoreTiming && !waitCassette(ctx, time.Duration(chunk.OffsetMs)*time.Millisecond-time.Since(start)) {
+			writer.CloseWithError(ctx.Err())
+			return
+		}
+		data := []byte(chunk.Data)
+		if chunk.Base64 {
+			decoded, err := base64.StdEncoding.DecodeString(chunk.Data)
+			if err != nil {
+				writer.CloseWithError(err)
+				return
+			}
+			data = decoded
+		}
+		if _, err := writer.Write(data); err != nil {
+			return
+		}
+	}
+	if cassette.Response.Error != "" {
+		writer.CloseWithError(errors.New(cassette.Response.Error))
+		return
+	}
+	_ = writer.Close()
+}
+
+// waitCassette 等待指定时长，请求被取消时返回 false
+func waitCassette(ctx context.Context, d time.Duration) bool {
+	if d <= 0 {
+		return true
+	}
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}
+
+// cassetteSecrets 拆分渠道密钥，多段密钥（如 AK|SK|Region）的每一段都需要脱敏
+func cassetteSecrets(apiKey string) []string {
+	secrets := []string{apiKey}
+	for _, part := range strings.Split(apiKey, "|") {
+		if len(part) >= 8 && part != apiKey {
+			secrets = append(secrets, part)
+		}
+	}
+	return secrets
+}
+
+func redactCassetteSecrets(s string, secrets []string) string {
+	for _, secret := range secrets {
+		if secret != "" {
+			s = strings.ReplaceAll(s, secret, cassetteRedacted)
+		}
+	}
+	return s
+}
+
+func sanitizeCassetteHeader(header http.Header, secrets []string) map[string]string {
+	result := make(map[string]string, len(header))
+	for key := range header {
+		if cassetteSensitiveHeaders[strings.ToLower(key)] {
+			result[key] = cassetteRedacted
+			continue
+		}
+		result[key] = redactCassetteSecrets(header.Get(key), secrets)
+	}
+	return result
+}
+
+func sanitizeCassetteURL(u *url.URL, secrets []string) string {
+	sanitized := *u
+	sanitized.User = nil
+	query := sanitized.Query()
+	for key := range query {
+		if cassetteSensitiveQueries[strings.ToLower(key)] {
+			query.Set(key, cassetteRedacted)
+		}
+	}
+	sanitized.RawQuery = query.Encode()
+	return redactCassetteSecrets(sanitized.String(), secrets)
+}
@@ -4,6 +4,7 @@ import (
 	"fmt"
 	"net/http"
 	"strings"
+	"time"
 
 	"github.com/QuantumNous/new-api/common"
 	"github.com/QuantumNous/new-api/constant"
@@ -44,6 +45,18 @@ func EnableChannel(channelId int, usingKey string, channelName string) {
 	}
 }
 
+// CooldownChannelKey 冷却模式下暂停使用触发限流的 key
+func CooldownChannelKey(channelId int, keyIndex int, retryAfter time.Duration) {
+	channel, err := model.CacheGetChannel(channelId)
+	if err != nil || !channel.ChannelInfo.IsMultiKey || channel.ChannelInfo.MultiKeyMode != constant.MultiKeyModeCooldown {
+		return
+	}
+	setting := operation_setting.GetMultiKeySetting()
+	cooldown := model.CooldownChannelKey(channelId, keyIndex, retryAfter,
+		time.Duration(setting.CooldownBaseSeconds)*time.Second, time.Duration(setting.CooldownMaxSeconds)*time.Second)
+	common.SysLog(fmt.Sprintf("通道「%s」（#%d）的 key #%d 触发限流，冷却 %s", channel.Name, channelId, keyIndex, cooldown))
+}
+
 func ShouldDisableChannel(channelType int, err *types.NewAPIError) bool {
 	if !common.AutomaticDisableChannelEnabled {
 		return false
@@ -16,13 +16,18 @@ func CacheGetRandomSatisfiedChannel(c *gin.Context, group string, modelName stri
 	var err error
 	selectGroup := group
 	userGroup := common.GetContextKeyString(c, constant.ContextKeyUserGroup)
+	var filter *model.ChannelFilter
+	routing := GetRoutingDecision(c)
+	if routing != nil {
+		filter = routing.Filter
+	}
 	if group == "auto" {
 		if len(setting.GetAutoGroups()) == 0 {
 			return nil, selectGroup, errors.New("auto groups is not enabled")
 		}
 		for _, autoGroup := range GetUserAutoGroup(userGroup) {
 			logger.LogDebug(c, "Auto selecting group:", autoGroup)
-			channel, _ = model.GetRandomSatisfiedChannel(autoGroup, modelName, retry)
+			channel, _ = getRandomSatisfiedChannel(autoGroup, modelName, retry, filter, routing)
 			if channel == nil {
 				continue
 			} else {
@@ -33,10 +38,32 @@ func CacheGetRandomSatisfiedChannel(c *gin.Context, group string, modelName stri
 			}
 		}
 	} else {
-		channel, err = model.GetRandomSatisfiedChannel(group, modelName, retry)
+		channel, err = getRandomSatisfiedChannel(group, modelName, retry, filter, routing)
 		if err != nil {
 			return nil, group, err
 		}
 	}
 	return channel, selectGroup, nil
 }
+
+// CacheGetRoutedChannel 选择渠道，路由规则改写后的模型无可用渠道且规则允许回退时改用请求的模型，
+// 同时返回实际使用的模型。首次选择和重试都经过这里，保证回退行为一致
+func CacheGetRoutedChannel(c *gin.Context, group string, modelName string, retry int) (*model.Channel, string, string, error) {
+	channel, selectGroup, err := CacheGetRandomSatisfiedChannel(c, group, modelName, retry)
+	routing := GetRoutingDecision(c)
+	if err == nil && channel == nil && routing != nil && routing.Fallback &&
+		routing.Model != "" && modelName == routing.Model && routing.RequestModel != "" && routing.RequestModel != modelName {
+		modelName = routing.RequestModel
+		channel, selectGroup, err = CacheGetRandomSatisfiedChannel(c, group, modelName, retry)
+	}
+	return channel, selectGroup, modelName, err
+}
+
+// getRandomSatisfiedChannel 在路由规则限定的渠道中选择，无可用渠道且规则允许回退时按默认方式选择
+func getRandomSatisfiedChannel(group string, modelName string, retry int, filter *model.ChannelFilter, routing *RoutingDecision) (*model.Channel, error) {
+	channel, err := model.GetRandomSatisfiedChannel(group, modelName, retry, filter)
+	if channel == nil && filter != nil && routing.Fallback {
+		return model.GetRandomSatisfiedChannel(group, modelName, retry, nil)
+	}
+	return channel, err
+}
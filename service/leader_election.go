@@ -0,0 +1,191 @@
+package service
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/model"
+)
+
+// 需要在集群中只由一个节点执行的后台任务，每个任务单独竞选租约
+const (
+	JobChannelTest          = "channel_test"
+	JobChannelBalance       = "channel_balance"
+	JobChannelKeyRecovery   = "channel_key_recovery"
+	JobTaskPolling          = "task_polling"
+	JobMidjourneyPolling    = "midjourney_polling"
+	JobGitHubSync           = "github_sync"
+	JobLogContentCleanup    = "log_content_cleanup"
+	JobTokenQuotaReset      = "token_quota_reset"
+	JobQuotaLedgerReconcile = "quota_ledger_reconcile"
+	JobMonthlyStatements    = "monthly_statements"
+	JobSubscriptionCheck    = "subscription_check"
+	JobTopUpReconcile       = "topup_reconcile"
+	JobMediaCleanup         = "media_cleanup"
+	JobWebhookDelivery      = "webhook_delivery"
+	JobModelIncidents       = "model_incidents"
+)
+
+const (
+	jobLeaseTTL           = 30 * time.Second
+	jobLeaseRenewInterval = 10 * time.Second
+	// 本地判断租约有效时预留的余量，避免续期失败后与接管节点同时执行
+	jobLeaseSafetyMargin = 5 * time.Second
+)
+
+type jobElection struct {
+	name      string
+	mu        sync.RWMutex
+	leader    bool
+	since     time.Time
+	validTill time.Time
+	lastError string
+}
+
+type JobLeaderStatus struct {
+	Name        string `json:"name"`
+	IsLeader    bool   `json:"is_leader"`
+	LeaderSince int64  `json:"leader_since,omitempty"`
+	Holder      string `json:"holder"`
+	AcquiredAt  int64  `json:"acquired_at,omitempty"`
+	RenewedAt   int64  `json:"renewed_at,omitempty"`
+	ExpiresAt   int64  `json:"expires_at,omitempty"`
+	LastError   string `json:"last_error,omitempty"`
+}
+
+var (
+	jobElections     = make(map[string]*jobElection)
+	jobElectionsLock sync.Mutex
+	jobElectionNode  = newJobElectionNodeId()
+)
+
+func newJobElectionNodeId() string {
+	hostname, err := os.Hostname()
+	if err != nil || hostname == "" {
+		hostname = "node"
+	}
+	return fmt.Sprintf("%s-%d-%s", hostname, os.Getpid(), common.GetRandomString(6))
+}
+
+// JobElectionNodeId 返回本节点参与竞选时使用的标识
+func JobElectionNodeId() string {
+	return jobElectionNode
+}
+
+// StartLeaderElection 为所有后台任务启动租约竞选，需在启动后台任务前调用
+func StartLeaderElection() {
+	if !common.LeaderElectionEnabled {
+		return
+	}
+	common.SysLog("leader election enabled, node id: " + jobElectionNode)
+	for _, name := range []string{
+		JobChannelTest, JobChannelBalance, JobChannelKeyRecovery, JobTaskPolling, JobMidjourneyPolling,
+		JobGitHubSync, JobLogContentCleanup, JobTokenQuotaReset, JobQuotaLedgerReconcile,
+		JobMonthlyStatements, JobSubscriptionCheck, JobTopUpReconcile, JobMediaCleanup, JobWebhookDelivery,
+		JobModelIncidents,
+	} {
+		getJobElection(name)
+	}
+}
+
+func getJobElection(name string) *jobElection {
+	jobElectionsLock.Lock()
+	defer jobElectionsLock.Unlock()
+	if election, ok := jobElections[name]; ok {
+		return election
+	}
+	election := &jobElection{name: name}
+	jobElections[name] = election
+	election.campaign()
+	go func() {
+		for {
+			time.Sleep(jobLeaseRenewInterval)
+			election.campaign()
+		}
+	}()
+	return election
+}
+
+// campaign 获取或续期租约，失败时保留本地租约直至其过期
+func (e *jobElection) campaign() {
+	start := time.Now()
+	acquired, err := model.AcquireJobLease(e.name, jobElectionNode, jobLeaseTTL)
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if err != nil {
+		e.lastError = err.Error()
+		common.SysLog(fmt.Sprintf("failed to renew lease of job %s: %s", e.name, err.Error()))
+		return
+	}
+	e.lastError = ""
+	if !acquired {
+		if e.leader {
+			common.SysLog(fmt.Sprintf("lost leadership of job %s", e.name))
+		}
+		e.leader = false
+		return
+	}
+	if !e.leader {
+		e.since = start
+		common.SysLog(fmt.Sprintf("became leader of job %s", e.name))
+	}
+	e.leader = true
+	e.validTill = start.Add(jobLeaseTTL - jobLeaseSafetyMargin)
+}
+
+func (e *jobElection) isLeader() bool {
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+	return e.leader && time.Now().Before(e.validTill)
+}
+
+// CanRunJobs 判断本节点是否参与后台任务：启用选举时所有节点参与竞选，否则仅主节点执行
+func CanRunJobs() bool {
+	return common.LeaderElectionEnabled || common.IsMasterNode
+}
+
+// IsJobLeader 判断本节点当前是否应执行任务 name；未启用选举时沿用 NODE_TYPE 的主节点判断
+func IsJobLeader(name string) bool {
+	if !common.LeaderElectionEnabled {
+		return common.IsMasterNode
+	}
+	return getJobElection(name).isLeader()
+}
+
+// GetJobLeaderStatuses 返回各任务的租约持有情况
+func GetJobLeaderStatuses() []JobLeaderStatus {
+	jobElectionsLock.Lock()
+	names := make([]string, 0, len(jobElections))
+	for name := range jobElections {
+		names = append(names, name)
+	}
+	jobElectionsLock.Unlock()
+	sort.Strings(names)
+
+	statuses := make([]JobLeaderStatus, 0, len(names))
+	for _, name := range names {
+		election := getJobElection(name)
+		status := JobLeaderStatus{Name: name, IsLeader: election.isLeader()}
+		election.mu.RLock()
+		if status.IsLeader {
+			status.LeaderSince = election.since.Unix()
+		}
+		status.LastError = election.lastError
+		election.mu.RUnlock()
+		lease, err := model.GetJobLease(name)
+		if err != nil {
+			status.LastError = err.Error()
+		} else if lease != nil {
+			status.Holder = lease.Holder
+			status.AcquiredAt = lease.AcquiredAt
+			status.RenewedAt = lease.RenewedAt
+			status.ExpiresAt = lease.ExpiresAt
+		}
+		statuses = append(statuses, status)
+	}
+	return statuses
+}
@@ -62,6 +62,14 @@ func GenerateTextOtherInfo(ctx *gin.Context, relayInfo *relaycommon.RelayInfo, m
 		adminInfo["is_multi_key"] = true
 		adminInfo["multi_key_index"] = common.GetContextKeyInt(ctx, constant.ContextKeyChannelMultiKeyIndex)
 	}
+	if hedgeAttempt := relaycommon.GetHedgeAttempt(ctx); hedgeAttempt != nil {
+		if hedgeInfo := hedgeAttempt.Race().Info(); hedgeInfo != nil {
+			adminInfo["hedge"] = hedgeInfo
+		}
+	}
+	if routing := GetRoutingDecision(ctx); routing != nil {
+		adminInfo["routing_rule"] = routing.Rule
+	}
 	other["admin_info"] = adminInfo
 	appendRequestPath(ctx, relayInfo, other)
 	return other
@@ -0,0 +1,394 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/logger"
+	"github.com/QuantumNous/new-api/model"
+	"github.com/QuantumNous/new-api/setting/system_setting"
+
+	"github.com/gin-gonic/gin"
+	"github.com/tidwall/gjson"
+	"github.com/tidwall/sjson"
+)
+
+var ErrMediaQuotaExceeded = errors.New("media storage quota exceeded")
+
+const (
+	// 同一响应中的图片最多同时下载的数量
+	mediaPersistConcurrency = 4
+	// 保存同步响应中的图片最多等待的时间，超时的图片保留上游链接
+	mediaPersistTimeout = 30 * time.Second
+)
+
+// MediaStorageEnabled 判断是否需要持久化某一来源的生成结果
+func MediaStorageEnabled(source string) bool {
+	setting := system_setting.GetMediaStorageSetting()
+	if !setting.Enabled {
+		return false
+	}
+	switch source {
+	case model.MediaSourceMidjourney:
+		return setting.StoreMidjourney
+	case model.MediaSourceImage:
+		return setting.StoreImages
+	case model.MediaSourceAudio:
+		return setting.StoreAudio
+	case model.MediaSourceVideo:
+		return setting.StoreVideos
+	}
+	return false
+}
+
+// NewMediaAsset 创建待保存的文件记录并确定访问标识和过期时间
+func NewMediaAsset(userId int, source string, sourceId string) *model.MediaAsset {
+	setting := system_setting.GetMediaStorageSetting()
+	retentionDays := setting.RetentionDays
+	if userCache, err := model.GetUserCache(userId); err == nil {
+		if days := userCache.GetSetting().MediaRetentionDays; days > 0 {
+			retentionDays = days
+			if setting.MaxRetentionDays > 0 && retentionDays > setting.MaxRetentionDays {
+				retentionDays = setting.MaxRetentionDays
+			}
+		}
+	}
+	asset := &model.MediaAsset{
+		Key:      common.GetRandomString(32),
+		UserId:   userId,
+		Source:   source,
+		SourceId: sourceId,
+		Backend:  setting.Backend,
+	}
+	if retentionDays > 0 {
+		asset.ExpiresAt = time.Now().AddDate(0, 0, retentionDays).Unix()
+	}
+	return asset
+}
+
+// StoreMediaAsset 检查用户存储空间后写入文件并保存记录，按配置一次性扣除存储额度
+func StoreMediaAsset(ctx context.Context, asset *model.MediaAsset, contentType string, data []byte) error {
+	setting := system_setting.GetMediaStorageSetting()
+	if len(data) == 0 {
+		return errors.New("media content is empty")
+	}
+	if setting.MaxFileSizeMB > 0 && int64(len(data)) > int64(setting.MaxFileSizeMB)<<20 {
+		return fmt.Errorf("media size %d exceeds limit %d MB", len(data), setting.MaxFileSizeMB)
+	}
+	// 同一来源已过期但尚未清理的记录会占用唯一索引，先删除后再重新保存
+	if expired, err := model.GetExpiredMediaAssetBySource(asset.Source, asset.SourceId); err != nil {
+		return err
+	} else if expired != nil {
+		if err := DeleteMediaAsset(ctx, expired); err != nil {
+			common.SysError(fmt.Sprintf("failed to delete expired media asset %s: %s", expired.Key, err.Error()))
+			_ = expired.Delete()
+		}
+	}
+	group := ""
+	if userCache, err := model.GetUserCache(asset.UserId); err == nil {
+		group = userCache.Group
+	}
+	if limit := setting.GetUserQuotaBytes(group); limit > 0 {
+		used, _, err := model.GetUserMediaUsage(asset.UserId)
+		if err != nil {
+			return err
+		}
+		if used+int64(len(data)) > limit {
+			return ErrMediaQuotaExceeded
+		}
+	}
+
+	if contentType == "" || contentType == "application/octet-stream" {
+		contentType = http.DetectContentType(data)
+	}
+	asset.ContentType = contentType
+	asset.Size = int64(len(data))
+	ext := ""
+	if exts, _ := mime.ExtensionsByType(strings.Split(contentType, ";")[0]); len(exts) > 0 {
+		ext = exts[0]
+	}
+	asset.StoragePath = fmt.Sprintf("%s/%d/%s%s", asset.Source, asset.UserId, asset.Key, ext)
+	store, err := getMediaStore(asset.Backend)
+	if err != nil {
+		return err
+	}
+	if err := store.Put(ctx, asset.StoragePath, contentType, data); err != nil {
+		return err
+	}
+
+	if setting.QuotaPerMB > 0 {
+		asset.Quota = int(math.Ceil(float64(asset.Size) / float64(1<<20) * float64(setting.QuotaPerMB)))
+	}
+	inserted, err := asset.Insert()
+	if err != nil {
+		_ = store.Delete(ctx, asset.StoragePath)
+		return err
+	}
+	if !inserted {
+		// 同一来源已由并发的请求保存，沿用已有记录且不重复扣费
+		_ = store.Delete(ctx, asset.StoragePath)
+		existing, err := model.GetMediaAssetBySource(asset.Source, asset.SourceId)
+		if err != nil {
+			return err
+		}
+		if existing == nil {
+			return fmt.Errorf("media asset %s/%s already exists", asset.Source, asset.SourceId)
+		}
+		*asset = *existing
+		return nil
+	}
+	if asset.Quota > 0 {
+		if err := model.DecreaseUserQuotaWithLedger(asset.UserId, asset.Quota, model.QuotaLedgerTypeMediaStorage, 0, asset.Key); err != nil {
+			common.SysError(fmt.Sprintf("failed to charge media storage quota for user %d: %s", asset.UserId, err.Error()))
+		} else {
+			model.UpdateUserUsedQuotaAndRequestCount(asset.UserId, asset.Quota)
+			model.RecordLog(asset.UserId, model.LogTypeSystem, fmt.Sprintf("保存生成结果 %s（%s，%.2f MB），扣除存储额度 %s",
+				asset.Key, asset.Source, float64(asset.Size)/float64(1<<20), logger.LogQuota(asset.Quota)))
+		}
+	}
+	return nil
+}
+
+// PersistMediaFromURL 下载生成结果并保存，同一任务已保存过时直接返回已有记录。
+// 下载通过 DoDownloadRequest 进行，受 SSRF 防护和 Worker 配置约束
+func PersistMediaFromURL(ctx context.Context, userId int, source string, sourceId string, originUrl string) (*model.MediaAsset, error) {
+	if sourceId != "" {
+		if existing, err := model.GetMediaAssetBySource(source, sourceId); err != nil || existing != nil {
+			return existing, err
+		}
+	}
+	contentType, data, err := fetchMediaContent(ctx, originUrl)
+	if err != nil {
+		return nil, err
+	}
+	asset := NewMediaAsset(userId, source, sourceId)
+	if err := StoreMediaAsset(ctx, asset, contentType, data); err != nil {
+		return nil, err
+	}
+	return asset, nil
+}
+
+func fetchMediaContent(ctx context.Context, originUrl string) (string, []byte, error) {
+	if strings.HasPrefix(originUrl, "data:") {
+		header, encoded, ok := strings.Cut(strings.TrimPrefix(originUrl, "data:"), ",")
+		if !ok || !strings.HasSuffix(header, ";base64") {
+			return "", nil, errors.New("unsupported data url")
+		}
+		data, err := base64.StdEncoding.DecodeString(encoded)
+		return strings.TrimSuffix(header, ";base64"), data, err
+	}
+	resp, err := DoDownloadRequestWithContext(ctx, originUrl, "media storage")
+	if err != nil {
+		return "", nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return "", nil, fmt.Errorf("download media failed: status %d", resp.StatusCode)
+	}
+	reader := io.Reader(resp.Body)
+	if maxSizeMB := system_setting.GetMediaStorageSetting().MaxFileSizeMB; maxSizeMB > 0 {
+		// 多读一个字节用于判断是否超过大小限制
+		reader = io.LimitReader(resp.Body, int64(maxSizeMB)<<20+1)
+	}
+	data, err := io.ReadAll(reader)
+	return resp.Header.Get("Content-Type"), data, err
+}
+
+// PersistMidjourneyImage 保存成功的 Midjourney 任务图片，之后 /mj/image/:id 直接从存储返回
+func PersistMidjourneyImage(task *model.Midjourney) {
+	if !MediaStorageEnabled(model.MediaSourceMidjourney) || task.Status != "SUCCESS" || task.ImageUrl == "" {
+		return
+	}
+	if _, err := PersistMediaFromURL(context.Background(), task.UserId, model.MediaSourceMidjourney, task.MjId, task.ImageUrl); err != nil {
+		common.SysError(fmt.Sprintf("failed to persist midjourney image %s: %s", task.MjId, err.Error()))
+	}
+}
+
+// PersistVideoResult 保存成功的视频任务结果，之后 /v1/videos/:task_id/content 直接从存储返回。
+// 结果地址指向网关自身时（由网关代理上游内容）无需保存
+func PersistVideoResult(task *model.Task, resultUrl string) {
+	if !MediaStorageEnabled(model.MediaSourceVideo) || resultUrl == "" {
+		return
+	}
+	if !strings.HasPrefix(resultUrl, "data:") && !strings.HasPrefix(resultUrl, "http") ||
+		strings.HasPrefix(resultUrl, system_setting.ServerAddress) {
+		return
+	}
+	if _, err := PersistMediaFromURL(context.Background(), task.UserId, model.MediaSourceVideo, task.TaskID, resultUrl); err != nil {
+		common.SysError(fmt.Sprintf("failed to persist video task %s: %s", task.TaskID, err.Error()))
+	}
+}
+
+// PersistImageResponse 并发保存图片生成响应中以链接返回的图片，并将链接替换为网关的签名链接，
+// 保存失败或超时的图片保留上游链接
+func PersistImageResponse(c *gin.Context, userId int, responseBody []byte) []byte {
+	if !MediaStorageEnabled(model.MediaSourceImage) {
+		return responseBody
+	}
+	requestId := c.GetString(common.RequestIdKey)
+	originUrls := make(map[int]string)
+	gjson.GetBytes(responseBody, "data").ForEach(func(index, item gjson.Result) bool {
+		if originUrl := item.Get("url").String(); strings.HasPrefix(originUrl, "http") {
+			originUrls[int(index.Int())] = originUrl
+		}
+		return true
+	})
+	if len(originUrls) == 0 {
+		return responseBody
+	}
+
+	ctx, cancel := context.WithTimeout(c.Request.Context(), mediaPersistTimeout)
+	defer cancel()
+	assets := make(map[int]*model.MediaAsset, len(originUrls))
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	semaphore := make(chan struct{}, mediaPersistConcurrency)
+	for index, originUrl := range originUrls {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			semaphore <- struct{}{}
+			defer func() { <-semaphore }()
+			asset, err := PersistMediaFromURL(ctx, userId, model.MediaSourceImage, fmt.Sprintf("%s-%d", requestId, index), originUrl)
+			if err != nil {
+				logger.LogWarn(c, fmt.Sprintf("failed to persist generated image: %s", err.Error()))
+				return
+			}
+			mu.Lock()
+			assets[index] = asset
+			mu.Unlock()
+		}()
+	}
+	wg.Wait()
+
+	for index, asset := range assets {
+		if updated, err := sjson.SetBytes(responseBody, fmt.Sprintf("data.%d.url", index), GetMediaAssetURL(asset)); err == nil {
+			responseBody = updated
+		}
+	}
+	return responseBody
+}
+
+// MediaCapture 边转发边保存时缓存响应内容。超过单文件大小限制后停止缓存并放弃保存，
+// 写入始终成功，不影响向客户端转发
+type MediaCapture struct {
+	buffer   bytes.Buffer
+	limit    int64
+	overflow bool
+}
+
+func NewMediaCapture() *MediaCapture {
+	return &MediaCapture{limit: int64(system_setting.GetMediaStorageSetting().MaxFileSizeMB) << 20}
+}
+
+func (m *MediaCapture) Write(p []byte) (int, error) {
+	if m.overflow {
+		return len(p), nil
+	}
+	if m.limit > 0 && int64(m.buffer.Len()+len(p)) > m.limit {
+		m.overflow = true
+		m.buffer = bytes.Buffer{}
+		return len(p), nil
+	}
+	return m.buffer.Write(p)
+}
+
+// Bytes 返回缓存的内容，超过大小限制时返回错误
+func (m *MediaCapture) Bytes() ([]byte, error) {
+	if m.overflow {
+		return nil, fmt.Errorf("media size exceeds limit %d MB", m.limit>>20)
+	}
+	return m.buffer.Bytes(), nil
+}
+
+func mediaSignature(key string, expires int64) string {
+	return common.GenerateHMAC(key + ":" + strconv.FormatInt(expires, 10))
+}
+
+// GetMediaAssetURL 返回网关的签名访问链接，未配置链接有效期时与文件保留期一致，因此链接在文件有效期内保持不变
+func GetMediaAssetURL(asset *model.MediaAsset) string {
+	expires := asset.ExpiresAt
+	if ttl := system_setting.GetMediaStorageSetting().SignedURLExpireSeconds; ttl > 0 {
+		expires = time.Now().Unix() + int64(ttl)
+		if asset.ExpiresAt > 0 && asset.ExpiresAt < expires {
+			expires = asset.ExpiresAt
+		}
+	}
+	return fmt.Sprintf("%s/media/%s?expires=%d&signature=%s", system_setting.ServerAddress, asset.Key, expires, mediaSignature(asset.Key, expires))
+}
+
+// VerifyMediaSignature 校验签名链接，expires 为 0 表示永久有效
+func VerifyMediaSignature(key string, expires int64, signature string) bool {
+	if expires > 0 && expires < time.Now().Unix() {
+		return false
+	}
+	return hmac.Equal([]byte(signature), []byte(mediaSignature(key, expires)))
+}
+
+// ServeMediaAsset 从存储读取文件并返回给客户端，仅在尚未写出响应时返回错误，调用方可据此回退到上游链接
+func ServeMediaAsset(c *gin.Context, asset *model.MediaAsset) error {
+	store, err := getMediaStore(asset.Backend)
+	if err != nil {
+		return err
+	}
+	reader, err := store.Open(c.Request.Context(), asset.StoragePath)
+	if err != nil {
+		return err
+	}
+	defer reader.Close()
+	c.Writer.Header().Set("Content-Type", asset.ContentType)
+	c.Writer.Header().Set("Content-Length", strconv.FormatInt(asset.Size, 10))
+	c.Writer.Header().Set("Cache-Control", "private, max-age=86400")
+	c.Writer.WriteHeader(http.StatusOK)
+	_, _ = io.Copy(c.Writer, reader)
+	return nil
+}
+
+// DeleteMediaAsset 删除存储中的文件和记录，已扣除的存储额度不退还
+func DeleteMediaAsset(ctx context.Context, asset *model.MediaAsset) error {
+	store, err := getMediaStore(asset.Backend)
+	if err != nil {
+		return err
+	}
+	if err := store.Delete(ctx, asset.StoragePath); err != nil {
+		return err
+	}
+	return asset.Delete()
+}
+
+// CleanupExpiredMediaAssets 删除已过期的文件，返回删除数量
+func CleanupExpiredMediaAssets() int {
+	deleted := 0
+	for {
+		assets, err := model.GetExpiredMediaAssets(100)
+		if err != nil {
+			common.SysError("failed to get expired media assets: " + err.Error())
+			return deleted
+		}
+		if len(assets) == 0 {
+			return deleted
+		}
+		for _, asset := range assets {
+			if err := DeleteMediaAsset(context.Background(), asset); err != nil {
+				common.SysError(fmt.Sprintf("failed to delete media asset %s: %s", asset.Key, err.Error()))
+				// 存储删除失败时仍删除记录，避免反复重试同一批文件
+				_ = asset.Delete()
+				continue
+			}
+			deleted++
+		}
+	}
+}
@@ -0,0 +1,190 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/QuantumNous/new-api/setting/system_setting"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	v4 "github.com/aws/aws-sdk-go-v2/aws/signer/v4"
+)
+
+// mediaStore 媒体文件存储后端，path 为后端内的相对路径
+type mediaStore interface {
+	Put(ctx context.Context, path string, contentType string, data []byte) error
+	Open(ctx context.Context, path string) (io.ReadCloser, error)
+	Delete(ctx context.Context, path string) error
+}
+
+func getMediaStore(backend string) (mediaStore, error) {
+	setting := system_setting.GetMediaStorageSetting()
+	switch backend {
+	case system_setting.MediaStorageBackendLocal:
+		if setting.LocalPath == "" {
+			return nil, errors.New("media storage local path is empty")
+		}
+		return &localMediaStore{root: setting.LocalPath}, nil
+	case system_setting.MediaStorageBackendS3:
+		if setting.S3Bucket == "" || setting.S3AccessKeyId == "" || setting.S3SecretAccessKey == "" {
+			return nil, errors.New("media storage s3 bucket or credentials are empty")
+		}
+		return &s3MediaStore{
+			endpoint:        setting.S3Endpoint,
+			region:          setting.S3Region,
+			bucket:          setting.S3Bucket,
+			accessKeyId:     setting.S3AccessKeyId,
+			secretAccessKey: setting.S3SecretAccessKey,
+			pathStyle:       setting.S3PathStyle,
+		}, nil
+	}
+	return nil, fmt.Errorf("unknown media storage backend: %s", backend)
+}
+
+type localMediaStore struct {
+	root string
+}
+
+func (s *localMediaStore) fullPath(path string) (string, error) {
+	fullPath := filepath.Join(s.root, filepath.FromSlash(path))
+	if !strings.HasPrefix(fullPath, filepath.Clean(s.root)+string(filepath.Separator)) {
+		return "", errors.New("invalid media path")
+	}
+	return fullPath, nil
+}
+
+func (s *localMediaStore) Put(ctx context.Context, path string, contentType string, data []byte) error {
+	fullPath, err := s.fullPath(path)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(fullPath), 0755); err != nil {
+		return err
+	}
+	tmp := fullPath + ".tmp"
+	if err := os.WriteFile(tmp, data, 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, fullPath)
+}
+
+func (s *localMediaStore) Open(ctx context.Context, path string) (io.ReadCloser, error) {
+	fullPath, err := s.fullPath(path)
+	if err != nil {
+		return nil, err
+	}
+	return os.Open(fullPath)
+}
+
+func (s *localMediaStore) Delete(ctx context.Context, path string) error {
+	fullPath, err := s.fullPath(path)
+	if err != nil {
+		return err
+	}
+	if err := os.Remove(fullPath); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
+
+// s3MediaStore 通过 SigV4 签名的 HTTP 请求访问 S3 兼容存储（AWS S3、MinIO、R2 等）
+type s3MediaStore struct {
+	endpoint        string
+	region          string
+	bucket          string
+	accessKeyId     string
+	secretAccessKey string
+	pathStyle       bool
+}
+
+func (s *s3MediaStore) objectURL(path string) (string, error) {
+	region := s.region
+	if region == "" {
+		region = "us-east-1"
+	}
+	endpoint := s.endpoint
+	if endpoint == "" {
+		endpoint = fmt.Sprintf("https://s3.%s.amazonaws.com", region)
+	}
+	u, err := url.Parse(strings.TrimSuffix(endpoint, "/"))
+	if err != nil {
+		return "", err
+	}
+	if s.pathStyle {
+		u.Path += "/" + s.bucket + "/" + path
+	} else {
+		u.Host = s.bucket + "." + u.Host
+		u.Path += "/" + path
+	}
+	return u.String(), nil
+}
+
+func (s *s3MediaStore) do(ctx context.Context, method string, path string, contentType string, data []byte) (*http.Response, error) {
+	objectURL, err := s.objectURL(path)
+	if err != nil {
+		return nil, err
+	}
+	req, err := http.NewRequestWithContext(ctx, method, objectURL, bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	if contentType != "" {
+		req.Header.Set("Content-Type", contentType)
+	}
+	payloadHash := sha256.Sum256(data)
+	payloadHashHex := hex.EncodeToString(payloadHash[:])
+	req.Header.Set("X-Amz-Content-Sha256", payloadHashHex)
+	region := s.region
+	if region == "" {
+		region = "us-east-1"
+	}
+	credentials := aws.Credentials{AccessKeyID: s.accessKeyId, SecretAccessKey: s.secretAccessKey}
+	if err := v4.NewSigner().SignHTTP(ctx, credentials, req, payloadHashHex, "s3", region, time.Now()); err != nil {
+		return nil, err
+	}
+	resp, err := GetHttpClient().Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode >= http.StatusBadRequest && !(method == http.MethodDelete && resp.StatusCode == http.StatusNotFound) {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		_ = resp.Body.Close()
+		return nil, fmt.Errorf("s3 %s %s failed: status %d, body: %s", method, path, resp.StatusCode, string(body))
+	}
+	return resp, nil
+}
+
+func (s *s3MediaStore) Put(ctx context.Context, path string, contentType string, data []byte) error {
+	resp, err := s.do(ctx, http.MethodPut, path, contentType, data)
+	if err != nil {
+		return err
+	}
+	return resp.Body.Close()
+}
+
+func (s *s3MediaStore) Open(ctx context.Context, path string) (io.ReadCloser, error) {
+	resp, err := s.do(ctx, http.MethodGet, path, "", nil)
+	if err != nil {
+		return nil, err
+	}
+	return resp.Body, nil
+}
+
+func (s *s3MediaStore) Delete(ctx context.Context, path string) error {
+	resp, err := s.do(ctx, http.MethodDelete, path, "", nil)
+	if err != nil {
+		return err
+	}
+	return resp.Body.Close()
+}
@@ -14,6 +14,7 @@ import (
 	"github.com/QuantumNous/new-api/logger"
 	"github.com/QuantumNous/new-api/model"
 	relaycommon "github.com/QuantumNous/new-api/relay/common"
+	"github.com/QuantumNous/new-api/setting/operation_setting"
 	"github.com/QuantumNous/new-api/setting/ratio_setting"
 	"github.com/QuantumNous/new-api/setting/system_setting"
 	"github.com/QuantumNous/new-api/types"
@@ -211,6 +212,9 @@ func PostWssConsumeQuota(ctx *gin.Context, relayInfo *relaycommon.RelayInfo, mod
 	} else {
 		model.UpdateUserUsedQuotaAndRequestCount(relayInfo.UserId, quota)
 		model.UpdateChannelUsedQuota(relayInfo.ChannelId, quota)
+		if relayInfo.ChannelIsMultiKey {
+			model.RecordChannelKeyTokens(relayInfo.ChannelId, relayInfo.ChannelMultiKeyIndex, totalTokens)
+		}
 	}
 
 	logModel := modelName
@@ -305,6 +309,9 @@ func PostClaudeConsumeQuota(ctx *gin.Context, relayInfo *relaycommon.RelayInfo,
 	} else {
 		model.UpdateUserUsedQuotaAndRequestCount(relayInfo.UserId, quota)
 		model.UpdateChannelUsedQuota(relayInfo.ChannelId, quota)
+		if relayInfo.ChannelIsMultiKey {
+			model.RecordChannelKeyTokens(relayInfo.ChannelId, relayInfo.ChannelMultiKeyIndex, totalTokens)
+		}
 	}
 
 	quotaDelta := quota - relayInfo.FinalPreConsumedQuota
@@ -430,6 +437,9 @@ func PostAudioConsumeQuota(ctx *gin.Context, relayInfo *relaycommon.RelayInfo, u
 	} else {
 		model.UpdateUserUsedQuotaAndRequestCount(relayInfo.UserId, quota)
 		model.UpdateChannelUsedQuota(relayInfo.ChannelId, quota)
+		if relayInfo.ChannelIsMultiKey {
+			model.RecordChannelKeyTokens(relayInfo.ChannelId, relayInfo.ChannelMultiKeyIndex, totalTokens)
+		}
 	}
 
 	quotaDelta := quota - relayInfo.FinalPreConsumedQuota
@@ -502,11 +512,15 @@ func PreConsumeTokenQuota(relayInfo *relaycommon.RelayInfo, quota int) error {
 }
 
 func PostConsumeQuota(relayInfo *relaycommon.RelayInfo, quota int, preConsumedQuota int, sendEmail bool) (err error) {
+	return postConsumeQuota(relayInfo, quota, preConsumedQuota, sendEmail, model.QuotaLedgerTypeSettle)
+}
+
+func postConsumeQuota(relayInfo *relaycommon.RelayInfo, quota int, preConsumedQuota int, sendEmail bool, ledgerType string) (err error) {
 
 	if quota > 0 {
-		err = model.DecreaseUserQuota(relayInfo.UserId, quota)
+		err = model.DecreaseUserQuotaWithLedger(relayInfo.UserId, quota, ledgerType, relayInfo.TokenId, relayInfo.OriginModelName)
 	} else {
-		err = model.IncreaseUserQuota(relayInfo.UserId, -quota, false)
+		err = model.IncreaseUserQuotaWithLedger(relayInfo.UserId, -quota, false, ledgerType, relayInfo.TokenId, relayInfo.OriginModelName)
 	}
 	if err != nil {
 		return err
@@ -521,6 +535,13 @@ func PostConsumeQuota(relayInfo *relaycommon.RelayInfo, quota int, preConsumedQu
 		if err != nil {
 			return err
 		}
+		// 本次消耗未达到鉴权时的剩余额度，令牌不可能被用尽，无需查询令牌
+		if quota > 0 && !relayInfo.TokenUnlimited && operation_setting.GetWebhookSetting().Enabled &&
+			relayInfo.TokenRemainQuota <= quota+preConsumedQuota {
+			gopool.Go(func() {
+				NotifyTokenQuotaExhaustedWebhook(relayInfo.UserId, relayInfo.TokenId, relayInfo.TokenKey)
+			})
+		}
 	}
 
 	if sendEmail {
@@ -0,0 +1,191 @@
+package service
+
+import (
+	"net/http"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/constant"
+	"github.com/QuantumNous/new-api/model"
+	"github.com/QuantumNous/new-api/setting/operation_setting"
+
+	"github.com/gin-gonic/gin"
+)
+
+// RoutingRequest 路由条件可使用的请求属性
+type RoutingRequest struct {
+	Model        string
+	Group        string
+	UserGroup    string
+	TokenName    string
+	PromptTokens func() int // 仅在规则使用 prompt_tokens 条件时调用
+	HasImage     bool
+	HasAudio     bool
+	HasVideo     bool
+	HasFile      bool
+	HasTools     bool
+	Stream       bool
+	Header       http.Header
+}
+
+// RoutingDecision 命中的路由规则，渠道选择和重试时都按其限定候选渠道
+type RoutingDecision struct {
+	Rule         string
+	Model        string
+	RequestModel string // 规则改写前请求的模型，改写后的模型无可用渠道时回退使用
+	Filter       *model.ChannelFilter
+	Fallback     bool
+}
+
+var routingRegexCache sync.Map
+
+// MatchRoutingRule 按顺序返回第一条命中的路由规则
+func MatchRoutingRule(request *RoutingRequest) *RoutingDecision {
+	if !operation_setting.RoutingEnabled() {
+		return nil
+	}
+	for _, rule := range operation_setting.GetRoutingSetting().Rules {
+		if !rule.Enabled || !matchRoutingConditions(request, rule.Conditions) {
+			continue
+		}
+		decision := &RoutingDecision{Rule: rule.Name, Fallback: rule.Action.Fallback}
+		switch rule.Action.Type {
+		case operation_setting.RoutingActionTag:
+			decision.Filter = &model.ChannelFilter{Tag: rule.Action.Tag}
+		case operation_setting.RoutingActionChannels:
+			decision.Filter = &model.ChannelFilter{ChannelIds: rule.Action.ChannelIds}
+		case operation_setting.RoutingActionModel:
+			decision.Model = rule.Action.Model
+		default:
+			continue
+		}
+		return decision
+	}
+	return nil
+}
+
+func matchRoutingConditions(request *RoutingRequest, conditions []operation_setting.RoutingCondition) bool {
+	for _, condition := range conditions {
+		if !matchRoutingCondition(request, condition) {
+			return false
+		}
+	}
+	return true
+}
+
+func matchRoutingCondition(request *RoutingRequest, condition operation_setting.RoutingCondition) bool {
+	var value string
+	exists := true
+	switch condition.Field {
+	case operation_setting.RoutingFieldModel:
+		value = request.Model
+	case operation_setting.RoutingFieldGroup:
+		value = request.Group
+	case operation_setting.RoutingFieldUserGroup:
+		value = request.UserGroup
+	case operation_setting.RoutingFieldTokenName:
+		value = request.TokenName
+	case operation_setting.RoutingFieldPromptTokens:
+		promptTokens := 0
+		if request.PromptTokens != nil {
+			promptTokens = request.PromptTokens()
+		}
+		value = strconv.Itoa(promptTokens)
+	case operation_setting.RoutingFieldHasImage:
+		value = strconv.FormatBool(request.HasImage)
+	case operation_setting.RoutingFieldHasAudio:
+		value = strconv.FormatBool(request.HasAudio)
+	case operation_setting.RoutingFieldHasVideo:
+		value = strconv.FormatBool(request.HasVideo)
+	case operation_setting.RoutingFieldHasFile:
+		value = strconv.FormatBool(request.HasFile)
+	case operation_setting.RoutingFieldHasTools:
+		value = strconv.FormatBool(request.HasTools)
+	case operation_setting.RoutingFieldStream:
+		value = strconv.FormatBool(request.Stream)
+	default:
+		name, ok := strings.CutPrefix(condition.Field, operation_setting.RoutingFieldHeaderPrefix)
+		if !ok {
+			return false
+		}
+		values := request.Header.Values(name)
+		exists = len(values) > 0
+		value = strings.Join(values, ",")
+	}
+
+	expected := condition.Value
+	switch condition.Operator {
+	case "", operation_setting.RoutingOperatorEq:
+		// 布尔字段省略值时视为 true
+		if expected == "" && (value == "true" || value == "false") {
+			expected = "true"
+		}
+		return exists && strings.EqualFold(value, expected)
+	case operation_setting.RoutingOperatorNe:
+		return !strings.EqualFold(value, expected)
+	case operation_setting.RoutingOperatorGt, operation_setting.RoutingOperatorGte,
+		operation_setting.RoutingOperatorLt, operation_setting.RoutingOperatorLte:
+		actual, err := strconv.ParseFloat(value, 64)
+		if err != nil {
+			return false
+		}
+		threshold, err := strconv.ParseFloat(expected, 64)
+		if err != nil {
+			return false
+		}
+		switch condition.Operator {
+		case operation_setting.RoutingOperatorGt:
+			return actual > threshold
+		case operation_setting.RoutingOperatorGte:
+			return actual >= threshold
+		case operation_setting.RoutingOperatorLt:
+			return actual < threshold
+		default:
+			return actual <= threshold
+		}
+	case operation_setting.RoutingOperatorIn:
+		return exists && slices.ContainsFunc(strings.Split(expected, ","), func(item string) bool {
+			return strings.EqualFold(strings.TrimSpace(item), value)
+		})
+	case operation_setting.RoutingOperatorNotIn:
+		return !slices.ContainsFunc(strings.Split(expected, ","), func(item string) bool {
+			return strings.EqualFold(strings.TrimSpace(item), value)
+		})
+	case operation_setting.RoutingOperatorContains:
+		return exists && strings.Contains(strings.ToLower(value), strings.ToLower(expected))
+	case operation_setting.RoutingOperatorPrefix:
+		return exists && strings.HasPrefix(value, expected)
+	case operation_setting.RoutingOperatorRegex:
+		re, err := getRoutingRegex(expected)
+		return err == nil && exists && re.MatchString(value)
+	case operation_setting.RoutingOperatorExists:
+		return exists && value != ""
+	}
+	return false
+}
+
+func getRoutingRegex(pattern string) (*regexp.Regexp, error) {
+	if re, ok := routingRegexCache.Load(pattern); ok {
+		return re.(*regexp.Regexp), nil
+	}
+	re, err := regexp.Compile(pattern)
+	if err != nil {
+		return nil, err
+	}
+	routingRegexCache.Store(pattern, re)
+	return re, nil
+}
+
+func SetRoutingDecision(c *gin.Context, decision *RoutingDecision) {
+	common.SetContextKey(c, constant.ContextKeyRoutingDecision, decision)
+}
+
+// GetRoutingDecision 返回当前请求命中的路由规则，未命中时返回 nil
+func GetRoutingDecision(c *gin.Context) *RoutingDecision {
+	decision, _ := common.GetContextKeyType[*RoutingDecision](c, constant.ContextKeyRoutingDecision)
+	return decision
+}
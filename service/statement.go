@@ -0,0 +1,281 @@
+package service
+
+import (
+	"bytes"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"html/template"
+	"math"
+	"strconv"
+	"time"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/model"
+	"github.com/QuantumNous/new-api/setting/operation_setting"
+)
+
+const statementPeriodLayout = "2006-01"
+
+// ErrStatementEmpty 账期内没有产生费用，不生成账单
+var ErrStatementEmpty = errors.New("账期内没有消费，无需生成账单")
+
+// ParseStatementPeriod 解析 YYYY-MM 格式的账期，返回账期的起止时间（左闭右开）
+func ParseStatementPeriod(period string) (time.Time, time.Time, error) {
+	start, err := time.ParseInLocation(statementPeriodLayout, period, time.Local)
+	if err != nil {
+		return time.Time{}, time.Time{}, errors.New("账期格式错误，应为 YYYY-MM")
+	}
+	return start, start.AddDate(0, 1, 0), nil
+}
+
+// statementCurrency 按额度展示设置确定账单币种；以 token 数展示时账单仍使用美元
+func statementCurrency() (currency string, symbol string, rate float64) {
+	switch operation_setting.GetQuotaDisplayType() {
+	case operation_setting.QuotaDisplayTypeCNY:
+		return "CNY", "¥", operation_setting.USDExchangeRate
+	case operation_setting.QuotaDisplayTypeCustom:
+		return "CUSTOM", operation_setting.GetCurrencySymbol(), operation_setting.GetUsdToCurrencyRate(operation_setting.USDExchangeRate)
+	default:
+		return "USD", "$", 1
+	}
+}
+
+func quotaToStatementAmount(quota int, rate float64) float64 {
+	return math.Round(float64(quota)/common.QuotaPerUnit*rate*100) / 100
+}
+
+// GenerateStatement 生成用户（userId）或分组（groupName）在指定账期的账单；同一账期已生成过时直接返回已有账单
+func GenerateStatement(userId int, groupName string, period string) (*model.Statement, error) {
+	if (userId == 0) == (groupName == "") {
+		return nil, errors.New("需要指定用户或分组其中之一")
+	}
+	start, end, err := ParseStatementPeriod(period)
+	if err != nil {
+		return nil, err
+	}
+	if end.After(time.Now()) {
+		return nil, errors.New("账期尚未结束")
+	}
+	existing, err := model.GetStatementBySubject(userId, groupName, period)
+	if err != nil || existing != nil {
+		return existing, err
+	}
+
+	var userIds []int
+	if groupName != "" {
+		userIds, err = model.GetUserIdsByGroup(groupName)
+		if err != nil {
+			return nil, err
+		}
+	} else {
+		if _, err := model.GetUserById(userId, false); err != nil {
+			return nil, err
+		}
+		userIds = []int{userId}
+	}
+	items, err := model.GetStatementLineItems(userIds, start.Unix(), end.Unix())
+	if err != nil {
+		return nil, err
+	}
+
+	currency, symbol, rate := statementCurrency()
+	statement := &model.Statement{
+		UserId:         userId,
+		GroupName:      groupName,
+		Period:         period,
+		PeriodStart:    start.Unix(),
+		PeriodEnd:      end.Unix(),
+		Currency:       currency,
+		CurrencySymbol: symbol,
+		ExchangeRate:   rate,
+	}
+	for i := range items {
+		items[i].Amount = quotaToStatementAmount(items[i].Quota, rate)
+		statement.TotalQuota += items[i].Quota
+		statement.TotalAmount += items[i].Amount
+	}
+	if statement.TotalQuota == 0 {
+		return nil, ErrStatementEmpty
+	}
+	statement.TotalAmount = math.Round(statement.TotalAmount*100) / 100
+	statement.Items = items
+	if err := statement.Insert(); err != nil {
+		return nil, err
+	}
+	return statement, nil
+}
+
+// statementSubject 账单抬头中的客户名称
+func statementSubject(statement *model.Statement) string {
+	if statement.GroupName != "" {
+		return "Group " + statement.GroupName
+	}
+	username, err := model.GetUsernameById(statement.UserId, false)
+	if err != nil || username == "" {
+		return fmt.Sprintf("User #%d", statement.UserId)
+	}
+	return fmt.Sprintf("%s (#%d)", username, statement.UserId)
+}
+
+func statementIssuer() string {
+	if name := operation_setting.GetStatementSetting().IssuerName; name != "" {
+		return name
+	}
+	return common.SystemName
+}
+
+func formatStatementAmount(statement *model.Statement, amount float64) string {
+	return statement.CurrencySymbol + strconv.FormatFloat(amount, 'f', 2, 64)
+}
+
+var statementHTMLTemplate = template.Must(template.New("statement").Funcs(template.FuncMap{
+	"date": func(ts int64) string { return time.Unix(ts, 0).Format("2006-01-02") },
+}).Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="UTF-8">
+<title>{{.Statement.InvoiceNo}}</title>
+<style>
+body { font-family: -apple-system, "Segoe UI", "PingFang SC", "Microsoft YaHei", sans-serif; color: #222; margin: 40px; }
+h1 { font-size: 22px; margin-bottom: 4px; }
+.meta td { padding: 2px 16px 2px 0; }
+table.items { width: 100%; border-collapse: collapse; margin-top: 24px; font-size: 13px; }
+table.items th, table.items td { border-bottom: 1px solid #ddd; padding: 6px 8px; text-align: left; }
+table.items td.num, table.items th.num { text-align: right; }
+.total { text-align: right; font-size: 16px; font-weight: bold; margin-top: 16px; }
+.issuer { white-space: pre-line; color: #555; }
+@media print { body { margin: 0; } }
+</style>
+</head>
+<body>
+<h1>Statement {{.Statement.InvoiceNo}}</h1>
+<div class="issuer"><strong>{{.Issuer}}</strong>
+{{.IssuerInfo}}</div>
+<table class="meta">
+<tr><td>Bill to</td><td>{{.Subject}}</td></tr>
+<tr><td>Billing period</td><td>{{date .Statement.PeriodStart}} – {{date .Statement.PeriodEnd}} (exclusive)</td></tr>
+<tr><td>Issued</td><td>{{date .Statement.CreatedAt}}</td></tr>
+<tr><td>Currency</td><td>{{.Statement.Currency}} (1 USD = {{.Statement.ExchangeRate}})</td></tr>
+</table>
+<table class="items">
+<tr><th>Model</th><th>Token</th><th>Group</th><th class="num">Requests</th><th class="num">Prompt tokens</th><th class="num">Completion tokens</th><th class="num">Amount</th></tr>
+{{range .Items}}<tr><td>{{.ModelName}}</td><td>{{.TokenName}}</td><td>{{.GroupName}}</td><td class="num">{{.Requests}}</td><td class="num">{{.PromptTokens}}</td><td class="num">{{.CompletionTokens}}</td><td class="num">{{.Amount}}</td></tr>
+{{end}}</table>
+<div class="total">Total: {{.Total}}</div>
+</body>
+</html>
+`))
+
+type statementHTMLItem struct {
+	model.StatementLineItem
+	Amount string
+}
+
+// RenderStatementHTML 生成可直接打印的 HTML 账单
+func RenderStatementHTML(statement *model.Statement) ([]byte, error) {
+	items := make([]statementHTMLItem, 0, len(statement.Items))
+	for _, item := range statement.Items {
+		items = append(items, statementHTMLItem{StatementLineItem: item, Amount: formatStatementAmount(statement, item.Amount)})
+	}
+	var buf bytes.Buffer
+	err := statementHTMLTemplate.Execute(&buf, map[string]interface{}{
+		"Statement":  statement,
+		"Issuer":     statementIssuer(),
+		"IssuerInfo": operation_setting.GetStatementSetting().IssuerInfo,
+		"Subject":    statementSubject(statement),
+		"Items":      items,
+		"Total":      formatStatementAmount(statement, statement.TotalAmount),
+	})
+	return buf.Bytes(), err
+}
+
+// RenderStatementCSV 生成 CSV 账单，每行一条明细，最后一行为合计
+func RenderStatementCSV(statement *model.Statement) ([]byte, error) {
+	var buf bytes.Buffer
+	writer := csv.NewWriter(&buf)
+	_ = writer.Write([]string{"invoice_no", "period", "currency", "model", "token", "group", "requests", "prompt_tokens", "completion_tokens", "total_tokens", "quota", "amount"})
+	for _, item := range statement.Items {
+		_ = writer.Write([]string{
+			statement.InvoiceNo,
+			statement.Period,
+			statement.Currency,
+			item.ModelName,
+			item.TokenName,
+			item.GroupName,
+			strconv.Itoa(item.Requests),
+			strconv.Itoa(item.PromptTokens),
+			strconv.Itoa(item.CompletionTokens),
+			strconv.Itoa(item.TotalTokens),
+			strconv.Itoa(item.Quota),
+			strconv.FormatFloat(item.Amount, 'f', 2, 64),
+		})
+	}
+	_ = writer.Write([]string{statement.InvoiceNo, statement.Period, statement.Currency, "TOTAL", "", "", "", "", "", "", strconv.Itoa(statement.TotalQuota), strconv.FormatFloat(statement.TotalAmount, 'f', 2, 64)})
+	writer.Flush()
+	return buf.Bytes(), writer.Error()
+}
+
+// RenderStatementPDF 生成 PDF 账单
+func RenderStatementPDF(statement *model.Statement) []byte {
+	pdf := newStatementPDF()
+	pdf.text(0, 18, true, "Statement "+statement.InvoiceNo)
+	pdf.newLine(24)
+	pdf.text(0, 10, true, statementIssuer())
+	for _, line := range splitLines(operation_setting.GetStatementSetting().IssuerInfo) {
+		pdf.newLine(13)
+		pdf.text(0, 9, false, line)
+	}
+	pdf.newLine(22)
+	meta := [][2]string{
+		{"Bill to", statementSubject(statement)},
+		{"Billing period", time.Unix(statement.PeriodStart, 0).Format("2006-01-02") + " - " + time.Unix(statement.PeriodEnd, 0).Format("2006-01-02") + " (exclusive)"},
+		{"Issued", time.Unix(statement.CreatedAt, 0).Format("2006-01-02")},
+		{"Currency", fmt.Sprintf("%s (1 USD = %s)", statement.Currency, strconv.FormatFloat(statement.ExchangeRate, 'f', -1, 64))},
+	}
+	for _, row := range meta {
+		pdf.text(0, 10, false, row[0])
+		pdf.text(100, 10, false, row[1])
+		pdf.newLine(14)
+	}
+	pdf.newLine(10)
+
+	columns := []float64{0, 150, 250, 320, 370, 420, 470}
+	header := []string{"Model", "Token", "Group", "Requests", "Prompt", "Completion", "Amount"}
+	for i, title := range header {
+		pdf.text(columns[i], 9, true, title)
+	}
+	pdf.newLine(14)
+	for _, item := range statement.Items {
+		cells := []string{
+			truncateRunes(item.ModelName, 28),
+			truncateRunes(item.TokenName, 18),
+			truncateRunes(item.GroupName, 12),
+			strconv.Itoa(item.Requests),
+			strconv.Itoa(item.PromptTokens),
+			strconv.Itoa(item.CompletionTokens),
+			strconv.FormatFloat(item.Amount, 'f', 2, 64),
+		}
+		for i, cell := range cells {
+			pdf.text(columns[i], 9, false, cell)
+		}
+		pdf.newLine(13)
+	}
+	pdf.newLine(10)
+	pdf.text(columns[5], 11, true, "Total")
+	pdf.text(columns[6], 11, true, fmt.Sprintf("%s %s", statement.Currency, strconv.FormatFloat(statement.TotalAmount, 'f', 2, 64)))
+	return pdf.bytes()
+}
+
+// SendStatementEmail 将 HTML 账单以邮件形式发送给用户
+func SendStatementEmail(statement *model.Statement, email string) error {
+	content, err := RenderStatementHTML(statement)
+	if err != nil {
+		return err
+	}
+	subject := fmt.Sprintf("%s 账单 %s（%s）", common.SystemName, statement.InvoiceNo, statement.Period)
+	if err := common.SendEmail(subject, email, string(content)); err != nil {
+		return err
+	}
+	return model.MarkStatementEmailSent(statement.Id)
+}
@@ -0,0 +1,117 @@
+package service
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+)
+
+// statementPDF 生成账单用的最小 PDF 写入器，仅使用 PDF 内置的 Helvetica 字体，
+// 因此只能显示 Latin-1 字符，其余字符以 ? 代替；需要完整字符集时请使用 HTML 账单打印
+type statementPDF struct {
+	pages []*bytes.Buffer
+	y     float64
+}
+
+const (
+	statementPDFWidth  = 595.0 // A4
+	statementPDFHeight = 842.0
+	statementPDFMargin = 50.0
+)
+
+func newStatementPDF() *statementPDF {
+	pdf := &statementPDF{}
+	pdf.addPage()
+	return pdf
+}
+
+func (pdf *statementPDF) addPage() {
+	pdf.pages = append(pdf.pages, &bytes.Buffer{})
+	pdf.y = statementPDFHeight - statementPDFMargin
+}
+
+// text 在当前行的 x 偏移处写入文本
+func (pdf *statementPDF) text(x float64, size float64, bold bool, s string) {
+	font := "F1"
+	if bold {
+		font = "F2"
+	}
+	page := pdf.pages[len(pdf.pages)-1]
+	fmt.Fprintf(page, "BT /%s %.1f Tf %.2f %.2f Td (%s) Tj ET\n", font, size, statementPDFMargin+x, pdf.y, escapePDFText(s))
+}
+
+// newLine 换行，超出页面底部时新建一页
+func (pdf *statementPDF) newLine(height float64) {
+	pdf.y -= height
+	if pdf.y < statementPDFMargin {
+		pdf.addPage()
+	}
+}
+
+func (pdf *statementPDF) bytes() []byte {
+	var out bytes.Buffer
+	offsets := make([]int, 0)
+	writeObject := func(content string) {
+		offsets = append(offsets, out.Len())
+		fmt.Fprintf(&out, "%d 0 obj\n%s\nendobj\n", len(offsets), content)
+	}
+
+	out.WriteString("%PDF-1.4\n")
+	// 1: Catalog, 2: Pages, 3/4: 字体，之后每页依次为内容流和页面对象
+	pageCount := len(pdf.pages)
+	kids := make([]string, 0, pageCount)
+	for i := 0; i < pageCount; i++ {
+		kids = append(kids, fmt.Sprintf("%d 0 R", 6+i*2))
+	}
+	writeObject("<< /Type /Catalog /Pages 2 0 R >>")
+	writeObject(fmt.Sprintf("<< /Type /Pages /Kids [%s] /Count %d >>", strings.Join(kids, " "), pageCount))
+	writeObject("<< /Type /Font /Subtype /Type1 /BaseFont /Helvetica /Encoding /WinAnsiEncoding >>")
+	writeObject("<< /Type /Font /Subtype /Type1 /BaseFont /Helvetica-Bold /Encoding /WinAnsiEncoding >>")
+	for i, page := range pdf.pages {
+		writeObject(fmt.Sprintf("<< /Length %d >>\nstream\n%sendstream", page.Len(), page.String()))
+		writeObject(fmt.Sprintf("<< /Type /Page /Parent 2 0 R /MediaBox [0 0 %.0f %.0f] /Resources << /Font << /F1 3 0 R /F2 4 0 R >> >> /Contents %d 0 R >>",
+			statementPDFWidth, statementPDFHeight, 5+i*2))
+	}
+
+	xref := out.Len()
+	fmt.Fprintf(&out, "xref\n0 %d\n0000000000 65535 f \n", len(offsets)+1)
+	for _, offset := range offsets {
+		fmt.Fprintf(&out, "%010d 00000 n \n", offset)
+	}
+	fmt.Fprintf(&out, "trailer\n<< /Size %d /Root 1 0 R >>\nstartxref\n%d\n%%%%EOF\n", len(offsets)+1, xref)
+	return out.Bytes()
+}
+
+// escapePDFText 转义 PDF 字符串中的特殊字符，并将 WinAnsi 之外的字符替换为 ?
+func escapePDFText(s string) string {
+	var b strings.Builder
+	for _, r := range s {
+		switch {
+		case r == '\\' || r == '(' || r == ')':
+			b.WriteByte('\\')
+			b.WriteRune(r)
+		case r >= 0x20 && r < 0x7f:
+			b.WriteRune(r)
+		case r >= 0xa0 && r <= 0xff:
+			fmt.Fprintf(&b, "\\%03o", r)
+		default:
+			b.WriteByte('?')
+		}
+	}
+	return b.String()
+}
+
+func splitLines(s string) []string {
+	if strings.TrimSpace(s) == "" {
+		return nil
+	}
+	return strings.Split(strings.ReplaceAll(s, "\r\n", "\n"), "\n")
+}
+
+func truncateRunes(s string, n int) string {
+	runes := []rune(s)
+	if len(runes) <= n {
+		return s
+	}
+	return string(runes[:n-3]) + "..."
+}
@@ -0,0 +1,36 @@
+package service
+
+import (
+	"math"
+
+	"github.com/QuantumNous/new-api/model"
+)
+
+// SubscriptionProration 套餐变更的按比例折算结果
+type SubscriptionProration struct {
+	RemainingRatio float64 `json:"remaining_ratio"` // 当前周期剩余时间占比
+	Credit         float64 `json:"credit"`          // 原套餐剩余时间的价值
+	Charge         float64 `json:"charge"`          // 新套餐剩余时间的价格
+	AmountDue      float64 `json:"amount_due"`      // 需补交的金额，降级时为 0
+	QuotaDelta     int     `json:"quota_delta"`     // 立即补发的额度，降级时为 0
+	Upgrade        bool    `json:"upgrade"`         // 新套餐价格不低于原套餐时视为升级，立即生效；否则下个周期生效
+}
+
+// CalcSubscriptionProration 按当前周期剩余时间折算套餐变更的差价与额度差
+func CalcSubscriptionProration(subscription *model.Subscription, from *model.SubscriptionPlan, to *model.SubscriptionPlan, now int64) SubscriptionProration {
+	result := SubscriptionProration{Upgrade: to.Price >= from.Price}
+	total := subscription.CurrentPeriodEnd - subscription.CurrentPeriodStart
+	if total > 0 && subscription.CurrentPeriodEnd > now {
+		result.RemainingRatio = float64(subscription.CurrentPeriodEnd-now) / float64(total)
+		result.RemainingRatio = math.Min(result.RemainingRatio, 1)
+	}
+	result.Credit = math.Round(from.Price*result.RemainingRatio*100) / 100
+	result.Charge = math.Round(to.Price*result.RemainingRatio*100) / 100
+	if result.Upgrade {
+		result.AmountDue = math.Max(result.Charge-result.Credit, 0)
+		if to.QuotaPerPeriod > from.QuotaPerPeriod {
+			result.QuotaDelta = int(float64(to.QuotaPerPeriod-from.QuotaPerPeriod) * result.RemainingRatio)
+		}
+	}
+	return result
+}
@@ -300,7 +300,7 @@ func CountRequestToken(c *gin.Context, meta *types.TokenCountMeta, info *relayco
 	if meta.TokenType == types.TokenTypeTextNumber {
 		tkm += utf8.RuneCountInString(meta.CombineText)
 	} else {
-		tkm += CountTextToken(meta.CombineText, model)
+		tkm += CountRequestTextToken(c, meta.CombineText, model)
 	}
 
 	if info.RelayFormat == types.RelayFormatOpenAI {
@@ -388,6 +388,21 @@ func CountRequestToken(c *gin.Context, meta *types.TokenCountMeta, info *relayco
 	return tkm, nil
 }
 
+type requestTextTokens struct {
+	model  string
+	tokens int
+}
+
+// CountRequestTextToken 计算请求文本的 token 数并缓存在上下文中，路由规则和预扣费共用同一次计数
+func CountRequestTextToken(c *gin.Context, text string, model string) int {
+	if cached, ok := common.GetContextKeyType[requestTextTokens](c, constant.ContextKeyRequestTextTokens); ok && cached.model == model {
+		return cached.tokens
+	}
+	tokens := CountTextToken(text, model)
+	common.SetContextKey(c, constant.ContextKeyRequestTextTokens, requestTextTokens{model: model, tokens: tokens})
+	return tokens
+}
+
 func CountTokenClaudeRequest(request dto.ClaudeRequest, model string) (int, error) {
 	tkm := 0
 
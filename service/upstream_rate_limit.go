@@ -0,0 +1,112 @@
+package service
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/QuantumNous/new-api/model"
+)
+
+// 上游未提供重置时间时，假定额度在该时间后恢复
+const defaultRateLimitResetSeconds = 60
+
+// UpdateChannelRateLimitFromHeader 解析上游响应中的限流头并更新对应渠道和 key 的额度，
+// 支持 OpenAI 风格的 x-ratelimit-*、Anthropic 的 anthropic-ratelimit-* 以及通用的 x-ratelimit-limit/remaining/reset
+func UpdateChannelRateLimitFromHeader(channelId int, keyIndex int, header http.Header) {
+	if header == nil {
+		return
+	}
+	budget := model.ChannelRateLimitBudget{
+		KeyIndex:          keyIndex,
+		LimitRequests:     -1,
+		RemainingRequests: -1,
+		LimitTokens:       -1,
+		RemainingTokens:   -1,
+	}
+	now := time.Now()
+	found := false
+
+	// OpenAI / Groq / DeepSeek 等：x-ratelimit-{limit,remaining,reset}-{requests,tokens}
+	if v := header.Get("x-ratelimit-remaining-requests"); v != "" {
+		found = true
+		budget.LimitRequests = parseRateLimitInt(header.Get("x-ratelimit-limit-requests"))
+		budget.RemainingRequests = parseRateLimitInt(v)
+		budget.ResetRequests = parseRateLimitReset(header.Get("x-ratelimit-reset-requests"), now)
+	}
+	if v := header.Get("x-ratelimit-remaining-tokens"); v != "" {
+		found = true
+		budget.LimitTokens = parseRateLimitInt(header.Get("x-ratelimit-limit-tokens"))
+		budget.RemainingTokens = parseRateLimitInt(v)
+		budget.ResetTokens = parseRateLimitReset(header.Get("x-ratelimit-reset-tokens"), now)
+	}
+
+	// Anthropic：anthropic-ratelimit-{requests,tokens,input-tokens}-{limit,remaining,reset}
+	if v := header.Get("anthropic-ratelimit-requests-remaining"); v != "" {
+		found = true
+		budget.LimitRequests = parseRateLimitInt(header.Get("anthropic-ratelimit-requests-limit"))
+		budget.RemainingRequests = parseRateLimitInt(v)
+		budget.ResetRequests = parseRateLimitReset(header.Get("anthropic-ratelimit-requests-reset"), now)
+	}
+	for _, prefix := range []string{"anthropic-ratelimit-tokens", "anthropic-ratelimit-input-tokens"} {
+		if v := header.Get(prefix + "-remaining"); v != "" {
+			found = true
+			budget.LimitTokens = parseRateLimitInt(header.Get(prefix + "-limit"))
+			budget.RemainingTokens = parseRateLimitInt(v)
+			budget.ResetTokens = parseRateLimitReset(header.Get(prefix+"-reset"), now)
+			break
+		}
+	}
+
+	// 通用格式：x-ratelimit-{limit,remaining,reset}，按请求数处理
+	if !found {
+		if v := header.Get("x-ratelimit-remaining"); v != "" {
+			found = true
+			budget.LimitRequests = parseRateLimitInt(header.Get("x-ratelimit-limit"))
+			budget.RemainingRequests = parseRateLimitInt(v)
+			budget.ResetRequests = parseRateLimitReset(header.Get("x-ratelimit-reset"), now)
+		}
+	}
+
+	if !found {
+		return
+	}
+	model.UpdateChannelRateLimitBudget(channelId, budget)
+}
+
+func parseRateLimitInt(value string) int64 {
+	value = strings.TrimSpace(value)
+	if value == "" {
+		return -1
+	}
+	if n, err := strconv.ParseInt(value, 10, 64); err == nil {
+		return n
+	}
+	if f, err := strconv.ParseFloat(value, 64); err == nil {
+		return int64(f)
+	}
+	return -1
+}
+
+// parseRateLimitReset 将重置时间解析为秒级时间戳，支持 Go 风格时长（6m0s、20ms）、RFC3339 时间、秒数和 Unix 时间戳
+func parseRateLimitReset(value string, now time.Time) int64 {
+	value = strings.TrimSpace(value)
+	if value == "" {
+		return now.Unix() + defaultRateLimitResetSeconds
+	}
+	if f, err := strconv.ParseFloat(value, 64); err == nil {
+		// 足够大的数值视为 Unix 时间戳
+		if f > 1e9 {
+			return int64(f)
+		}
+		return now.Add(time.Duration(f * float64(time.Second))).Unix()
+	}
+	if d, err := time.ParseDuration(value); err == nil {
+		return now.Add(d).Unix()
+	}
+	if t, err := time.Parse(time.RFC3339, value); err == nil {
+		return t.Unix()
+	}
+	return now.Unix() + defaultRateLimitResetSeconds
+}
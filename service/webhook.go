@@ -7,6 +7,7 @@ import (
 	"encoding/hex"
 	"encoding/json"
 	"fmt"
+	"io"
 	"net/http"
 	"time"
 
@@ -54,73 +55,66 @@ func SendWebhookNotify(webhookURL string, secret string, data dto.Notify) error
 		return fmt.Errorf("failed to marshal webhook payload: %v", err)
 	}
 
-	// 创建 HTTP 请求
-	var req *http.Request
-	var resp *http.Response
+	headers := map[string]string{
+		"Content-Type": "application/json",
+	}
+	// 如果有 secret，生成签名
+	if secret != "" {
+		headers["X-Webhook-Signature"] = generateSignature(secret, payloadBytes)
+		if system_setting.EnableWorker() {
+			headers["Authorization"] = "Bearer " + secret
+		}
+	}
+
+	statusCode, err := doWebhookRequest(GetHttpClient(), webhookURL, headers, payloadBytes)
+	if err != nil {
+		return err
+	}
+	// 检查响应状态
+	if statusCode < 200 || statusCode >= 300 {
+		return fmt.Errorf("webhook request failed with status code: %d", statusCode)
+	}
+
+	return nil
+}
 
+// doWebhookRequest 发送 webhook 请求并返回响应状态码，启用 Worker 时经由 Worker 转发，否则进行 SSRF 校验后直接请求
+func doWebhookRequest(client *http.Client, webhookURL string, headers map[string]string, payload []byte) (int, error) {
+	var resp *http.Response
+	var err error
 	if system_setting.EnableWorker() {
 		// 构建worker请求数据
 		workerReq := &WorkerRequest{
-			URL:    webhookURL,
-			Key:    system_setting.WorkerValidKey,
-			Method: http.MethodPost,
-			Headers: map[string]string{
-				"Content-Type": "application/json",
-			},
-			Body: payloadBytes,
+			URL:     webhookURL,
+			Key:     system_setting.WorkerValidKey,
+			Method:  http.MethodPost,
+			Headers: headers,
+			Body:    payload,
 		}
-
-		// 如果有secret，添加签名到headers
-		if secret != "" {
-			signature := generateSignature(secret, payloadBytes)
-			workerReq.Headers["X-Webhook-Signature"] = signature
-			workerReq.Headers["Authorization"] = "Bearer " + secret
-		}
-
 		resp, err = DoWorkerRequest(workerReq)
 		if err != nil {
-			return fmt.Errorf("failed to send webhook request through worker: %v", err)
-		}
-		defer resp.Body.Close()
-
-		// 检查响应状态
-		if resp.StatusCode < 200 || resp.StatusCode >= 300 {
-			return fmt.Errorf("webhook request failed with status code: %d", resp.StatusCode)
+			return 0, fmt.Errorf("failed to send webhook request through worker: %v", err)
 		}
 	} else {
 		// SSRF防护：验证Webhook URL（非Worker模式）
 		fetchSetting := system_setting.GetFetchSetting()
 		if err := common.ValidateURLWithFetchSetting(webhookURL, fetchSetting.EnableSSRFProtection, fetchSetting.AllowPrivateIp, fetchSetting.DomainFilterMode, fetchSetting.IpFilterMode, fetchSetting.DomainList, fetchSetting.IpList, fetchSetting.AllowedPorts, fetchSetting.ApplyIPFilterForDomain); err != nil {
-			return fmt.Errorf("request reject: %v", err)
+			return 0, fmt.Errorf("request reject: %v", err)
 		}
 
-		req, err = http.NewRequest(http.MethodPost, webhookURL, bytes.NewBuffer(payloadBytes))
+		req, err := http.NewRequest(http.MethodPost, webhookURL, bytes.NewBuffer(payload))
 		if err != nil {
-			return fmt.Errorf("failed to create webhook request: %v", err)
+			return 0, fmt.Errorf("failed to create webhook request: %v", err)
 		}
-
-		// 设置请求头
-		req.Header.Set("Content-Type", "application/json")
-
-		// 如果有 secret，生成签名
-		if secret != "" {
-			signature := generateSignature(secret, payloadBytes)
-			req.Header.Set("X-Webhook-Signature", signature)
+		for key, value := range headers {
+			req.Header.Set(key, value)
 		}
-
-		// 发送请求
-		client := GetHttpClient()
 		resp, err = client.Do(req)
 		if err != nil {
-			return fmt.Errorf("failed to send webhook request: %v", err)
-		}
-		defer resp.Body.Close()
-
-		// 检查响应状态
-		if resp.StatusCode < 200 || resp.StatusCode >= 300 {
-			return fmt.Errorf("webhook request failed with status code: %d", resp.StatusCode)
+			return 0, fmt.Errorf("failed to send webhook request: %v", err)
 		}
 	}
-
-	return nil
+	defer resp.Body.Close()
+	_, _ = io.Copy(io.Discard, io.LimitReader(resp.Body, 64<<10))
+	return resp.StatusCode, nil
 }
@@ -0,0 +1,286 @@
+package service
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/constant"
+	"github.com/QuantumNous/new-api/model"
+	"github.com/QuantumNous/new-api/setting"
+	"github.com/QuantumNous/new-api/setting/operation_setting"
+	"github.com/QuantumNous/new-api/setting/system_setting"
+
+	"github.com/bytedance/gopkg/util/gopool"
+)
+
+// 定时重试时并发投递的数量
+const webhookDeliveryConcurrency = 8
+
+// EmitWebhookEvent 将用户事件写入投递队列并立即尝试投递，失败的投递由定时任务按指数退避重试
+func EmitWebhookEvent(userId int, eventId string, eventType string, data any) {
+	deliveries, err := model.EnqueueWebhookEvent(userId, eventId, eventType, data)
+	if err != nil {
+		common.SysError(fmt.Sprintf("failed to enqueue webhook event %s for user %d: %s", eventId, userId, err.Error()))
+		return
+	}
+	for _, delivery := range deliveries {
+		delivery := delivery
+		gopool.Go(func() {
+			DeliverWebhook(delivery)
+		})
+	}
+}
+
+// DeliverWebhook 认领并发送一次投递，成功后标记完成，失败时按指数退避安排下次重试，
+// 超过最大尝试次数后标记为失败
+func DeliverWebhook(delivery *model.WebhookDelivery) {
+	setting := operation_setting.GetWebhookSetting()
+	timeout := time.Duration(setting.TimeoutSeconds) * time.Second
+	if timeout <= 0 {
+		timeout = 10 * time.Second
+	}
+	// 租约需覆盖请求超时，避免请求尚未结束时被其他节点重复发送
+	claimed, err := model.ClaimWebhookDelivery(delivery, time.Now().Add(timeout+30*time.Second).Unix())
+	if err != nil || !claimed {
+		return
+	}
+
+	delivery.Attempts++
+	statusCode, err := sendWebhookDelivery(delivery, timeout)
+	delivery.LastStatusCode = statusCode
+	now := common.GetTimestamp()
+	switch {
+	case err == nil && statusCode >= 200 && statusCode < 300:
+		delivery.Status = model.WebhookDeliveryStatusSuccess
+		delivery.LastError = ""
+		delivery.DeliveredAt = now
+	default:
+		if err != nil {
+			delivery.LastError = err.Error()
+		} else {
+			delivery.LastError = fmt.Sprintf("webhook request failed with status code: %d", statusCode)
+		}
+		if delivery.Attempts >= setting.MaxAttempts {
+			delivery.Status = model.WebhookDeliveryStatusFailed
+		} else {
+			delivery.NextAttemptAt = now + webhookRetryDelay(delivery.Attempts)
+		}
+	}
+	if err := delivery.SaveResult(); err != nil {
+		common.SysError(fmt.Sprintf("failed to save webhook delivery %d: %s", delivery.Id, err.Error()))
+	}
+}
+
+// webhookRetryDelay 第 n 次失败后的重试间隔（秒），从 RetryBaseSeconds 开始每次翻倍，不超过 RetryMaxSeconds
+func webhookRetryDelay(attempts int) int64 {
+	setting := operation_setting.GetWebhookSetting()
+	delay := int64(setting.RetryBaseSeconds)
+	if delay <= 0 {
+		delay = 30
+	}
+	for i := 1; i < attempts && delay < int64(setting.RetryMaxSeconds); i++ {
+		delay *= 2
+	}
+	if setting.RetryMaxSeconds > 0 && delay > int64(setting.RetryMaxSeconds) {
+		delay = int64(setting.RetryMaxSeconds)
+	}
+	return delay
+}
+
+func sendWebhookDelivery(delivery *model.WebhookDelivery, timeout time.Duration) (int, error) {
+	subscription, err := model.GetWebhookSubscriptionById(delivery.SubscriptionId, delivery.UserId)
+	if err != nil {
+		return 0, fmt.Errorf("subscription not found: %v", err)
+	}
+	if !subscription.Enabled {
+		return 0, fmt.Errorf("subscription is disabled")
+	}
+	payload := []byte(delivery.Payload)
+	headers := map[string]string{
+		"Content-Type":        "application/json",
+		"X-Webhook-Event":     delivery.EventType,
+		"X-Webhook-Event-Id":  delivery.EventId,
+		"X-Webhook-Delivery":  strconv.Itoa(delivery.Id),
+		"X-Webhook-Signature": generateSignature(subscription.Secret, payload),
+	}
+	// 保留重定向校验，避免通过校验的地址再跳转到内网地址
+	client := &http.Client{
+		Transport:     GetHttpClient().Transport,
+		Timeout:       timeout,
+		CheckRedirect: checkRedirect,
+	}
+	return doWebhookRequest(client, subscription.Url, headers, payload)
+}
+
+// ProcessWebhookDeliveries 发送所有到达重试时间的投递
+func ProcessWebhookDeliveries() {
+	for {
+		deliveries, err := model.GetDueWebhookDeliveries(common.GetTimestamp(), 100)
+		if err != nil {
+			common.SysError("failed to get due webhook deliveries: " + err.Error())
+			return
+		}
+		if len(deliveries) == 0 {
+			return
+		}
+		var wg sync.WaitGroup
+		sem := make(chan struct{}, webhookDeliveryConcurrency)
+		for _, delivery := range deliveries {
+			delivery := delivery
+			wg.Add(1)
+			sem <- struct{}{}
+			gopool.Go(func() {
+				defer wg.Done()
+				defer func() { <-sem }()
+				DeliverWebhook(delivery)
+			})
+		}
+		wg.Wait()
+		if len(deliveries) < 100 {
+			return
+		}
+	}
+}
+
+// RedeliverWebhook 将已结束的投递重新放入队列并立即发送
+func RedeliverWebhook(delivery *model.WebhookDelivery) error {
+	if err := model.ResetWebhookDelivery(delivery); err != nil {
+		return err
+	}
+	gopool.Go(func() {
+		DeliverWebhook(delivery)
+	})
+	return nil
+}
+
+// PingWebhookSubscription 向指定订阅发送测试事件，用于验证地址和签名
+func PingWebhookSubscription(subscription *model.WebhookSubscription) (*model.WebhookDelivery, error) {
+	eventId := fmt.Sprintf("%s:%d:%s", model.WebhookEventPing, subscription.Id, common.GetRandomString(8))
+	payload, err := model.NewWebhookEventPayload(eventId, model.WebhookEventPing, map[string]any{
+		"subscription_id": subscription.Id,
+	})
+	if err != nil {
+		return nil, err
+	}
+	delivery := &model.WebhookDelivery{
+		SubscriptionId: subscription.Id,
+		UserId:         subscription.UserId,
+		EventId:        eventId,
+		EventType:      model.WebhookEventPing,
+		Payload:        payload,
+		Status:         model.WebhookDeliveryStatusPending,
+		NextAttemptAt:  common.GetTimestamp(),
+	}
+	if err := delivery.Insert(); err != nil {
+		return nil, err
+	}
+	DeliverWebhook(delivery)
+	return delivery, nil
+}
+
+// NotifyTaskWebhook 发送异步任务（视频、Suno）完成或失败事件
+func NotifyTaskWebhook(task *model.Task) {
+	eventType := model.WebhookEventTaskSucceeded
+	switch task.Status {
+	case model.TaskStatusSuccess:
+	case model.TaskStatusFailure:
+		eventType = model.WebhookEventTaskFailed
+	default:
+		return
+	}
+	data := map[string]any{
+		"task_id":     task.TaskID,
+		"platform":    task.Platform,
+		"action":      task.Action,
+		"status":      task.Status,
+		"progress":    task.Progress,
+		"quota":       task.Quota,
+		"submit_time": task.SubmitTime,
+		"finish_time": task.FinishTime,
+	}
+	if eventType == model.WebhookEventTaskFailed {
+		data["fail_reason"] = task.FailReason
+	} else if task.Platform != constant.TaskPlatformSuno {
+		data["result_url"] = fmt.Sprintf("%s/v1/videos/%s/content", system_setting.ServerAddress, task.TaskID)
+	}
+	EmitWebhookEvent(task.UserId, eventType+":"+task.TaskID, eventType, data)
+}
+
+// NotifyMidjourneyWebhook 发送 Midjourney 任务完成或失败事件
+func NotifyMidjourneyWebhook(task *model.Midjourney) {
+	eventType := model.WebhookEventTaskSucceeded
+	switch task.Status {
+	case "SUCCESS":
+	case "FAILURE":
+		eventType = model.WebhookEventTaskFailed
+	default:
+		return
+	}
+	data := map[string]any{
+		"task_id":     task.MjId,
+		"platform":    "mj",
+		"action":      task.Action,
+		"status":      task.Status,
+		"progress":    task.Progress,
+		"quota":       task.Quota,
+		"submit_time": task.SubmitTime,
+		"finish_time": task.FinishTime,
+	}
+	if eventType == model.WebhookEventTaskFailed {
+		data["fail_reason"] = task.FailReason
+	} else {
+		imageUrl := task.ImageUrl
+		if setting.MjForwardUrlEnabled {
+			imageUrl = system_setting.ServerAddress + "/mj/image/" + task.MjId
+		}
+		data["image_url"] = imageUrl
+	}
+	EmitWebhookEvent(task.UserId, eventType+":mj:"+task.MjId, eventType, data)
+}
+
+// NotifyTokenExpiringWebhooks 为订阅了令牌即将过期事件的用户扫描即将过期的令牌，同一令牌的同一过期时间只通知一次
+func NotifyTokenExpiringWebhooks() {
+	setting := operation_setting.GetWebhookSetting()
+	if !setting.Enabled || setting.TokenExpiringHours <= 0 {
+		return
+	}
+	userIds, err := model.GetWebhookSubscribedUserIds(model.WebhookEventTokenExpiring)
+	if err != nil {
+		common.SysError("failed to get webhook subscribed users: " + err.Error())
+		return
+	}
+	now := common.GetTimestamp()
+	for _, userId := range userIds {
+		tokens, err := model.GetUserTokensExpiringBefore(userId, now, now+int64(setting.TokenExpiringHours)*3600)
+		if err != nil {
+			common.SysError(fmt.Sprintf("failed to get expiring tokens for user %d: %s", userId, err.Error()))
+			continue
+		}
+		for _, token := range tokens {
+			EmitWebhookEvent(userId, fmt.Sprintf("%s:%d:%d", model.WebhookEventTokenExpiring, token.Id, token.ExpiredTime), model.WebhookEventTokenExpiring, map[string]any{
+				"token_id":     token.Id,
+				"token_name":   token.Name,
+				"expired_time": token.ExpiredTime,
+			})
+		}
+	}
+}
+
+// NotifyTokenQuotaExhaustedWebhook 令牌额度用尽时发送事件，同一令牌每天最多通知一次
+func NotifyTokenQuotaExhaustedWebhook(userId int, tokenId int, tokenKey string) {
+	token, err := model.GetTokenByKey(tokenKey, false)
+	if err != nil || token.UnlimitedQuota || token.RemainQuota > 0 {
+		return
+	}
+	eventId := fmt.Sprintf("%s:%d:%s", model.WebhookEventTokenQuotaExhaust, tokenId, time.Now().Format("20060102"))
+	EmitWebhookEvent(userId, eventId, model.WebhookEventTokenQuotaExhaust, map[string]any{
+		"token_id":     tokenId,
+		"token_name":   token.Name,
+		"used_quota":   token.UsedQuota,
+		"remain_quota": token.RemainQuota,
+	})
+}
@@ -0,0 +1,34 @@
+package model_setting
+
+import (
+	"github.com/QuantumNous/new-api/setting/config"
+)
+
+// RealtimeEmulationSettings 定义实时接口模拟的配置：上游不支持 Realtime WebSocket 的渠道，
+// 由网关按 Realtime 事件协议驱动流式对话补全，语音输入输出通过转写与语音合成模型串联
+type RealtimeEmulationSettings struct {
+	Enabled            bool   `json:"enabled"`
+	TranscriptionModel string `json:"transcription_model"`
+	SpeechModel        string `json:"speech_model"`
+	DefaultVoice       string `json:"default_voice"`
+}
+
+// 默认配置
+var defaultRealtimeEmulationSettings = RealtimeEmulationSettings{
+	Enabled:            false,
+	TranscriptionModel: "whisper-1",
+	SpeechModel:        "tts-1",
+	DefaultVoice:       "alloy",
+}
+
+// 全局实例
+var realtimeEmulationSettings = defaultRealtimeEmulationSettings
+
+func init() {
+	// 注册到全局配置管理器
+	config.GlobalConfig.Register("realtime_emulation", &realtimeEmulationSettings)
+}
+
+func GetRealtimeEmulationSettings() *RealtimeEmulationSettings {
+	return &realtimeEmulationSettings
+}
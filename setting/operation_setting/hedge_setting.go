@@ -0,0 +1,40 @@
+package operation_setting
+
+import (
+	"slices"
+
+	"github.com/QuantumNous/new-api/setting/config"
+)
+
+type HedgeSetting struct {
+	// 是否允许对冲请求，关闭时分组和令牌上的对冲配置均不生效
+	Enabled bool `json:"enabled"`
+	// 启用对冲的分组，令牌也可以单独开启
+	Groups []string `json:"groups"`
+	// 首个渠道在该时间内未返回首字节时，并行向另一个渠道发起请求（毫秒）
+	ThresholdMs int `json:"threshold_ms"`
+}
+
+// 默认配置
+var hedgeSetting = HedgeSetting{
+	Enabled:     false,
+	Groups:      []string{},
+	ThresholdMs: 3000,
+}
+
+func init() {
+	// 注册到全局配置管理器
+	config.GlobalConfig.Register("hedge_setting", &hedgeSetting)
+}
+
+func GetHedgeSetting() *HedgeSetting {
+	return &hedgeSetting
+}
+
+// ShouldHedge 判断指定分组或令牌的请求是否启用对冲
+func ShouldHedge(group string, tokenHedgeEnabled bool) bool {
+	if !hedgeSetting.Enabled || hedgeSetting.ThresholdMs <= 0 {
+		return false
+	}
+	return tokenHedgeEnabled || slices.Contains(hedgeSetting.Groups, group)
+}
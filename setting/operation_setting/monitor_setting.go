@@ -7,15 +7,39 @@ import (
 	"github.com/QuantumNous/new-api/setting/config"
 )
 
+const (
+	ProbeModelModeDefault = "default" // 仅测试渠道的测试模型（或第一个模型）
+	ProbeModelModeAll     = "all"     // 测试渠道的所有模型
+	ProbeModelModeSample  = "sample"  // 随机抽样测试部分模型
+)
+
 type MonitorSetting struct {
 	AutoTestChannelEnabled bool    `json:"auto_test_channel_enabled"`
 	AutoTestChannelMinutes float64 `json:"auto_test_channel_minutes"`
+	// 并发探测的 worker 数量
+	ProbeConcurrency int `json:"probe_concurrency"`
+	// 探测模型的选择方式：default / all / sample
+	ProbeModelMode string `json:"probe_model_mode"`
+	// sample 模式下每个渠道抽样的模型数量
+	ProbeSampleSize int `json:"probe_sample_size"`
+	// 是否使用流式请求探测，流式探测会额外记录首字时间
+	ProbeStream bool `json:"probe_stream"`
+	// 探测历史保留天数，0 表示不清理
+	ProbeHistoryDays int `json:"probe_history_days"`
+	// 连续失败多少次探测后自动禁用渠道，0 表示仅按错误类型禁用
+	ProbeFailureThreshold int `json:"probe_failure_threshold"`
 }
 
 // 默认配置
 var monitorSetting = MonitorSetting{
 	AutoTestChannelEnabled: false,
 	AutoTestChannelMinutes: 10,
+	ProbeConcurrency:       5,
+	ProbeModelMode:         ProbeModelModeDefault,
+	ProbeSampleSize:        3,
+	ProbeStream:            false,
+	ProbeHistoryDays:       7,
+	ProbeFailureThreshold:  0,
 }
 
 func init() {
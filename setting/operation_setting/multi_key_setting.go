@@ -0,0 +1,31 @@
+package operation_setting
+
+import "github.com/QuantumNous/new-api/setting/config"
+
+type MultiKeySetting struct {
+	// 冷却模式下未返回 Retry-After 时的初始冷却秒数，之后按指数退避
+	CooldownBaseSeconds int `json:"cooldown_base_seconds"`
+	// 冷却时间上限（秒）
+	CooldownMaxSeconds int `json:"cooldown_max_seconds"`
+	// 是否自动重新测试并恢复被自动禁用的 key
+	AutoRecoveryEnabled bool `json:"auto_recovery_enabled"`
+	// 同一个 key 两次恢复测试之间的间隔（分钟）
+	AutoRecoveryMinutes int `json:"auto_recovery_minutes"`
+}
+
+// 默认配置
+var multiKeySetting = MultiKeySetting{
+	CooldownBaseSeconds: 5,
+	CooldownMaxSeconds:  600,
+	AutoRecoveryEnabled: false,
+	AutoRecoveryMinutes: 30,
+}
+
+func init() {
+	// 注册到全局配置管理器
+	config.GlobalConfig.Register("multi_key_setting", &multiKeySetting)
+}
+
+func GetMultiKeySetting() *MultiKeySetting {
+	return &multiKeySetting
+}
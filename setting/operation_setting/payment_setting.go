@@ -5,12 +5,22 @@ import "github.com/QuantumNous/new-api/setting/config"
 type PaymentSetting struct {
 	AmountOptions  []int           `json:"amount_options"`
 	AmountDiscount map[int]float64 `json:"amount_discount"` // 充值金额对应的折扣，例如 100 元 0.9 表示 100 元充值享受 9 折优惠
+	// 是否定期向支付平台查询待支付订单，补全丢失的回调
+	ReconcileEnabled bool `json:"reconcile_enabled"`
+	// 待支付订单查询间隔（分钟）
+	ReconcileIntervalMinutes int `json:"reconcile_interval_minutes"`
+	// 待支付订单超过该时长（小时）仍未支付则标记为过期
+	PendingExpireHours int `json:"pending_expire_hours"`
 }
 
 // 默认配置
 var paymentSetting = PaymentSetting{
 	AmountOptions:  []int{10, 20, 50, 100, 200, 500},
 	AmountDiscount: map[int]float64{},
+
+	ReconcileEnabled:         true,
+	ReconcileIntervalMinutes: 5,
+	PendingExpireHours:       24,
 }
 
 func init() {
@@ -0,0 +1,31 @@
+package operation_setting
+
+import "github.com/QuantumNous/new-api/setting/config"
+
+type QuotaLedgerSetting struct {
+	// 是否记录额度流水，未开启批量更新时每次扣费都会同步写库，默认关闭
+	Enabled bool `json:"enabled"`
+	// 是否定期对账，用户余额与流水合计不一致时记录偏差
+	ReconcileEnabled bool `json:"reconcile_enabled"`
+	// 对账间隔（分钟）
+	ReconcileIntervalMinutes int `json:"reconcile_interval_minutes"`
+	// 批量更新的预写日志每次写入后是否立即落盘，开启后可应对断电，但会降低吞吐
+	WalSync bool `json:"wal_sync"`
+}
+
+// 默认配置
+var quotaLedgerSetting = QuotaLedgerSetting{
+	Enabled:                  false,
+	ReconcileEnabled:         true,
+	ReconcileIntervalMinutes: 60,
+	WalSync:                  false,
+}
+
+func init() {
+	// 注册到全局配置管理器
+	config.GlobalConfig.Register("quota_ledger_setting", &quotaLedgerSetting)
+}
+
+func GetQuotaLedgerSetting() *QuotaLedgerSetting {
+	return &quotaLedgerSetting
+}
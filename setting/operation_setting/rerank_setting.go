@@ -0,0 +1,37 @@
+package operation_setting
+
+import "github.com/QuantumNous/new-api/setting/config"
+
+type RerankSetting struct {
+	// 是否对按次计费的重排序模型按文档数计费，启用后模型价格视为每组文档的价格
+	PerDocumentBillingEnabled bool `json:"per_document_billing_enabled"`
+	// 每组文档数量，不足一组按一组计，默认与 Cohere 的搜索单元一致
+	DocumentsPerUnit int `json:"documents_per_unit"`
+}
+
+// 默认配置
+var rerankSetting = RerankSetting{
+	PerDocumentBillingEnabled: false,
+	DocumentsPerUnit:          100,
+}
+
+func init() {
+	// 注册到全局配置管理器
+	config.GlobalConfig.Register("rerank_setting", &rerankSetting)
+}
+
+func GetRerankSetting() *RerankSetting {
+	return &rerankSetting
+}
+
+// GetRerankDocumentUnits 返回文档数对应的计费组数，未启用按文档计费时返回 1
+func GetRerankDocumentUnits(documents int) int {
+	if !rerankSetting.PerDocumentBillingEnabled || documents <= 0 {
+		return 1
+	}
+	perUnit := rerankSetting.DocumentsPerUnit
+	if perUnit <= 0 {
+		perUnit = 1
+	}
+	return (documents + perUnit - 1) / perUnit
+}
@@ -0,0 +1,167 @@
+package operation_setting
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/setting/config"
+)
+
+// 路由条件可使用的请求属性，header.<名称> 表示请求头
+const (
+	RoutingFieldModel        = "model"
+	RoutingFieldGroup        = "group"
+	RoutingFieldUserGroup    = "user_group"
+	RoutingFieldTokenName    = "token_name"
+	RoutingFieldPromptTokens = "prompt_tokens"
+	RoutingFieldHasImage     = "has_image"
+	RoutingFieldHasAudio     = "has_audio"
+	RoutingFieldHasVideo     = "has_video"
+	RoutingFieldHasFile      = "has_file"
+	RoutingFieldHasTools     = "has_tools"
+	RoutingFieldStream       = "stream"
+	RoutingFieldHeaderPrefix = "header."
+)
+
+const (
+	RoutingOperatorEq       = "eq"
+	RoutingOperatorNe       = "ne"
+	RoutingOperatorGt       = "gt"
+	RoutingOperatorGte      = "gte"
+	RoutingOperatorLt       = "lt"
+	RoutingOperatorLte      = "lte"
+	RoutingOperatorIn       = "in"
+	RoutingOperatorNotIn    = "not_in"
+	RoutingOperatorContains = "contains"
+	RoutingOperatorPrefix   = "prefix"
+	RoutingOperatorRegex    = "regex"
+	RoutingOperatorExists   = "exists"
+)
+
+const (
+	RoutingActionTag      = "tag"      // 只在带有该标签的渠道中选择
+	RoutingActionChannels = "channels" // 只在指定的渠道中选择
+	RoutingActionModel    = "model"    // 改用另一个模型名选择渠道并计费
+)
+
+// RoutingCondition 路由条件，Value 为字符串形式，in/not_in 以逗号分隔多个值
+type RoutingCondition struct {
+	Field    string `json:"field"`
+	Operator string `json:"operator"`
+	Value    string `json:"value"`
+}
+
+type RoutingAction struct {
+	Type       string `json:"type"`
+	Tag        string `json:"tag,omitempty"`
+	ChannelIds []int  `json:"channel_ids,omitempty"`
+	Model      string `json:"model,omitempty"`
+	// 目标中没有可用渠道时回退到默认的分组和模型选择，否则直接返回无可用渠道
+	Fallback bool `json:"fallback"`
+}
+
+// RoutingRule 路由规则，所有条件均满足时命中，按顺序取第一条命中的规则
+type RoutingRule struct {
+	Name       string             `json:"name"`
+	Enabled    bool               `json:"enabled"`
+	Conditions []RoutingCondition `json:"conditions"`
+	Action     RoutingAction      `json:"action"`
+}
+
+type RoutingSetting struct {
+	Enabled bool          `json:"enabled"`
+	Rules   []RoutingRule `json:"rules"`
+}
+
+// 默认配置
+var routingSetting = RoutingSetting{
+	Enabled: false,
+	Rules:   []RoutingRule{},
+}
+
+func init() {
+	// 注册到全局配置管理器
+	config.GlobalConfig.Register("routing_setting", &routingSetting)
+}
+
+func GetRoutingSetting() *RoutingSetting {
+	return &routingSetting
+}
+
+// RoutingEnabled 判断是否存在需要评估的路由规则
+func RoutingEnabled() bool {
+	return routingSetting.Enabled && len(routingSetting.Rules) > 0
+}
+
+// ValidateRoutingRules 校验路由规则的 JSON 配置
+func ValidateRoutingRules(jsonStr string) error {
+	var rules []RoutingRule
+	if err := common.UnmarshalJsonStr(jsonStr, &rules); err != nil {
+		return fmt.Errorf("路由规则格式错误: %s", err.Error())
+	}
+	for i, rule := range rules {
+		name := rule.Name
+		if name == "" {
+			name = strconv.Itoa(i + 1)
+		}
+		for _, condition := range rule.Conditions {
+			if err := validateRoutingCondition(condition); err != nil {
+				return fmt.Errorf("路由规则 %s: %s", name, err.Error())
+			}
+		}
+		if err := validateRoutingAction(rule.Action); err != nil {
+			return fmt.Errorf("路由规则 %s: %s", name, err.Error())
+		}
+	}
+	return nil
+}
+
+func validateRoutingCondition(condition RoutingCondition) error {
+	switch condition.Field {
+	case RoutingFieldModel, RoutingFieldGroup, RoutingFieldUserGroup, RoutingFieldTokenName, RoutingFieldPromptTokens,
+		RoutingFieldHasImage, RoutingFieldHasAudio, RoutingFieldHasVideo, RoutingFieldHasFile, RoutingFieldHasTools, RoutingFieldStream:
+	default:
+		if !strings.HasPrefix(condition.Field, RoutingFieldHeaderPrefix) || len(condition.Field) == len(RoutingFieldHeaderPrefix) {
+			return fmt.Errorf("不支持的条件字段 %s", condition.Field)
+		}
+	}
+	switch condition.Operator {
+	case "", RoutingOperatorEq, RoutingOperatorNe, RoutingOperatorIn, RoutingOperatorNotIn,
+		RoutingOperatorContains, RoutingOperatorPrefix, RoutingOperatorExists:
+	case RoutingOperatorGt, RoutingOperatorGte, RoutingOperatorLt, RoutingOperatorLte:
+		if _, err := strconv.ParseFloat(condition.Value, 64); err != nil {
+			return fmt.Errorf("条件 %s 的值 %s 不是数字", condition.Field, condition.Value)
+		}
+	case RoutingOperatorRegex:
+		if _, err := regexp.Compile(condition.Value); err != nil {
+			return fmt.Errorf("条件 %s 的正则表达式无效: %s", condition.Field, err.Error())
+		}
+	default:
+		return fmt.Errorf("不支持的条件运算符 %s", condition.Operator)
+	}
+	return nil
+}
+
+func validateRoutingAction(action RoutingAction) error {
+	switch action.Type {
+	case RoutingActionTag:
+		if action.Tag == "" {
+			return errors.New("路由到标签时必须指定标签")
+		}
+	case RoutingActionChannels:
+		if len(action.ChannelIds) == 0 {
+			return errors.New("路由到渠道时必须指定渠道")
+		}
+	case RoutingActionModel:
+		if action.Model == "" {
+			return errors.New("路由到模型时必须指定模型")
+		}
+	default:
+		return fmt.Errorf("不支持的路由动作 %s", action.Type)
+	}
+	return nil
+}
@@ -0,0 +1,34 @@
+package operation_setting
+
+import "github.com/QuantumNous/new-api/setting/config"
+
+type StatementSetting struct {
+	// 账单编号前缀，编号为前缀加 6 位顺序号
+	InvoicePrefix string `json:"invoice_prefix"`
+	// 账单抬头中的开票方名称，为空时使用系统名称
+	IssuerName string `json:"issuer_name"`
+	// 开票方地址、税号等附加信息，原样显示在账单抬头
+	IssuerInfo string `json:"issuer_info"`
+	// 是否在每月 1 日自动生成上月账单
+	MonthlyEnabled bool `json:"monthly_enabled"`
+	// 自动生成账单后是否发送邮件给用户
+	MonthlyEmailEnabled bool `json:"monthly_email_enabled"`
+}
+
+// 默认配置
+var statementSetting = StatementSetting{
+	InvoicePrefix:       "INV-",
+	IssuerName:          "",
+	IssuerInfo:          "",
+	MonthlyEnabled:      false,
+	MonthlyEmailEnabled: false,
+}
+
+func init() {
+	// 注册到全局配置管理器
+	config.GlobalConfig.Register("statement_setting", &statementSetting)
+}
+
+func GetStatementSetting() *StatementSetting {
+	return &statementSetting
+}
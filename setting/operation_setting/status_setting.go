@@ -0,0 +1,34 @@
+package operation_setting
+
+import "github.com/QuantumNous/new-api/setting/config"
+
+type StatusSetting struct {
+	// 是否开放公开的模型状态页接口
+	PublicStatusEnabled bool `json:"public_status_enabled"`
+	// 是否将渠道探测结果计入模型可用性
+	IncludeProbeResults bool `json:"include_probe_results"`
+	// 故障检测的滑动窗口（分钟）
+	IncidentWindowMinutes int `json:"incident_window_minutes"`
+	// 窗口内错误率达到该值时开启故障事件（0-1）
+	IncidentErrorRate float64 `json:"incident_error_rate"`
+	// 窗口内请求数不少于该值才判定故障，避免少量请求误报
+	IncidentMinRequests int `json:"incident_min_requests"`
+}
+
+// 默认配置
+var statusSetting = StatusSetting{
+	PublicStatusEnabled:   true,
+	IncludeProbeResults:   true,
+	IncidentWindowMinutes: 5,
+	IncidentErrorRate:     0.5,
+	IncidentMinRequests:   10,
+}
+
+func init() {
+	// 注册到全局配置管理器
+	config.GlobalConfig.Register("status_setting", &statusSetting)
+}
+
+func GetStatusSetting() *StatusSetting {
+	return &statusSetting
+}
@@ -0,0 +1,31 @@
+package operation_setting
+
+import "github.com/QuantumNous/new-api/setting/config"
+
+type SubscriptionSetting struct {
+	// 是否开放订阅套餐
+	Enabled bool `json:"enabled"`
+	// 周期结束未续费时的宽限时间（小时），超过后订阅到期并恢复原分组
+	GracePeriodHours int `json:"grace_period_hours"`
+	// 发起支付后未付款的订阅保留时间（小时）
+	PendingExpireHours int `json:"pending_expire_hours"`
+	// 到期检查间隔（分钟）
+	CheckIntervalMinutes int `json:"check_interval_minutes"`
+}
+
+// 默认配置
+var subscriptionSetting = SubscriptionSetting{
+	Enabled:              false,
+	GracePeriodHours:     72,
+	PendingExpireHours:   24,
+	CheckIntervalMinutes: 10,
+}
+
+func init() {
+	// 注册到全局配置管理器
+	config.GlobalConfig.Register("subscription_setting", &subscriptionSetting)
+}
+
+func GetSubscriptionSetting() *SubscriptionSetting {
+	return &subscriptionSetting
+}
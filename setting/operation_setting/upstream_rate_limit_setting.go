@@ -0,0 +1,25 @@
+package operation_setting
+
+import "github.com/QuantumNous/new-api/setting/config"
+
+type UpstreamRateLimitSetting struct {
+	// 是否根据上游限流响应头调整渠道选择
+	Enabled bool `json:"enabled"`
+	// 剩余额度比例低于该值时开始按比例降低渠道权重，额度耗尽时渠道仅在没有其他选择时使用
+	LowWatermark float64 `json:"low_watermark"`
+}
+
+// 默认配置
+var upstreamRateLimitSetting = UpstreamRateLimitSetting{
+	Enabled:      true,
+	LowWatermark: 0.1,
+}
+
+func init() {
+	// 注册到全局配置管理器
+	config.GlobalConfig.Register("upstream_rate_limit_setting", &upstreamRateLimitSetting)
+}
+
+func GetUpstreamRateLimitSetting() *UpstreamRateLimitSetting {
+	return &upstreamRateLimitSetting
+}
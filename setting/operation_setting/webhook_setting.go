@@ -0,0 +1,43 @@
+package operation_setting
+
+import "github.com/QuantumNous/new-api/setting/config"
+
+type WebhookSetting struct {
+	// 是否启用用户事件 Webhook
+	Enabled bool `json:"enabled"`
+	// 每个用户最多可创建的订阅数
+	MaxSubscriptionsPerUser int `json:"max_subscriptions_per_user"`
+	// 单次投递的最大尝试次数，超过后标记为失败
+	MaxAttempts int `json:"max_attempts"`
+	// 首次重试间隔（秒），之后每次翻倍
+	RetryBaseSeconds int `json:"retry_base_seconds"`
+	// 重试间隔上限（秒）
+	RetryMaxSeconds int `json:"retry_max_seconds"`
+	// 单次投递的超时时间（秒）
+	TimeoutSeconds int `json:"timeout_seconds"`
+	// 令牌过期前多少小时发送即将过期事件
+	TokenExpiringHours int `json:"token_expiring_hours"`
+	// 投递记录保留天数，0 表示不清理
+	DeliveryRetentionDays int `json:"delivery_retention_days"`
+}
+
+// 默认配置
+var webhookSetting = WebhookSetting{
+	Enabled:                 true,
+	MaxSubscriptionsPerUser: 10,
+	MaxAttempts:             8,
+	RetryBaseSeconds:        30,
+	RetryMaxSeconds:         6 * 3600,
+	TimeoutSeconds:          10,
+	TokenExpiringHours:      24,
+	DeliveryRetentionDays:   30,
+}
+
+func init() {
+	// 注册到全局配置管理器
+	config.GlobalConfig.Register("webhook_setting", &webhookSetting)
+}
+
+func GetWebhookSetting() *WebhookSetting {
+	return &webhookSetting
+}
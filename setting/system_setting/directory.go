@@ -0,0 +1,90 @@
+package system_setting
+
+import (
+	"strings"
+
+	"github.com/QuantumNous/new-api/setting/config"
+)
+
+// DirectoryGroupMapping 目录服务中的组到用户分组的映射，Value 为组名或组 DN（不区分大小写）
+type DirectoryGroupMapping struct {
+	Value string `json:"value"`
+	Group string `json:"group"`
+}
+
+// ResolveDirectoryGroup 按映射顺序返回第一个命中的分组，均未命中时返回 defaultGroup
+func ResolveDirectoryGroup(mappings []DirectoryGroupMapping, values []string, defaultGroup string) string {
+	for _, mapping := range mappings {
+		if mapping.Group == "" {
+			continue
+		}
+		for _, value := range values {
+			if strings.EqualFold(mapping.Value, value) {
+				return mapping.Group
+			}
+		}
+	}
+	return defaultGroup
+}
+
+type LDAPSettings struct {
+	Enabled bool `json:"enabled"`
+	// 服务器地址，如 ldap://ldap.example.com:389 或 ldaps://ldap.example.com:636
+	Url                string `json:"url"`
+	StartTLS           bool   `json:"start_tls"`
+	InsecureSkipVerify bool   `json:"insecure_skip_verify"`
+	// 用于查找用户的服务账号，为空时匿名查找
+	BindDN       string `json:"bind_dn"`
+	BindPassword string `json:"bind_password"`
+	BaseDN       string `json:"base_dn"`
+	// 查找用户的过滤器，%s 替换为转义后的登录名
+	UserFilter           string `json:"user_filter"`
+	UsernameAttribute    string `json:"username_attribute"`
+	EmailAttribute       string `json:"email_attribute"`
+	DisplayNameAttribute string `json:"display_name_attribute"`
+	// 组成员属性（如 memberOf），为空时不同步分组
+	GroupAttribute string                  `json:"group_attribute"`
+	GroupMappings  []DirectoryGroupMapping `json:"group_mappings"`
+	DefaultGroup   string                  `json:"default_group"`
+	// 首次登录时自动创建账号
+	AutoRegister bool `json:"auto_register"`
+}
+
+var defaultLDAPSettings = LDAPSettings{
+	UserFilter:           "(uid=%s)",
+	UsernameAttribute:    "uid",
+	EmailAttribute:       "mail",
+	DisplayNameAttribute: "cn",
+	GroupAttribute:       "memberOf",
+	GroupMappings:        []DirectoryGroupMapping{},
+	DefaultGroup:         "default",
+	AutoRegister:         true,
+}
+
+type SCIMSettings struct {
+	Enabled bool `json:"enabled"`
+	// 身份提供方调用 SCIM 接口时使用的 Bearer Token
+	Token string `json:"token"`
+	// SCIM 组到用户分组的映射；未配置映射时与已有分组同名的 SCIM 组直接对应该分组
+	GroupMappings []DirectoryGroupMapping `json:"group_mappings"`
+	// 不属于任何已映射组的用户所在分组
+	DefaultGroup string `json:"default_group"`
+}
+
+var defaultSCIMSettings = SCIMSettings{
+	GroupMappings: []DirectoryGroupMapping{},
+	DefaultGroup:  "default",
+}
+
+func init() {
+	config.GlobalConfig.Register("ldap", &defaultLDAPSettings)
+	config.GlobalConfig.Register("scim", &defaultSCIMSettings)
+}
+
+func GetLDAPSettings() *LDAPSettings {
+	return &defaultLDAPSettings
+}
+
+func GetSCIMSettings() *SCIMSettings {
+	return &defaultSCIMSettings
+}
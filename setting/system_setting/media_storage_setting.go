@@ -0,0 +1,77 @@
+package system_setting
+
+import "github.com/QuantumNous/new-api/setting/config"
+
+const (
+	MediaStorageBackendLocal = "local"
+	MediaStorageBackendS3    = "s3"
+)
+
+type MediaStorageSetting struct {
+	// 是否启用媒体持久化存储
+	Enabled bool `json:"enabled"`
+	// 存储后端：local 或 s3
+	Backend string `json:"backend"`
+	// 本地存储目录
+	LocalPath string `json:"local_path"`
+	// S3 兼容存储配置，PathStyle 用于 MinIO 等不支持虚拟主机风格的服务
+	S3Endpoint        string `json:"s3_endpoint"`
+	S3Region          string `json:"s3_region"`
+	S3Bucket          string `json:"s3_bucket"`
+	S3AccessKeyId     string `json:"s3_access_key_id"`
+	S3SecretAccessKey string `json:"s3_secret_access_key"`
+	S3PathStyle       bool   `json:"s3_path_style"`
+	// 按类型开启持久化
+	StoreMidjourney bool `json:"store_midjourney"`
+	StoreImages     bool `json:"store_images"`
+	StoreAudio      bool `json:"store_audio"`
+	StoreVideos     bool `json:"store_videos"`
+	// 单个文件大小上限（MB），超过时不保存
+	MaxFileSizeMB int `json:"max_file_size_mb"`
+	// 默认保留天数，0 表示永久保留；用户可在个人设置中选择不超过 MaxRetentionDays 的保留天数
+	RetentionDays    int `json:"retention_days"`
+	MaxRetentionDays int `json:"max_retention_days"`
+	// 每个用户的存储空间上限（MB），0 表示不限制；GroupQuotaMB 按分组覆盖
+	UserQuotaMB  int            `json:"user_quota_mb"`
+	GroupQuotaMB map[string]int `json:"group_quota_mb"`
+	// 每 MB 存储扣除的额度，保存时一次性扣除，0 表示不计费
+	QuotaPerMB int `json:"quota_per_mb"`
+	// 签名链接有效期（秒），0 表示与文件保留期一致
+	SignedURLExpireSeconds int `json:"signed_url_expire_seconds"`
+}
+
+// 默认配置
+var mediaStorageSetting = MediaStorageSetting{
+	Enabled:                false,
+	Backend:                MediaStorageBackendLocal,
+	LocalPath:              "media",
+	StoreMidjourney:        true,
+	StoreImages:            true,
+	StoreAudio:             false,
+	StoreVideos:            true,
+	MaxFileSizeMB:          200,
+	RetentionDays:          30,
+	MaxRetentionDays:       365,
+	UserQuotaMB:            1024,
+	GroupQuotaMB:           map[string]int{},
+	QuotaPerMB:             0,
+	SignedURLExpireSeconds: 0,
+}
+
+func init() {
+	// 注册到全局配置管理器
+	config.GlobalConfig.Register("media_storage_setting", &mediaStorageSetting)
+}
+
+func GetMediaStorageSetting() *MediaStorageSetting {
+	return &mediaStorageSetting
+}
+
+// GetUserQuotaBytes 返回分组的存储空间上限（字节），0 表示不限制
+func (s *MediaStorageSetting) GetUserQuotaBytes(group string) int64 {
+	quotaMB := s.UserQuotaMB
+	if groupQuota, ok := s.GroupQuotaMB[group]; ok {
+		quotaMB = groupQuota
+	}
+	return int64(quotaMB) << 20
+}
@@ -1,6 +1,23 @@
 package system_setting
 
-import "github.com/QuantumNous/new-api/setting/config"
+import (
+	"strings"
+
+	"github.com/QuantumNous/new-api/setting/config"
+)
+
+// OIDCGroupMapping 声明值到用户分组的映射，ProvisionToken 为 true 时登录后自动为用户创建该分组的令牌
+type OIDCGroupMapping struct {
+	Value          string `json:"value"`
+	Group          string `json:"group"`
+	ProvisionToken bool   `json:"provision_token"`
+}
+
+// OIDCRoleMapping 声明值到用户角色的映射，角色最高为管理员，超级管理员不会被映射或降级
+type OIDCRoleMapping struct {
+	Value string `json:"value"`
+	Role  int    `json:"role"`
+}
 
 type OIDCSettings struct {
 	Enabled               bool   `json:"enabled"`
@@ -10,10 +27,27 @@ type OIDCSettings struct {
 	AuthorizationEndpoint string `json:"authorization_endpoint"`
 	TokenEndpoint         string `json:"token_endpoint"`
 	UserInfoEndpoint      string `json:"user_info_endpoint"`
+	Scopes                string `json:"scopes"`
+	UsePKCE               bool   `json:"use_pkce"`
+	// 允许登录的邮箱域名，为空时不限制
+	AllowedEmailDomains []string `json:"allowed_email_domains"`
+	// 分组声明名称，支持以 . 访问嵌套声明（如 realm_access.roles）；为空时不映射分组
+	GroupClaim    string             `json:"group_claim"`
+	GroupMappings []OIDCGroupMapping `json:"group_mappings"`
+	// 没有命中任何分组映射时使用的分组
+	DefaultGroup string            `json:"default_group"`
+	RoleClaim    string            `json:"role_claim"`
+	RoleMappings []OIDCRoleMapping `json:"role_mappings"`
 }
 
 // 默认配置
-var defaultOIDCSettings = OIDCSettings{}
+var defaultOIDCSettings = OIDCSettings{
+	Scopes:              "openid profile email",
+	AllowedEmailDomains: []string{},
+	GroupMappings:       []OIDCGroupMapping{},
+	DefaultGroup:        "default",
+	RoleMappings:        []OIDCRoleMapping{},
+}
 
 func init() {
 	// 注册到全局配置管理器
@@ -23,3 +57,22 @@ func init() {
 func GetOIDCSettings() *OIDCSettings {
 	return &defaultOIDCSettings
 }
+
+// IsEmailDomainAllowed 判断邮箱域名是否在允许列表中
+func (s *OIDCSettings) IsEmailDomainAllowed(email string) bool {
+	if len(s.AllowedEmailDomains) == 0 {
+		return true
+	}
+	at := strings.LastIndex(email, "@")
+	if at < 0 {
+		return false
+	}
+	domain := strings.ToLower(email[at+1:])
+	for _, allowed := range s.AllowedEmailDomains {
+		allowed = strings.ToLower(strings.TrimPrefix(strings.TrimSpace(allowed), "@"))
+		if allowed != "" && domain == allowed {
+			return true
+		}
+	}
+	return false
+}
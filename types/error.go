@@ -5,6 +5,7 @@ import (
 	"fmt"
 	"net/http"
 	"strings"
+	"time"
 
 	"github.com/QuantumNous/new-api/common"
 )
@@ -47,6 +48,7 @@ const (
 	ErrorCodeDoRequestFailed    ErrorCode = "do_request_failed"
 	ErrorCodeGetChannelFailed   ErrorCode = "get_channel_failed"
 	ErrorCodeGenRelayInfoFailed ErrorCode = "gen_relay_info_failed"
+	ErrorCodeHedgeLost          ErrorCode = "hedge_lost"
 
 	// channel error
 	ErrorCodeChannelNoAvailableKey        ErrorCode = "channel:no_available_key"
@@ -61,6 +63,25 @@ const (
 	ErrorCodeReadRequestBodyFailed ErrorCode = "read_request_body_failed"
 	ErrorCodeConvertRequestFailed  ErrorCode = "convert_request_failed"
 	ErrorCodeAccessDenied          ErrorCode = "access_denied"
+	ErrorCodeInvalidChannelId      ErrorCode = "invalid_channel_id"
+	ErrorCodeModelNameRequired     ErrorCode = "model_name_required"
+
+	// access error
+	ErrorCodeChannelDisabled          ErrorCode = "channel_disabled"
+	ErrorCodeTokenNoModels            ErrorCode = "token_no_models"
+	ErrorCodeTokenModelNotAllowed     ErrorCode = "token_model_not_allowed"
+	ErrorCodeGroupAccessDenied        ErrorCode = "group_access_denied"
+	ErrorCodeGroupDeprecated          ErrorCode = "group_deprecated"
+	ErrorCodeIpNotAllowed             ErrorCode = "ip_not_allowed"
+	ErrorCodeUserBanned               ErrorCode = "user_banned"
+	ErrorCodeSpecificChannelForbidden ErrorCode = "specific_channel_forbidden"
+
+	// token error
+	ErrorCodeTokenNotProvided    ErrorCode = "token_not_provided"
+	ErrorCodeTokenInvalid        ErrorCode = "token_invalid"
+	ErrorCodeTokenExpired        ErrorCode = "token_expired"
+	ErrorCodeTokenUnavailable    ErrorCode = "token_unavailable"
+	ErrorCodeTokenQuotaExhausted ErrorCode = "token_quota_exhausted"
 
 	// request error
 	ErrorCodeBadRequestBody ErrorCode = "bad_request_body"
@@ -92,6 +113,11 @@ type NewAPIError struct {
 	errorType      ErrorType
 	errorCode      ErrorCode
 	StatusCode     int
+	// 上游通过 Retry-After 头要求等待的时间，未提供时为 0
+	RetryAfter time.Duration
+	// 信息取自错误信息目录时为 true，返回给客户端前可按语言重新渲染
+	localized   bool
+	messageArgs []any
 }
 
 func (e *NewAPIError) GetErrorCode() ErrorCode {
@@ -137,6 +163,16 @@ func (e *NewAPIError) SetMessage(message string) {
 	e.Err = errors.New(message)
 }
 
+// Localize 按语言重新渲染错误信息，仅对信息取自错误信息目录的错误生效
+func (e *NewAPIError) Localize(language string) {
+	if e == nil || !e.localized {
+		return
+	}
+	if message, ok := LocalizeErrorMessage(e.errorCode, language, e.messageArgs...); ok {
+		e.SetMessage(message)
+	}
+}
+
 func (e *NewAPIError) ToOpenAIError() OpenAIError {
 	var result OpenAIError
 	switch e.errorType {
@@ -274,6 +310,18 @@ func NewErrorWithStatusCode(err error, errorCode ErrorCode, statusCode int, ops
 	return e
 }
 
+// NewLocalizedError 创建信息取自错误信息目录的错误，默认以 DefaultErrorLanguage 渲染
+func NewLocalizedError(errorCode ErrorCode, statusCode int, args []any, ops ...NewAPIErrorOptions) *NewAPIError {
+	message, ok := LocalizeErrorMessage(errorCode, DefaultErrorLanguage(), args...)
+	if !ok {
+		message = string(errorCode)
+	}
+	e := NewErrorWithStatusCode(errors.New(message), errorCode, statusCode, ops...)
+	e.localized = ok
+	e.messageArgs = args
+	return e
+}
+
 func WithOpenAIError(openAIError OpenAIError, statusCode int, ops ...NewAPIErrorOptions) *NewAPIError {
 	code, ok := openAIError.Code.(string)
 	if !ok {
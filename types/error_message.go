@@ -0,0 +1,200 @@
+package types
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/QuantumNous/new-api/common"
+)
+
+// 面向客户端的错误信息语言
+const (
+	ErrorLanguageEnglish  = "en"
+	ErrorLanguageChinese  = "zh"
+	ErrorLanguageFrench   = "fr"
+	ErrorLanguageJapanese = "ja"
+)
+
+// DefaultErrorLanguage 返回创建错误及无法确定客户端语言时使用的语言，由 ERROR_MESSAGE_LANGUAGE 配置
+func DefaultErrorLanguage() string {
+	if language := NormalizeErrorLanguage(common.ErrorMessageLanguage); language != "" {
+		return language
+	}
+	return ErrorLanguageChinese
+}
+
+// 参数依次为模型、分组
+var noAvailableChannelMessages = map[string]string{
+	ErrorLanguageEnglish:  "no available channel for model %s under group %s",
+	ErrorLanguageChinese:  "分组 %[2]s 下模型 %[1]s 无可用渠道",
+	ErrorLanguageFrench:   "aucun canal disponible pour le modèle %s dans le groupe %s",
+	ErrorLanguageJapanese: "グループ %[2]s でモデル %[1]s に利用可能なチャネルがありません",
+}
+
+// errorMessages 错误信息目录，按错误码和语言组织，参数顺序在各语言中保持一致
+var errorMessages = map[ErrorCode]map[string]string{
+	ErrorCodeInvalidChannelId: {
+		ErrorLanguageEnglish:  "invalid channel id",
+		ErrorLanguageChinese:  "无效的渠道 Id",
+		ErrorLanguageFrench:   "identifiant de canal invalide",
+		ErrorLanguageJapanese: "無効なチャネル ID です",
+	},
+	ErrorCodeChannelDisabled: {
+		ErrorLanguageEnglish:  "this channel has been disabled",
+		ErrorLanguageChinese:  "该渠道已被禁用",
+		ErrorLanguageFrench:   "ce canal a été désactivé",
+		ErrorLanguageJapanese: "このチャネルは無効化されています",
+	},
+	ErrorCodeTokenNoModels: {
+		ErrorLanguageEnglish:  "this token is not allowed to access any model",
+		ErrorLanguageChinese:  "该令牌无权访问任何模型",
+		ErrorLanguageFrench:   "ce jeton n'a accès à aucun modèle",
+		ErrorLanguageJapanese: "このトークンはどのモデルにもアクセスできません",
+	},
+	ErrorCodeTokenModelNotAllowed: {
+		ErrorLanguageEnglish:  "this token is not allowed to access model %s",
+		ErrorLanguageChinese:  "该令牌无权访问模型 %s",
+		ErrorLanguageFrench:   "ce jeton n'a pas accès au modèle %s",
+		ErrorLanguageJapanese: "このトークンはモデル %s にアクセスできません",
+	},
+	ErrorCodeModelNameRequired: {
+		ErrorLanguageEnglish:  "model name is not specified, model name cannot be empty",
+		ErrorLanguageChinese:  "未指定模型名称，模型名称不能为空",
+		ErrorLanguageFrench:   "aucun nom de modèle spécifié, le nom du modèle ne peut pas être vide",
+		ErrorLanguageJapanese: "モデル名が指定されていません。モデル名は必須です",
+	},
+	ErrorCodeModelNotFound:    noAvailableChannelMessages,
+	ErrorCodeGetChannelFailed: noAvailableChannelMessages,
+	ErrorCodeGroupAccessDenied: {
+		ErrorLanguageEnglish:  "access to group %s is denied",
+		ErrorLanguageChinese:  "无权访问 %s 分组",
+		ErrorLanguageFrench:   "accès refusé au groupe %s",
+		ErrorLanguageJapanese: "グループ %s へのアクセス権がありません",
+	},
+	ErrorCodeGroupDeprecated: {
+		ErrorLanguageEnglish:  "group %s has been deprecated",
+		ErrorLanguageChinese:  "分组 %s 已被弃用",
+		ErrorLanguageFrench:   "le groupe %s est obsolète",
+		ErrorLanguageJapanese: "グループ %s は廃止されました",
+	},
+	ErrorCodeIpNotAllowed: {
+		ErrorLanguageEnglish:  "your IP is not in the allow list of this token",
+		ErrorLanguageChinese:  "您的 IP 不在令牌允许访问的列表中",
+		ErrorLanguageFrench:   "votre adresse IP ne figure pas dans la liste autorisée de ce jeton",
+		ErrorLanguageJapanese: "お使いの IP はこのトークンの許可リストに含まれていません",
+	},
+	ErrorCodeUserBanned: {
+		ErrorLanguageEnglish:  "user has been banned",
+		ErrorLanguageChinese:  "用户已被封禁",
+		ErrorLanguageFrench:   "l'utilisateur a été banni",
+		ErrorLanguageJapanese: "ユーザーは利用停止されています",
+	},
+	ErrorCodeSpecificChannelForbidden: {
+		ErrorLanguageEnglish:  "specifying a channel is not allowed for regular users",
+		ErrorLanguageChinese:  "普通用户不支持指定渠道",
+		ErrorLanguageFrench:   "les utilisateurs standard ne peuvent pas spécifier de canal",
+		ErrorLanguageJapanese: "一般ユーザーはチャネルを指定できません",
+	},
+	ErrorCodeTokenNotProvided: {
+		ErrorLanguageEnglish:  "no token provided",
+		ErrorLanguageChinese:  "未提供令牌",
+		ErrorLanguageFrench:   "aucun jeton fourni",
+		ErrorLanguageJapanese: "トークンが指定されていません",
+	},
+	ErrorCodeTokenInvalid: {
+		ErrorLanguageEnglish:  "invalid token",
+		ErrorLanguageChinese:  "无效的令牌",
+		ErrorLanguageFrench:   "jeton invalide",
+		ErrorLanguageJapanese: "無効なトークンです",
+	},
+	ErrorCodeTokenExpired: {
+		ErrorLanguageEnglish:  "this token has expired",
+		ErrorLanguageChinese:  "该令牌已过期",
+		ErrorLanguageFrench:   "ce jeton a expiré",
+		ErrorLanguageJapanese: "このトークンは期限切れです",
+	},
+	ErrorCodeTokenUnavailable: {
+		ErrorLanguageEnglish:  "this token is unavailable",
+		ErrorLanguageChinese:  "该令牌状态不可用",
+		ErrorLanguageFrench:   "ce jeton n'est pas disponible",
+		ErrorLanguageJapanese: "このトークンは利用できません",
+	},
+	ErrorCodeTokenQuotaExhausted: {
+		ErrorLanguageEnglish:  "[%s] this token's quota has been exhausted",
+		ErrorLanguageChinese:  "[%s] 该令牌额度已用尽",
+		ErrorLanguageFrench:   "[%s] le quota de ce jeton est épuisé",
+		ErrorLanguageJapanese: "[%s] このトークンのクォータを使い切りました",
+	},
+	ErrorCodeInsufficientUserQuota: {
+		ErrorLanguageEnglish:  "insufficient user quota, remaining quota: %s, required quota: %s",
+		ErrorLanguageChinese:  "用户额度不足, 剩余额度: %s, 需要预扣费额度: %s",
+		ErrorLanguageFrench:   "quota utilisateur insuffisant, quota restant : %s, quota requis : %s",
+		ErrorLanguageJapanese: "ユーザーのクォータが不足しています。残り: %s、必要: %s",
+	},
+}
+
+// IsSupportedErrorLanguage 判断错误信息目录是否提供该语言
+func IsSupportedErrorLanguage(language string) bool {
+	switch language {
+	case ErrorLanguageEnglish, ErrorLanguageChinese, ErrorLanguageFrench, ErrorLanguageJapanese:
+		return true
+	}
+	return false
+}
+
+// NormalizeErrorLanguage 将 zh-CN、en_US 等语言标签归一为目录中的语言，不支持时返回空字符串
+func NormalizeErrorLanguage(language string) string {
+	language = strings.ToLower(strings.TrimSpace(language))
+	if i := strings.IndexAny(language, "-_"); i >= 0 {
+		language = language[:i]
+	}
+	if IsSupportedErrorLanguage(language) {
+		return language
+	}
+	return ""
+}
+
+// ParseAcceptLanguage 按权重返回 Accept-Language 中第一个受支持的语言，没有时返回空字符串
+func ParseAcceptLanguage(header string) string {
+	type weightedLanguage struct {
+		language string
+		q        float64
+	}
+	var languages []weightedLanguage
+	for _, part := range strings.Split(header, ",") {
+		tag, params, _ := strings.Cut(strings.TrimSpace(part), ";")
+		q := 1.0
+		if value, ok := strings.CutPrefix(strings.TrimSpace(params), "q="); ok {
+			if parsed, err := strconv.ParseFloat(value, 64); err == nil {
+				q = parsed
+			}
+		}
+		language := NormalizeErrorLanguage(tag)
+		if language == "" || q <= 0 {
+			continue
+		}
+		languages = append(languages, weightedLanguage{language: language, q: q})
+	}
+	sort.SliceStable(languages, func(i, j int) bool {
+		return languages[i].q > languages[j].q
+	})
+	if len(languages) == 0 {
+		return ""
+	}
+	return languages[0].language
+}
+
+// LocalizeErrorMessage 按语言渲染错误码对应的信息，目录未收录该错误码时 ok 为 false
+func LocalizeErrorMessage(errorCode ErrorCode, language string, args ...any) (message string, ok bool) {
+	messages, ok := errorMessages[errorCode]
+	if !ok {
+		return "", false
+	}
+	format, ok := messages[language]
+	if !ok {
+		format = messages[DefaultErrorLanguage()]
+	}
+	return fmt.Sprintf(format, args...), true
+}
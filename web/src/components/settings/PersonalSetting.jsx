@@ -86,6 +86,7 @@ const PersonalSetting = () => {
     gotifyPriority: 5,
     acceptUnsetModelRatioModel: false,
     recordIpLog: false,
+    errorLanguage: '',
   });
 
   useEffect(() => {
@@ -159,6 +160,7 @@ const PersonalSetting = () => {
         acceptUnsetModelRatioModel:
           settings.accept_unset_model_ratio_model || false,
         recordIpLog: settings.record_ip_log || false,
+        errorLanguage: settings.error_language || '',
       });
     }
   }, [userState?.user?.setting]);
@@ -427,6 +429,7 @@ const PersonalSetting = () => {
         accept_unset_model_ratio_model:
           notificationSettings.acceptUnsetModelRatioModel,
         record_ip_log: notificationSettings.recordIpLog,
+        error_language: notificationSettings.errorLanguage,
       });
 
       if (res.data.success) {
@@ -748,6 +748,20 @@ const NotificationSettings = ({
                     '开启后，仅"消费"和"错误"日志将记录您的客户端IP地址',
                   )}
                 />
+                <Form.Select
+                  field='errorLanguage'
+                  label={t('接口错误信息语言')}
+                  style={{ width: '100%' }}
+                  optionList={[
+                    { value: '', label: t('跟随请求头 Accept-Language') },
+                    { value: 'en', label: 'English' },
+                    { value: 'zh', label: '中文' },
+                    { value: 'fr', label: 'Français' },
+                    { value: 'ja', label: '日本語' },
+                  ]}
+                  onChange={(value) => handleFormChange('errorLanguage', value)}
+                  extraText={t('调用 API 出错时返回的错误信息所使用的语言')}
+                />
               </div>
             </TabPane>
 
@@ -187,6 +187,85 @@ const renderResponseTime = (responseTime, t) => {
   }
 };
 
+// 与后端 remainingRatio 一致：已过重置时间或上游未提供的项视为充足
+const getRateLimitRatio = (budget, now) => {
+  let ratio = 1;
+  if (
+    budget.limit_requests > 0 &&
+    budget.remaining_requests >= 0 &&
+    budget.reset_requests > now
+  ) {
+    ratio = Math.min(ratio, budget.remaining_requests / budget.limit_requests);
+  }
+  if (
+    budget.limit_tokens > 0 &&
+    budget.remaining_tokens >= 0 &&
+    budget.reset_tokens > now
+  ) {
+    ratio = Math.min(ratio, budget.remaining_tokens / budget.limit_tokens);
+  }
+  return ratio;
+};
+
+const renderRateLimitBudgets = (budgets, t) => {
+  if (!budgets || budgets.length === 0) {
+    return (
+      <Tag color='grey' shape='circle'>
+        {t('未上报')}
+      </Tag>
+    );
+  }
+  const now = Date.now() / 1000;
+  const best = Math.max(...budgets.map((b) => getRateLimitRatio(b, now)));
+  let color = 'green';
+  if (best < 0.2) {
+    color = 'red';
+  } else if (best < 0.5) {
+    color = 'yellow';
+  }
+  const renderItem = (remaining, limit, reset) => {
+    if (limit <= 0 || remaining < 0) {
+      return '-';
+    }
+    if (reset <= now) {
+      return t('已重置');
+    }
+    return `${remaining} / ${limit}（${t('重置时间')} ${timestamp2string(
+      reset,
+    )}）`;
+  };
+  const content = (
+    <div>
+      {budgets.map((b) => (
+        <div key={b.key_index}>
+          {budgets.length > 1 && (
+            <div>{t('密钥') + ' #' + (b.key_index + 1)}</div>
+          )}
+          <div>
+            {t('请求剩余')}:{' '}
+            {renderItem(
+              b.remaining_requests,
+              b.limit_requests,
+              b.reset_requests,
+            )}
+          </div>
+          <div>
+            {t('Token 剩余')}:{' '}
+            {renderItem(b.remaining_tokens, b.limit_tokens, b.reset_tokens)}
+          </div>
+        </div>
+      ))}
+    </div>
+  );
+  return (
+    <Tooltip content={content}>
+      <Tag color={color} shape='circle'>
+        {(best * 100).toFixed(0)}%
+      </Tag>
+    </Tooltip>
+  );
+};
+
 export const getChannelsColumns = ({
   t,
   COLUMN_KEYS,
@@ -365,6 +444,17 @@ export const getChannelsColumns = ({
         }
       },
     },
+    {
+      key: COLUMN_KEYS.RATE_LIMIT,
+      title: t('上游限流'),
+      dataIndex: 'rate_limit_budgets',
+      render: (text, record, index) => {
+        if (record.children !== undefined) {
+          return null;
+        }
+        return <div>{renderRateLimitBudgets(text, t)}</div>;
+      },
+    },
     {
       key: COLUMN_KEYS.PRIORITY,
       title: t('优先级'),
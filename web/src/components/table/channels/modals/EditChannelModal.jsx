@@ -89,6 +89,36 @@ const REGION_EXAMPLE = {
   'claude-3-5-sonnet-20240620': 'europe-west1',
 };
 
+const CHANNEL_TEMPLATE_EXAMPLE = {
+  request_url: '{base_url}/v1/generate',
+  auth_header: 'X-API-Key',
+  auth_value: '{api_key}',
+  request_mapping: {
+    model: '{{model}}',
+    prompt: '{{$prompt}}',
+    max_new_tokens: '{{max_tokens}}',
+    temperature: '{{temperature}}',
+    stream: '{{stream}}',
+  },
+  content_path: 'output.text',
+  finish_reason_path: 'output.stop_reason',
+  prompt_tokens_path: 'usage.input_tokens',
+  completion_tokens_path: 'usage.output_tokens',
+  stream_content_path: 'delta.text',
+  done_sentinel: '[DONE]',
+};
+
+const CHANNEL_SIMULATOR_EXAMPLE = {
+  ttft_ms: 300,
+  tokens_per_second: 50,
+  output_tokens: 200,
+  rate_limit_rate: 0.01,
+  server_error_rate: 0.01,
+  timeout_rate: 0,
+  malformed_rate: 0,
+  disconnect_rate: 0,
+};
+
 // 支持并且已适配通过接口获取模型列表的渠道类型
 const MODEL_FETCHABLE_TYPES = new Set([
   1, 4, 14, 34, 17, 26, 27, 24, 47, 25, 20, 23, 31, 35, 40, 42, 48, 43,
@@ -161,6 +191,14 @@ const EditChannelModal = (props) => {
     is_enterprise_account: false,
     // 字段透传控制默认值
     allow_service_tier: false,
+    // 仅模板渠道: 模板配置（存入 settings.template）
+    channel_template: '',
+    // 仅模拟渠道: 模拟配置（存入 settings.simulator）
+    channel_simulator: '',
+    // 仅回放渠道: 录制时的渠道类型和是否忽略时间间隔（存入 settings.replay）
+    replay_channel_type: undefined,
+    replay_ignore_timing: false,
+    record_traffic: false,
     disable_store: false, // false = 允许透传（默认开启）
     allow_safety_identifier: false,
   };
@@ -529,6 +567,16 @@ const EditChannelModal = (props) => {
           data.disable_store = parsedSettings.disable_store || false;
           data.allow_safety_identifier =
             parsedSettings.allow_safety_identifier || false;
+          data.channel_template = parsedSettings.template
+            ? JSON.stringify(parsedSettings.template, null, 2)
+            : '';
+          data.channel_simulator = parsedSettings.simulator
+            ? JSON.stringify(parsedSettings.simulator, null, 2)
+            : '';
+          data.replay_channel_type = parsedSettings.replay?.channel_type;
+          data.replay_ignore_timing =
+            parsedSettings.replay?.ignore_timing || false;
+          data.record_traffic = parsedSettings.record_traffic || false;
         } catch (error) {
           console.error('解析其他设置失败:', error);
           data.azure_responses_version = '';
@@ -539,6 +587,11 @@ const EditChannelModal = (props) => {
           data.allow_service_tier = false;
           data.disable_store = false;
           data.allow_safety_identifier = false;
+          data.channel_template = '';
+          data.channel_simulator = '';
+          data.replay_channel_type = undefined;
+          data.replay_ignore_timing = false;
+          data.record_traffic = false;
         }
       } else {
         // 兼容历史数据：老渠道没有 settings 时，默认按 json 展示
@@ -548,6 +601,11 @@ const EditChannelModal = (props) => {
         data.allow_service_tier = false;
         data.disable_store = false;
         data.allow_safety_identifier = false;
+        data.channel_template = '';
+        data.channel_simulator = '';
+        data.replay_channel_type = undefined;
+        data.replay_ignore_timing = false;
+        data.record_traffic = false;
       }
 
       if (
@@ -968,6 +1026,26 @@ const EditChannelModal = (props) => {
       showInfo(t('模型映射必须是合法的 JSON 格式！'));
       return;
     }
+    if (
+      localInputs.type === 57 &&
+      (!localInputs.channel_template ||
+        !verifyJSON(localInputs.channel_template))
+    ) {
+      showInfo(t('模板配置必须是合法的 JSON 格式！'));
+      return;
+    }
+    if (
+      localInputs.type === 58 &&
+      localInputs.channel_simulator &&
+      !verifyJSON(localInputs.channel_simulator)
+    ) {
+      showInfo(t('模拟配置必须是合法的 JSON 格式！'));
+      return;
+    }
+    if (localInputs.type === 59 && !localInputs.replay_channel_type) {
+      showInfo(t('请选择录制时的渠道类型！'));
+      return;
+    }
     if (localInputs.base_url && localInputs.base_url.endsWith('/')) {
       localInputs.base_url = localInputs.base_url.slice(
         0,
@@ -1021,6 +1099,37 @@ const EditChannelModal = (props) => {
       }
     }
 
+    // type === 57 (模板渠道): 保存模板配置到 settings
+    if (localInputs.type === 57) {
+      settings.template = JSON.parse(localInputs.channel_template);
+    }
+
+    // type === 58 (模拟渠道): 保存模拟配置到 settings，为空时使用默认配置
+    if (localInputs.type === 58) {
+      if (localInputs.channel_simulator) {
+        settings.simulator = JSON.parse(localInputs.channel_simulator);
+      } else {
+        delete settings.simulator;
+      }
+    }
+
+    // type === 59 (回放渠道): 保存回放配置到 settings
+    if (localInputs.type === 59) {
+      settings.replay = {
+        channel_type: localInputs.replay_channel_type,
+        ignore_timing: localInputs.replay_ignore_timing === true,
+      };
+    } else {
+      delete settings.replay;
+    }
+
+    // 模拟渠道和回放渠道不请求上游，无需录制
+    if (localInputs.type !== 58 && localInputs.type !== 59) {
+      settings.record_traffic = localInputs.record_traffic === true;
+    } else {
+      delete settings.record_traffic;
+    }
+
     localInputs.settings = JSON.stringify(settings);
 
     // 清理不需要发送到后端的字段
@@ -1039,6 +1148,11 @@ const EditChannelModal = (props) => {
     delete localInputs.allow_service_tier;
     delete localInputs.disable_store;
     delete localInputs.allow_safety_identifier;
+    delete localInputs.channel_template;
+    delete localInputs.channel_simulator;
+    delete localInputs.replay_channel_type;
+    delete localInputs.replay_ignore_timing;
+    delete localInputs.record_traffic;
 
     let res;
     localInputs.auto_ban = localInputs.auto_ban ? 1 : 0;
@@ -2080,6 +2194,139 @@ const EditChannelModal = (props) => {
                         </>
                       )}
 
+                      {inputs.type === 57 && (
+                        <>
+                          <Banner
+                            type='info'
+                            description={t(
+                              '模板渠道通过声明式配置接入 OpenAI 类上游：请求地址支持 {base_url} 和 {model}，请求体模板中的占位符从 OpenAI 请求取值，响应路径为空时按 OpenAI 格式处理。',
+                            )}
+                            className='!rounded-lg'
+                          />
+                          <div>
+                            <Form.TextArea
+                              field='channel_template'
+                              label={t('模板配置')}
+                              placeholder={JSON.stringify(
+                                CHANNEL_TEMPLATE_EXAMPLE,
+                                null,
+                                2,
+                              )}
+                              autosize={{ minRows: 6, maxRows: 20 }}
+                              onChange={(value) =>
+                                handleInputChange('channel_template', value)
+                              }
+                              rules={[
+                                {
+                                  required: true,
+                                  message: t('请输入模板配置'),
+                                },
+                              ]}
+                              extraText={
+                                <Text
+                                  className='!text-semi-color-primary cursor-pointer'
+                                  onClick={() =>
+                                    handleInputChange(
+                                      'channel_template',
+                                      JSON.stringify(
+                                        CHANNEL_TEMPLATE_EXAMPLE,
+                                        null,
+                                        2,
+                                      ),
+                                    )
+                                  }
+                                >
+                                  {t('填入模板')}
+                                </Text>
+                              }
+                              showClear
+                            />
+                          </div>
+                        </>
+                      )}
+
+                      {inputs.type === 58 && (
+                        <>
+                          <Banner
+                            type='info'
+                            description={t(
+                              '模拟渠道在本地生成响应，不会请求任何上游，可用于压测和故障演练，请求仍会正常计费和记录日志。密钥可任意填写。',
+                            )}
+                            className='!rounded-lg'
+                          />
+                          <div>
+                            <Form.TextArea
+                              field='channel_simulator'
+                              label={t('模拟配置')}
+                              placeholder={JSON.stringify(
+                                CHANNEL_SIMULATOR_EXAMPLE,
+                                null,
+                                2,
+                              )}
+                              autosize={{ minRows: 6, maxRows: 20 }}
+                              onChange={(value) =>
+                                handleInputChange('channel_simulator', value)
+                              }
+                              extraText={
+                                <Text
+                                  className='!text-semi-color-primary cursor-pointer'
+                                  onClick={() =>
+                                    handleInputChange(
+                                      'channel_simulator',
+                                      JSON.stringify(
+                                        CHANNEL_SIMULATOR_EXAMPLE,
+                                        null,
+                                        2,
+                                      ),
+                                    )
+                                  }
+                                >
+                                  {t('填入模板')}
+                                </Text>
+                              }
+                              showClear
+                            />
+                          </div>
+                        </>
+                      )}
+
+                      {inputs.type === 59 && (
+                        <>
+                          <Banner
+                            type='info'
+                            description={t(
+                              '回放渠道按请求指纹读取录制文件代替上游响应，并使用录制时渠道类型的适配器转换请求和响应，可用于离线复现问题和回归测试。录制文件需放在网关的录制目录下。密钥可任意填写。',
+                            )}
+                            className='!rounded-lg'
+                          />
+                          <Form.Select
+                            field='replay_channel_type'
+                            label={t('录制时的渠道类型')}
+                            placeholder={t('请选择录制时的渠道类型')}
+                            optionList={channelOptionList.filter(
+                              (opt) => opt.value !== 58 && opt.value !== 59,
+                            )}
+                            filter={selectFilter}
+                            style={{ width: '100%' }}
+                            onChange={(value) =>
+                              handleInputChange('replay_channel_type', value)
+                            }
+                          />
+                          <Form.Switch
+                            field='replay_ignore_timing'
+                            label={t('忽略录制的时间间隔')}
+                            checkedText={t('开')}
+                            uncheckedText={t('关')}
+                            onChange={(value) =>
+                              handleInputChange('replay_ignore_timing', value)
+                            }
+                            extraText={t(
+                              '开启后立即返回全部录制数据，关闭时按录制时的首字延迟和数据块间隔回放',
+                            )}
+                          />
+                        </>
+                      )}
+
                       {inputs.type === 37 && (
                         <Banner
                           type='warning'
@@ -2094,7 +2341,9 @@ const EditChannelModal = (props) => {
                         inputs.type !== 8 &&
                         inputs.type !== 22 &&
                         inputs.type !== 36 &&
-                        inputs.type !== 45 && (
+                        inputs.type !== 45 &&
+                        inputs.type !== 58 &&
+                        inputs.type !== 59 && (
                           <div>
                             <Form.Input
                               field='base_url'
@@ -2596,6 +2845,68 @@ const EditChannelModal = (props) => {
                       showClear
                     />
 
+                    <Form.TextArea
+                      field='response_override'
+                      label={t('响应覆盖')}
+                      placeholder={
+                        t(
+                          '此项可选，用于改写返回给客户端的响应体，流式请求会改写每个数据块，格式与参数覆盖相同',
+                        ) +
+                        '\n' +
+                        t('格式示例：') +
+                        '\n{\n  "operations": [\n    {\n      "path": "model",\n      "mode": "set",\n      "value": "{{original_model}}"\n    }\n  ]\n}'
+                      }
+                      autosize
+                      onChange={(value) =>
+                        handleInputChange('response_override', value)
+                      }
+                      extraText={
+                        <div className='flex flex-col gap-1'>
+                          <div className='flex gap-2 flex-wrap items-center'>
+                            <Text
+                              className='!text-semi-color-primary cursor-pointer'
+                              onClick={() =>
+                                handleInputChange(
+                                  'response_override',
+                                  JSON.stringify(
+                                    {
+                                      operations: [
+                                        {
+                                          path: 'model',
+                                          mode: 'set',
+                                          value: '{{original_model}}',
+                                        },
+                                        {
+                                          mode: 'move',
+                                          from: 'choices.0.delta.reasoning',
+                                          to: 'choices.0.delta.reasoning_content',
+                                        },
+                                      ],
+                                    },
+                                    null,
+                                    2,
+                                  ),
+                                )
+                              }
+                            >
+                              {t('填入模板')}
+                            </Text>
+                          </div>
+                          <div>
+                            <Text type='tertiary' size='small'>
+                              {t('支持变量：')}
+                            </Text>
+                            <div className='text-xs text-tertiary ml-2'>
+                              <div>
+                                {t('请求模型')}: {'{{original_model}}'}
+                              </div>
+                            </div>
+                          </div>
+                        </div>
+                      }
+                      showClear
+                    />
+
                     <JSONEditor
                       key={`status_code_mapping-${isEdit ? channelId : 'new'}`}
                       field='status_code_mapping'
@@ -2772,6 +3083,21 @@ const EditChannelModal = (props) => {
                       extraText={t('启用请求体透传功能')}
                     />
 
+                    {inputs.type !== 58 && inputs.type !== 59 && (
+                      <Form.Switch
+                        field='record_traffic'
+                        label={t('录制上游流量')}
+                        checkedText={t('开')}
+                        uncheckedText={t('关')}
+                        onChange={(value) =>
+                          handleInputChange('record_traffic', value)
+                        }
+                        extraText={t(
+                          '将脱敏后的上游请求和响应（含流式数据的时间间隔）写入录制目录，供回放渠道复现，仅建议排查问题时临时开启',
+                        )}
+                      />
+                    )}
+
                     <Form.Input
                       field='proxy'
                       label={t('代理地址')}
@@ -72,6 +72,7 @@ const EditTagModal = (props) => {
     models: [],
     param_override: null,
     header_override: null,
+    response_override: null,
   };
   const [inputs, setInputs] = useState(originInputs);
   const formApiRef = useRef(null);
@@ -227,6 +228,26 @@ const EditTagModal = (props) => {
       }
       data.header_override = trimmedHeaderOverride;
     }
+    if (
+      formVals.response_override !== undefined &&
+      formVals.response_override !== null
+    ) {
+      if (typeof formVals.response_override !== 'string') {
+        showInfo('响应覆盖必须是合法的 JSON 格式！');
+        setLoading(false);
+        return;
+      }
+      const trimmedResponseOverride = formVals.response_override.trim();
+      if (
+        trimmedResponseOverride !== '' &&
+        !verifyJSON(trimmedResponseOverride)
+      ) {
+        showInfo('响应覆盖必须是合法的 JSON 格式！');
+        setLoading(false);
+        return;
+      }
+      data.response_override = trimmedResponseOverride;
+    }
     data.new_tag = formVals.new_tag;
     if (
       data.model_mapping === undefined &&
@@ -234,7 +255,8 @@ const EditTagModal = (props) => {
       data.models === undefined &&
       data.new_tag === undefined &&
       data.param_override === undefined &&
-      data.header_override === undefined
+      data.header_override === undefined &&
+      data.response_override === undefined
     ) {
       showWarning('没有任何修改！');
       setLoading(false);
@@ -678,6 +700,71 @@ const EditTagModal = (props) => {
                       </div>
                     }
                   />
+
+                  <Form.TextArea
+                    field='response_override'
+                    label={t('响应覆盖')}
+                    placeholder={
+                      t(
+                        '此项可选，用于改写返回给客户端的响应体，流式请求会改写每个数据块，格式与参数覆盖相同',
+                      ) +
+                      '\n' +
+                      t('格式示例：') +
+                      '\n{\n  "operations": [\n    {\n      "path": "model",\n      "mode": "set",\n      "value": "{{original_model}}"\n    }\n  ]\n}'
+                    }
+                    autosize
+                    showClear
+                    onChange={(value) =>
+                      handleInputChange('response_override', value)
+                    }
+                    extraText={
+                      <div className='flex flex-col gap-1'>
+                        <div className='flex gap-2 flex-wrap items-center'>
+                          <Text
+                            className='!text-semi-color-primary cursor-pointer'
+                            onClick={() =>
+                              handleInputChange(
+                                'response_override',
+                                JSON.stringify(
+                                  {
+                                    operations: [
+                                      {
+                                        path: 'model',
+                                        mode: 'set',
+                                        value: '{{original_model}}',
+                                      },
+                                    ],
+                                  },
+                                  null,
+                                  2,
+                                ),
+                              )
+                            }
+                          >
+                            {t('填入模板')}
+                          </Text>
+                          <Text
+                            className='!text-semi-color-primary cursor-pointer'
+                            onClick={() =>
+                              handleInputChange('response_override', null)
+                            }
+                          >
+                            {t('不更改')}
+                          </Text>
+                        </div>
+                        <div>
+                          <Text type='tertiary' size='small'>
+                            {t('支持变量：')}
+                          </Text>
+                          <div className='text-xs text-tertiary ml-2'>
+                            <div>
+                              {t('请求模型')}: {'{{original_model}}'}
+                            </div>
+                          </div>
+                        </div>
+                      </div>
+                    }
+                  />
                 </div>
               </Card>
 
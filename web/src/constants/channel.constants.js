@@ -119,6 +119,9 @@ export const CHANNEL_OPTIONS = [
   { value: 40, color: 'purple', label: 'SiliconCloud' },
   { value: 42, color: 'blue', label: 'Mistral AI' },
   { value: 8, color: 'pink', label: '自定义渠道' },
+  { value: 57, color: 'pink', label: '模板渠道' },
+  { value: 58, color: 'grey', label: '模拟渠道' },
+  { value: 59, color: 'grey', label: '回放渠道' },
   {
     value: 22,
     color: 'blue',
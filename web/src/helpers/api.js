@@ -231,15 +231,35 @@ export async function getOAuthState() {
   }
 }
 
+async function getOIDCAuthState() {
+  let path = '/api/oauth/oidc/state';
+  let affCode = localStorage.getItem('aff');
+  if (affCode && affCode.length > 0) {
+    path += `?aff=${affCode}`;
+  }
+  const res = await API.get(path);
+  const { success, message, data } = res.data;
+  if (success) {
+    return data;
+  } else {
+    showError(message);
+    return null;
+  }
+}
+
 export async function onOIDCClicked(auth_url, client_id, openInNewTab = false) {
-  const state = await getOAuthState();
-  if (!state) return;
+  const authState = await getOIDCAuthState();
+  if (!authState) return;
   const url = new URL(auth_url);
   url.searchParams.set('client_id', client_id);
   url.searchParams.set('redirect_uri', `${window.location.origin}/oauth/oidc`);
   url.searchParams.set('response_type', 'code');
-  url.searchParams.set('scope', 'openid profile email');
-  url.searchParams.set('state', state);
+  url.searchParams.set('scope', authState.scope || 'openid profile email');
+  url.searchParams.set('state', authState.state);
+  if (authState.code_challenge) {
+    url.searchParams.set('code_challenge', authState.code_challenge);
+    url.searchParams.set('code_challenge_method', authState.code_challenge_method);
+  }
   if (openInNewTab) {
     window.open(url.toString(), '_blank');
   } else {